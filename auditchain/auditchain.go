@@ -0,0 +1,151 @@
+// Package auditchain calcula o encadeamento do audit_log e assina os checkpoints exportados para fora do
+// banco. Cada linha tem hash = SHA-256(hash da anterior || conteúdo canônico da linha) e um HMAC desse
+// hash com AUDIT_HMAC_KEY: quem só tem acesso ao banco não consegue alterar, inserir ou apagar uma linha
+// no meio sem quebrar a cadeia, nem recalculá-la sem a chave. Os checkpoints, assinados com Ed25519,
+// fixam a posição e o hash da cabeça da cadeia em um armazenamento à parte, o que também denuncia linhas
+// removidas do fim.
+package auditchain
+
+import (
+	"bytes"
+	"challenge-v3/models"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Genesis é o prev_hash da primeira linha da cadeia.
+var Genesis = make([]byte, sha256.Size)
+
+// CanonicalDetails normaliza o JSON de details para o hash. O Postgres guarda jsonb sem a formatação e a
+// ordem das chaves originais; decodificar e codificar de novo dá o mesmo resultado dos dois lados.
+func CanonicalDetails(raw []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return []byte("null"), nil
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("details inválido: %w", err)
+	}
+	return json.Marshal(value)
+}
+
+// Hash calcula o hash da linha a partir do hash da anterior. O instante entra em UTC com precisão de
+// microssegundos, a do Postgres.
+func Hash(prev []byte, entry models.AuditEntry) ([]byte, error) {
+	details, err := CanonicalDetails(entry.Details)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal([]any{"audit", entry.Seq, entry.Timestamp.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		entry.Actor, entry.Action, json.RawMessage(details)})
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(content)
+	return h.Sum(nil), nil
+}
+
+// MAC é o HMAC-SHA-256 do hash da linha; nil sem chave.
+func MAC(key, hash []byte) []byte {
+	if key == nil {
+		return nil
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(hash)
+	return mac.Sum(nil)
+}
+
+// HMACKeyFromEnv lê AUDIT_HMAC_KEY ou o arquivo de AUDIT_HMAC_KEY_FILE. Retorna nil quando nenhum dos
+// dois está definido, o que só o comando audit aceita sem mais: quem grava usa WriterHMACKeyFromEnv.
+func HMACKeyFromEnv() ([]byte, error) {
+	key, err := secretFromEnv("AUDIT_HMAC_KEY")
+	if key == nil || err != nil {
+		return nil, err
+	}
+	if len(key) < 32 {
+		return nil, fmt.Errorf("AUDIT_HMAC_KEY deve ter pelo menos 32 bytes, tem %d", len(key))
+	}
+	return key, nil
+}
+
+// ErrHMACKeyRequired indica que API ou worker iam gravar a cadeia sem HMAC.
+var ErrHMACKeyRequired = errors.New("AUDIT_HMAC_KEY não configurada: as linhas do audit_log seriam gravadas sem HMAC")
+
+// WriterHMACKeyFromEnv é o HMACKeyFromEnv de quem grava no audit_log. O modo estrito (AUDIT_HMAC_STRICT)
+// vem ligado: sem chave o processo não sobe. Com AUDIT_HMAC_STRICT=false, só em desenvolvimento, a cadeia
+// é gravada sem HMAC e a coluna hmac dessas linhas fica nula.
+func WriterHMACKeyFromEnv() ([]byte, error) {
+	strict := true
+	if raw := os.Getenv("AUDIT_HMAC_STRICT"); raw != "" {
+		var err error
+		if strict, err = strconv.ParseBool(raw); err != nil {
+			return nil, fmt.Errorf("AUDIT_HMAC_STRICT inválido: %w", err)
+		}
+	}
+	key, err := HMACKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil && strict {
+		return nil, fmt.Errorf("%w; configure AUDIT_HMAC_KEY ou AUDIT_HMAC_KEY_FILE, ou defina AUDIT_HMAC_STRICT=false", ErrHMACKeyRequired)
+	}
+	return key, nil
+}
+
+// SigningKeyFromEnv lê a semente Ed25519 (32 bytes em base64) de AUDIT_SIGNING_KEY ou do arquivo de
+// AUDIT_SIGNING_KEY_FILE. Retorna nil quando nenhum dos dois está definido.
+func SigningKeyFromEnv() (ed25519.PrivateKey, error) {
+	raw, err := secretFromEnv("AUDIT_SIGNING_KEY")
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(string(raw))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("AUDIT_SIGNING_KEY deve ser uma semente Ed25519 de 32 bytes em base64")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// VerifyKeyFromEnv lê a chave pública de AUDIT_VERIFY_KEY (base64) ou, na falta dela, deriva a de
+// AUDIT_SIGNING_KEY. Retorna nil quando nenhuma está definida.
+func VerifyKeyFromEnv() (ed25519.PublicKey, error) {
+	if raw := strings.TrimSpace(os.Getenv("AUDIT_VERIFY_KEY")); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("AUDIT_VERIFY_KEY deve ser uma chave pública Ed25519 em base64")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+	signer, err := SigningKeyFromEnv()
+	if signer == nil || err != nil {
+		return nil, err
+	}
+	return signer.Public().(ed25519.PublicKey), nil
+}
+
+// secretFromEnv lê a variável name ou o arquivo de name_FILE, sem espaços nas pontas.
+func secretFromEnv(name string) ([]byte, error) {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		return []byte(raw), nil
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler %s_FILE: %w", name, err)
+	}
+	return bytes.TrimSpace(raw), nil
+}
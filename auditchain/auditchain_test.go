@@ -0,0 +1,92 @@
+package auditchain
+
+import (
+	"challenge-v3/models"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash_IgnoresJSONBNormalization(t *testing.T) {
+	ts := time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.FixedZone("BRT", -3*3600))
+	written := models.AuditEntry{Seq: 7, Timestamp: ts, Actor: "dev-1", Action: "PHOTO_PROCESSED",
+		Details: json.RawMessage(`{"photo_id": 1, "match": true}`)}
+	// Como a linha volta do Postgres: jsonb com outra formatação e ordem, instante em UTC com microssegundos.
+	read := written
+	read.Timestamp = ts.UTC().Truncate(time.Microsecond)
+	read.Details = json.RawMessage(`{"match":true,"photo_id":1}`)
+
+	first, err := Hash(Genesis, written)
+	require.NoError(t, err)
+	second, err := Hash(Genesis, read)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	read.Actor = "dev-2"
+	changed, err := Hash(Genesis, read)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+
+	other, err := Hash(first, written)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other, "o hash depende da linha anterior")
+}
+
+func TestCheckpoint_SignAndVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	checkpoint := NewCheckpoint(42, []byte{1, 2, 3}, time.Now(), CheckpointKey(40))
+	checkpoint.Sign(private)
+	require.NoError(t, checkpoint.Verify(public))
+
+	checkpoint.Seq = 41
+	assert.ErrorIs(t, checkpoint.Verify(public), ErrInvalidSignature)
+}
+
+func TestCompletionRecord_VerifiesAfterJSONRoundTrip(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	record := &CompletionRecord{
+		RequestID: 7, SubjectType: "device", SubjectID: "dev-1", Action: "erase", Reason: "protocolo 123",
+		RequestedBy: "bia", Rows: map[string]int64{"gps": 10, "photo": 2}, FacesDeleted: 1,
+		CompletedAt: time.Date(2025, 3, 1, 9, 0, 0, 123456789, time.FixedZone("BRT", -3*3600)),
+	}
+	record.Sign(private)
+
+	raw, err := json.Marshal(record)
+	require.NoError(t, err)
+	var decoded CompletionRecord
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	require.NoError(t, decoded.Verify(public))
+	assert.Equal(t, record.Digest(), decoded.Digest())
+
+	decoded.Rows["gps"] = 9
+	assert.ErrorIs(t, decoded.Verify(public), ErrInvalidRecordSignature)
+}
+
+func TestWriterHMACKeyFromEnv_StrictByDefault(t *testing.T) {
+	t.Setenv("AUDIT_HMAC_KEY", "")
+	t.Setenv("AUDIT_HMAC_KEY_FILE", "")
+	t.Setenv("AUDIT_HMAC_STRICT", "")
+	_, err := WriterHMACKeyFromEnv()
+	assert.ErrorIs(t, err, ErrHMACKeyRequired, "sem chave API e worker não sobem")
+
+	t.Setenv("AUDIT_HMAC_KEY", "curta-demais")
+	_, err = WriterHMACKeyFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("AUDIT_HMAC_KEY", "uma-chave-de-auditoria-com-32-bytes!")
+	key, err := WriterHMACKeyFromEnv()
+	require.NoError(t, err)
+	assert.NotNil(t, key)
+
+	t.Setenv("AUDIT_HMAC_KEY", "")
+	t.Setenv("AUDIT_HMAC_STRICT", "false")
+	key, err = WriterHMACKeyFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, key, "só em desenvolvimento a cadeia vai sem HMAC")
+}
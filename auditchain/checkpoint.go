@@ -0,0 +1,124 @@
+package auditchain
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// LatestCheckpointKey aponta sempre para o checkpoint mais recente; cada checkpoint também fica na sua
+// própria chave e referencia o anterior, então os checkpoints formam uma lista que a verificação percorre
+// a partir do mais recente.
+const LatestCheckpointKey = "latest.json"
+
+var ErrInvalidSignature = errors.New("assinatura do checkpoint inválida")
+
+// Checkpoint fixa a cabeça da cadeia: a linha Seq tinha o hash Hash em CreatedAt.
+type Checkpoint struct {
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	// Previous é a chave do checkpoint anterior no armazenamento; vazio no primeiro.
+	Previous  string `json:"previous,omitempty"`
+	Signature string `json:"signature"`
+}
+
+func NewCheckpoint(seq int64, hash []byte, createdAt time.Time, previous string) *Checkpoint {
+	return &Checkpoint{Seq: seq, Hash: hex.EncodeToString(hash), CreatedAt: createdAt.UTC(), Previous: previous}
+}
+
+// CheckpointKey é a chave do checkpoint da posição seq.
+func CheckpointKey(seq int64) string {
+	return fmt.Sprintf("%020d.json", seq)
+}
+
+func (c *Checkpoint) signedContent() []byte {
+	content, _ := json.Marshal([]any{"audit-checkpoint", c.Seq, c.Hash, c.CreatedAt.UTC().Format(time.RFC3339Nano), c.Previous})
+	return content
+}
+
+func (c *Checkpoint) Sign(key ed25519.PrivateKey) {
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, c.signedContent()))
+}
+
+func (c *Checkpoint) Verify(key ed25519.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil || !ed25519.Verify(key, c.signedContent(), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HashBytes decodifica Hash.
+func (c *Checkpoint) HashBytes() ([]byte, error) {
+	return hex.DecodeString(c.Hash)
+}
+
+// SaveCheckpoint grava o checkpoint na sua chave e depois em LatestCheckpointKey.
+func SaveCheckpoint(ctx context.Context, store blob.Store, checkpoint *Checkpoint) error {
+	content, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{CheckpointKey(checkpoint.Seq), LatestCheckpointKey} {
+		if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content))); err != nil {
+			return fmt.Errorf("falha ao gravar o checkpoint %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// LoadCheckpoint lê o checkpoint de key; retorna blob.ErrNotFound quando ele não existe.
+func LoadCheckpoint(ctx context.Context, store blob.Store, key string) (*Checkpoint, error) {
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s inválido: %w", key, err)
+	}
+	return &checkpoint, nil
+}
+
+// OpenCheckpointStoreFromEnv abre o destino dos checkpoints: AUDIT_CHECKPOINT_STORAGE=local (padrão, em
+// AUDIT_CHECKPOINT_DIR) ou s3 (AUDIT_CHECKPOINT_S3_BUCKET e AUDIT_CHECKPOINT_S3_PREFIX). O destino deve
+// ficar fora do alcance de quem administra o banco.
+func OpenCheckpointStoreFromEnv(cfg aws.Config) (blob.Store, error) {
+	switch os.Getenv("AUDIT_CHECKPOINT_STORAGE") {
+	case "", "local":
+		dir := os.Getenv("AUDIT_CHECKPOINT_DIR")
+		if dir == "" {
+			dir = "audit-checkpoints"
+		}
+		return blob.NewLocalStore(dir)
+	case "s3":
+		bucket := os.Getenv("AUDIT_CHECKPOINT_S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("AUDIT_CHECKPOINT_S3_BUCKET é obrigatório quando AUDIT_CHECKPOINT_STORAGE=s3")
+		}
+		prefix := os.Getenv("AUDIT_CHECKPOINT_S3_PREFIX")
+		if prefix == "" {
+			prefix = "audit-checkpoints"
+		}
+		return blob.NewS3Store(blob.NewS3Client(cfg), bucket, prefix), nil
+	default:
+		return nil, fmt.Errorf("AUDIT_CHECKPOINT_STORAGE inválido: %s", os.Getenv("AUDIT_CHECKPOINT_STORAGE"))
+	}
+}
@@ -0,0 +1,62 @@
+package auditchain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrInvalidRecordSignature = errors.New("assinatura do registro de conclusão inválida")
+
+// CompletionRecord comprova a execução de um pedido de titular (LGPD). É assinado com a mesma chave dos
+// checkpoints (AUDIT_SIGNING_KEY) e conferido com AUDIT_VERIFY_KEY, sem acesso ao banco.
+type CompletionRecord struct {
+	RequestID   int64  `json:"request_id"`
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Action      string `json:"action"`
+	Reason      string `json:"reason"`
+	RequestedBy string `json:"requested_by"`
+	// Devices são os dispositivos cujos dados foram tratados num pedido por motorista.
+	Devices []string `json:"devices,omitempty"`
+	// Rows são as linhas exportadas, apagadas ou anonimizadas por tabela.
+	Rows         map[string]int64 `json:"rows"`
+	BlobsDeleted int64            `json:"blobs_deleted"`
+	FacesDeleted int64            `json:"faces_deleted"`
+	// ArchiveLocation e ArchiveSHA256 identificam o arquivo entregue ao titular numa exportação.
+	ArchiveLocation string    `json:"archive_location,omitempty"`
+	ArchiveSHA256   string    `json:"archive_sha256,omitempty"`
+	CompletedAt     time.Time `json:"completed_at"`
+	Signature       string    `json:"signature"`
+}
+
+func (r *CompletionRecord) signedContent() []byte {
+	unsigned := *r
+	unsigned.Signature = ""
+	unsigned.CompletedAt = r.CompletedAt.UTC()
+	content, _ := json.Marshal([]any{"data-subject-record", unsigned})
+	return content
+}
+
+func (r *CompletionRecord) Sign(key ed25519.PrivateKey) {
+	r.CompletedAt = r.CompletedAt.UTC()
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, r.signedContent()))
+}
+
+func (r *CompletionRecord) Verify(key ed25519.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(key, r.signedContent(), signature) {
+		return ErrInvalidRecordSignature
+	}
+	return nil
+}
+
+// Digest é o SHA-256 (hex) do conteúdo assinado; é o valor registrado no audit_log.
+func (r *CompletionRecord) Digest() string {
+	sum := sha256.Sum256(r.signedContent())
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,20 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("objeto não encontrado")
+
+// Store guarda objetos binários endereçados por chave (ex.: "photos/dev-1/2025/01/02/<id>").
+// As chaves usam "/" como separador em todos os backends.
+type Store interface {
+	// Put grava o objeto inteiro; size é o tamanho de r em bytes.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get retorna ErrNotFound quando a chave não existe.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete não falha quando a chave não existe.
+	Delete(ctx context.Context, key string) error
+}
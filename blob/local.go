@@ -0,0 +1,79 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore grava cada objeto como um arquivo abaixo de Dir.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("não foi possível criar o diretório de blobs: %w", err)
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+// path recusa chaves absolutas ou com "..", que escapariam de Dir.
+func (s *LocalStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("chave de blob inválida: %q", key)
+	}
+	return filepath.Join(s.Dir, name), nil
+}
+
+// Put grava num arquivo temporário e renomeia no final, para que um Get nunca veja o objeto pela metade.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	finalPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0o750); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(finalPath), filepath.Base(finalPath)+".*.partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), finalPath)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore_PutGetDelete(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	content := []byte("conteúdo da foto")
+	require.NoError(t, store.Put(ctx, "photos/dev-1/2025/01/02/abc", bytes.NewReader(content), int64(len(content))))
+
+	r, err := store.Get(ctx, "photos/dev-1/2025/01/02/abc")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	r.Close()
+	assert.Equal(t, content, got)
+
+	entries, err := os.ReadDir(filepath.Join(store.Dir, "photos", "dev-1", "2025", "01", "02"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "o arquivo temporário não pode sobrar")
+
+	require.NoError(t, store.Delete(ctx, "photos/dev-1/2025/01/02/abc"))
+	_, err = store.Get(ctx, "photos/dev-1/2025/01/02/abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, "photos/dev-1/2025/01/02/abc"), "apagar de novo não é erro")
+}
+
+func TestLocalStore_RejectsKeysOutsideDir(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"../fora", "/etc/passwd", "photos/../../fora", ""} {
+		err := store.Put(context.Background(), key, bytes.NewReader(nil), 0)
+		assert.Error(t, err, key)
+		_, err = store.Get(context.Background(), key)
+		assert.Error(t, err, key)
+	}
+}
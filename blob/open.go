@@ -0,0 +1,40 @@
+package blob
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// OpenFromEnv escolhe onde ficam as imagens das fotos: diretório local (padrão) ou bucket S3/MinIO via
+// PHOTO_STORAGE. API e worker precisam apontar para o mesmo lugar.
+func OpenFromEnv(cfg aws.Config) (Store, error) {
+	switch os.Getenv("PHOTO_STORAGE") {
+	case "", "local":
+		dir := os.Getenv("PHOTO_DIR")
+		if dir == "" {
+			dir = "photos"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		bucket := os.Getenv("PHOTO_S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("PHOTO_S3_BUCKET é obrigatório quando PHOTO_STORAGE=s3")
+		}
+		return NewS3Store(NewS3Client(cfg), bucket, os.Getenv("PHOTO_S3_PREFIX")), nil
+	default:
+		return nil, fmt.Errorf("PHOTO_STORAGE inválido: %s", os.Getenv("PHOTO_STORAGE"))
+	}
+}
+
+// NewS3Client usa S3_ENDPOINT, quando definido, para falar com um MinIO em vez da AWS.
+func NewS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"challenge-v3/auditchain"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
 	_ "challenge-v3/docs" // Import para o Swagger
 	"challenge-v3/handlers"
 	"challenge-v3/messaging"
 	"challenge-v3/metrics"
+	"challenge-v3/services"
+	"challenge-v3/storage"
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/joho/godotenv"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -38,9 +48,48 @@ func main() {
 		os.Exit(1)
 	}
 
-	// A API só precisa da dependência do NATS para publicar mensagens.
-	// As outras dependências (DB, Rekognition) são usadas apenas pelo Worker.
-	api := handlers.NewAPI(nil, nil, js)
+	// Requisições recusadas (autenticação, papel, rate limit e validação) viram eventos de segurança,
+	// publicados em segundo plano e gravados pelo worker no audit_log.
+	securityEventsRate := 50.0
+	if raw := os.Getenv("SECURITY_EVENTS_PER_SECOND"); raw != "" {
+		securityEventsRate, err = strconv.ParseFloat(raw, 64)
+		if err != nil || securityEventsRate <= 0 {
+			slog.Error("SECURITY_EVENTS_PER_SECOND inválido", "value", raw)
+			os.Exit(1)
+		}
+	}
+	securityEvents := handlers.NewSecurityEvents(js, 1024, securityEventsRate)
+	go securityEvents.Run(context.Background())
+	handlers.SetSecurityEvents(securityEvents)
+
+	// A API publica a telemetria no NATS e usa o banco apenas para consultas.
+	// O Rekognition é usado aqui só no cadastro dos rostos de referência dos motoristas.
+	db, err := storage.OpenFromEnv()
+	if err != nil {
+		slog.Error("falha ao conectar ao banco de dados", "error", err)
+		os.Exit(1)
+	}
+
+	locations, err := crypto.LocationCipherFromEnv()
+	if err != nil {
+		slog.Error("configuração da cifragem de posições inválida", "error", err)
+		os.Exit(1)
+	}
+	if locations != nil {
+		db.SetLocationCipher(locations)
+	}
+
+	auditKey, err := auditchain.WriterHMACKeyFromEnv()
+	if err != nil {
+		slog.Error("configuração da chave da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+	if auditKey == nil {
+		slog.Warn("AUDIT_HMAC_STRICT=false e AUDIT_HMAC_KEY não configurada: o audit_log será gravado SEM HMAC; não use em produção")
+	}
+	db.SetAuditKey(auditKey)
+
+	api := handlers.NewAPI(db, nil, js)
 
 	router := http.NewServeMux()
 
@@ -53,6 +102,98 @@ func main() {
 	router.Handle("/telemetry/photo",
 		handlers.RateLimiterMiddleware(handlers.AuthenticationMiddleware(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandlePhoto)))))
 
+	fleets, err := handlers.ParseFleets(os.Getenv("FLEET_DEVICES"))
+	if err != nil {
+		slog.Error("configuração de frotas inválida", "error", err)
+		os.Exit(1)
+	}
+	liveInterval := time.Second
+	if raw := os.Getenv("LIVE_MIN_INTERVAL_MS"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil {
+			slog.Error("LIVE_MIN_INTERVAL_MS inválido", "error", err)
+			os.Exit(1)
+		}
+		liveInterval = time.Duration(ms) * time.Millisecond
+	}
+	liveHub := handlers.NewLiveHub(fleets, liveInterval)
+	if _, err := nc.Subscribe("telemetry.gps", liveHub.HandleMsg); err != nil {
+		slog.Error("Falha ao assinar o tópico de gps para o feed ao vivo", "error", err)
+		os.Exit(1)
+	}
+
+	privilegedKeys, err := handlers.ParsePrivilegedKeys(os.Getenv("PRIVILEGED_API_KEYS"))
+	if err != nil {
+		slog.Error("configuração de chaves privilegiadas inválida", "error", err)
+		os.Exit(1)
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(os.Getenv("AWS_REGION")))
+	if err != nil {
+		slog.Error("Falha ao carregar config da AWS", "error", err)
+		os.Exit(1)
+	}
+	photoStore, err := blob.OpenFromEnv(awsCfg)
+	if err != nil {
+		slog.Error("configuração do armazenamento de fotos inválida", "error", err)
+		os.Exit(1)
+	}
+	photoKeys, err := services.PhotoKeysFromEnv()
+	if err != nil {
+		slog.Error("configuração das chaves de criptografia inválida", "error", err)
+		os.Exit(1)
+	}
+	photoHandler := handlers.NewPhotoHandler(db, services.NewPhotoViewer(db, photoStore, photoKeys))
+	driverFaceHandler := handlers.NewDriverFaceHandler(db,
+		services.NewDriverFaceService(rekognition.NewFromConfig(awsCfg), os.Getenv("REKOGNITION_COLLECTION_ID")))
+
+	router.Handle("/live/positions",
+		handlers.RateLimiterMiddleware(handlers.EventSourceKey(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(liveHub.HandleLivePositions))))))
+
+	router.Handle("GET /devices/{id}/track",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleDeviceTrack)))))
+
+	router.Handle("GET /devices/{id}/stats",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleDeviceStats)))))
+
+	router.Handle("GET /devices/{id}/photos",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleDevicePhotos)))))
+
+	router.Handle("GET /telemetry/areas",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleGPSAreas)))))
+
+	router.Handle("POST /exports",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleCreateExport)))))
+
+	router.Handle("GET /exports/{id}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleGetExport)))))
+
+	router.Handle("GET /photos/{id}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(photoHandler.HandleGetPhoto)))))
+
+	router.Handle("GET /admin/audit",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleSearchAudit)))))
+
+	router.Handle("POST /admin/data-subject-requests",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleCreateDataSubjectRequest)))))
+
+	router.Handle("GET /admin/data-subject-requests/{id}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleGetDataSubjectRequest)))))
+
+	router.Handle("PUT /drivers/{id}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleSaveDriver)))))
+
+	router.Handle("GET /drivers/{id}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(api.HandleGetDriver)))))
+
+	router.Handle("POST /drivers/{id}/faces",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(driverFaceHandler.HandleEnrollFace)))))
+
+	router.Handle("GET /drivers/{id}/faces",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleInvestigator, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(driverFaceHandler.HandleListFaces)))))
+
+	router.Handle("DELETE /drivers/{id}/faces/{faceId}",
+		handlers.RateLimiterMiddleware(handlers.RequireRole(privilegedKeys, handlers.RoleAdmin)(metrics.PrometheusMiddleware(http.HandlerFunc(driverFaceHandler.HandleRemoveFace)))))
+
 	router.HandleFunc("/swagger/", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
 	))
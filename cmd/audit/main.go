@@ -0,0 +1,156 @@
+package main
+
+import (
+	"challenge-v3/auditchain"
+	"challenge-v3/services"
+	"challenge-v3/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/joho/godotenv"
+)
+
+const usage = `uso: audit <comando>
+
+comandos:
+  verify       confere a cadeia do audit_log, os HMACs e os checkpoints assinados
+  checkpoint   confere as linhas novas e exporta um checkpoint assinado da cabeça da cadeia
+  record <arq> confere a assinatura de um registro de conclusão de pedido de titular (LGPD)`
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+	godotenv.Load()
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// O registro de conclusão é conferido só com a chave pública, sem banco.
+	if os.Args[1] == "record" {
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		verifyRecord(os.Args[2])
+		return
+	}
+
+	db, err := storage.OpenFromEnv()
+	if err != nil {
+		slog.Error("falha ao conectar ao banco de dados", "error", err)
+		os.Exit(1)
+	}
+	hmacKey, err := auditchain.HMACKeyFromEnv()
+	if err != nil {
+		slog.Error("configuração da chave da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+	if hmacKey == nil {
+		slog.Warn("AUDIT_HMAC_KEY não configurada; os HMACs das linhas não serão conferidos")
+	}
+	db.SetAuditKey(hmacKey)
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("AWS_REGION")))
+	if err != nil {
+		slog.Error("Falha ao carregar config da AWS", "error", err)
+		os.Exit(1)
+	}
+	store, err := auditchain.OpenCheckpointStoreFromEnv(cfg)
+	if err != nil {
+		slog.Error("configuração do destino dos checkpoints da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "verify":
+		verifyKey, err := auditchain.VerifyKeyFromEnv()
+		if err != nil {
+			slog.Error("configuração da chave de verificação da auditoria inválida", "error", err)
+			os.Exit(1)
+		}
+		var checkpoints []*auditchain.Checkpoint
+		var problems []services.AuditChainProblem
+		if verifyKey != nil {
+			checkpoints, problems, err = services.LoadAuditCheckpoints(ctx, store, verifyKey)
+			if err != nil {
+				slog.Error("falha ao ler os checkpoints da auditoria", "error", err)
+				os.Exit(1)
+			}
+		} else {
+			slog.Warn("AUDIT_VERIFY_KEY não configurada; os checkpoints não serão conferidos")
+		}
+		report, err := services.NewAuditChainVerifier(db, hmacKey).Verify(ctx, nil, checkpoints)
+		if err != nil {
+			slog.Error("falha ao verificar a cadeia do audit_log", "error", err)
+			os.Exit(1)
+		}
+		report.Problems = append(problems, report.Problems...)
+
+		fmt.Printf("linhas conferidas: %d (seq %d a %d)\n", report.Entries, report.FirstSeq, report.LastSeq)
+		if report.Entries > 0 {
+			fmt.Printf("primeira linha:    %s\n", report.FirstTimestamp.Format(time.RFC3339))
+		}
+		fmt.Printf("checkpoints:       %d conferido(s), %d anterior(es) à primeira linha\n", report.Checkpoints, report.ExpiredCheckpoints)
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+		if !report.OK() {
+			fmt.Printf("%d problema(s) encontrado(s)\n", len(report.Problems))
+			os.Exit(1)
+		}
+		fmt.Println("cadeia íntegra")
+	case "checkpoint":
+		signer, err := auditchain.SigningKeyFromEnv()
+		if err != nil || signer == nil {
+			slog.Error("AUDIT_SIGNING_KEY ausente ou inválida", "error", err)
+			os.Exit(1)
+		}
+		checkpoint, err := services.NewAuditCheckpointService(db, store, signer, hmacKey).Checkpoint(ctx, time.Now())
+		if err != nil {
+			slog.Error("falha ao gerar checkpoint do audit_log", "error", err)
+			os.Exit(1)
+		}
+		if checkpoint == nil {
+			fmt.Println("a cadeia não mudou desde o último checkpoint")
+			return
+		}
+		fmt.Printf("checkpoint gerado: seq %d, hash %s\n", checkpoint.Seq, checkpoint.Hash)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func verifyRecord(path string) {
+	verifyKey, err := auditchain.VerifyKeyFromEnv()
+	if err != nil || verifyKey == nil {
+		slog.Error("AUDIT_VERIFY_KEY ausente ou inválida", "error", err)
+		os.Exit(1)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("falha ao ler o registro de conclusão", "error", err)
+		os.Exit(1)
+	}
+	var record auditchain.CompletionRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		slog.Error("registro de conclusão inválido", "error", err)
+		os.Exit(1)
+	}
+	if err := record.Verify(verifyKey); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("pedido %d (%s de %s %s) concluído em %s\n", record.RequestID, record.Action, record.SubjectType, record.SubjectID,
+		record.CompletedAt.Format(time.RFC3339))
+	fmt.Printf("digest:     %s (details.record_digest no audit_log)\n", record.Digest())
+	fmt.Println("assinatura válida")
+}
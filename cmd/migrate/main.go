@@ -0,0 +1,79 @@
+package main
+
+import (
+	"challenge-v3/storage"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `uso: migrate <comando>
+
+comandos:
+  up           aplica todas as migrações pendentes
+  down [n]     desfaz as últimas n migrações (padrão: 1)
+  status       lista as migrações e quando foram aplicadas`
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+	godotenv.Load()
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, err := storage.OpenFromEnv()
+	if err != nil {
+		slog.Error("falha ao conectar ao banco de dados", "error", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "up":
+		count, err := db.Migrate(ctx)
+		if err != nil {
+			slog.Error("falha ao aplicar migrações", "error", err, "applied", count)
+			os.Exit(1)
+		}
+		fmt.Printf("%d migração(ões) aplicada(s)\n", count)
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps <= 0 {
+				fmt.Fprintln(os.Stderr, usage)
+				os.Exit(2)
+			}
+		}
+		count, err := db.Rollback(ctx, steps)
+		if err != nil {
+			slog.Error("falha ao desfazer migrações", "error", err, "rolled_back", count)
+			os.Exit(1)
+		}
+		fmt.Printf("%d migração(ões) desfeita(s)\n", count)
+	case "status":
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			slog.Error("falha ao consultar migrações", "error", err)
+			os.Exit(1)
+		}
+		for _, m := range status {
+			applied := "pendente"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s  %s\n", m.Version, m.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
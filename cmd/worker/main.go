@@ -1,6 +1,10 @@
 package main
 
 import (
+	"challenge-v3/auditchain"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/export"
 	"challenge-v3/ierr"
 	"challenge-v3/messaging"
 	"challenge-v3/metrics"
@@ -14,11 +18,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"log/slog"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
@@ -26,75 +33,132 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// consumerAckWait é o AckWait dos consumidores (o padrão do JetStream, explícito só no de fotos).
+// ackMargin é a folga entre o fim do prazo de uma operação e a reentrega da mensagem, para o ack
+// ou nak chegar ao servidor antes de o JetStream desistir dela.
+const (
+	consumerAckWait = 30 * time.Second
+	ackMargin       = 5 * time.Second
+)
+
+// operationTimeout é quanto uma mensagem (ou lote) pode levar desde o recebimento; depois disso o
+// banco e o Rekognition são cancelados e a mensagem recebe nak em vez de ser processada em dobro.
+const operationTimeout = consumerAckWait - ackMargin
+
 type Worker struct {
-	db            storage.Storage
-	photoAnalyzer services.PhotoAnalyzer
+	db              storage.Storage
+	photoAnalyzer   services.PhotoAnalyzer
+	gpsAnalyzer     services.GPSAnalyzer
+	securityMonitor *services.SecurityMonitor
 }
 
-func (w *Worker) handleGyroscopeMsg(msg *nats.Msg) {
-	subject := "telemetry.gyroscope"
-	var data models.GyroscopeData
-	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		slog.Error("Falha ao decodificar mensagem de giroscópios", "error", err.Error(), "action", "retrying_message")
+// decodeBatch decodifica e valida cada mensagem do lote. Mensagens inválidas são terminadas na hora,
+// já que reenviá-las não adiantaria; as válidas seguem com a mensagem de origem para o ack.
+func decodeBatch[T any](subject string, msgs []*nats.Msg, validate func(*T) error) ([]*T, []*nats.Msg) {
+	items := make([]*T, 0, len(msgs))
+	valid := make([]*nats.Msg, 0, len(msgs))
+	for _, msg := range msgs {
+		item := new(T)
+		err := json.Unmarshal(msg.Data, item)
+		if err == nil {
+			err = validate(item)
+		}
+		if err != nil {
+			slog.Warn("mensagem inválida terminada", "subject", subject, "error", err)
+			msg.Term()
+			metrics.NatsMessagesProcessed.WithLabelValues(subject, "terminated").Inc()
+			continue
+		}
+		items = append(items, item)
+		valid = append(valid, msg)
+	}
+	return items, valid
+}
 
-		msg.Term()
-		metrics.NatsMessagesProcessed.WithLabelValues(subject, "terminated").Inc()
-		return
+// settleBatch confirma (ou devolve para reenvio) todas as mensagens do lote de uma vez.
+func settleBatch(subject string, msgs []*nats.Msg, err error) {
+	status := "success"
+	for _, msg := range msgs {
+		if err != nil {
+			msg.Nak()
+		} else {
+			msg.Ack()
+		}
 	}
-	if err := w.db.SaveGyroscope(&data); err != nil {
-		slog.Error("falha ao salvar dados de giroscópio", "error", err, "device_id", data.DeviceID)
-		msg.Nak()
-		metrics.NatsMessagesProcessed.WithLabelValues(subject, "failed").Inc()
+	if err != nil {
+		status = "failed"
+	}
+	metrics.NatsMessagesProcessed.WithLabelValues(subject, status).Add(float64(len(msgs)))
+	metrics.WorkerBatchSize.WithLabelValues(subject).Observe(float64(len(msgs)))
+}
+
+func (w *Worker) handleGyroscopeBatch(ctx context.Context, msgs []*nats.Msg) {
+	subject := "telemetry.gyroscope"
+	batch, valid := decodeBatch(subject, msgs, (*models.GyroscopeData).Validate)
+	if len(batch) == 0 {
 		return
 	}
-	slog.Info("mensagem de giroscópio processada", "device_id", data.DeviceID)
 
-	auditEvent := models.AuditEvent{
-		Actor:  data.DeviceID,
-		Action: "GYROSCOPE_PROCESSED",
-		Details: map[string]interface{}{
-			"x": *data.X,
-			"y": *data.Y,
-			"z": *data.Z,
-		},
+	// As leituras não vão para o audit_log: ele não pode ser alterado sem quebrar a cadeia, nem num pedido
+	// de eliminação do titular. Fica só o registro de que a leitura foi processada.
+	auditEvents := make([]models.AuditEvent, 0, len(batch))
+	for _, data := range batch {
+		auditEvents = append(auditEvents, models.AuditEvent{
+			Actor:   data.DeviceID,
+			Action:  "GYROSCOPE_PROCESSED",
+			Details: map[string]interface{}{"timestamp": data.Timestamp},
+		})
 	}
-	if err := w.db.LogAuditEvent(auditEvent); err != nil {
-		slog.Error("falha ao registrar evento de auditoria para giroscópio", "error", err, "device_id", data.DeviceID)
+	// Leituras e auditoria são confirmadas juntas; o lote só recebe ack depois do commit.
+	err := w.db.WithTx(ctx, func(tx storage.Storage) error {
+		if err := tx.SaveGyroscopeBatch(ctx, batch); err != nil {
+			return err
+		}
+		return tx.LogAuditEvents(ctx, auditEvents)
+	})
+	if err != nil {
+		slog.Error("falha ao salvar lote de giroscópio", "error", err, "count", len(batch))
+		settleBatch(subject, valid, err)
+		return
 	}
-
-	msg.Ack()
-	metrics.NatsMessagesProcessed.WithLabelValues(subject, "success").Inc()
+	slog.Info("lote de giroscópio processado", "count", len(batch))
+	settleBatch(subject, valid, nil)
 }
-func (w *Worker) handleGpsMsg(msg *nats.Msg) {
+
+func (w *Worker) handleGpsBatch(ctx context.Context, msgs []*nats.Msg) {
 	subject := "telemetry.gps"
-	var data models.GPSData
-	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		slog.Error("falha ao decodificar mensagem de gps", "error", err)
-		msg.Term()
-		metrics.NatsMessagesProcessed.WithLabelValues(subject, "terminated").Inc()
+	batch, valid := decodeBatch(subject, msgs, (*models.GPSData).Validate)
+	if len(batch) == 0 {
 		return
 	}
-	if err := w.db.SaveGPS(&data); err != nil {
-		slog.Error("falha ao salvar dados de gps", "error", err, "device_id", data.DeviceID)
-		msg.Nak()
-		metrics.NatsMessagesProcessed.WithLabelValues(subject, "failed").Inc()
+	// O analisador grava leituras, eventos de excesso de velocidade e auditoria na mesma transação.
+	overspeeds, err := w.gpsAnalyzer.AnalyzeAndSaveGPSBatch(ctx, batch)
+	if err != nil {
+		slog.Error("falha ao salvar lote de gps", "error", err, "count", len(batch))
+		settleBatch(subject, valid, err)
 		return
 	}
-	slog.Info("mensagem de gps processada", "device_id", data.DeviceID)
-	auditEvent := models.AuditEvent{
-		Actor:  data.DeviceID,
-		Action: "GPS_DATA_PROCESSED",
-		Details: map[string]interface{}{
-			"latitude":  *data.Latitude,
-			"longitude": *data.Longitude,
-		},
+	metrics.OverspeedEventsTotal.Add(float64(len(overspeeds)))
+	slog.Info("lote de gps processado", "count", len(batch), "overspeed_events", len(overspeeds))
+	settleBatch(subject, valid, nil)
+}
+
+func (w *Worker) handleSecurityBatch(ctx context.Context, msgs []*nats.Msg) {
+	subject := messaging.SecurityEventsSubject
+	batch, valid := decodeBatch(subject, msgs, (*models.SecurityEvent).Validate)
+	if len(batch) == 0 {
+		return
 	}
-	if err := w.db.LogAuditEvent(auditEvent); err != nil {
-		slog.Error("falha ao registrar evento de auditoria para gps", "error", err, "device_id", data.DeviceID)
+	alerts, err := w.securityMonitor.RecordSecurityEvents(ctx, batch)
+	if err != nil {
+		slog.Error("falha ao salvar lote de eventos de segurança", "error", err, "count", len(batch))
+		settleBatch(subject, valid, err)
+		return
 	}
-	msg.Ack()
-	metrics.NatsMessagesProcessed.WithLabelValues(subject, "success").Inc()
+	slog.Info("lote de eventos de segurança processado", "count", len(batch), "alerts", len(alerts))
+	settleBatch(subject, valid, nil)
 }
+
 func (w *Worker) handlePhotoMsg(msg *nats.Msg) {
 	subject := "telemetry.photo"
 	var data models.PhotoData
@@ -104,7 +168,9 @@ func (w *Worker) handlePhotoMsg(msg *nats.Msg) {
 		metrics.NatsMessagesProcessed.WithLabelValues(subject, "terminated").Inc()
 		return
 	}
-	_, err := w.photoAnalyzer.AnalyzeAndSavePhoto(&data)
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	_, err := w.photoAnalyzer.AnalyzeAndSavePhoto(ctx, &data)
 	if err != nil {
 		var validationErr *ierr.ValidationError
 		if errors.As(err, &validationErr) {
@@ -119,18 +185,99 @@ func (w *Worker) handlePhotoMsg(msg *nats.Msg) {
 		return
 	}
 	slog.Info("mensagem de foto processada com sucesso", "device_id", data.DeviceID)
-	auditEvent := models.AuditEvent{
-		Actor:   data.DeviceID,
-		Action:  "PHOTO_PROCESSED",
-		Details: map[string]interface{}{"recognized": data.Recognized},
-	}
-	if err := w.db.LogAuditEvent(auditEvent); err != nil {
-		slog.Error("falha ao registrar evento de auditoria no worker", "error", err)
-	}
 	msg.Ack()
 	metrics.NatsMessagesProcessed.WithLabelValues(subject, "success").Inc()
 }
 
+// loadBatchConfig lê WORKER_BATCH_SIZE e WORKER_BATCH_INTERVAL_MS. O tamanho precisa ficar abaixo do
+// MaxAckPending do consumidor (1000 por padrão), senão o servidor para de entregar antes do lote encher.
+func loadBatchConfig() (int, time.Duration, error) {
+	size, interval := 500, 200*time.Millisecond
+	if raw := os.Getenv("WORKER_BATCH_SIZE"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return 0, 0, fmt.Errorf("WORKER_BATCH_SIZE inválido: %s", raw)
+		}
+		size = parsed
+	}
+	if raw := os.Getenv("WORKER_BATCH_INTERVAL_MS"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return 0, 0, fmt.Errorf("WORKER_BATCH_INTERVAL_MS inválido: %s", raw)
+		}
+		interval = time.Duration(parsed) * time.Millisecond
+	}
+	// O prazo do lote conta desde a primeira mensagem, então o intervalo consome parte dele.
+	if interval >= operationTimeout {
+		return 0, 0, fmt.Errorf("WORKER_BATCH_INTERVAL_MS precisa ser menor que %s", operationTimeout)
+	}
+	return size, interval, nil
+}
+
+func loadSpeedConfig() (services.SpeedConfig, error) {
+	cfg := services.DefaultSpeedConfig()
+	if raw := os.Getenv("OVERSPEED_LIMIT_KMH"); raw != "" {
+		limit, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("OVERSPEED_LIMIT_KMH inválido: %w", err)
+		}
+		cfg.DefaultLimit = limit
+	}
+	deviceLimits, err := services.ParseDeviceLimits(os.Getenv("OVERSPEED_DEVICE_LIMITS"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.DeviceLimits = deviceLimits
+	if raw := os.Getenv("GPS_JITTER_METERS"); raw != "" {
+		meters, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("GPS_JITTER_METERS inválido: %w", err)
+		}
+		cfg.MinDistance = meters
+	}
+	return cfg, nil
+}
+
+// newExportDestination escolhe entre diretório local (padrão) e bucket S3/MinIO via EXPORT_DESTINATION.
+func newExportDestination(cfg aws.Config) (export.Destination, error) {
+	switch os.Getenv("EXPORT_DESTINATION") {
+	case "", "local":
+		dir := os.Getenv("EXPORT_DIR")
+		if dir == "" {
+			dir = "exports"
+		}
+		return export.NewLocalDestination(dir)
+	case "s3":
+		bucket := os.Getenv("EXPORT_S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("EXPORT_S3_BUCKET é obrigatório quando EXPORT_DESTINATION=s3")
+		}
+		return export.NewS3Destination(blob.NewS3Client(cfg), bucket, os.Getenv("EXPORT_S3_PREFIX")), nil
+	default:
+		return nil, fmt.Errorf("EXPORT_DESTINATION inválido: %s", os.Getenv("EXPORT_DESTINATION"))
+	}
+}
+
+// loadSecurityAlertConfig lê SECURITY_ALERT_THRESHOLD e SECURITY_ALERT_WINDOW_SECONDS.
+func loadSecurityAlertConfig() (services.SecurityAlertConfig, error) {
+	config := services.DefaultSecurityAlertConfig()
+	if raw := os.Getenv("SECURITY_ALERT_THRESHOLD"); raw != "" {
+		threshold, err := strconv.Atoi(raw)
+		if err != nil || threshold <= 0 {
+			return config, fmt.Errorf("SECURITY_ALERT_THRESHOLD inválido: %q", raw)
+		}
+		config.Threshold = threshold
+	}
+	if raw := os.Getenv("SECURITY_ALERT_WINDOW_SECONDS"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			return config, fmt.Errorf("SECURITY_ALERT_WINDOW_SECONDS inválido: %q", raw)
+		}
+		config.Window = time.Duration(seconds) * time.Second
+	}
+	return config, nil
+}
+
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
@@ -138,17 +285,39 @@ func main() {
 	slog.Info("iniciando o worker")
 	godotenv.Load()
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
-	db, err := storage.NewPostgresStorage(connStr)
+	db, err := storage.OpenFromEnv()
 	if err != nil {
 		slog.Error("falha ao conectar ao banco de dados", "error", err)
 		os.Exit(1)
 
 	}
 
-	if err := db.InitTables(); err != nil {
-		slog.Error("Não foi possível inicializar as tabelas a partir do worker", "error", err)
+	locations, err := crypto.LocationCipherFromEnv()
+	if err != nil {
+		slog.Error("configuração da cifragem de posições inválida", "error", err)
+		os.Exit(1)
+	}
+	if locations != nil {
+		db.SetLocationCipher(locations)
+	}
+
+	auditKey, err := auditchain.WriterHMACKeyFromEnv()
+	if err != nil {
+		slog.Error("configuração da chave da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+	if auditKey == nil {
+		slog.Warn("AUDIT_HMAC_STRICT=false e AUDIT_HMAC_KEY não configurada: o audit_log será gravado SEM HMAC; não use em produção")
+	}
+	db.SetAuditKey(auditKey)
+
+	if _, err := db.Migrate(context.Background()); err != nil {
+		slog.Error("Não foi possível aplicar as migrações do banco de dados", "error", err)
+		os.Exit(1)
+	}
+	partitionService := services.NewPartitionService(db)
+	if err := partitionService.EnsureFuturePartitions(context.Background(), time.Now()); err != nil {
+		slog.Error("Não foi possível criar as partições das tabelas de telemetria", "error", err)
 		os.Exit(1)
 	}
 
@@ -167,7 +336,27 @@ func main() {
 
 	}
 
-	photoAnalyzer := services.NewPhotoAnalyzerService(rekognitionClient, collectionID, db)
+	photoStore, err := blob.OpenFromEnv(cfg)
+	if err != nil {
+		slog.Error("configuração do armazenamento de fotos inválida", "error", err)
+		os.Exit(1)
+	}
+	photoKeys, err := services.PhotoKeysFromEnv()
+	if err != nil {
+		slog.Error("configuração das chaves de criptografia inválida", "error", err)
+		os.Exit(1)
+	}
+	photoAnalyzer := services.NewPhotoAnalyzerService(rekognitionClient, collectionID, db, photoStore, photoKeys)
+	// Rostos desconhecidos só entram na coleção quando habilitado; o caminho normal é o cadastro do motorista.
+	photoAnalyzer.SetAutoIndex(os.Getenv("REKOGNITION_AUTO_INDEX") == "true")
+
+	speedConfig, err := loadSpeedConfig()
+	if err != nil {
+		slog.Error("configuração de limites de velocidade inválida", "error", err)
+		os.Exit(1)
+	}
+	gpsAnalyzer := services.NewGPSAnalyzerService(db, speedConfig)
+
 	natsURL := os.Getenv("NATS_URL")
 	nc, err := messaging.ConnectNATS(natsURL)
 	if err != nil {
@@ -190,19 +379,133 @@ func main() {
 		}
 	}()
 
+	exportDest, err := newExportDestination(cfg)
+	if err != nil {
+		slog.Error("Falha ao configurar o destino das exportações", "error", err)
+		os.Exit(1)
+	}
+	exportInterval := 10 * time.Second
+	if raw := os.Getenv("EXPORT_POLL_INTERVAL_SECONDS"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			slog.Error("EXPORT_POLL_INTERVAL_SECONDS inválido", "value", raw)
+			os.Exit(1)
+		}
+		exportInterval = time.Duration(seconds) * time.Second
+	}
+	exportService := services.NewExportService(db, exportDest)
+	if raw := os.Getenv("EXPORT_JOB_TIMEOUT_MINUTES"); raw != "" {
+		minutes, err := strconv.Atoi(raw)
+		if err != nil || minutes <= 0 {
+			slog.Error("EXPORT_JOB_TIMEOUT_MINUTES inválido", "value", raw)
+			os.Exit(1)
+		}
+		exportService.SetJobTimeout(time.Duration(minutes) * time.Minute)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exportService.Start(ctx, exportInterval, os.Getenv("EXPORT_DAILY_FORMAT"))
+
+	rollupService := services.NewRollupService(db)
+	go rollupService.Start(ctx, time.Minute)
+
+	retentionPolicies, err := services.ParseRetentionPolicies(os.Getenv("RETENTION_POLICIES"))
+	if err != nil {
+		slog.Error("RETENTION_POLICIES inválido", "error", err)
+		os.Exit(1)
+	}
+	purgeBatchSize := 0
+	if raw := os.Getenv("RETENTION_BATCH_SIZE"); raw != "" {
+		purgeBatchSize, err = strconv.Atoi(raw)
+		if err != nil || purgeBatchSize <= 0 {
+			slog.Error("RETENTION_BATCH_SIZE inválido", "value", raw)
+			os.Exit(1)
+		}
+	}
+	detachPartitions := os.Getenv("RETENTION_DETACH_PARTITIONS") == "true"
+	retentionService := services.NewRetentionService(db, photoStore, retentionPolicies, purgeBatchSize, detachPartitions)
+	go retentionService.Start(ctx, time.Hour)
+
+	go partitionService.Start(ctx, 6*time.Hour)
+	go services.NewPhotoMigrationService(db, photoStore, photoKeys).Start(ctx)
+	if photoKeys.Provider != nil {
+		go services.NewPhotoReencryptionService(db, photoStore, photoKeys).Start(ctx, time.Hour)
+	}
+
+	// Sem a chave de assinatura não há checkpoints da cadeia nem como concluir os pedidos de titulares,
+	// que a API continuaria aceitando e ficariam pendentes para sempre.
+	auditSigner, err := auditchain.SigningKeyFromEnv()
+	if err != nil {
+		slog.Error("configuração da chave de assinatura da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+	if auditSigner == nil {
+		slog.Error("AUDIT_SIGNING_KEY não configurada: é necessária para os checkpoints da auditoria e os pedidos de titulares (LGPD)")
+		os.Exit(1)
+	}
+	checkpointStore, err := auditchain.OpenCheckpointStoreFromEnv(cfg)
+	if err != nil {
+		slog.Error("configuração do destino dos checkpoints da auditoria inválida", "error", err)
+		os.Exit(1)
+	}
+	checkpointInterval := time.Hour
+	if raw := os.Getenv("AUDIT_CHECKPOINT_INTERVAL_MINUTES"); raw != "" {
+		minutes, err := strconv.Atoi(raw)
+		if err != nil || minutes <= 0 {
+			slog.Error("AUDIT_CHECKPOINT_INTERVAL_MINUTES inválido", "value", raw)
+			os.Exit(1)
+		}
+		checkpointInterval = time.Duration(minutes) * time.Minute
+	}
+	go services.NewAuditCheckpointService(db, checkpointStore, auditSigner, auditKey).Start(ctx, checkpointInterval)
+	// Os pedidos de titulares usam a mesma chave para assinar o registro de conclusão.
+	dataSubjects := services.NewDataSubjectService(db, photoStore, photoKeys, rekognitionClient, collectionID, exportDest, auditSigner)
+	dataSubjects.SetFacesDeletedHook(photoAnalyzer.ForgetFaces)
+	go dataSubjects.Start(ctx, exportInterval)
+
+	securityAlerts, err := loadSecurityAlertConfig()
+	if err != nil {
+		slog.Error("configuração dos alertas de segurança inválida", "error", err)
+		os.Exit(1)
+	}
+
 	worker := &Worker{
-		db:            db,
-		photoAnalyzer: photoAnalyzer,
+		db:              db,
+		photoAnalyzer:   photoAnalyzer,
+		gpsAnalyzer:     gpsAnalyzer,
+		securityMonitor: services.NewSecurityMonitor(db, securityAlerts),
+	}
+
+	batchSize, batchInterval, err := loadBatchConfig()
+	if err != nil {
+		slog.Error("configuração de lotes inválida", "error", err)
+		os.Exit(1)
+	}
+	gyroscopeBatcher := messaging.NewBatcher(batchSize, batchInterval, operationTimeout, worker.handleGyroscopeBatch)
+	gpsBatcher := messaging.NewBatcher(batchSize, batchInterval, operationTimeout, worker.handleGpsBatch)
+	securityBatcher := messaging.NewBatcher(batchSize, batchInterval, operationTimeout, worker.handleSecurityBatch)
+	batchCtx, stopBatchers := context.WithCancel(context.Background())
+	var batchers sync.WaitGroup
+	for _, b := range []*messaging.Batcher{gyroscopeBatcher, gpsBatcher, securityBatcher} {
+		batchers.Add(1)
+		go func() {
+			defer batchers.Done()
+			b.Run(batchCtx)
+		}()
 	}
 
-	ackWait := nats.AckWait(30 * time.Second)
-	js.Subscribe("telemetry.gyroscope", worker.handleGyroscopeMsg, nats.Durable("GYROSCOPE_WORKER"))
-	js.Subscribe("telemetry.gps", worker.handleGpsMsg, nats.Durable("GPS_WORKER"))
+	ackWait := nats.AckWait(consumerAckWait)
+	js.Subscribe("telemetry.gyroscope", gyroscopeBatcher.Add, nats.Durable("GYROSCOPE_WORKER"))
+	js.Subscribe("telemetry.gps", gpsBatcher.Add, nats.Durable("GPS_WORKER"))
 	js.Subscribe("telemetry.photo", worker.handlePhotoMsg, nats.Durable("PHOTO_WORKER"), ackWait)
+	js.Subscribe(messaging.SecurityEventsSubject, securityBatcher.Add, nats.Durable("SECURITY_WORKER"))
 
-	slog.Info("Worker está no ar, esperando por mensagens de telemetria...")
+	slog.Info("Worker está no ar, esperando por mensagens de telemetria...", "batch_size", batchSize, "batch_interval", batchInterval.String())
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 	slog.Info("Desligando o Worker...")
+	// Grava os lotes pendentes antes de sair; o que não for confirmado é reenviado pelo JetStream.
+	stopBatchers()
+	batchers.Wait()
 }
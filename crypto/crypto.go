@@ -9,6 +9,12 @@ import (
 )
 
 func Encrypt(dataToEncrypt []byte, key []byte) ([]byte, error) {
+	return EncryptWithAAD(dataToEncrypt, key, nil)
+}
+
+// EncryptWithAAD autentica aad junto com o texto cifrado sem incluí-lo no resultado: DecryptWithAAD só
+// abre com o mesmo aad, o que amarra o texto cifrado ao contexto em que foi gravado.
+func EncryptWithAAD(dataToEncrypt []byte, key []byte, aad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -24,11 +30,15 @@ func Encrypt(dataToEncrypt []byte, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, dataToEncrypt, nil)
+	ciphertext := gcm.Seal(nonce, nonce, dataToEncrypt, aad)
 	return ciphertext, nil
 }
 
 func Decrypt(encryptedData []byte, key []byte) ([]byte, error) {
+	return DecryptWithAAD(encryptedData, key, nil)
+}
+
+func DecryptWithAAD(encryptedData []byte, key []byte, aad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -45,7 +55,7 @@ func Decrypt(encryptedData []byte, key []byte) ([]byte, error) {
 
 	nonce, ciphertext := encryptedData[:gcm.NonceSize()], encryptedData[gcm.NonceSize():]
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
 	if err != nil {
 		return nil, err
 	}
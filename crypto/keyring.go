@@ -0,0 +1,173 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Envelope: "CVE" | versão do formato (1 byte) | versão da chave (uint32 big-endian) | nonce | texto
+// cifrado com a tag. O cabeçalho entra como dado autenticado, então trocar a versão da chave invalida a
+// mensagem em vez de fazê-la ser aberta com outra chave.
+const (
+	envelopeMagic      = "CVE"
+	envelopeFormat     = 1
+	envelopeHeaderSize = len(envelopeMagic) + 1 + 4
+)
+
+var (
+	ErrInvalidEnvelope = errors.New("envelope de criptografia inválido")
+	ErrUnknownKey      = errors.New("versão de chave de criptografia desconhecida")
+)
+
+// Keyring guarda as chaves ativas por versão. Novas cifragens usam sempre a versão mais alta; as
+// anteriores continuam disponíveis para abrir o que já foi gravado até serem retiradas.
+type Keyring struct {
+	keys    map[uint32]cipher.AEAD
+	current uint32
+}
+
+func NewKeyring(keys map[uint32][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("nenhuma chave de criptografia informada")
+	}
+	k := &Keyring{keys: make(map[uint32]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if version == 0 {
+			return nil, errors.New("a versão de chave 0 é reservada")
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("a chave de versão %d deve ter 32 bytes, tem %d", version, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[version] = gcm
+		k.current = max(k.current, version)
+	}
+	return k, nil
+}
+
+// ParseKeyring lê entradas "versão:chave" separadas por ";". A chave é o restante da entrada.
+func ParseKeyring(raw string) (*Keyring, error) {
+	keys := make(map[uint32][]byte)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rawVersion, key, found := strings.Cut(entry, ":")
+		version, err := strconv.ParseUint(rawVersion, 10, 32)
+		if !found || err != nil {
+			return nil, fmt.Errorf("entrada de chave inválida %q: use versão:chave", rawVersion)
+		}
+		if _, dup := keys[uint32(version)]; dup {
+			return nil, fmt.Errorf("versão de chave repetida: %d", version)
+		}
+		keys[uint32(version)] = []byte(key)
+	}
+	return NewKeyring(keys)
+}
+
+// KeyringFromEnv carrega ENCRYPTION_KEYS ou, na falta dela, usa ENCRYPTION_KEY como a versão 1.
+// Retorna nil quando nenhuma das duas está definida; uma ENCRYPTION_KEY com tamanho errado é erro, e não
+// um motivo para gravar sem criptografia.
+func KeyringFromEnv() (*Keyring, error) {
+	if raw := os.Getenv("ENCRYPTION_KEYS"); raw != "" {
+		return ParseKeyring(raw)
+	}
+	key := []byte(os.Getenv("ENCRYPTION_KEY"))
+	if len(key) == 0 {
+		return nil, nil
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("ENCRYPTION_KEY deve ter exatamente 32 bytes, tem %d", len(key))
+	}
+	return NewKeyring(map[uint32][]byte{1: key})
+}
+
+// Current é a versão usada nas novas cifragens.
+func (k *Keyring) Current() uint32 {
+	return k.current
+}
+
+// Seal cifra com a chave atual e devolve o envelope completo.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	return k.SealWithAAD(plaintext, nil)
+}
+
+// SealWithAAD é Seal com dados autenticados além do cabeçalho; OpenWithAAD precisa recebê-los iguais.
+func (k *Keyring) SealWithAAD(plaintext, aad []byte) ([]byte, error) {
+	gcm := k.keys[k.current]
+	out := make([]byte, envelopeHeaderSize, envelopeHeaderSize+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	copy(out, envelopeMagic)
+	out[len(envelopeMagic)] = envelopeFormat
+	binary.BigEndian.PutUint32(out[len(envelopeMagic)+1:], k.current)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	header := out[:envelopeHeaderSize:envelopeHeaderSize]
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, append(header, aad...)), nil
+}
+
+// Open abre um envelope com a versão de chave indicada no cabeçalho.
+func (k *Keyring) Open(envelope []byte) ([]byte, error) {
+	return k.OpenWithAAD(envelope, nil)
+}
+
+func (k *Keyring) OpenWithAAD(envelope, aad []byte) ([]byte, error) {
+	version, err := EnvelopeKeyVersion(envelope)
+	if err != nil {
+		return nil, err
+	}
+	gcm, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, version)
+	}
+	body := envelope[envelopeHeaderSize:]
+	if len(body) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrInvalidEnvelope
+	}
+	nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	header := envelope[:envelopeHeaderSize:envelopeHeaderSize]
+	return gcm.Open(nil, nonce, ciphertext, append(header, aad...))
+}
+
+// OpenLegacy abre o formato antigo de Encrypt (nonce||texto cifrado), que não diz qual chave foi usada:
+// tenta cada uma até a autenticação do GCM aceitar.
+func (k *Keyring) OpenLegacy(ciphertext []byte) ([]byte, error) {
+	for _, gcm := range k.keys {
+		if len(ciphertext) < gcm.NonceSize() {
+			return nil, fmt.Errorf("texto cifrado muito curto")
+		}
+		nonce, body := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+		if plaintext, err := gcm.Open(nil, nonce, body, nil); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// EnvelopeKeyVersion lê a versão da chave no cabeçalho sem decifrar.
+func EnvelopeKeyVersion(envelope []byte) (uint32, error) {
+	if len(envelope) < envelopeHeaderSize || string(envelope[:len(envelopeMagic)]) != envelopeMagic ||
+		envelope[len(envelopeMagic)] != envelopeFormat {
+		return 0, ErrInvalidEnvelope
+	}
+	return binary.BigEndian.Uint32(envelope[len(envelopeMagic)+1:]), nil
+}
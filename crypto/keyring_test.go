@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKeyV1 = []byte("este-e-um-segredo-de-32-bytes!!*")
+	testKeyV2 = []byte("outro-segredo-de-exatos-32-bytes")
+)
+
+func TestKeyring_RotationKeepsOldEnvelopesReadable(t *testing.T) {
+	v1, err := NewKeyring(map[uint32][]byte{1: testKeyV1})
+	require.NoError(t, err)
+	old, err := v1.Seal([]byte("imagem"))
+	require.NoError(t, err)
+
+	rotated, err := ParseKeyring("1:" + string(testKeyV1) + "; 2:" + string(testKeyV2))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), rotated.Current())
+
+	plaintext, err := rotated.Open(old)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("imagem"), plaintext)
+
+	fresh, err := rotated.Seal([]byte("imagem"))
+	require.NoError(t, err)
+	version, err := EnvelopeKeyVersion(fresh)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+
+	_, err = v1.Open(fresh)
+	assert.ErrorIs(t, err, ErrUnknownKey, "a chave 1 sozinha não abre o que foi cifrado com a 2")
+}
+
+func TestKeyring_RejectsTamperedEnvelope(t *testing.T) {
+	keys, err := NewKeyring(map[uint32][]byte{1: testKeyV1, 2: testKeyV2})
+	require.NoError(t, err)
+	envelope, err := keys.Seal([]byte("imagem"))
+	require.NoError(t, err)
+
+	// Apontar o cabeçalho para outra chave existente não pode funcionar: ele é autenticado.
+	tampered := append([]byte(nil), envelope...)
+	tampered[envelopeHeaderSize-1] = 1
+	_, err = keys.Open(tampered)
+	assert.Error(t, err)
+
+	_, err = keys.Open([]byte("nonce-e-texto-no-formato-antigo"))
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+}
+
+func TestKeyring_OpenLegacyTriesEveryKey(t *testing.T) {
+	legacy, err := Encrypt([]byte("imagem"), testKeyV1)
+	require.NoError(t, err)
+	keys, err := NewKeyring(map[uint32][]byte{1: testKeyV1, 2: testKeyV2})
+	require.NoError(t, err)
+
+	plaintext, err := keys.OpenLegacy(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("imagem"), plaintext)
+
+	onlyV2, err := NewKeyring(map[uint32][]byte{2: testKeyV2})
+	require.NoError(t, err)
+	_, err = onlyV2.OpenLegacy(legacy)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestParseKeyring_Invalid(t *testing.T) {
+	for _, invalid := range []string{"", "1", "x:" + string(testKeyV1), "0:" + string(testKeyV1), "1:curta",
+		"1:" + string(testKeyV1) + ";1:" + string(testKeyV2)} {
+		_, err := ParseKeyring(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// LocationCipher cifra pares latitude/longitude para gravação campo a campo. Cada posição vira um envelope
+// do Keyring com o device_id como dados autenticados, então uma posição copiada para a linha de outro
+// dispositivo não abre. Ao contrário das fotos, não há chave de dados por registro: são milhões de leituras
+// e cada uma cabe em poucos bytes.
+type LocationCipher struct {
+	keys *Keyring
+}
+
+func NewLocationCipher(keys *Keyring) *LocationCipher {
+	return &LocationCipher{keys: keys}
+}
+
+// LocationCipherFromEnv retorna nil, nil quando GPS_ENCRYPTION não está ligado. As chaves são as do
+// chaveiro local: o arquivo de ENCRYPTION_KEY_FILE com KEY_PROVIDER=file, senão ENCRYPTION_KEYS ou
+// ENCRYPTION_KEY. Com KEY_PROVIDER=vault uma dessas duas precisa estar definida, já que chamar o Vault a
+// cada leitura de GPS não é viável.
+func LocationCipherFromEnv() (*LocationCipher, error) {
+	raw := os.Getenv("GPS_ENCRYPTION")
+	if raw == "" {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("GPS_ENCRYPTION inválido: %w", err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	var keys *Keyring
+	if os.Getenv("KEY_PROVIDER") == "file" {
+		keys, err = keyringFromKeyFile()
+	} else {
+		keys, err = KeyringFromEnv()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, errors.New("GPS_ENCRYPTION=true exige uma chave local em ENCRYPTION_KEYS, ENCRYPTION_KEY ou ENCRYPTION_KEY_FILE")
+	}
+	return NewLocationCipher(keys), nil
+}
+
+func (c *LocationCipher) Seal(deviceID string, latitude, longitude float64) ([]byte, error) {
+	plaintext := make([]byte, 16)
+	binary.BigEndian.PutUint64(plaintext, math.Float64bits(latitude))
+	binary.BigEndian.PutUint64(plaintext[8:], math.Float64bits(longitude))
+	return c.keys.SealWithAAD(plaintext, []byte(deviceID))
+}
+
+func (c *LocationCipher) Open(deviceID string, sealed []byte) (float64, float64, error) {
+	plaintext, err := c.keys.OpenWithAAD(sealed, []byte(deviceID))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(plaintext) != 16 {
+		return 0, 0, ErrInvalidEnvelope
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(plaintext)), math.Float64frombits(binary.BigEndian.Uint64(plaintext[8:])), nil
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocationCipher_BoundToDevice(t *testing.T) {
+	keys, err := NewKeyring(map[uint32][]byte{1: testKeyV1})
+	require.NoError(t, err)
+	locations := NewLocationCipher(keys)
+
+	sealed, err := locations.Seal("caminhao-01", -23.5505, -46.6333)
+	require.NoError(t, err)
+	lat, lon, err := locations.Open("caminhao-01", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, -23.5505, lat)
+	assert.Equal(t, -46.6333, lon)
+
+	_, _, err = locations.Open("caminhao-02", sealed)
+	assert.Error(t, err, "a posição copiada para outro dispositivo não abre")
+}
+
+func TestLocationCipherFromEnv(t *testing.T) {
+	t.Setenv("KEY_PROVIDER", "")
+	t.Setenv("ENCRYPTION_KEYS", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+
+	t.Setenv("GPS_ENCRYPTION", "")
+	locations, err := LocationCipherFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, locations, "desligado por padrão")
+
+	t.Setenv("GPS_ENCRYPTION", "true")
+	_, err = LocationCipherFromEnv()
+	assert.Error(t, err, "ligado sem chave local não sobe")
+
+	t.Setenv("ENCRYPTION_KEY", string(testKeyV1))
+	locations, err = LocationCipherFromEnv()
+	require.NoError(t, err)
+	assert.NotNil(t, locations)
+
+	t.Setenv("GPS_ENCRYPTION", "talvez")
+	_, err = LocationCipherFromEnv()
+	assert.Error(t, err)
+}
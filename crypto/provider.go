@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DataKeySize = 32
+
+// KeyProvider guarda as chaves mestras e embrulha (cifra) as chaves de dados. Cada foto é cifrada com
+// uma chave de dados aleatória e só a versão embrulhada é persistida; a chave mestra nunca sai do provedor.
+type KeyProvider interface {
+	// WrapKey embrulha a chave de dados com a versão atual da chave mestra e informa qual foi usada.
+	WrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, version uint32, err error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+	// CurrentVersion é a versão que WrapKey usa no momento.
+	CurrentVersion(ctx context.Context) (uint32, error)
+}
+
+// NewDataKey gera uma chave AES-256 aleatória.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LocalKeyProvider embrulha as chaves de dados com um Keyring em memória, carregado de variável de
+// ambiente ou de arquivo.
+type LocalKeyProvider struct {
+	keys *Keyring
+}
+
+func NewLocalKeyProvider(keys *Keyring) *LocalKeyProvider {
+	return &LocalKeyProvider{keys: keys}
+}
+
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, uint32, error) {
+	wrapped, err := p.keys.Seal(dataKey)
+	return wrapped, p.keys.Current(), err
+}
+
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return p.keys.Open(wrapped)
+}
+
+func (p *LocalKeyProvider) CurrentVersion(ctx context.Context) (uint32, error) {
+	return p.keys.Current(), nil
+}
+
+// KeyringFromFile lê as chaves de um arquivo, como os secrets do Docker em /run/secrets. O conteúdo
+// segue o formato de ENCRYPTION_KEYS ou é uma única chave de 32 bytes, tratada como versão 1. Espaços e
+// quebras de linha nas pontas são ignorados.
+func KeyringFromFile(path string) (*Keyring, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(string(raw))
+	if len(content) == 32 {
+		return NewKeyring(map[uint32][]byte{1: []byte(content)})
+	}
+	return ParseKeyring(strings.ReplaceAll(content, "\n", ";"))
+}
+
+// KeyProviderFromEnv escolhe o provedor das chaves mestras por KEY_PROVIDER: env (padrão, ENCRYPTION_KEYS
+// ou ENCRYPTION_KEY), file (ENCRYPTION_KEY_FILE) ou vault (VAULT_ADDR, VAULT_TOKEN e VAULT_TRANSIT_KEY).
+// Retorna nil no modo env sem chave configurada.
+func KeyProviderFromEnv() (KeyProvider, error) {
+	switch os.Getenv("KEY_PROVIDER") {
+	case "", "env":
+		keys, err := KeyringFromEnv()
+		if err != nil || keys == nil {
+			return nil, err
+		}
+		return NewLocalKeyProvider(keys), nil
+	case "file":
+		keys, err := keyringFromKeyFile()
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalKeyProvider(keys), nil
+	case "vault":
+		token := os.Getenv("VAULT_TOKEN")
+		if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("falha ao ler VAULT_TOKEN_FILE: %w", err)
+			}
+			token = strings.TrimSpace(string(raw))
+		}
+		if os.Getenv("VAULT_ADDR") == "" || token == "" || os.Getenv("VAULT_TRANSIT_KEY") == "" {
+			return nil, errors.New("VAULT_ADDR, VAULT_TOKEN e VAULT_TRANSIT_KEY são obrigatórios quando KEY_PROVIDER=vault")
+		}
+		return NewVaultTransitProvider(os.Getenv("VAULT_ADDR"), token, os.Getenv("VAULT_TRANSIT_KEY"), nil), nil
+	default:
+		return nil, fmt.Errorf("KEY_PROVIDER inválido: %s", os.Getenv("KEY_PROVIDER"))
+	}
+}
+
+// keyringFromKeyFile lê ENCRYPTION_KEY_FILE (padrão /run/secrets/encryption_key).
+func keyringFromKeyFile() (*Keyring, error) {
+	path := os.Getenv("ENCRYPTION_KEY_FILE")
+	if path == "" {
+		path = "/run/secrets/encryption_key"
+	}
+	keys, err := KeyringFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler chaves de %s: %w", path, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalKeyProvider_WrapsWithCurrentVersion(t *testing.T) {
+	keys, err := NewKeyring(map[uint32][]byte{1: testKeyV1, 2: testKeyV2})
+	require.NoError(t, err)
+	provider := NewLocalKeyProvider(keys)
+	dataKey, err := NewDataKey()
+	require.NoError(t, err)
+
+	wrapped, version, err := provider.WrapKey(context.Background(), dataKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := provider.UnwrapKey(context.Background(), wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+}
+
+func TestKeyringFromFile(t *testing.T) {
+	dir := t.TempDir()
+	single := filepath.Join(dir, "single")
+	require.NoError(t, os.WriteFile(single, append(testKeyV1, '\n'), 0o600))
+	keys, err := KeyringFromFile(single)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), keys.Current(), "uma chave sozinha é a versão 1")
+
+	versioned := filepath.Join(dir, "versioned")
+	require.NoError(t, os.WriteFile(versioned, []byte("1:"+string(testKeyV1)+"\n2:"+string(testKeyV2)+"\n"), 0o600))
+	keys, err = KeyringFromFile(versioned)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), keys.Current())
+
+	_, err = KeyringFromFile(filepath.Join(dir, "ausente"))
+	assert.Error(t, err)
+}
+
+func TestKeyProviderFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEYS", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("KEY_PROVIDER", "")
+	provider, err := KeyProviderFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, provider, "sem chave configurada as fotos não são cifradas")
+
+	path := filepath.Join(t.TempDir(), "encryption_key")
+	require.NoError(t, os.WriteFile(path, testKeyV1, 0o600))
+	t.Setenv("KEY_PROVIDER", "file")
+	t.Setenv("ENCRYPTION_KEY_FILE", path)
+	provider, err = KeyProviderFromEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &LocalKeyProvider{}, provider)
+
+	t.Setenv("KEY_PROVIDER", "vault")
+	t.Setenv("VAULT_ADDR", "http://vault:8200")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	_, err = KeyProviderFromEnv()
+	assert.Error(t, err, "o modo vault exige token")
+
+	t.Setenv("KEY_PROVIDER", "kms")
+	_, err = KeyProviderFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Fluxo cifrado: "CVS" | versão do formato (1 byte) | tamanho do bloco (uint32 big-endian) | prefixo do
+// nonce (7 bytes), seguido dos blocos. Cada bloco de até chunkSize bytes é selado com AES-256-GCM e o
+// nonce prefixo | contador (uint32) | marcador de último bloco (1 byte), como na construção STREAM: um
+// bloco fora de ordem, repetido ou de outro fluxo não abre, e o último bloco só autentica com o marcador,
+// então cortar o fluxo numa fronteira de bloco também é detectado. O cabeçalho e o aad do chamador entram
+// como dados autenticados de todos os blocos.
+const (
+	streamMagic        = "CVS"
+	streamFormat       = 1
+	streamPrefixSize   = 7
+	streamHeaderSize   = len(streamMagic) + 1 + 4 + streamPrefixSize
+	streamTagSize      = 16
+	streamMaxChunkSize = 16 << 20
+
+	// StreamChunkSize é o tamanho do bloco de texto claro usado por NewStreamWriter.
+	StreamChunkSize = 64 << 10
+)
+
+// ErrStreamTruncated indica um fluxo que terminou antes do último bloco.
+var ErrStreamTruncated = errors.New("fluxo cifrado truncado")
+
+var errStreamClosed = errors.New("fluxo cifrado já fechado")
+
+// StreamCiphertextSize é o tamanho exato do fluxo cifrado de size bytes de texto claro, para quem precisa
+// informar o tamanho antes de gravar (ex.: blob.Store.Put).
+func StreamCiphertextSize(size int64) int64 {
+	chunks := max(1, (size+StreamChunkSize-1)/StreamChunkSize)
+	return int64(streamHeaderSize) + size + chunks*streamTagSize
+}
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// StreamWriter cifra o que recebe em blocos e grava em dst. Close sela o último bloco e é obrigatório:
+// sem ele o fluxo fica truncado e não abre.
+type StreamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	buf     []byte
+	out     []byte
+	counter uint32
+	err     error
+}
+
+// NewStreamWriter grava o cabeçalho em dst e retorna o escritor dos blocos. key é uma chave de 32 bytes;
+// aad precisa ser o mesmo na leitura.
+func NewStreamWriter(dst io.Writer, key, aad []byte) (*StreamWriter, error) {
+	return newStreamWriter(dst, key, aad, StreamChunkSize)
+}
+
+func newStreamWriter(dst io.Writer, key, aad []byte, chunkSize int) (*StreamWriter, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	header[len(streamMagic)] = streamFormat
+	binary.BigEndian.PutUint32(header[len(streamMagic)+1:], uint32(chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[streamHeaderSize-streamPrefixSize:]); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &StreamWriter{
+		dst:    dst,
+		aead:   aead,
+		aad:    append(header, aad...),
+		prefix: header[streamHeaderSize-streamPrefixSize:],
+		buf:    make([]byte, 0, chunkSize),
+		out:    make([]byte, 0, chunkSize+streamTagSize),
+	}, nil
+}
+
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// Um bloco cheio só é selado quando chega mais dado: se nada mais vier, ele é o último.
+		if len(w.buf) == cap(w.buf) {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close sela o último bloco, mesmo vazio. Não fecha dst.
+func (w *StreamWriter) Close() error {
+	if w.err != nil {
+		if errors.Is(w.err, errStreamClosed) {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.seal(true); err != nil {
+		return err
+	}
+	w.err = errStreamClosed
+	return nil
+}
+
+func (w *StreamWriter) seal(last bool) error {
+	if w.counter == math.MaxUint32 && !last {
+		w.err = errors.New("fluxo cifrado excede o número máximo de blocos")
+		return w.err
+	}
+	w.out = w.aead.Seal(w.out[:0], streamNonce(w.prefix, w.counter, last), w.buf, w.aad)
+	if _, err := w.dst.Write(w.out); err != nil {
+		w.err = err
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// StreamReader decifra um fluxo de StreamWriter. Cada bloco só é entregue depois de autenticado; um
+// bloco adulterado retorna ErrInvalidEnvelope e um fluxo cortado, ErrStreamTruncated, em vez de io.EOF.
+type StreamReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	chunk   []byte
+	out     []byte
+	plain   []byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+// NewStreamReader lê e confere o cabeçalho de src.
+func NewStreamReader(src io.Reader, key, aad []byte) (*StreamReader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrStreamTruncated
+		}
+		return nil, err
+	}
+	if string(header[:len(streamMagic)]) != streamMagic || header[len(streamMagic)] != streamFormat {
+		return nil, ErrInvalidEnvelope
+	}
+	chunkSize := binary.BigEndian.Uint32(header[len(streamMagic)+1:])
+	if chunkSize == 0 || chunkSize > streamMaxChunkSize {
+		return nil, fmt.Errorf("%w: tamanho de bloco %d", ErrInvalidEnvelope, chunkSize)
+	}
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamReader{
+		src:    bufio.NewReaderSize(src, int(chunkSize)+streamTagSize+1),
+		aead:   aead,
+		aad:    append(header, aad...),
+		prefix: header[streamHeaderSize-streamPrefixSize:],
+		chunk:  make([]byte, int(chunkSize)+streamTagSize),
+		out:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (r *StreamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next lê e abre o próximo bloco. O último é o que termina junto com src.
+func (r *StreamReader) next() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n < streamTagSize {
+		return ErrStreamTruncated
+	}
+	last := n < len(r.chunk)
+	if !last {
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	// A saída não reaproveita chunk: em caso de falha o GCM zera o destino, e o bloco ainda é usado abaixo.
+	plain, err := r.aead.Open(r.out[:0], streamNonce(r.prefix, r.counter, last), r.chunk[:n], r.aad)
+	if err != nil {
+		// O bloco é íntegro, mas não era o último: o fluxo foi cortado numa fronteira de bloco.
+		if last {
+			if _, err := r.aead.Open(nil, streamNonce(r.prefix, r.counter, false), r.chunk[:n], r.aad); err == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return fmt.Errorf("%w: bloco %d não autenticado", ErrInvalidEnvelope, r.counter)
+	}
+	r.plain = plain
+	r.counter++
+	r.done = last
+	return nil
+}
@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sealStream(t *testing.T, plaintext []byte, chunkSize int, aad []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := newStreamWriter(&sealed, testKeyV1, aad, chunkSize)
+	require.NoError(t, err)
+	// Escritas pequenas e irregulares, para não coincidirem com as fronteiras dos blocos.
+	for rest := plaintext; len(rest) > 0; {
+		n := min(len(rest), 7)
+		_, err := w.Write(rest[:n])
+		require.NoError(t, err)
+		rest = rest[n:]
+	}
+	require.NoError(t, w.Close())
+	return sealed.Bytes()
+}
+
+func openStream(sealed []byte, aad []byte) ([]byte, error) {
+	r, err := NewStreamReader(bytes.NewReader(sealed), testKeyV1, aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	const chunk = 16
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3 * chunk, 3*chunk + 5} {
+		plaintext := bytes.Repeat([]byte{'x'}, size)
+		sealed := sealStream(t, plaintext, chunk, []byte("foto-1"))
+
+		opened, err := openStream(sealed, []byte("foto-1"))
+		require.NoError(t, err, "tamanho %d", size)
+		assert.Equal(t, plaintext, opened)
+	}
+}
+
+func TestStream_CiphertextSize(t *testing.T) {
+	for _, size := range []int{0, 1, StreamChunkSize, StreamChunkSize + 1, 3 * StreamChunkSize} {
+		var sealed bytes.Buffer
+		w, err := NewStreamWriter(&sealed, testKeyV1, nil)
+		require.NoError(t, err)
+		_, err = w.Write(make([]byte, size))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, StreamCiphertextSize(int64(size)), int64(sealed.Len()), "tamanho %d", size)
+	}
+}
+
+func TestStream_DetectsTampering(t *testing.T) {
+	const chunk = 16
+	plaintext := bytes.Repeat([]byte("0123456789"), 5)
+	sealed := sealStream(t, plaintext, chunk, []byte("foto-1"))
+	block := chunk + streamTagSize
+
+	t.Run("truncado numa fronteira de bloco", func(t *testing.T) {
+		_, err := openStream(sealed[:streamHeaderSize+2*block], []byte("foto-1"))
+		assert.ErrorIs(t, err, ErrStreamTruncated)
+	})
+	t.Run("só o cabeçalho", func(t *testing.T) {
+		_, err := openStream(sealed[:streamHeaderSize], []byte("foto-1"))
+		assert.ErrorIs(t, err, ErrStreamTruncated)
+	})
+	t.Run("truncado no meio de um bloco", func(t *testing.T) {
+		_, err := openStream(sealed[:streamHeaderSize+block+5], []byte("foto-1"))
+		assert.Error(t, err)
+	})
+	t.Run("byte alterado", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		tampered[streamHeaderSize+block+3] ^= 1
+		_, err := openStream(tampered, []byte("foto-1"))
+		assert.ErrorIs(t, err, ErrInvalidEnvelope)
+	})
+	t.Run("blocos trocados de posição", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		first := tampered[streamHeaderSize : streamHeaderSize+block]
+		second := tampered[streamHeaderSize+block : streamHeaderSize+2*block]
+		swapped := append(bytes.Clone(second), first...)
+		copy(tampered[streamHeaderSize:], swapped)
+		_, err := openStream(tampered, []byte("foto-1"))
+		assert.ErrorIs(t, err, ErrInvalidEnvelope)
+	})
+	t.Run("dados depois do último bloco", func(t *testing.T) {
+		_, err := openStream(append(bytes.Clone(sealed), sealed[streamHeaderSize:streamHeaderSize+block]...), []byte("foto-1"))
+		assert.Error(t, err)
+	})
+	t.Run("outro aad", func(t *testing.T) {
+		_, err := openStream(sealed, []byte("foto-2"))
+		assert.ErrorIs(t, err, ErrInvalidEnvelope)
+	})
+}
+
+func TestStream_NoPlaintextBeforeAuthentication(t *testing.T) {
+	sealed := sealStream(t, []byte("segredo"), 16, nil)
+	sealed[len(sealed)-1] ^= 1
+
+	r, err := NewStreamReader(bytes.NewReader(sealed), testKeyV1, nil)
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, err := r.Read(buf)
+	assert.Zero(t, n)
+	assert.ErrorIs(t, err, ErrInvalidEnvelope)
+}
@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VaultTransitProvider usa o engine transit do Vault (ou qualquer serviço com a mesma API) para
+// embrulhar as chaves de dados. A versão da chave mestra vem no próprio texto cifrado ("vault:v3:...").
+type VaultTransitProvider struct {
+	addr    string
+	token   string
+	keyName string
+	client  *http.Client
+}
+
+// NewVaultTransitProvider usa um cliente com timeout de 10s quando client é nil.
+func NewVaultTransitProvider(addr, token, keyName string, client *http.Client) *VaultTransitProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &VaultTransitProvider{addr: strings.TrimRight(addr, "/"), token: token, keyName: keyName, client: client}
+}
+
+func (p *VaultTransitProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, uint32, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	in := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := p.call(ctx, http.MethodPost, "encrypt", in, &out); err != nil {
+		return nil, 0, err
+	}
+	version, err := vaultCiphertextVersion(out.Ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+	return []byte(out.Ciphertext), version, nil
+}
+
+func (p *VaultTransitProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := p.call(ctx, http.MethodPost, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+func (p *VaultTransitProvider) CurrentVersion(ctx context.Context) (uint32, error) {
+	var out struct {
+		LatestVersion uint32 `json:"latest_version"`
+	}
+	if err := p.call(ctx, http.MethodGet, "keys", nil, &out); err != nil {
+		return 0, err
+	}
+	return out.LatestVersion, nil
+}
+
+// call faz a requisição em /v1/transit/<operação>/<chave> e decodifica o campo "data" da resposta.
+func (p *VaultTransitProvider) call(ctx context.Context, method, operation string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	endpoint := fmt.Sprintf("%s/v1/transit/%s/%s", p.addr, operation, url.PathEscape(p.keyName))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("falha ao chamar o vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("resposta inválida do vault: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault respondeu %d em transit/%s: %s", resp.StatusCode, operation, strings.Join(envelope.Errors, "; "))
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// vaultCiphertextVersion lê a versão de "vault:v<N>:<base64>".
+func vaultCiphertextVersion(ciphertext string) (uint32, error) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, fmt.Errorf("texto cifrado do vault em formato inesperado")
+	}
+	version, err := strconv.ParseUint(parts[1][1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("versão inválida no texto cifrado do vault: %w", err)
+	}
+	return uint32(version), nil
+}
@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransit imita as rotas do engine transit usadas pelo provedor. O "texto cifrado" é só o plaintext
+// com o prefixo de versão, o que basta para conferir o protocolo.
+func fakeTransit(t *testing.T, version int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token-teste" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		var in map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		var data any
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/transit/encrypt/fotos":
+			data = map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:%s", version, in["plaintext"])}
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/transit/decrypt/fotos":
+			parts := strings.SplitN(in["ciphertext"], ":", 3)
+			data = map[string]string{"plaintext": parts[2]}
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/transit/keys/fotos":
+			data = map[string]int{"latest_version": version}
+		default:
+			t.Errorf("rota inesperada: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+}
+
+func TestVaultTransitProvider_RoundTrip(t *testing.T) {
+	server := fakeTransit(t, 3)
+	defer server.Close()
+	provider := NewVaultTransitProvider(server.URL+"/", "token-teste", "fotos", server.Client())
+	dataKey, err := NewDataKey()
+	require.NoError(t, err)
+
+	wrapped, version, err := provider.WrapKey(context.Background(), dataKey)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), version)
+	assert.Equal(t, "vault:v3:"+base64.StdEncoding.EncodeToString(dataKey), string(wrapped))
+
+	unwrapped, err := provider.UnwrapKey(context.Background(), wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	current, err := provider.CurrentVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), current)
+}
+
+func TestVaultTransitProvider_Errors(t *testing.T) {
+	server := fakeTransit(t, 1)
+	defer server.Close()
+
+	_, _, err := NewVaultTransitProvider(server.URL, "outro-token", "fotos", server.Client()).WrapKey(context.Background(), []byte("k"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+
+	_, err = vaultCiphertextVersion("v1:abc")
+	assert.Error(t, err)
+}
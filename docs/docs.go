@@ -9,19 +9,1068 @@ const docTemplate = `{
     "info": {
         "description": "{{escape .Description}}",
         "title": "{{.Title}}",
-        "contact": {
-            "name": "API Support",
-            "email": "support@exemplo.com"
-        },
-        "license": {
-            "name": "Apache 2.0",
-            "url": "http://www.apache.org/licenses/LICENSE-2.0.html"
-        },
+        "contact": {},
         "version": "{{.Version}}"
     },
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/audit": {
+            "get": {
+                "description": "Busca no audit_log por ator, ação, intervalo e campos de details (details.\u003ccampo\u003e=\u003cvalor\u003e, com o valor em JSON ou texto), das linhas mais novas para as mais antigas. Em JSON a resposta é paginada: repita a busca com cursor=next_cursor. Com format=csv ou ndjson, transmite todas as linhas do filtro, sem paginação. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; cada busca é registrada no audit_log (AUDIT_LOG_QUERIED).",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Audit"
+                ],
+                "summary": "Busca eventos de auditoria",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ator",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ação (ex.: PHOTO_VIEWED)",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Início (RFC3339), padrão: 24h antes de 'to'",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fim (RFC3339), padrão: agora",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Linhas por página em JSON (padrão: 100, máximo: 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor da página anterior",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json, csv ou ndjson (padrão: json)",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.AuditPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/data-subject-requests": {
+            "post": {
+                "description": "Enfileira a exportação (export), eliminação (erase) ou anonimização (anonymize) dos dados de um dispositivo (subject_type=device) ou de um motorista (subject_type=driver), que alcança os dispositivos em que ele foi reconhecido e o cadastro dele. O worker executa o pedido: a exportação gera um zip com gps, gyroscope, metadados e imagens decifradas das fotos e as linhas do audit_log do titular; a eliminação e a anonimização também apagam as imagens e os rostos indexados no Rekognition. Ao final o pedido recebe um registro de conclusão assinado. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a abertura é registrada no audit_log (DATA_SUBJECT_REQUEST_CREATED).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DataSubjects"
+                ],
+                "summary": "Abre um pedido de titular (LGPD)",
+                "parameters": [
+                    {
+                        "description": "Titular e ação",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.DataSubjectRequestInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.DataSubjectRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/data-subject-requests/{id}": {
+            "get": {
+                "description": "Retorna o status do pedido, o local do arquivo exportado (ou da cópia do registro de conclusão) e o registro de conclusão assinado, que pode ser conferido com \"audit record\". Exige uma chave de PRIVILEGED_API_KEYS com papel admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DataSubjects"
+                ],
+                "summary": "Consulta um pedido de titular (LGPD)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID do pedido",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DataSubjectRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{id}/photos": {
+            "get": {
+                "description": "Retorna os metadados das fotos no intervalo (sem a imagem), com o rosto reconhecido em cada uma: face_id e similarity do Rekognition e driver_id do motorista associado ao rosto. Fotos sem rosto reconhecido vêm sem esses campos; driver_id também fica ausente quando o rosto não está associado a um motorista. O intervalo é de no máximo 31 dias. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Photos"
+                ],
+                "summary": "Lista as fotos de um dispositivo",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do dispositivo",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Início (RFC3339), padrão: 24h antes de 'to'",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fim (RFC3339), padrão: agora",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DevicePhotos"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{id}/stats": {
+            "get": {
+                "description": "Retorna, por minuto ou por hora, a contagem de pontos, distância percorrida, área coberta e magnitude do giroscópio. Com resolution=auto (padrão), intervalos de até 2h são calculados dos dados brutos, até 7 dias usam os rollups por minuto e acima disso os rollups por hora. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tracks"
+                ],
+                "summary": "Telemetria agregada por intervalo de tempo",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do dispositivo",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Início (RFC3339), padrão: 24h antes de 'to'",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fim (RFC3339), padrão: agora",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "auto, raw, minute ou hour",
+                        "name": "resolution",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.TelemetryStats"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{id}/track": {
+            "get": {
+                "description": "Transmite as leituras de GPS armazenadas no formato GPX, KML ou GeoJSON. Intervalos de mais de 10 minutos sem leituras separam as viagens. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/gpx+xml",
+                    "application/vnd.google-earth.kml+xml",
+                    "application/geo+json"
+                ],
+                "tags": [
+                    "Tracks"
+                ],
+                "summary": "Exporta o trajeto de um dispositivo",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do dispositivo",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Início (RFC3339), padrão: 24h antes de 'to'",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fim (RFC3339), padrão: agora",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "gpx, kml ou geojson (padrão: geojson)",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/drivers/{id}": {
+            "get": {
+                "description": "Retorna o cadastro do motorista e os rostos da coleção associados a ele. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drivers"
+                ],
+                "summary": "Consulta um motorista",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do motorista",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Driver"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Cria o motorista com o id informado ou atualiza o nome de um já cadastrado. face_ids associa rostos já indexados na coleção do Rekognition ao motorista (associações anteriores são mantidas); rostos indexados com ExternalImageId igual ao id do motorista o identificam sem associação. As fotos processadas a partir daí passam a registrar o motorista reconhecido. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a alteração é registrada no audit_log (DRIVER_SAVED).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drivers"
+                ],
+                "summary": "Cadastra ou atualiza um motorista",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do motorista",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Nome e rostos associados",
+                        "name": "driver",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.DriverInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Driver"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/drivers/{id}/faces": {
+            "get": {
+                "description": "Retorna os rostos da coleção associados ao motorista, com a origem: enrolled (foto de referência cadastrada) ou associated (rosto que já estava na coleção). Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drivers"
+                ],
+                "summary": "Lista os rostos de um motorista",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do motorista",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DriverFace"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Confere a foto (um único rosto, de frente, nítido e iluminado) e indexa o rosto na coleção do Rekognition com ExternalImageId igual ao id do motorista. A imagem não é guardada, só o rosto indexado. Fotos recusadas pela conferência ou pelo filtro de qualidade do Rekognition retornam 422 com o motivo. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; o cadastro é registrado no audit_log (DRIVER_FACE_ENROLLED).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drivers"
+                ],
+                "summary": "Cadastra uma foto de referência do motorista",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do motorista",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Foto de referência em base64",
+                        "name": "photo",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FaceEnrollmentInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.DriverFace"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/drivers/{id}/faces/{faceId}": {
+            "delete": {
+                "description": "Apaga o rosto da coleção do Rekognition e a associação com o motorista; as fotos já processadas mantêm o driver_id gravado. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a remoção é registrada no audit_log (DRIVER_FACE_REMOVED).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drivers"
+                ],
+                "summary": "Remove um rosto do motorista",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do motorista",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "FaceId do rosto",
+                        "name": "faceId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/exports": {
+            "post": {
+                "description": "Enfileira a exportação de gps, gyroscope ou metadados de photo (nunca as imagens) em CSV ou Parquet. O worker executa o job e grava o arquivo no destino configurado. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exports"
+                ],
+                "summary": "Cria um job de exportação de dados",
+                "parameters": [
+                    {
+                        "description": "Filtros da exportação",
+                        "name": "export",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ExportRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.ExportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/exports/{id}": {
+            "get": {
+                "description": "Retorna o status e o destino do arquivo. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Exports"
+                ],
+                "summary": "Consulta um job de exportação",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID do job",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ExportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/live/positions": {
+            "get": {
+                "description": "Abre um stream Server-Sent Events com a última posição de cada dispositivo (as recebidas há mais de 10 minutos não são enviadas na conexão). Filtre por frota ou lista de dispositivos; cada dispositivo é enviado no máximo uma vez por intervalo. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin; como o EventSource dos navegadores não envia cabeçalhos, só esta rota aceita a chave no parâmetro api_key.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Live"
+                ],
+                "summary": "Feed de posições em tempo real (SSE)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Nome da frota",
+                        "name": "fleet",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Lista de device_id separados por vírgula",
+                        "name": "devices",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Intervalo mínimo entre atualizações de um mesmo dispositivo",
+                        "name": "interval_ms",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.GPSData"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/photos/{id}": {
+            "get": {
+                "description": "Decifra e transmite a imagem original. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin; cada acesso é registrado no audit_log com quem acessou e o motivo informado.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png"
+                ],
+                "tags": [
+                    "Photos"
+                ],
+                "summary": "Consulta a imagem de uma foto",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID da foto",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Motivo do acesso (ex.: número do incidente)",
+                        "name": "reason",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/telemetry/areas": {
+            "get": {
+                "description": "Conta leituras e dispositivos por célula de geohash no intervalo, a partir da coluna geohash gravada em claro. Funciona também com a cifragem das coordenadas ligada (GPS_ENCRYPTION), sem expor as posições exatas. Leituras gravadas antes da coluna existir não entram. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tracks"
+                ],
+                "summary": "Leituras de GPS por célula de geohash",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID do dispositivo (vazio para todos)",
+                        "name": "device_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Início (RFC3339), padrão: 24h antes de 'to'",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fim (RFC3339), padrão: agora",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Caracteres do geohash, de 1 a 6 (padrão: 5, células de cerca de 5 km)",
+                        "name": "precision",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.GPSAreas"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/telemetry/gps": {
             "post": {
                 "description": "Recebe um payload JSON com os dados de GPS, valida, e publica em uma fila NATS para processamento assíncrono.",
@@ -171,6 +1220,198 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "models.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "details": {
+                    "type": "object"
+                },
+                "hash": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "hmac": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "prev_hash": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "seq": {
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.AuditPage": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AuditEntry"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DataSubjectRequest": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Reason registra a base do pedido (ex.: protocolo do atendimento ao titular).",
+                    "type": "string"
+                },
+                "record": {
+                    "type": "object"
+                },
+                "requested_by": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subject_id": {
+                    "type": "string"
+                },
+                "subject_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DataSubjectRequestInput": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Reason registra a base do pedido (ex.: protocolo do atendimento ao titular).",
+                    "type": "string"
+                },
+                "subject_id": {
+                    "type": "string"
+                },
+                "subject_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DevicePhotos": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "photos": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PhotoMetadata"
+                    }
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Driver": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "face_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DriverFace": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "driver_id": {
+                    "type": "string"
+                },
+                "face_id": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DriverInput": {
+            "type": "object",
+            "properties": {
+                "face_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
         "models.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -179,6 +1420,124 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ExportJob": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "dataset": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "location": {
+                    "type": "string"
+                },
+                "requested_by": {
+                    "type": "string"
+                },
+                "rows": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ExportRequest": {
+            "type": "object",
+            "properties": {
+                "dataset": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FaceEnrollmentInput": {
+            "type": "object",
+            "properties": {
+                "photo": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.GPSArea": {
+            "type": "object",
+            "properties": {
+                "devices": {
+                    "type": "integer"
+                },
+                "first_seen": {
+                    "type": "string"
+                },
+                "geohash": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.GPSAreas": {
+            "type": "object",
+            "properties": {
+                "areas": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.GPSArea"
+                    }
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "precision": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
         "models.GPSData": {
             "type": "object",
             "properties": {
@@ -216,6 +1575,32 @@ const docTemplate = `{
                 }
             }
         },
+        "models.PhotoMetadata": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string"
+                },
+                "driver_id": {
+                    "type": "string"
+                },
+                "face_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "recognized": {
+                    "type": "boolean"
+                },
+                "similarity": {
+                    "type": "number"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
         "models.PhotoRequest": {
             "type": "object",
             "properties": {
@@ -229,6 +1614,70 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "models.TelemetryRollup": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "distance_meters": {
+                    "type": "number"
+                },
+                "gps_points": {
+                    "type": "integer"
+                },
+                "gyroscope_avg_magnitude": {
+                    "type": "number"
+                },
+                "gyroscope_max_magnitude": {
+                    "type": "number"
+                },
+                "gyroscope_min_magnitude": {
+                    "type": "number"
+                },
+                "gyroscope_points": {
+                    "type": "integer"
+                },
+                "max_latitude": {
+                    "type": "number"
+                },
+                "max_longitude": {
+                    "type": "number"
+                },
+                "min_latitude": {
+                    "type": "number"
+                },
+                "min_longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.TelemetryStats": {
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TelemetryRollup"
+                    }
+                },
+                "device_id": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "resolution": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
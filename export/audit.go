@@ -0,0 +1,63 @@
+package export
+
+import (
+	"challenge-v3/models"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// AuditRow é uma linha exportada do audit_log. Hash permite conferir a linha contra a cadeia.
+type AuditRow struct {
+	ID        int64           `json:"id"`
+	Seq       int64           `json:"seq"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details"`
+	Hash      string          `json:"hash"`
+}
+
+func NewAuditRow(e models.AuditEntry) AuditRow {
+	details := e.Details
+	if len(details) == 0 {
+		details = json.RawMessage("null")
+	}
+	return AuditRow{ID: e.ID, Seq: e.Seq, Timestamp: e.Timestamp, Actor: e.Actor, Action: e.Action, Details: details, Hash: hex.EncodeToString(e.Hash)}
+}
+
+func (AuditRow) CSVHeader() []string {
+	return []string{"id", "seq", "timestamp", "actor", "action", "details", "hash"}
+}
+
+func (r AuditRow) CSVRecord() []string {
+	return []string{strconv.FormatInt(r.ID, 10), strconv.FormatInt(r.Seq, 10), formatTime(r.Timestamp), r.Actor, r.Action, string(r.Details), r.Hash}
+}
+
+// NewAuditWriter grava as linhas em csv (details como texto JSON numa coluna) ou ndjson (um objeto
+// por linha).
+func NewAuditWriter(format string, w io.Writer) (DatasetWriter[AuditRow], error) {
+	switch format {
+	case "csv":
+		return NewDatasetWriter[AuditRow](format, w)
+	case "ndjson":
+		return &ndjsonWriter[AuditRow]{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("formato de exportação não suportado: %s", format)
+	}
+}
+
+type ndjsonWriter[T any] struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) Write(row T) error {
+	return n.enc.Encode(row)
+}
+
+func (n *ndjsonWriter[T]) Close() error {
+	return nil
+}
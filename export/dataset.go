@@ -0,0 +1,160 @@
+package export
+
+import (
+	"challenge-v3/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Row é uma linha exportável, com a mesma estrutura em CSV e Parquet.
+type Row interface {
+	CSVHeader() []string
+	CSVRecord() []string
+}
+
+type GPSRow struct {
+	DeviceID  string    `parquet:"device_id"`
+	Latitude  float64   `parquet:"latitude"`
+	Longitude float64   `parquet:"longitude"`
+	Speed     *float64  `parquet:"speed,optional"`
+	Heading   *float64  `parquet:"heading,optional"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+}
+
+func NewGPSRow(d models.GPSData) GPSRow {
+	return GPSRow{DeviceID: d.DeviceID, Latitude: *d.Latitude, Longitude: *d.Longitude, Speed: d.Speed, Heading: d.Heading, Timestamp: d.Timestamp}
+}
+
+func (GPSRow) CSVHeader() []string {
+	return []string{"device_id", "latitude", "longitude", "speed", "heading", "timestamp"}
+}
+
+func (r GPSRow) CSVRecord() []string {
+	return []string{r.DeviceID, formatCoord(r.Latitude), formatCoord(r.Longitude), formatOptional(r.Speed), formatOptional(r.Heading), formatTime(r.Timestamp)}
+}
+
+type GyroscopeRow struct {
+	DeviceID  string    `parquet:"device_id"`
+	X         float64   `parquet:"x"`
+	Y         float64   `parquet:"y"`
+	Z         float64   `parquet:"z"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+}
+
+func NewGyroscopeRow(d models.GyroscopeData) GyroscopeRow {
+	return GyroscopeRow{DeviceID: d.DeviceID, X: *d.X, Y: *d.Y, Z: *d.Z, Timestamp: d.Timestamp}
+}
+
+func (GyroscopeRow) CSVHeader() []string {
+	return []string{"device_id", "x", "y", "z", "timestamp"}
+}
+
+func (r GyroscopeRow) CSVRecord() []string {
+	return []string{r.DeviceID, formatCoord(r.X), formatCoord(r.Y), formatCoord(r.Z), formatTime(r.Timestamp)}
+}
+
+type PhotoRow struct {
+	ID         int64     `parquet:"id"`
+	DeviceID   string    `parquet:"device_id"`
+	Recognized bool      `parquet:"recognized"`
+	DriverID   string    `parquet:"driver_id,optional"`
+	FaceID     string    `parquet:"face_id,optional"`
+	Similarity *float64  `parquet:"similarity,optional"`
+	Timestamp  time.Time `parquet:"timestamp,timestamp(millisecond)"`
+}
+
+func NewPhotoRow(m models.PhotoMetadata) PhotoRow {
+	return PhotoRow{ID: m.ID, DeviceID: m.DeviceID, Recognized: m.Recognized, DriverID: m.DriverID, FaceID: m.FaceID,
+		Similarity: m.Similarity, Timestamp: m.Timestamp}
+}
+
+func (PhotoRow) CSVHeader() []string {
+	return []string{"id", "device_id", "recognized", "driver_id", "face_id", "similarity", "timestamp"}
+}
+
+func (r PhotoRow) CSVRecord() []string {
+	return []string{strconv.FormatInt(r.ID, 10), r.DeviceID, strconv.FormatBool(r.Recognized), r.DriverID, r.FaceID,
+		formatOptional(r.Similarity), formatTime(r.Timestamp)}
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatCoord(*v)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+type DatasetWriter[T Row] interface {
+	Write(row T) error
+	Close() error
+}
+
+func NewDatasetWriter[T Row](format string, w io.Writer) (DatasetWriter[T], error) {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		var zero T
+		if err := cw.Write(zero.CSVHeader()); err != nil {
+			return nil, err
+		}
+		return &csvWriter[T]{w: cw}, nil
+	case "parquet":
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w)}, nil
+	default:
+		return nil, fmt.Errorf("formato de exportação não suportado: %s", format)
+	}
+}
+
+type csvWriter[T Row] struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter[T]) Write(row T) error {
+	return c.w.Write(row.CSVRecord())
+}
+
+func (c *csvWriter[T]) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+const parquetBatchSize = 1024
+
+// parquetWriter acumula as linhas em lotes pequenos; o parquet-go grava os row groups à medida que enchem.
+type parquetWriter[T Row] struct {
+	w     *parquet.GenericWriter[T]
+	batch []T
+}
+
+func (p *parquetWriter[T]) Write(row T) error {
+	p.batch = append(p.batch, row)
+	if len(p.batch) < parquetBatchSize {
+		return nil
+	}
+	return p.flush()
+}
+
+func (p *parquetWriter[T]) flush() error {
+	if len(p.batch) == 0 {
+		return nil
+	}
+	_, err := p.w.Write(p.batch)
+	p.batch = p.batch[:0]
+	return err
+}
+
+func (p *parquetWriter[T]) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
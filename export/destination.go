@@ -0,0 +1,123 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Object é um arquivo de exportação em escrita. Só fica visível no destino após Commit; o contexto de Commit
+// limita o envio, que num bucket é a parte demorada.
+type Object interface {
+	io.Writer
+	Commit(ctx context.Context) (location string, err error)
+	Abort()
+}
+
+type Destination interface {
+	Create(name string) (Object, error)
+}
+
+type LocalDestination struct {
+	Dir string
+}
+
+func NewLocalDestination(dir string) (*LocalDestination, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("não foi possível criar o diretório de exportação: %w", err)
+	}
+	return &LocalDestination{Dir: dir}, nil
+}
+
+func (d *LocalDestination) Create(name string) (Object, error) {
+	finalPath := filepath.Join(d.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0o750); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(finalPath), filepath.Base(finalPath)+".*.partial")
+	if err != nil {
+		return nil, err
+	}
+	return &localObject{File: file, finalPath: finalPath}, nil
+}
+
+type localObject struct {
+	*os.File
+	finalPath string
+}
+
+func (o *localObject) Commit(ctx context.Context) (string, error) {
+	if err := o.File.Close(); err != nil {
+		os.Remove(o.File.Name())
+		return "", err
+	}
+	if err := os.Rename(o.File.Name(), o.finalPath); err != nil {
+		os.Remove(o.File.Name())
+		return "", err
+	}
+	return "file://" + o.finalPath, nil
+}
+
+func (o *localObject) Abort() {
+	o.File.Close()
+	os.Remove(o.File.Name())
+}
+
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Destination grava em um bucket compatível com S3 (AWS ou MinIO). O arquivo é montado em disco
+// temporário e enviado no Commit, pois o PutObject precisa de um corpo com tamanho conhecido.
+type S3Destination struct {
+	client S3Client
+	bucket string
+	prefix string
+}
+
+func NewS3Destination(client S3Client, bucket, prefix string) *S3Destination {
+	return &S3Destination{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (d *S3Destination) Create(name string) (Object, error) {
+	file, err := os.CreateTemp("", "export-*.partial")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{File: file, dest: d, key: path.Join(d.prefix, name)}, nil
+}
+
+type s3Object struct {
+	*os.File
+	dest *S3Destination
+	key  string
+}
+
+func (o *s3Object) Commit(ctx context.Context) (string, error) {
+	defer os.Remove(o.File.Name())
+	defer o.File.Close()
+
+	if _, err := o.File.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	_, err := o.dest.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(o.dest.bucket),
+		Key:    aws.String(o.key),
+		Body:   o.File,
+	})
+	if err != nil {
+		return "", fmt.Errorf("falha ao enviar exportação para o bucket: %w", err)
+	}
+	return fmt.Sprintf("s3://%s/%s", o.dest.bucket, o.key), nil
+}
+
+func (o *s3Object) Abort() {
+	o.File.Close()
+	os.Remove(o.File.Name())
+}
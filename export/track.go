@@ -0,0 +1,256 @@
+package export
+
+import (
+	"challenge-v3/models"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackEncoder escreve um trajeto de forma incremental, sem manter os pontos em memória.
+type TrackEncoder interface {
+	ContentType() string
+	Extension() string
+	Begin(deviceID string) error
+	BeginTrip(index int, start time.Time) error
+	Point(p models.GPSData) error
+	EndTrip(end time.Time) error
+	End() error
+}
+
+func NewTrackEncoder(format string, w io.Writer) (TrackEncoder, error) {
+	switch strings.ToLower(format) {
+	case "gpx":
+		return &gpxEncoder{w: w}, nil
+	case "kml":
+		return &kmlEncoder{w: w}, nil
+	case "geojson":
+		return &geoJSONEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("formato de trajeto não suportado: %s", format)
+	}
+}
+
+// TrackWriter separa os pontos em viagens sempre que o intervalo entre duas leituras ultrapassa tripGap.
+type TrackWriter struct {
+	enc      TrackEncoder
+	tripGap  time.Duration
+	trips    int
+	inTrip   bool
+	lastSeen time.Time
+}
+
+func NewTrackWriter(enc TrackEncoder, deviceID string, tripGap time.Duration) (*TrackWriter, error) {
+	if err := enc.Begin(deviceID); err != nil {
+		return nil, err
+	}
+	return &TrackWriter{enc: enc, tripGap: tripGap}, nil
+}
+
+func (t *TrackWriter) Write(p models.GPSData) error {
+	if t.inTrip && t.tripGap > 0 && p.Timestamp.Sub(t.lastSeen) > t.tripGap {
+		if err := t.enc.EndTrip(t.lastSeen); err != nil {
+			return err
+		}
+		t.inTrip = false
+	}
+	if !t.inTrip {
+		t.trips++
+		if err := t.enc.BeginTrip(t.trips, p.Timestamp); err != nil {
+			return err
+		}
+		t.inTrip = true
+	}
+	t.lastSeen = p.Timestamp
+	return t.enc.Point(p)
+}
+
+func (t *TrackWriter) Close() error {
+	if t.inTrip {
+		if err := t.enc.EndTrip(t.lastSeen); err != nil {
+			return err
+		}
+		t.inTrip = false
+	}
+	return t.enc.End()
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type gpxEncoder struct {
+	w io.Writer
+}
+
+func (e *gpxEncoder) ContentType() string { return "application/gpx+xml" }
+func (e *gpxEncoder) Extension() string   { return "gpx" }
+
+func (e *gpxEncoder) Begin(deviceID string) error {
+	_, err := fmt.Fprintf(e.w, "%s<gpx version=\"1.1\" creator=\"challenge-v3\" xmlns=\"http://www.topografix.com/GPX/1/1\">\n<trk>\n<name>%s</name>\n",
+		xml.Header, escapeXML(deviceID))
+	return err
+}
+
+// No GPX cada viagem vira um trkseg, que representa uma interrupção no registro do trajeto.
+func (e *gpxEncoder) BeginTrip(int, time.Time) error {
+	_, err := io.WriteString(e.w, "<trkseg>\n")
+	return err
+}
+
+func (e *gpxEncoder) Point(p models.GPSData) error {
+	_, err := fmt.Fprintf(e.w, "<trkpt lat=\"%s\" lon=\"%s\"><time>%s</time></trkpt>\n",
+		formatCoord(*p.Latitude), formatCoord(*p.Longitude), p.Timestamp.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *gpxEncoder) EndTrip(time.Time) error {
+	_, err := io.WriteString(e.w, "</trkseg>\n")
+	return err
+}
+
+func (e *gpxEncoder) End() error {
+	_, err := io.WriteString(e.w, "</trk>\n</gpx>\n")
+	return err
+}
+
+type kmlEncoder struct {
+	w io.Writer
+}
+
+func (e *kmlEncoder) ContentType() string { return "application/vnd.google-earth.kml+xml" }
+func (e *kmlEncoder) Extension() string   { return "kml" }
+
+func (e *kmlEncoder) Begin(deviceID string) error {
+	_, err := fmt.Fprintf(e.w, "%s<kml xmlns=\"http://www.opengis.net/kml/2.2\">\n<Document>\n<name>%s</name>\n",
+		xml.Header, escapeXML(deviceID))
+	return err
+}
+
+func (e *kmlEncoder) BeginTrip(index int, start time.Time) error {
+	_, err := fmt.Fprintf(e.w, "<Placemark>\n<name>Viagem %d</name>\n<description>Início: %s</description>\n<LineString>\n<tessellate>1</tessellate>\n<coordinates>\n",
+		index, start.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *kmlEncoder) Point(p models.GPSData) error {
+	_, err := fmt.Fprintf(e.w, "%s,%s,0\n", formatCoord(*p.Longitude), formatCoord(*p.Latitude))
+	return err
+}
+
+func (e *kmlEncoder) EndTrip(time.Time) error {
+	_, err := io.WriteString(e.w, "</coordinates>\n</LineString>\n</Placemark>\n")
+	return err
+}
+
+func (e *kmlEncoder) End() error {
+	_, err := io.WriteString(e.w, "</Document>\n</kml>\n")
+	return err
+}
+
+type geoJSONEncoder struct {
+	w         io.Writer
+	deviceID  string
+	tripIndex int
+	tripStart time.Time
+	firstTrip bool
+	// points conta os pontos da viagem aberta; o primeiro fica em first até se saber se a viagem
+	// vira um LineString (dois pontos ou mais) ou um Point, já que a RFC 7946 não aceita LineString
+	// de uma posição só.
+	points int
+	first  models.GPSData
+}
+
+func (e *geoJSONEncoder) ContentType() string { return "application/geo+json" }
+func (e *geoJSONEncoder) Extension() string   { return "geojson" }
+
+func (e *geoJSONEncoder) Begin(deviceID string) error {
+	e.deviceID = deviceID
+	e.firstTrip = true
+	_, err := io.WriteString(e.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (e *geoJSONEncoder) BeginTrip(index int, start time.Time) error {
+	e.tripIndex, e.tripStart, e.points = index, start, 0
+	return nil
+}
+
+func (e *geoJSONEncoder) beginFeature(geometry string) error {
+	prefix := ","
+	if e.firstTrip {
+		prefix = ""
+		e.firstTrip = false
+	}
+	_, err := fmt.Fprintf(e.w, "%s\n{\"type\":\"Feature\",\"geometry\":{\"type\":%q,\"coordinates\":", prefix, geometry)
+	return err
+}
+
+func (e *geoJSONEncoder) position(p models.GPSData) error {
+	_, err := fmt.Fprintf(e.w, "[%s,%s]", formatCoord(*p.Longitude), formatCoord(*p.Latitude))
+	return err
+}
+
+func (e *geoJSONEncoder) Point(p models.GPSData) error {
+	e.points++
+	switch e.points {
+	case 1:
+		e.first = p
+		return nil
+	case 2:
+		if err := e.beginFeature("LineString"); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(e.w, "["); err != nil {
+			return err
+		}
+		if err := e.position(e.first); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(e.w, ","); err != nil {
+		return err
+	}
+	return e.position(p)
+}
+
+// As propriedades vêm depois da geometria porque o fim da viagem só é conhecido ao fechá-la.
+func (e *geoJSONEncoder) EndTrip(end time.Time) error {
+	switch e.points {
+	case 0:
+		return nil
+	case 1:
+		if err := e.beginFeature("Point"); err != nil {
+			return err
+		}
+		if err := e.position(e.first); err != nil {
+			return err
+		}
+	default:
+		if _, err := io.WriteString(e.w, "]"); err != nil {
+			return err
+		}
+	}
+	deviceID, err := json.Marshal(e.deviceID)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "},\"properties\":{\"device_id\":%s,\"trip\":%d,\"start\":%q,\"end\":%q}}",
+		deviceID, e.tripIndex, e.tripStart.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *geoJSONEncoder) End() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
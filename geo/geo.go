@@ -0,0 +1,65 @@
+package geo
+
+import "math"
+
+const earthRadiusMeters = 6371000.0
+
+func toRadians(deg float64) float64 { return deg * math.Pi / 180 }
+
+func toDegrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Haversine retorna a distância em metros entre dois pontos (lat/lon em graus).
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Bearing retorna o rumo inicial, em graus [0, 360), do primeiro para o segundo ponto.
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dLon := toRadians(lon2 - lon1)
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+	return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// CoarseGeohashPrecision é a precisão do geohash guardado em claro junto das posições: 6 caracteres
+// formam células de cerca de 1,2 km por 0,6 km, o bastante para agregar por região sem revelar o endereço.
+const CoarseGeohashPrecision = 6
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash codifica a posição com precision caracteres; prefixos iguais indicam a mesma célula maior.
+func Geohash(lat, lon float64, precision int) string {
+	latRange, lonRange := [2]float64{-90, 90}, [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch, even := 0, 0, true
+	for len(hash) < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const auditDetailsParamPrefix = "details."
+
+// parseAuditFilter lê os filtros da busca no audit_log. Cada details.<campo>=<valor> compara um campo de
+// primeiro nível de details: o valor é lido como JSON (1, true, "123") e, se não for JSON válido, como
+// texto.
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		return models.AuditFilter{}, err
+	}
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		From:   from,
+		To:     to,
+		Limit:  models.DefaultAuditPageSize,
+	}
+	for name, values := range query {
+		key, ok := strings.CutPrefix(name, auditDetailsParamPrefix)
+		if !ok {
+			continue
+		}
+		value := json.RawMessage(values[0])
+		if !json.Valid(value) {
+			value, _ = json.Marshal(values[0])
+		}
+		if filter.Details == nil {
+			filter.Details = map[string]json.RawMessage{}
+		}
+		filter.Details[key] = value
+	}
+	if raw := query.Get("limit"); raw != "" {
+		filter.Limit, err = strconv.Atoi(raw)
+		if err != nil || filter.Limit <= 0 {
+			return models.AuditFilter{}, fmt.Errorf("'limit' deve estar entre 1 e %d", models.MaxAuditPageSize)
+		}
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		filter.BeforeID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || filter.BeforeID <= 0 {
+			return models.AuditFilter{}, fmt.Errorf("parâmetro 'cursor' inválido")
+		}
+	}
+	return filter, filter.Validate()
+}
+
+// HandleSearchAudit busca no audit_log
+// @Summary      Busca eventos de auditoria
+// @Description  Busca no audit_log por ator, ação, intervalo e campos de details (details.<campo>=<valor>, com o valor em JSON ou texto), das linhas mais novas para as mais antigas. Em JSON a resposta é paginada: repita a busca com cursor=next_cursor. Com format=csv ou ndjson, transmite todas as linhas do filtro, sem paginação. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; cada busca é registrada no audit_log (AUDIT_LOG_QUERIED).
+// @Tags         Audit
+// @Produce      json,text/csv,application/x-ndjson
+// @Param        actor   query     string  false  "Ator"
+// @Param        action  query     string  false  "Ação (ex.: PHOTO_VIEWED)"
+// @Param        from    query     string  false  "Início (RFC3339), padrão: 24h antes de 'to'"
+// @Param        to      query     string  false  "Fim (RFC3339), padrão: agora"
+// @Param        limit   query     int     false  "Linhas por página em JSON (padrão: 100, máximo: 1000)"
+// @Param        cursor  query     string  false  "next_cursor da página anterior"
+// @Param        format  query     string  false  "json, csv ou ndjson (padrão: json)"
+// @Success      200  {object}  models.AuditPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/audit [get]
+func (a *API) HandleSearchAudit(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		format = "json"
+	case "csv", "ndjson":
+		filter.Limit, filter.BeforeID = 0, 0
+	default:
+		sendValidationError(w, r, "formato inválido: use json, csv ou ndjson")
+		return
+	}
+
+	// Sem o registro da busca nenhuma linha é entregue.
+	details := make(map[string]string, len(filter.Details))
+	for key, value := range filter.Details {
+		details[key] = string(value)
+	}
+	auditEvent := models.AuditEvent{
+		Actor:  principal.Name,
+		Action: "AUDIT_LOG_QUERIED",
+		Details: map[string]interface{}{
+			"role":        principal.Role,
+			"actor":       filter.Actor,
+			"action":      filter.Action,
+			"details":     details,
+			"from":        filter.From,
+			"to":          filter.To,
+			"cursor":      filter.BeforeID,
+			"format":      format,
+			"remote_addr": r.RemoteAddr,
+		},
+	}
+	if err := a.db.LogAuditEvent(r.Context(), auditEvent); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para busca no audit_log", "error", err, "actor", principal.Name)
+		SendJSONError(w, "Erro interno ao registrar a busca", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "json" {
+		a.sendAuditPage(w, r, filter)
+		return
+	}
+	a.exportAudit(w, r, filter, format, principal)
+}
+
+func (a *API) sendAuditPage(w http.ResponseWriter, r *http.Request, filter models.AuditFilter) {
+	limit := filter.Limit
+	// Uma linha a mais indica se existe próxima página.
+	filter.Limit++
+	page := models.AuditPage{Events: []models.AuditEntry{}}
+	err := a.db.StreamAuditLog(r.Context(), filter, func(e models.AuditEntry) error {
+		page.Events = append(page.Events, e)
+		return nil
+	})
+	if err != nil {
+		slog.Error("falha ao buscar no audit_log", "error", err)
+		SendJSONError(w, "Erro interno ao buscar no audit_log", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Events) > limit {
+		page.Events = page.Events[:limit]
+		page.NextCursor = strconv.FormatInt(page.Events[limit-1].ID, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (a *API) exportAudit(w http.ResponseWriter, r *http.Request, filter models.AuditFilter, format string, principal Principal) {
+	buffered := bufio.NewWriter(w)
+	writer, err := export.NewAuditWriter(format, buffered)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	contentType := "text/csv"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "audit."+format))
+	w.Header().Set("Cache-Control", "no-store")
+
+	rows := 0
+	err = a.db.StreamAuditLog(r.Context(), filter, func(e models.AuditEntry) error {
+		rows++
+		return writer.Write(export.NewAuditRow(e))
+	})
+	if err != nil && rows == 0 {
+		// Nada foi enviado ainda (no máximo o cabeçalho do CSV está no buffer), então dá para responder com erro.
+		slog.Error("falha ao buscar no audit_log", "error", err)
+		buffered.Reset(w)
+		w.Header().Del("Content-Disposition")
+		SendJSONError(w, "Erro interno ao buscar no audit_log", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// O cabeçalho já foi enviado; o cliente recebe um arquivo truncado e o erro fica no log.
+		slog.Error("falha ao exportar o audit_log", "error", err, "rows", rows)
+		buffered.Flush()
+		return
+	}
+	if err := writer.Close(); err != nil {
+		slog.Error("falha ao finalizar exportação do audit_log", "error", err)
+		return
+	}
+	if err := buffered.Flush(); err != nil {
+		slog.Error("falha ao enviar exportação do audit_log", "error", err)
+		return
+	}
+	slog.Info("audit_log exportado", "actor", principal.Name, "format", format, "rows", rows)
+}
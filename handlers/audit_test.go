@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) StreamAuditLog(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	args := m.Called(filter)
+	if entries, ok := args.Get(0).([]models.AuditEntry); ok {
+		for _, e := range entries {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func auditMux(t *testing.T, db *MockStorage) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("bia:admin:chave-bia;ana:investigator:chave-ana")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/audit", RequireRole(privileged, RoleAdmin)(http.HandlerFunc(NewAPI(db, nil, nil).HandleSearchAudit)))
+	return mux
+}
+
+func getAudit(mux *http.ServeMux, url, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func auditEntries(ids ...int64) []models.AuditEntry {
+	entries := []models.AuditEntry{}
+	for _, id := range ids {
+		entries = append(entries, models.AuditEntry{ID: id, Seq: id, Timestamp: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			Actor: "ana", Action: "PHOTO_VIEWED", Details: json.RawMessage(`{"photo_id": 1, "reason": "incidente, 42"}`), Hash: []byte{0xab}})
+	}
+	return entries
+}
+
+func TestHandleSearchAudit_PagesAndAudits(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "AUDIT_LOG_QUERIED" && e.Actor == "bia" && e.Details["actor"] == "ana" &&
+			e.Details["details"].(map[string]string)["photo_id"] == "1" && e.Details["format"] == "json"
+	})).Return(nil)
+	mockDB.On("StreamAuditLog", mock.MatchedBy(func(f models.AuditFilter) bool {
+		return f.Actor == "ana" && f.Action == "PHOTO_VIEWED" && f.Limit == 3 && f.BeforeID == 50 &&
+			string(f.Details["photo_id"]) == "1" && string(f.Details["device_id"]) == `"dev-1"` && string(f.Details["ref"]) == `"123"` &&
+			f.From.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	})).Return(auditEntries(40, 30, 20), nil)
+
+	rr := getAudit(auditMux(t, mockDB), `/admin/audit?actor=ana&action=PHOTO_VIEWED&details.photo_id=1&details.device_id=dev-1&details.ref=%22123%22&from=2025-03-01T00:00:00Z&to=2025-03-02T00:00:00Z&limit=2&cursor=50`, "chave-bia")
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var page models.AuditPage
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&page))
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "30", page.NextCursor)
+	assert.JSONEq(t, `{"photo_id": 1, "reason": "incidente, 42"}`, string(page.Events[0].Details))
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleSearchAudit_Exports(t *testing.T) {
+	for _, format := range []string{"csv", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			mockDB := new(MockStorage)
+			mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+			mockDB.On("StreamAuditLog", mock.MatchedBy(func(f models.AuditFilter) bool {
+				return f.Limit == 0 && f.BeforeID == 0
+			})).Return(auditEntries(3, 2, 1), nil)
+
+			rr := getAudit(auditMux(t, mockDB), "/admin/audit?format="+format+"&cursor=9", "chave-bia")
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.Contains(t, rr.Header().Get("Content-Disposition"), "audit."+format)
+			if format == "csv" {
+				records, err := csv.NewReader(rr.Body).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 4)
+				assert.Equal(t, []string{"id", "seq", "timestamp", "actor", "action", "details", "hash"}, records[0])
+				assert.Equal(t, []string{"3", "3", "2025-03-01T00:00:00Z", "ana", "PHOTO_VIEWED", `{"photo_id": 1, "reason": "incidente, 42"}`, "ab"}, records[1])
+				return
+			}
+			lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+			require.Len(t, lines, 3)
+			var row map[string]any
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+			assert.Equal(t, "ana", row["actor"])
+			assert.Equal(t, map[string]any{"photo_id": 1.0, "reason": "incidente, 42"}, row["details"])
+		})
+	}
+}
+
+func TestHandleSearchAudit_Errors(t *testing.T) {
+	mockDB := new(MockStorage)
+	mux := auditMux(t, mockDB)
+
+	assert.Equal(t, http.StatusForbidden, getAudit(mux, "/admin/audit", "chave-ana").Code, "só admin busca no audit_log")
+	assert.Equal(t, http.StatusUnauthorized, getAudit(mux, "/admin/audit", "desconhecida").Code)
+	for _, query := range []string{"details.a-b=1", "limit=0", "limit=1001", "cursor=abc", "format=xml", "from=ontem"} {
+		assert.Equal(t, http.StatusBadRequest, getAudit(mux, "/admin/audit?"+query, "chave-bia").Code, query)
+	}
+	mockDB.AssertNotCalled(t, "LogAuditEvent", mock.Anything)
+
+	mockDB.On("LogAuditEvent", mock.Anything).Return(errors.New("audit_log indisponível")).Once()
+	assert.Equal(t, http.StatusInternalServerError, getAudit(mux, "/admin/audit", "chave-bia").Code, "sem auditoria a busca não sai")
+	mockDB.AssertNotCalled(t, "StreamAuditLog", mock.Anything)
+
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+	mockDB.On("StreamAuditLog", mock.Anything).Return(nil, errors.New("banco indisponível"))
+	rr := getAudit(mux, "/admin/audit?format=csv", "chave-bia")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// HandleCreateDataSubjectRequest abre um pedido de titular (LGPD)
+// @Summary      Abre um pedido de titular (LGPD)
+// @Description  Enfileira a exportação (export), eliminação (erase) ou anonimização (anonymize) dos dados de um dispositivo (subject_type=device) ou de um motorista (subject_type=driver), que alcança os dispositivos em que ele foi reconhecido e o cadastro dele. O worker executa o pedido: a exportação gera um zip com gps, gyroscope, metadados e imagens decifradas das fotos e as linhas do audit_log do titular; a eliminação e a anonimização também apagam as imagens e os rostos indexados no Rekognition. Ao final o pedido recebe um registro de conclusão assinado. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a abertura é registrada no audit_log (DATA_SUBJECT_REQUEST_CREATED).
+// @Tags         DataSubjects
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.DataSubjectRequestInput  true  "Titular e ação"
+// @Success      202  {object}  models.DataSubjectRequest
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/data-subject-requests [post]
+func (a *API) HandleCreateDataSubjectRequest(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var input models.DataSubjectRequestInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendValidationError(w, r, "Corpo da requisição inválido")
+		return
+	}
+	if err := input.Validate(); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	// O pedido só existe junto com o registro de quem o abriu.
+	req := &models.DataSubjectRequest{DataSubjectRequestInput: input, RequestedBy: principal.Name}
+	err := a.db.WithTx(r.Context(), func(tx storage.Storage) error {
+		if err := tx.CreateDataSubjectRequest(r.Context(), req); err != nil {
+			return err
+		}
+		return tx.LogAuditEvent(r.Context(), models.AuditEvent{
+			Actor:  principal.Name,
+			Action: "DATA_SUBJECT_REQUEST_CREATED",
+			Details: map[string]interface{}{
+				"request_id":   req.ID,
+				"subject_type": req.SubjectType,
+				"subject_id":   req.SubjectID,
+				"action":       req.Action,
+				"reason":       req.Reason,
+				"role":         principal.Role,
+				"remote_addr":  r.RemoteAddr,
+			},
+		})
+	})
+	if err != nil {
+		slog.Error("falha ao criar pedido de titular", "error", err, "actor", principal.Name)
+		SendJSONError(w, "Erro interno ao criar o pedido", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("pedido de titular criado", "request_id", req.ID, "action", req.Action, "actor", principal.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(req)
+}
+
+// HandleGetDataSubjectRequest consulta um pedido de titular
+// @Summary      Consulta um pedido de titular (LGPD)
+// @Description  Retorna o status do pedido, o local do arquivo exportado (ou da cópia do registro de conclusão) e o registro de conclusão assinado, que pode ser conferido com "audit record". Exige uma chave de PRIVILEGED_API_KEYS com papel admin.
+// @Tags         DataSubjects
+// @Produce      json
+// @Param        id   path      int  true  "ID do pedido"
+// @Success      200  {object}  models.DataSubjectRequest
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/data-subject-requests/{id} [get]
+func (a *API) HandleGetDataSubjectRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		sendValidationError(w, r, "id inválido")
+		return
+	}
+	req, err := a.db.GetDataSubjectRequest(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Pedido não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao consultar pedido de titular", "error", err, "request_id", id)
+		SendJSONError(w, "Erro interno ao consultar o pedido", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(req)
+}
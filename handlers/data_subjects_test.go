@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) CreateDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	args := m.Called(req)
+	req.ID, req.Status = 5, models.ExportStatusPending
+	return args.Error(0)
+}
+
+// WithTx executa a unidade de trabalho sobre o próprio mock.
+func (m *MockStorage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return fn(m)
+}
+
+func dataSubjectMux(t *testing.T, db *MockStorage) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("bia:admin:chave-bia;ana:investigator:chave-ana")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin/data-subject-requests", RequireRole(privileged, RoleAdmin)(http.HandlerFunc(NewAPI(db, nil, nil).HandleCreateDataSubjectRequest)))
+	return mux
+}
+
+func postDataSubjectRequest(mux *http.ServeMux, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/data-subject-requests", strings.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleCreateDataSubjectRequest_QueuesAndAudits(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("CreateDataSubjectRequest", mock.MatchedBy(func(r *models.DataSubjectRequest) bool {
+		return r.SubjectID == "dev-1" && r.Action == models.SubjectActionErase && r.RequestedBy == "bia"
+	})).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "DATA_SUBJECT_REQUEST_CREATED" && e.Actor == "bia" && e.Details["request_id"] == int64(5) &&
+			e.Details["reason"] == "protocolo 7"
+	})).Return(nil)
+
+	rr := postDataSubjectRequest(dataSubjectMux(t, mockDB),
+		`{"subject_type":"device","subject_id":"dev-1","action":"erase","reason":"protocolo 7"}`, "chave-bia")
+
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	var created models.DataSubjectRequest
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, int64(5), created.ID)
+	assert.Equal(t, models.ExportStatusPending, created.Status)
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleCreateDataSubjectRequest_Rejects(t *testing.T) {
+	tests := []struct {
+		name, body, key string
+		status          int
+	}{
+		{"investigador", `{"subject_type":"device","subject_id":"dev-1","action":"export","reason":"x"}`, "chave-ana", http.StatusForbidden},
+		{"motorista com id inválido", `{"subject_type":"driver","subject_id":"m 1","action":"export","reason":"x"}`, "chave-bia", http.StatusBadRequest},
+		{"titular desconhecido", `{"subject_type":"vehicle","subject_id":"v-1","action":"export","reason":"x"}`, "chave-bia", http.StatusBadRequest},
+		{"sem motivo", `{"subject_type":"device","subject_id":"dev-1","action":"export"}`, "chave-bia", http.StatusBadRequest},
+		{"ação inválida", `{"subject_type":"device","subject_id":"dev-1","action":"delete","reason":"x"}`, "chave-bia", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockStorage)
+			rr := postDataSubjectRequest(dataSubjectMux(t, mockDB), tt.body, tt.key)
+			assert.Equal(t, tt.status, rr.Code, rr.Body.String())
+			mockDB.AssertNotCalled(t, "CreateDataSubjectRequest", mock.Anything)
+		})
+	}
+}
+
+func TestHandleCreateDataSubjectRequest_AuditFailureIs500(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("CreateDataSubjectRequest", mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(errors.New("banco fora"))
+
+	rr := postDataSubjectRequest(dataSubjectMux(t, mockDB),
+		`{"subject_type":"device","subject_id":"dev-1","action":"export","reason":"protocolo 7"}`, "chave-bia")
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
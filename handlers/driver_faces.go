@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/services"
+	"challenge-v3/storage"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DriverFaceHandler cadastra e remove os rostos de referência dos motoristas.
+type DriverFaceHandler struct {
+	db    storage.Storage
+	faces *services.DriverFaceService
+}
+
+func NewDriverFaceHandler(db storage.Storage, faces *services.DriverFaceService) *DriverFaceHandler {
+	return &DriverFaceHandler{db: db, faces: faces}
+}
+
+// HandleEnrollFace cadastra uma foto de referência do motorista
+// @Summary      Cadastra uma foto de referência do motorista
+// @Description  Confere a foto (um único rosto, de frente, nítido e iluminado) e indexa o rosto na coleção do Rekognition com ExternalImageId igual ao id do motorista. A imagem não é guardada, só o rosto indexado. Fotos recusadas pela conferência ou pelo filtro de qualidade do Rekognition retornam 422 com o motivo. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; o cadastro é registrado no audit_log (DRIVER_FACE_ENROLLED).
+// @Tags         Drivers
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string                      true  "ID do motorista"
+// @Param        photo  body      models.FaceEnrollmentInput  true  "Foto de referência em base64"
+// @Success      201  {object}  models.DriverFace
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      422  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drivers/{id}/faces [post]
+func (h *DriverFaceHandler) HandleEnrollFace(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	driverID := r.PathValue("id")
+	if err := models.ValidateDriverID(driverID); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	// A foto chega em base64 (4 bytes para cada 3); a folga cobre o restante do JSON.
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxReferencePhotoBytes/3*4+4096)
+	var input models.FaceEnrollmentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendValidationError(w, r, "Corpo da requisição inválido")
+		return
+	}
+	if err := input.Validate(); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	image, err := base64.StdEncoding.DecodeString(input.Photo)
+	if err != nil {
+		sendValidationError(w, r, "campo 'photo' deve estar em base64")
+		return
+	}
+
+	if _, err := h.db.GetDriver(r.Context(), driverID); errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Motorista não encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.Error("falha ao consultar motorista", "error", err, "driver_id", driverID)
+		SendJSONError(w, "Erro interno ao cadastrar o rosto", http.StatusInternalServerError)
+		return
+	}
+
+	faceID, err := h.faces.IndexReferenceFace(r.Context(), driverID, image)
+	if errors.Is(err, services.ErrReferencePhotoRejected) {
+		slog.Warn("foto de referência recusada", "error", err, "driver_id", driverID, "actor", principal.Name)
+		SendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao indexar rosto de referência", "error", err, "driver_id", driverID)
+		SendJSONError(w, "Erro interno ao cadastrar o rosto", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.WithTx(r.Context(), func(tx storage.Storage) error {
+		if err := tx.AddDriverFaces(r.Context(), driverID, models.DriverFaceSourceEnrolled, []string{faceID}); err != nil {
+			return err
+		}
+		return tx.LogAuditEvent(r.Context(), models.AuditEvent{
+			Actor:  principal.Name,
+			Action: "DRIVER_FACE_ENROLLED",
+			Details: map[string]interface{}{
+				"driver_id":   driverID,
+				"face_id":     faceID,
+				"role":        principal.Role,
+				"remote_addr": r.RemoteAddr,
+			},
+		})
+	})
+	if err != nil {
+		// Sem a associação e o registro, o rosto não pode ficar na coleção identificando o motorista.
+		slog.Error("falha ao registrar rosto de referência", "error", err, "driver_id", driverID, "face_id", faceID)
+		if delErr := h.faces.DeleteFace(context.WithoutCancel(r.Context()), faceID); delErr != nil {
+			slog.Error("falha ao remover rosto não registrado da coleção", "error", delErr, "face_id", faceID)
+		}
+		SendJSONError(w, "Erro interno ao cadastrar o rosto", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("rosto de referência cadastrado", "driver_id", driverID, "face_id", faceID, "actor", principal.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.DriverFace{
+		FaceID: faceID, DriverID: driverID, Source: models.DriverFaceSourceEnrolled, CreatedAt: time.Now().UTC(),
+	})
+}
+
+// HandleListFaces lista os rostos de um motorista
+// @Summary      Lista os rostos de um motorista
+// @Description  Retorna os rostos da coleção associados ao motorista, com a origem: enrolled (foto de referência cadastrada) ou associated (rosto que já estava na coleção). Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Drivers
+// @Produce      json
+// @Param        id   path      string  true  "ID do motorista"
+// @Success      200  {array}   models.DriverFace
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drivers/{id}/faces [get]
+func (h *DriverFaceHandler) HandleListFaces(w http.ResponseWriter, r *http.Request) {
+	driverID := r.PathValue("id")
+	if err := models.ValidateDriverID(driverID); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	faces, err := h.db.ListDriverFaces(r.Context(), driverID)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Motorista não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao listar rostos do motorista", "error", err, "driver_id", driverID)
+		SendJSONError(w, "Erro interno ao listar os rostos", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(faces)
+}
+
+// HandleRemoveFace remove um rosto do motorista
+// @Summary      Remove um rosto do motorista
+// @Description  Apaga o rosto da coleção do Rekognition e a associação com o motorista; as fotos já processadas mantêm o driver_id gravado. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a remoção é registrada no audit_log (DRIVER_FACE_REMOVED).
+// @Tags         Drivers
+// @Produce      json
+// @Param        id      path  string  true  "ID do motorista"
+// @Param        faceId  path  string  true  "FaceId do rosto"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drivers/{id}/faces/{faceId} [delete]
+func (h *DriverFaceHandler) HandleRemoveFace(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	driverID, faceID := r.PathValue("id"), r.PathValue("faceId")
+	if err := models.ValidateDriverID(driverID); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	faces, err := h.db.ListDriverFaces(r.Context(), driverID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		slog.Error("falha ao listar rostos do motorista", "error", err, "driver_id", driverID)
+		SendJSONError(w, "Erro interno ao remover o rosto", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, face := range faces {
+		found = found || face.FaceID == faceID
+	}
+	if !found {
+		SendJSONError(w, "Rosto não encontrado para o motorista", http.StatusNotFound)
+		return
+	}
+
+	// O rosto sai primeiro da coleção: a associação apagada antes deixaria um rosto que ainda identifica o
+	// motorista pelo ExternalImageId.
+	if err := h.faces.DeleteFace(r.Context(), faceID); err != nil {
+		slog.Error("falha ao apagar rosto da coleção", "error", err, "driver_id", driverID, "face_id", faceID)
+		SendJSONError(w, "Erro interno ao remover o rosto", http.StatusInternalServerError)
+		return
+	}
+	err = h.db.WithTx(r.Context(), func(tx storage.Storage) error {
+		if err := tx.RemoveDriverFace(r.Context(), driverID, faceID); err != nil {
+			return err
+		}
+		return tx.LogAuditEvent(r.Context(), models.AuditEvent{
+			Actor:  principal.Name,
+			Action: "DRIVER_FACE_REMOVED",
+			Details: map[string]interface{}{
+				"driver_id":   driverID,
+				"face_id":     faceID,
+				"role":        principal.Role,
+				"remote_addr": r.RemoteAddr,
+			},
+		})
+	})
+	if err != nil {
+		slog.Error("falha ao registrar remoção do rosto", "error", err, "driver_id", driverID, "face_id", faceID)
+		SendJSONError(w, "Erro interno ao remover o rosto", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("rosto do motorista removido", "driver_id", driverID, "face_id", faceID, "actor", principal.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/services"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockFaceEnroller struct{ mock.Mock }
+
+func (m *MockFaceEnroller) DetectFaces(ctx context.Context, params *rekognition.DetectFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DetectFacesOutput, error) {
+	args := m.Called(params)
+	return args.Get(0).(*rekognition.DetectFacesOutput), args.Error(1)
+}
+func (m *MockFaceEnroller) IndexFaces(ctx context.Context, params *rekognition.IndexFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.IndexFacesOutput, error) {
+	args := m.Called(params)
+	return args.Get(0).(*rekognition.IndexFacesOutput), args.Error(1)
+}
+func (m *MockFaceEnroller) DeleteFaces(ctx context.Context, params *rekognition.DeleteFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DeleteFacesOutput, error) {
+	args := m.Called(params)
+	return args.Get(0).(*rekognition.DeleteFacesOutput), args.Error(1)
+}
+
+func (m *MockStorage) ListDriverFaces(ctx context.Context, driverID string) ([]models.DriverFace, error) {
+	args := m.Called(driverID)
+	return args.Get(0).([]models.DriverFace), args.Error(1)
+}
+func (m *MockStorage) RemoveDriverFace(ctx context.Context, driverID, faceID string) error {
+	return m.Called(driverID, faceID).Error(0)
+}
+
+func driverFacesMux(t *testing.T, db *MockStorage, rek *MockFaceEnroller) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("bia:admin:chave-bia")
+	require.NoError(t, err)
+	handler := NewDriverFaceHandler(db, services.NewDriverFaceService(rek, "test-collection"))
+	mux := http.NewServeMux()
+	mux.Handle("POST /drivers/{id}/faces", RequireRole(privileged, RoleAdmin)(http.HandlerFunc(handler.HandleEnrollFace)))
+	mux.Handle("DELETE /drivers/{id}/faces/{faceId}", RequireRole(privileged, RoleAdmin)(http.HandlerFunc(handler.HandleRemoveFace)))
+	return mux
+}
+
+func enrollFace(mux *http.ServeMux) *httptest.ResponseRecorder {
+	body := `{"photo":"` + base64.StdEncoding.EncodeToString([]byte("imagem")) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/drivers/drv-1/faces", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "chave-bia")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func detectedFaces(n int) *rekognition.DetectFacesOutput {
+	out := &rekognition.DetectFacesOutput{}
+	for i := 0; i < n; i++ {
+		out.FaceDetails = append(out.FaceDetails, types.FaceDetail{Confidence: aws.Float32(99.9),
+			Quality: &types.ImageQuality{Brightness: aws.Float32(80), Sharpness: aws.Float32(80)}})
+	}
+	return out
+}
+
+func TestHandleEnrollFace_IndexesAndAudits(t *testing.T) {
+	mockDB, mockRek := new(MockStorage), new(MockFaceEnroller)
+	mockDB.On("GetDriver", "drv-1").Return(&models.Driver{ID: "drv-1"}, nil)
+	mockRek.On("DetectFaces", mock.Anything).Return(detectedFaces(1), nil)
+	mockRek.On("IndexFaces", mock.MatchedBy(func(in *rekognition.IndexFacesInput) bool {
+		return aws.ToString(in.ExternalImageId) == "drv-1"
+	})).Return(&rekognition.IndexFacesOutput{FaceRecords: []types.FaceRecord{{Face: &types.Face{FaceId: aws.String("face-1")}}}}, nil)
+	mockDB.On("AddDriverFaces", "drv-1", models.DriverFaceSourceEnrolled, []string{"face-1"}).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "DRIVER_FACE_ENROLLED" && e.Actor == "bia" && e.Details["face_id"] == "face-1"
+	})).Return(nil)
+
+	rr := enrollFace(driverFacesMux(t, mockDB, mockRek))
+
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"face_id":"face-1"`)
+	mockDB.AssertExpectations(t)
+	mockRek.AssertExpectations(t)
+}
+
+func TestHandleEnrollFace_RejectsPhotoWithTwoFaces(t *testing.T) {
+	mockDB, mockRek := new(MockStorage), new(MockFaceEnroller)
+	mockDB.On("GetDriver", "drv-1").Return(&models.Driver{ID: "drv-1"}, nil)
+	mockRek.On("DetectFaces", mock.Anything).Return(detectedFaces(2), nil)
+
+	rr := enrollFace(driverFacesMux(t, mockDB, mockRek))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	mockRek.AssertNotCalled(t, "IndexFaces", mock.Anything)
+	mockDB.AssertNotCalled(t, "AddDriverFaces", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleEnrollFace_AuditFailureRemovesIndexedFace(t *testing.T) {
+	mockDB, mockRek := new(MockStorage), new(MockFaceEnroller)
+	mockDB.On("GetDriver", "drv-1").Return(&models.Driver{ID: "drv-1"}, nil)
+	mockRek.On("DetectFaces", mock.Anything).Return(detectedFaces(1), nil)
+	mockRek.On("IndexFaces", mock.Anything).
+		Return(&rekognition.IndexFacesOutput{FaceRecords: []types.FaceRecord{{Face: &types.Face{FaceId: aws.String("face-1")}}}}, nil)
+	mockDB.On("AddDriverFaces", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(errors.New("banco fora"))
+	mockRek.On("DeleteFaces", mock.MatchedBy(func(in *rekognition.DeleteFacesInput) bool {
+		return assert.ObjectsAreEqual([]string{"face-1"}, in.FaceIds)
+	})).Return(&rekognition.DeleteFacesOutput{DeletedFaces: []string{"face-1"}}, nil)
+
+	rr := enrollFace(driverFacesMux(t, mockDB, mockRek))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	mockRek.AssertExpectations(t)
+}
+
+func TestHandleRemoveFace(t *testing.T) {
+	mockDB, mockRek := new(MockStorage), new(MockFaceEnroller)
+	mockDB.On("ListDriverFaces", "drv-1").Return([]models.DriverFace{{FaceID: "face-1", DriverID: "drv-1"}}, nil)
+	mockRek.On("DeleteFaces", mock.Anything).Return(&rekognition.DeleteFacesOutput{DeletedFaces: []string{"face-1"}}, nil)
+	mockDB.On("RemoveDriverFace", "drv-1", "face-1").Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DRIVER_FACE_REMOVED" })).Return(nil)
+	mux := driverFacesMux(t, mockDB, mockRek)
+
+	for _, tc := range []struct {
+		faceID string
+		status int
+	}{{"face-1", http.StatusNoContent}, {"face-de-outro", http.StatusNotFound}} {
+		req := httptest.NewRequest(http.MethodDelete, "/drivers/drv-1/faces/"+tc.faceID, nil)
+		req.Header.Set("X-API-Key", "chave-bia")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assert.Equal(t, tc.status, rr.Code, tc.faceID)
+	}
+	mockRek.AssertNumberOfCalls(t, "DeleteFaces", 1)
+	mockDB.AssertExpectations(t)
+}
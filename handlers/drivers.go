@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// HandleSaveDriver cadastra ou atualiza um motorista
+// @Summary      Cadastra ou atualiza um motorista
+// @Description  Cria o motorista com o id informado ou atualiza o nome de um já cadastrado. face_ids associa rostos já indexados na coleção do Rekognition ao motorista (associações anteriores são mantidas); rostos indexados com ExternalImageId igual ao id do motorista o identificam sem associação. As fotos processadas a partir daí passam a registrar o motorista reconhecido. Exige uma chave de PRIVILEGED_API_KEYS com papel admin; a alteração é registrada no audit_log (DRIVER_SAVED).
+// @Tags         Drivers
+// @Accept       json
+// @Produce      json
+// @Param        id      path      string              true  "ID do motorista"
+// @Param        driver  body      models.DriverInput  true  "Nome e rostos associados"
+// @Success      200  {object}  models.Driver
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drivers/{id} [put]
+func (a *API) HandleSaveDriver(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	id := r.PathValue("id")
+	if err := models.ValidateDriverID(id); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	var input models.DriverInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendValidationError(w, r, "Corpo da requisição inválido")
+		return
+	}
+	if err := input.Validate(); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	var driver *models.Driver
+	err := a.db.WithTx(r.Context(), func(tx storage.Storage) error {
+		saved := &models.Driver{ID: id, Name: input.Name}
+		if err := tx.SaveDriver(r.Context(), saved); err != nil {
+			return err
+		}
+		if err := tx.AddDriverFaces(r.Context(), id, models.DriverFaceSourceAssociated, input.FaceIDs); err != nil {
+			return err
+		}
+		if err := tx.LogAuditEvent(r.Context(), models.AuditEvent{
+			Actor:  principal.Name,
+			Action: "DRIVER_SAVED",
+			Details: map[string]interface{}{
+				"driver_id":   id,
+				"face_ids":    input.FaceIDs,
+				"role":        principal.Role,
+				"remote_addr": r.RemoteAddr,
+			},
+		}); err != nil {
+			return err
+		}
+		var err error
+		driver, err = tx.GetDriver(r.Context(), id)
+		return err
+	})
+	if errors.Is(err, storage.ErrFaceAssigned) {
+		SendJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao salvar motorista", "error", err, "driver_id", id, "actor", principal.Name)
+		SendJSONError(w, "Erro interno ao salvar o motorista", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("motorista salvo", "driver_id", id, "faces", len(driver.FaceIDs), "actor", principal.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(driver)
+}
+
+// HandleGetDriver consulta um motorista
+// @Summary      Consulta um motorista
+// @Description  Retorna o cadastro do motorista e os rostos da coleção associados a ele. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Drivers
+// @Produce      json
+// @Param        id   path      string  true  "ID do motorista"
+// @Success      200  {object}  models.Driver
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drivers/{id} [get]
+func (a *API) HandleGetDriver(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := models.ValidateDriverID(id); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	driver, err := a.db.GetDriver(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Motorista não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao consultar motorista", "error", err, "driver_id", id)
+		SendJSONError(w, "Erro interno ao consultar o motorista", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(driver)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) SaveDriver(ctx context.Context, driver *models.Driver) error {
+	return m.Called(driver).Error(0)
+}
+func (m *MockStorage) AddDriverFaces(ctx context.Context, driverID, source string, faceIDs []string) error {
+	return m.Called(driverID, source, faceIDs).Error(0)
+}
+func (m *MockStorage) GetDriver(ctx context.Context, id string) (*models.Driver, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Driver), args.Error(1)
+}
+
+func driverMux(t *testing.T, db *MockStorage) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("bia:admin:chave-bia;ana:investigator:chave-ana")
+	require.NoError(t, err)
+	api := NewAPI(db, nil, nil)
+	mux := http.NewServeMux()
+	mux.Handle("PUT /drivers/{id}", RequireRole(privileged, RoleAdmin)(http.HandlerFunc(api.HandleSaveDriver)))
+	mux.Handle("GET /drivers/{id}", RequireRole(privileged, RoleInvestigator, RoleAdmin)(http.HandlerFunc(api.HandleGetDriver)))
+	return mux
+}
+
+func putDriver(mux *http.ServeMux, id, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/drivers/"+id, strings.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleSaveDriver_SavesFacesAndAudits(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("SaveDriver", mock.MatchedBy(func(d *models.Driver) bool { return d.ID == "drv-1" && d.Name == "Ana" })).Return(nil)
+	mockDB.On("AddDriverFaces", "drv-1", models.DriverFaceSourceAssociated, []string{"face-1"}).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "DRIVER_SAVED" && e.Actor == "bia" && e.Details["driver_id"] == "drv-1"
+	})).Return(nil)
+	mockDB.On("GetDriver", "drv-1").Return(&models.Driver{ID: "drv-1", Name: "Ana", FaceIDs: []string{"face-0", "face-1"}}, nil)
+
+	rr := putDriver(driverMux(t, mockDB), "drv-1", `{"name":"Ana","face_ids":["face-1"]}`, "chave-bia")
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var driver models.Driver
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&driver))
+	assert.Equal(t, []string{"face-0", "face-1"}, driver.FaceIDs)
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleSaveDriver_FaceOfAnotherDriverIsConflict(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("SaveDriver", mock.Anything).Return(nil)
+	mockDB.On("AddDriverFaces", "drv-1", models.DriverFaceSourceAssociated, []string{"face-9"}).Return(fmt.Errorf("%w: face-9", storage.ErrFaceAssigned))
+
+	rr := putDriver(driverMux(t, mockDB), "drv-1", `{"name":"Ana","face_ids":["face-9"]}`, "chave-bia")
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	mockDB.AssertNotCalled(t, "LogAuditEvent", mock.Anything)
+}
+
+func TestHandleSaveDriver_Rejects(t *testing.T) {
+	tests := []struct {
+		name, id, body, key string
+		status              int
+	}{
+		{"investigador", "drv-1", `{"name":"Ana"}`, "chave-ana", http.StatusForbidden},
+		{"sem nome", "drv-1", `{"face_ids":["face-1"]}`, "chave-bia", http.StatusBadRequest},
+		{"id inválido", "drv%201", `{"name":"Ana"}`, "chave-bia", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockStorage)
+			rr := putDriver(driverMux(t, mockDB), tt.id, tt.body, tt.key)
+			assert.Equal(t, tt.status, rr.Code, rr.Body.String())
+			mockDB.AssertNotCalled(t, "SaveDriver", mock.Anything)
+		})
+	}
+}
+
+func TestHandleSaveDriver_AuditFailureIs500(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("SaveDriver", mock.Anything).Return(nil)
+	mockDB.On("AddDriverFaces", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(errors.New("banco fora"))
+
+	rr := putDriver(driverMux(t, mockDB), "drv-1", `{"name":"Ana"}`, "chave-bia")
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestHandleGetDriver_NotFound(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("GetDriver", "drv-2").Return(nil, storage.ErrNotFound)
+	req := httptest.NewRequest(http.MethodGet, "/drivers/drv-2", nil)
+	req.Header.Set("X-API-Key", "chave-ana")
+	rr := httptest.NewRecorder()
+
+	driverMux(t, mockDB).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// HandleCreateExport cria um job de exportação em massa
+// @Summary      Cria um job de exportação de dados
+// @Description  Enfileira a exportação de gps, gyroscope ou metadados de photo (nunca as imagens) em CSV ou Parquet. O worker executa o job e grava o arquivo no destino configurado. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Exports
+// @Accept       json
+// @Produce      json
+// @Param        export  body      models.ExportRequest  true  "Filtros da exportação"
+// @Success      202  {object}  models.ExportJob
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /exports [post]
+func (a *API) HandleCreateExport(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var request models.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendValidationError(w, r, "Corpo da requisição inválido")
+		return
+	}
+	if err := request.Validate(); err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	job := &models.ExportJob{ExportRequest: request, RequestedBy: principal.Name}
+	if err := a.db.CreateExportJob(r.Context(), job); err != nil {
+		slog.Error("falha ao criar job de exportação", "error", err)
+		SendJSONError(w, "Erro interno ao criar a exportação", http.StatusInternalServerError)
+		return
+	}
+
+	auditEvent := models.AuditEvent{
+		Actor:  job.RequestedBy,
+		Action: "EXPORT_REQUESTED",
+		Details: map[string]interface{}{
+			"job_id":      job.ID,
+			"dataset":     job.Dataset,
+			"format":      job.Format,
+			"device_id":   job.DeviceID,
+			"from":        job.From,
+			"to":          job.To,
+			"role":        principal.Role,
+			"remote_addr": r.RemoteAddr,
+		},
+	}
+	if err := a.db.LogAuditEvent(r.Context(), auditEvent); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para exportação", "error", err, "job_id", job.ID)
+	}
+
+	slog.Info("job de exportação criado", "job_id", job.ID, "dataset", job.Dataset, "format", job.Format)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleGetExport consulta o status de um job de exportação
+// @Summary      Consulta um job de exportação
+// @Description  Retorna o status e o destino do arquivo. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Exports
+// @Produce      json
+// @Param        id   path      int  true  "ID do job"
+// @Success      200  {object}  models.ExportJob
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /exports/{id} [get]
+func (a *API) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		sendValidationError(w, r, "id inválido")
+		return
+	}
+	job, err := a.db.GetExportJob(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Exportação não encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao consultar job de exportação", "error", err, "job_id", id)
+		SendJSONError(w, "Erro interno ao consultar a exportação", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
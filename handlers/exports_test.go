@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	args := m.Called(job)
+	job.ID = 42
+	return args.Error(0)
+}
+func (m *MockStorage) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExportJob), args.Error(1)
+}
+func (m *MockStorage) LogAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	return m.Called(event).Error(0)
+}
+
+func exportsMux(t *testing.T, api *API) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("ana:investigator:chave-ana")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("POST /exports", RequireRole(privileged, RoleInvestigator)(http.HandlerFunc(api.HandleCreateExport)))
+	mux.Handle("GET /exports/{id}", RequireRole(privileged, RoleInvestigator)(http.HandlerFunc(api.HandleGetExport)))
+	return mux
+}
+
+func exportRequest(method, target string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(body))
+	req.Header.Set("X-API-Key", "chave-ana")
+	return req
+}
+
+func TestHandleCreateExport(t *testing.T) {
+	from := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	t.Run("sucesso - cria job e registra auditoria", func(t *testing.T) {
+		mockDB := new(MockStorage)
+		mockDB.On("CreateExportJob", mock.MatchedBy(func(j *models.ExportJob) bool {
+			return j.Dataset == "gyroscope" && j.Format == "parquet" && j.DeviceID == "dev-1" && j.RequestedBy == "ana"
+		})).Return(nil)
+		mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+			return e.Action == "EXPORT_REQUESTED" && e.Actor == "ana" && e.Details["job_id"] == int64(42)
+		})).Return(nil)
+
+		body, err := json.Marshal(models.ExportRequest{Dataset: "gyroscope", Format: "parquet", DeviceID: "dev-1", From: from, To: from.Add(time.Hour)})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		exportsMux(t, NewAPI(mockDB, nil, nil)).ServeHTTP(rr, exportRequest(http.MethodPost, "/exports", body))
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		var job models.ExportJob
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+		assert.Equal(t, int64(42), job.ID)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("falha - dataset inválido", func(t *testing.T) {
+		mockDB := new(MockStorage)
+		body, err := json.Marshal(models.ExportRequest{Dataset: "photo_blobs", Format: "csv", From: from, To: from.Add(time.Hour)})
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		exportsMux(t, NewAPI(mockDB, nil, nil)).ServeHTTP(rr, exportRequest(http.MethodPost, "/exports", body))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockDB.AssertNotCalled(t, "CreateExportJob", mock.Anything)
+	})
+}
+
+func TestHandleGetExport(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("GetExportJob", int64(5)).Return(&models.ExportJob{ID: 5, Status: models.ExportStatusCompleted, Rows: 10}, nil)
+	mockDB.On("GetExportJob", int64(6)).Return(nil, storage.ErrNotFound)
+	mux := exportsMux(t, NewAPI(mockDB, nil, nil))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, exportRequest(http.MethodGet, "/exports/5", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"completed"`)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, exportRequest(http.MethodGet, "/exports/6", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -56,6 +56,7 @@ func RateLimiterMiddleware(next http.Handler) http.Handler {
 		mu.Unlock()
 
 		if !limiter.Allow() {
+			emitSecurityEvent(r, models.SecurityRateLimited, "", "limite de requisições por IP atingido")
 			SendJSONError(w, "Você atingiu o limite de requisições", http.StatusTooManyRequests)
 			return
 		}
@@ -77,6 +78,11 @@ func AuthenticationMiddleware(next http.Handler) http.Handler {
 
 		if receivedApiKey != expectedApiKey {
 			slog.Warn("tentativa de acesso não autorizado", "remote_addr", r.RemoteAddr)
+			reason := "chave de API inválida"
+			if receivedApiKey == "" {
+				reason = "chave de API ausente"
+			}
+			emitSecurityEvent(r, models.SecurityAuthFailure, "", reason)
 			SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
 			return
 		}
@@ -109,11 +115,11 @@ func (a *API) HandleGyroscope(w http.ResponseWriter, r *http.Request) {
 	}
 	var data models.GyroscopeData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		SendJSONError(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		sendValidationError(w, r, "Corpo da requisição inválido")
 		return
 	}
 	if err := data.Validate(); err != nil {
-		SendJSONError(w, err.Error(), http.StatusBadRequest)
+		sendValidationError(w, r, err.Error())
 		return
 	}
 
@@ -153,11 +159,11 @@ func (a *API) HandleGPS(w http.ResponseWriter, r *http.Request) {
 	}
 	var data models.GPSData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		SendJSONError(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		sendValidationError(w, r, "Corpo da requisição inválido")
 		return
 	}
 	if err := data.Validate(); err != nil {
-		SendJSONError(w, err.Error(), http.StatusBadRequest)
+		sendValidationError(w, r, err.Error())
 		return
 	}
 
@@ -197,7 +203,7 @@ func (a *API) HandlePhoto(w http.ResponseWriter, r *http.Request) {
 	}
 	var requestData models.PhotoRequest
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		SendJSONError(w, "Corpo da requisição inválido", http.StatusBadRequest)
+		sendValidationError(w, r, "Corpo da requisição inválido")
 		return
 	}
 
@@ -208,7 +214,7 @@ func (a *API) HandlePhoto(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := dataToPublish.Validate(); err != nil {
-		SendJSONError(w, err.Error(), http.StatusBadRequest)
+		sendValidationError(w, r, err.Error())
 		return
 	}
 
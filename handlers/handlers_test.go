@@ -3,6 +3,8 @@ package handlers
 import (
 	"bytes"
 	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -30,6 +32,23 @@ func (m *MockNATSJetStream) Publish(subj string, data []byte, opts ...nats.PubOp
 	return args.Get(0).(*nats.PubAck), args.Error(1)
 }
 
+type MockStorage struct {
+	storage.Storage
+	mock.Mock
+}
+
+func (m *MockStorage) StreamGPS(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GPSData) error) error {
+	args := m.Called(deviceID, from, to)
+	if points, ok := args.Get(0).([]models.GPSData); ok {
+		for _, p := range points {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
 func float64Ptr(f float64) *float64 { return &f }
 
 func TestAuthenticationMiddleware(t *testing.T) {
@@ -62,6 +81,13 @@ func TestAuthenticationMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, rr.Code, "Deveria retornar 401 com a chave errada")
 	})
 
+	t.Run("falha - chave de api na query string", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?api_key="+apiKey, nil)
+		rr := httptest.NewRecorder()
+		protectedHandler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "A chave só é aceita no cabeçalho")
+	})
+
 	t.Run("sucesso - com chave de api correta", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		req.Header.Set("X-API-Key", apiKey)
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	liveHeartbeatInterval = 15 * time.Second
+	// liveLatestTTL é por quanto tempo a última posição de um dispositivo que parou de transmitir
+	// continua sendo enviada aos novos clientes.
+	liveLatestTTL = 10 * time.Minute
+	// liveSweepInterval espaça as varreduras das posições expiradas feitas por Broadcast.
+	liveSweepInterval = time.Minute
+)
+
+type liveClient struct {
+	devices map[string]bool // nil recebe todos os dispositivos
+	mu      sync.Mutex
+	pending map[string]models.GPSData
+}
+
+func (c *liveClient) wants(deviceID string) bool {
+	return c.devices == nil || c.devices[deviceID]
+}
+
+func (c *liveClient) push(data models.GPSData) {
+	c.mu.Lock()
+	c.pending[data.DeviceID] = data
+	c.mu.Unlock()
+}
+
+func (c *liveClient) drain() map[string]models.GPSData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	batch := c.pending
+	c.pending = make(map[string]models.GPSData)
+	return batch
+}
+
+// liveEntry é a última posição de um dispositivo e quando ela chegou ao hub.
+type liveEntry struct {
+	data       models.GPSData
+	receivedAt time.Time
+}
+
+// LiveHub mantém a última posição de cada dispositivo e distribui as atualizações
+// recebidas do tópico telemetry.gps para os clientes conectados via SSE. Posições
+// recebidas há mais de latestTTL deixam de ser enviadas e são descartadas.
+type LiveHub struct {
+	mu          sync.Mutex
+	clients     map[*liveClient]struct{}
+	latest      map[string]liveEntry
+	latestTTL   time.Duration
+	lastSweep   time.Time
+	fleets      map[string][]string
+	minInterval time.Duration
+}
+
+func NewLiveHub(fleets map[string][]string, minInterval time.Duration) *LiveHub {
+	if minInterval <= 0 {
+		minInterval = time.Second
+	}
+	return &LiveHub{
+		clients:     make(map[*liveClient]struct{}),
+		latest:      make(map[string]liveEntry),
+		latestTTL:   liveLatestTTL,
+		lastSweep:   time.Now(),
+		fleets:      fleets,
+		minInterval: minInterval,
+	}
+}
+
+// ParseFleets interpreta o formato "norte:dev-1,dev-2;sul:dev-3".
+func ParseFleets(raw string) (map[string][]string, error) {
+	fleets := make(map[string][]string)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, devices, found := strings.Cut(entry, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("definição de frota inválida: %q", entry)
+		}
+		fleets[strings.TrimSpace(name)] = splitList(devices)
+	}
+	return fleets, nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (h *LiveHub) HandleMsg(msg *nats.Msg) {
+	var data models.GPSData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		slog.Warn("mensagem de gps inválida ignorada no feed ao vivo", "error", err)
+		return
+	}
+	if err := data.Validate(); err != nil {
+		return
+	}
+	h.Broadcast(data)
+}
+
+func (h *LiveHub) Broadcast(data models.GPSData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.lastSweep) >= liveSweepInterval {
+		h.sweep(now)
+	}
+	if current, ok := h.latest[data.DeviceID]; ok && !h.expired(current, now) && current.data.Timestamp.After(data.Timestamp) {
+		return
+	}
+	h.latest[data.DeviceID] = liveEntry{data: data, receivedAt: now}
+	for client := range h.clients {
+		if client.wants(data.DeviceID) {
+			client.push(data)
+		}
+	}
+}
+
+func (h *LiveHub) expired(entry liveEntry, now time.Time) bool {
+	return now.Sub(entry.receivedAt) > h.latestTTL
+}
+
+// sweep descarta as posições expiradas; chamada com h.mu travado.
+func (h *LiveHub) sweep(now time.Time) {
+	for deviceID, entry := range h.latest {
+		if h.expired(entry, now) {
+			delete(h.latest, deviceID)
+		}
+	}
+	h.lastSweep = now
+}
+
+func (h *LiveHub) register(client *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for deviceID, entry := range h.latest {
+		if client.wants(deviceID) && !h.expired(entry, now) {
+			client.pending[deviceID] = entry.data
+		}
+	}
+	h.clients[client] = struct{}{}
+}
+
+func (h *LiveHub) unregister(client *liveClient) {
+	h.mu.Lock()
+	delete(h.clients, client)
+	h.mu.Unlock()
+}
+
+// deviceFilter monta o conjunto de dispositivos a partir dos parâmetros fleet e devices.
+// Retorna nil quando nenhum filtro foi informado.
+func (h *LiveHub) deviceFilter(r *http.Request) (map[string]bool, error) {
+	fleet := r.URL.Query().Get("fleet")
+	devices := splitList(r.URL.Query().Get("devices"))
+	if fleet == "" && len(devices) == 0 {
+		return nil, nil
+	}
+	filter := make(map[string]bool)
+	if fleet != "" {
+		members, ok := h.fleets[fleet]
+		if !ok {
+			return nil, fmt.Errorf("frota desconhecida: %s", fleet)
+		}
+		for _, deviceID := range members {
+			filter[deviceID] = true
+		}
+	}
+	for _, deviceID := range devices {
+		filter[deviceID] = true
+	}
+	return filter, nil
+}
+
+// HandleLivePositions transmite as posições em tempo real
+// @Summary      Feed de posições em tempo real (SSE)
+// @Description  Abre um stream Server-Sent Events com a última posição de cada dispositivo (as recebidas há mais de 10 minutos não são enviadas na conexão). Filtre por frota ou lista de dispositivos; cada dispositivo é enviado no máximo uma vez por intervalo. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin; como o EventSource dos navegadores não envia cabeçalhos, só esta rota aceita a chave no parâmetro api_key.
+// @Tags         Live
+// @Produce      text/event-stream
+// @Param        fleet        query     string  false  "Nome da frota"
+// @Param        devices      query     string  false  "Lista de device_id separados por vírgula"
+// @Param        interval_ms  query     int     false  "Intervalo mínimo entre atualizações de um mesmo dispositivo"
+// @Success      200  {object}  models.GPSData
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Router       /live/positions [get]
+func (h *LiveHub) HandleLivePositions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		SendJSONError(w, "Método não permitido. Use GET.", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := h.deviceFilter(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	interval := h.minInterval
+	if raw := r.URL.Query().Get("interval_ms"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms < 0 {
+			sendValidationError(w, r, "interval_ms inválido")
+			return
+		}
+		if requested := time.Duration(ms) * time.Millisecond; requested > interval {
+			interval = requested
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("streaming não suportado pela conexão", "error", err)
+		return
+	}
+
+	client := &liveClient{devices: filter, pending: make(map[string]models.GPSData)}
+	h.register(client)
+	defer h.unregister(client)
+	slog.Info("cliente conectado ao feed ao vivo", "remote_addr", r.RemoteAddr, "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+
+	send := func() bool {
+		for _, data := range client.drain() {
+			payload, err := json.Marshal(data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: position\ndata: %s\n\n", payload); err != nil {
+				return false
+			}
+			lastWrite = time.Now()
+		}
+		if time.Since(lastWrite) >= liveHeartbeatInterval {
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return false
+			}
+			lastWrite = time.Now()
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send() {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Info("cliente desconectado do feed ao vivo", "remote_addr", r.RemoteAddr)
+			return
+		case <-ticker.C:
+			if !send() {
+				return
+			}
+		}
+	}
+}
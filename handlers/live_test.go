@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bufio"
+	"challenge-v3/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPositions(t *testing.T, scanner *bufio.Scanner, n int) []models.GPSData {
+	var positions []models.GPSData
+	for len(positions) < n && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var data models.GPSData
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data))
+		positions = append(positions, data)
+	}
+	return positions
+}
+
+func TestParseFleets(t *testing.T) {
+	fleets, err := ParseFleets("norte: dev-1, dev-2 ; sul:dev-3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dev-1", "dev-2"}, fleets["norte"])
+	assert.Equal(t, []string{"dev-3"}, fleets["sul"])
+
+	_, err = ParseFleets("sem-separador")
+	assert.Error(t, err)
+}
+
+func TestLiveHub_StreamsFilteredPositions(t *testing.T) {
+	hub := NewLiveHub(map[string][]string{"norte": {"dev-1"}}, 10*time.Millisecond)
+	hub.Broadcast(models.GPSData{DeviceID: "dev-1", Latitude: float64Ptr(1), Longitude: float64Ptr(1), Timestamp: time.Now()})
+
+	server := httptest.NewServer(http.HandlerFunc(hub.HandleLivePositions))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?fleet=norte&devices=dev-2", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	snapshot := readPositions(t, scanner, 1)
+	require.Len(t, snapshot, 1, "a última posição conhecida deve ser enviada na conexão")
+	assert.Equal(t, "dev-1", snapshot[0].DeviceID)
+
+	hub.Broadcast(models.GPSData{DeviceID: "dev-outside", Latitude: float64Ptr(9), Longitude: float64Ptr(9), Timestamp: time.Now()})
+	hub.Broadcast(models.GPSData{DeviceID: "dev-2", Latitude: float64Ptr(2), Longitude: float64Ptr(2), Timestamp: time.Now()})
+
+	updates := readPositions(t, scanner, 1)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "dev-2", updates[0].DeviceID)
+}
+
+func TestLiveHub_ThrottleKeepsLatestPosition(t *testing.T) {
+	hub := NewLiveHub(nil, time.Hour)
+	client := &liveClient{pending: make(map[string]models.GPSData)}
+	hub.register(client)
+	defer hub.unregister(client)
+
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		hub.Broadcast(models.GPSData{DeviceID: "dev-1", Latitude: float64Ptr(float64(i)), Longitude: float64Ptr(0), Timestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+	// Uma leitura atrasada não pode sobrescrever a posição mais recente.
+	hub.Broadcast(models.GPSData{DeviceID: "dev-1", Latitude: float64Ptr(-1), Longitude: float64Ptr(0), Timestamp: base})
+
+	batch := client.drain()
+	require.Len(t, batch, 1)
+	assert.Equal(t, 4.0, *batch["dev-1"].Latitude)
+}
+
+func TestLiveHub_DropsStalePositions(t *testing.T) {
+	hub := NewLiveHub(nil, time.Hour)
+	old := time.Now().Add(-2 * liveLatestTTL)
+	hub.latest["dev-parado"] = liveEntry{data: models.GPSData{DeviceID: "dev-parado", Timestamp: old}, receivedAt: old}
+
+	// Um cliente novo não recebe a posição de um dispositivo que parou de transmitir.
+	client := &liveClient{pending: make(map[string]models.GPSData)}
+	hub.register(client)
+	defer hub.unregister(client)
+	assert.Empty(t, client.drain())
+
+	// A próxima varredura tira a posição expirada do mapa.
+	hub.lastSweep = old
+	hub.Broadcast(models.GPSData{DeviceID: "dev-1", Latitude: float64Ptr(1), Longitude: float64Ptr(1), Timestamp: time.Now()})
+	assert.NotContains(t, hub.latest, "dev-parado")
+	assert.Contains(t, hub.latest, "dev-1")
+
+	// Uma leitura nova de um dispositivo expirado vale mesmo com horário anterior ao da posição descartada.
+	hub.latest["dev-relogio"] = liveEntry{data: models.GPSData{DeviceID: "dev-relogio", Timestamp: time.Now()}, receivedAt: old}
+	hub.Broadcast(models.GPSData{DeviceID: "dev-relogio", Latitude: float64Ptr(2), Longitude: float64Ptr(2), Timestamp: old})
+	assert.Equal(t, 2.0, *hub.latest["dev-relogio"].data.Latitude)
+}
+
+func TestLiveHub_UnknownFleet(t *testing.T) {
+	hub := NewLiveHub(nil, time.Second)
+	req := httptest.NewRequest(http.MethodGet, "/live/positions?fleet=inexistente", nil)
+	rr := httptest.NewRecorder()
+	hub.HandleLivePositions(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bufio"
+	"challenge-v3/models"
+	"challenge-v3/services"
+	"challenge-v3/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxAccessReasonLength = 500
+
+// maxDevicePhotosRange limita o intervalo da listagem de fotos, que devolve todas as linhas de uma vez.
+const maxDevicePhotosRange = 31 * 24 * time.Hour
+
+// PhotoHandler serve as imagens das fotos para os papéis privilegiados.
+type PhotoHandler struct {
+	db     storage.Storage
+	viewer *services.PhotoViewer
+}
+
+func NewPhotoHandler(db storage.Storage, viewer *services.PhotoViewer) *PhotoHandler {
+	return &PhotoHandler{db: db, viewer: viewer}
+}
+
+// HandleGetPhoto entrega a imagem decifrada de uma foto
+// @Summary      Consulta a imagem de uma foto
+// @Description  Decifra e transmite a imagem original. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin; cada acesso é registrado no audit_log com quem acessou e o motivo informado.
+// @Tags         Photos
+// @Produce      image/jpeg,image/png
+// @Param        id      path      int     true  "ID da foto"
+// @Param        reason  query     string  true  "Motivo do acesso (ex.: número do incidente)"
+// @Success      200  {file}    file
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /photos/{id} [get]
+func (h *PhotoHandler) HandleGetPhoto(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		sendValidationError(w, r, "id inválido")
+		return
+	}
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		sendValidationError(w, r, "parâmetro obrigatório ausente: reason")
+		return
+	}
+	if utf8.RuneCountInString(reason) > maxAccessReasonLength {
+		sendValidationError(w, r, "parâmetro 'reason' deve ter no máximo 500 caracteres")
+		return
+	}
+
+	photo, image, err := h.viewer.Open(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		SendJSONError(w, "Foto não encontrada", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrPhotoContentUnavailable) {
+		slog.Warn("imagem da foto indisponível", "error", err, "photo_id", id)
+		SendJSONError(w, "Imagem da foto indisponível", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("falha ao abrir a foto", "error", err, "photo_id", id)
+		SendJSONError(w, "Erro interno ao consultar a foto", http.StatusInternalServerError)
+		return
+	}
+	defer image.Close()
+
+	// Sem o registro do acesso a imagem não é entregue.
+	auditEvent := models.AuditEvent{
+		Actor:  principal.Name,
+		Action: "PHOTO_VIEWED",
+		Details: map[string]interface{}{
+			"photo_id":    photo.ID,
+			"device_id":   photo.DeviceID,
+			"role":        principal.Role,
+			"reason":      reason,
+			"remote_addr": r.RemoteAddr,
+		},
+	}
+	if err := h.db.LogAuditEvent(r.Context(), auditEvent); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para acesso à foto", "error", err, "photo_id", id)
+		SendJSONError(w, "Erro interno ao registrar o acesso", http.StatusInternalServerError)
+		return
+	}
+
+	body := bufio.NewReader(image)
+	head, _ := body.Peek(512)
+	w.Header().Set("Content-Type", http.DetectContentType(head))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	slog.Info("foto acessada", "photo_id", photo.ID, "actor", principal.Name, "role", principal.Role)
+	if _, err := io.Copy(w, body); err != nil {
+		if errors.Is(err, services.ErrPhotoContentUnavailable) {
+			// Parte da imagem já foi enviada: derrubar a conexão impede que o cliente tome o que recebeu
+			// por uma imagem completa.
+			slog.Error("objeto da foto corrompido durante o envio", "error", err, "photo_id", photo.ID)
+			panic(http.ErrAbortHandler)
+		}
+		slog.Warn("envio da foto interrompido", "error", err, "photo_id", photo.ID)
+	}
+}
+
+// HandleDevicePhotos lista as fotos de um dispositivo
+// @Summary      Lista as fotos de um dispositivo
+// @Description  Retorna os metadados das fotos no intervalo (sem a imagem), com o rosto reconhecido em cada uma: face_id e similarity do Rekognition e driver_id do motorista associado ao rosto. Fotos sem rosto reconhecido vêm sem esses campos; driver_id também fica ausente quando o rosto não está associado a um motorista. O intervalo é de no máximo 31 dias. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Photos
+// @Produce      json
+// @Param        id    path      string  true   "ID do dispositivo"
+// @Param        from  query     string  false  "Início (RFC3339), padrão: 24h antes de 'to'"
+// @Param        to    query     string  false  "Fim (RFC3339), padrão: agora"
+// @Success      200  {object}  models.DevicePhotos
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /devices/{id}/photos [get]
+func (a *API) HandleDevicePhotos(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("id")
+	if deviceID == "" {
+		sendValidationError(w, r, "campo obrigatório ausente: id")
+		return
+	}
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	if to.Sub(from) > maxDevicePhotosRange {
+		sendValidationError(w, r, "intervalo máximo de 31 dias entre 'from' e 'to'")
+		return
+	}
+
+	photos := []models.PhotoMetadata{}
+	err = a.db.StreamPhotoMetadata(r.Context(), deviceID, from, to, func(p models.PhotoMetadata) error {
+		photos = append(photos, p)
+		return nil
+	})
+	if err != nil {
+		slog.Error("falha ao consultar fotos do dispositivo", "error", err, "device_id", deviceID)
+		SendJSONError(w, "Erro interno ao consultar as fotos", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.DevicePhotos{DeviceID: deviceID, From: from, To: to, Photos: photos})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"challenge-v3/services"
+	"challenge-v3/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) GetPhoto(ctx context.Context, id int64) (*models.StoredPhoto, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StoredPhoto), args.Error(1)
+}
+
+func (m *MockStorage) StreamPhotoMetadata(ctx context.Context, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error {
+	args := m.Called(deviceID, from, to)
+	for _, p := range args.Get(0).([]models.PhotoMetadata) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func testKeyring(t *testing.T) services.PhotoKeys {
+	keys, err := crypto.NewKeyring(map[uint32][]byte{1: []byte("este-e-um-segredo-de-32-bytes!!*")})
+	require.NoError(t, err)
+	return services.PhotoKeys{Provider: crypto.NewLocalKeyProvider(keys), Legacy: keys}
+}
+
+// photoFixture grava face.jpg cifrada com uma chave de dados no blob store e devolve a linha que aponta
+// para ela.
+func photoFixture(t *testing.T, keys services.PhotoKeys) (*models.StoredPhoto, blob.Store, []byte) {
+	image, err := os.ReadFile("testData/face.jpg")
+	require.NoError(t, err)
+	dataKey, err := crypto.NewDataKey()
+	require.NoError(t, err)
+	wrapped, version, err := keys.Provider.WrapKey(context.Background(), dataKey)
+	require.NoError(t, err)
+	encrypted, err := crypto.Encrypt(image, dataKey)
+	require.NoError(t, err)
+	store, err := blob.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "photos/dev/1", bytes.NewReader(encrypted), int64(len(encrypted))))
+	sum := sha256.Sum256(encrypted)
+	photo := &models.StoredPhoto{
+		PhotoMetadata: models.PhotoMetadata{ID: 1, DeviceID: "dev", Timestamp: time.Now()},
+		PhotoContent: models.PhotoContent{Key: "photos/dev/1", Size: int64(len(encrypted)),
+			SHA256: hex.EncodeToString(sum[:]), Encryption: models.PhotoEncryptionDataKey, KeyVersion: version,
+			WrappedKey: wrapped},
+	}
+	return photo, store, image
+}
+
+func photosMux(t *testing.T, db storage.Storage, store blob.Store, keys services.PhotoKeys) *http.ServeMux {
+	privileged, err := ParsePrivilegedKeys("ana:investigator:chave-ana")
+	require.NoError(t, err)
+	handler := NewPhotoHandler(db, services.NewPhotoViewer(db, store, keys))
+	mux := http.NewServeMux()
+	mux.Handle("GET /photos/{id}", RequireRole(privileged, RoleInvestigator)(http.HandlerFunc(handler.HandleGetPhoto)))
+	return mux
+}
+
+func getPhoto(mux *http.ServeMux, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("X-API-Key", "chave-ana")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleGetPhoto_DecryptsAndAudits(t *testing.T) {
+	keys := testKeyring(t)
+	photo, store, image := photoFixture(t, keys)
+	mockDB := new(MockStorage)
+	mockDB.On("GetPhoto", int64(1)).Return(photo, nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "PHOTO_VIEWED" && e.Actor == "ana" && e.Details["reason"] == "incidente 42" &&
+			e.Details["role"] == RoleInvestigator && e.Details["device_id"] == "dev"
+	})).Return(nil)
+
+	rr := getPhoto(photosMux(t, mockDB, store, keys), "/photos/1?reason=incidente+42")
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	assert.Equal(t, image, rr.Body.Bytes())
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleGetPhoto_Errors(t *testing.T) {
+	keys := testKeyring(t)
+	photo, store, _ := photoFixture(t, keys)
+	tampered := *photo
+	tampered.ID, tampered.SHA256 = 3, "00"
+	mockDB := new(MockStorage)
+	mockDB.On("GetPhoto", int64(1)).Return(photo, nil)
+	mockDB.On("GetPhoto", int64(2)).Return(nil, storage.ErrNotFound)
+	mockDB.On("GetPhoto", int64(3)).Return(&tampered, nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(errors.New("audit_log indisponível"))
+	mux := photosMux(t, mockDB, store, keys)
+
+	assert.Equal(t, http.StatusBadRequest, getPhoto(mux, "/photos/1").Code, "reason é obrigatório")
+	assert.Equal(t, http.StatusBadRequest, getPhoto(mux, "/photos/abc?reason=x").Code)
+	assert.Equal(t, http.StatusNotFound, getPhoto(mux, "/photos/2?reason=x").Code)
+	assert.Equal(t, http.StatusNotFound, getPhoto(mux, "/photos/3?reason=x").Code, "hash divergente não é entregue")
+
+	rr := getPhoto(mux, "/photos/1?reason=x")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "sem auditoria a imagem não sai")
+	assert.NotContains(t, rr.Header().Get("Content-Type"), "image/")
+
+	req := httptest.NewRequest(http.MethodGet, "/photos/1?reason=x", nil)
+	req.Header.Set("X-API-Key", os.Getenv("API_KEY"))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "a API_KEY comum não dá acesso às fotos")
+}
+
+func TestHandleDevicePhotos_ReturnsRecognizedDriver(t *testing.T) {
+	base := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	similarity := 99.2
+	mockDB := new(MockStorage)
+	mockDB.On("StreamPhotoMetadata", "dev-1", base, base.Add(time.Hour)).Return([]models.PhotoMetadata{
+		{ID: 1, DeviceID: "dev-1", Timestamp: base, Recognized: true, DriverID: "drv-1", FaceID: "face-1", Similarity: &similarity},
+		{ID: 2, DeviceID: "dev-1", Timestamp: base.Add(time.Minute)},
+	}, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/photos", NewAPI(mockDB, nil, nil).HandleDevicePhotos)
+
+	url := "/devices/dev-1/photos?from=" + base.Format(time.RFC3339) + "&to=" + base.Add(time.Hour).Format(time.RFC3339)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"driver_id":"drv-1","face_id":"face-1","similarity":99.2`)
+	var listed models.DevicePhotos
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed.Photos, 2)
+	assert.Empty(t, listed.Photos[1].DriverID)
+	assert.Nil(t, listed.Photos[1].Similarity)
+}
+
+func TestHandleDevicePhotos_RangeTooLong(t *testing.T) {
+	base := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	mockDB := new(MockStorage)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/photos", NewAPI(mockDB, nil, nil).HandleDevicePhotos)
+
+	url := "/devices/dev-1/photos?from=" + base.Format(time.RFC3339) + "&to=" + base.Add(32*24*time.Hour).Format(time.RFC3339)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockDB.AssertNotCalled(t, "StreamPhotoMetadata", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Papéis das chaves privilegiadas. A API_KEY comum, compartilhada pelos dispositivos, fica restrita à
+// ingestão; as consultas e exportações de dados da frota exigem uma chave nominal com um desses papéis.
+const (
+	RoleInvestigator = "investigator"
+	RoleAdmin        = "admin"
+)
+
+// Principal identifica o dono de uma chave privilegiada nos registros de auditoria.
+type Principal struct {
+	Name string
+	Role string
+}
+
+type privilegedKey struct {
+	key       []byte
+	principal Principal
+}
+
+// PrivilegedKeys é o conjunto de chaves nominais lido de PRIVILEGED_API_KEYS.
+type PrivilegedKeys []privilegedKey
+
+// ParsePrivilegedKeys lê entradas "nome:papel:chave" separadas por ";". A chave é o restante da entrada
+// e pode conter ":".
+func ParsePrivilegedKeys(raw string) (PrivilegedKeys, error) {
+	var keys PrivilegedKeys
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("chave privilegiada inválida para %q: use nome:papel:chave", parts[0])
+		}
+		if parts[1] != RoleInvestigator && parts[1] != RoleAdmin {
+			return nil, fmt.Errorf("papel desconhecido para %s: %s", parts[0], parts[1])
+		}
+		if keys.lookup(parts[2]) != nil {
+			return nil, fmt.Errorf("chave privilegiada repetida para %s", parts[0])
+		}
+		keys = append(keys, privilegedKey{key: []byte(parts[2]), principal: Principal{Name: parts[0], Role: parts[1]}})
+	}
+	return keys, nil
+}
+
+// lookup compara com todas as chaves em tempo constante, sem parar na primeira que bate.
+func (k PrivilegedKeys) lookup(received string) *Principal {
+	var found *Principal
+	for i := range k {
+		if subtle.ConstantTimeCompare(k[i].key, []byte(received)) == 1 {
+			found = &k[i].principal
+		}
+	}
+	return found
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext retorna o dono da chave usada na requisição, quando ela passou por RequireRole.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// RequireRole substitui o AuthenticationMiddleware nas rotas privilegiadas: aceita apenas chaves de
+// PRIVILEGED_API_KEYS com um dos papéis informados e guarda o Principal no contexto.
+func RequireRole(keys PrivilegedKeys, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := keys.lookup(r.Header.Get("X-API-Key"))
+			if principal == nil {
+				slog.Warn("tentativa de acesso não autorizado a rota privilegiada", "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+				emitSecurityEvent(r, models.SecurityAuthFailure, "", "chave privilegiada desconhecida")
+				SendJSONError(w, "Acesso não autorizado", http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, principal.Role) {
+				slog.Warn("acesso negado por papel", "actor", principal.Name, "role", principal.Role, "path", r.URL.Path)
+				emitSecurityEvent(r, models.SecurityAccessDenied, principal.Name, "papel "+principal.Role+" sem permissão")
+				SendJSONError(w, "Acesso negado para o papel "+principal.Role, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, *principal)))
+		})
+	}
+}
+
+// EventSourceKey aceita a chave no parâmetro api_key, porque o EventSource dos navegadores não envia
+// cabeçalhos. Só deve envolver as rotas SSE: a chave na URL acaba nos logs de proxies. O parâmetro é
+// retirado da URL antes de seguir.
+func EventSourceKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if key := query.Get("api_key"); key != "" {
+			r = r.Clone(r.Context())
+			if r.Header.Get("X-API-Key") == "" {
+				r.Header.Set("X-API-Key", key)
+			}
+			query.Del("api_key")
+			r.URL.RawQuery = query.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
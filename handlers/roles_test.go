@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrivilegedKeys(t *testing.T) {
+	keys, err := ParsePrivilegedKeys("ana:investigator:chave:com:dois-pontos; bruno:admin:outra")
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "ana", Role: RoleInvestigator}, keys.lookup("chave:com:dois-pontos"))
+	assert.Equal(t, &Principal{Name: "bruno", Role: RoleAdmin}, keys.lookup("outra"))
+	assert.Nil(t, keys.lookup(""))
+
+	for _, invalid := range []string{"ana:investigator", "ana:auditor:chave", ":admin:chave", "ana:admin:x;bia:admin:x"} {
+		_, err := ParsePrivilegedKeys(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	keys, err := ParsePrivilegedKeys("ana:investigator:chave-ana;bruno:admin:chave-bruno")
+	require.NoError(t, err)
+	var seen Principal
+	handler := RequireRole(keys, RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = PrincipalFromContext(r.Context())
+	}))
+
+	for key, code := range map[string]int{"": http.StatusUnauthorized, "chave-ana": http.StatusForbidden, "chave-bruno": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, code, rr.Code, key)
+	}
+	assert.Equal(t, Principal{Name: "bruno", Role: RoleAdmin}, seen)
+}
+
+func TestEventSourceKey(t *testing.T) {
+	keys, err := ParsePrivilegedKeys("ana:investigator:chave-ana")
+	require.NoError(t, err)
+	var rawQuery string
+	handler := EventSourceKey(RequireRole(keys, RoleInvestigator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+	})))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/live/positions?fleet=norte&api_key=chave-ana", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "fleet=norte", rawQuery, "a chave não segue na URL")
+
+	rr = httptest.NewRecorder()
+	RequireRole(keys, RoleInvestigator)(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/devices/d/track?api_key=chave-ana", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "fora das rotas SSE a chave só vale no cabeçalho")
+}
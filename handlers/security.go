@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"challenge-v3/messaging"
+	"challenge-v3/metrics"
+	"challenge-v3/models"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"golang.org/x/time/rate"
+)
+
+// SecurityEvents publica os eventos de segurança sem bloquear a requisição: Emit só enfileira, e Run
+// publica no NATS em segundo plano. Com a fila cheia, ou acima de perSecond eventos por segundo (uma
+// enxurrada de 429 não pode virar uma enxurrada de gravações no audit_log), o evento é descartado e
+// contado em security_events_dropped_total.
+type SecurityEvents struct {
+	js      nats.JetStreamContext
+	events  chan models.SecurityEvent
+	limiter *rate.Limiter
+}
+
+func NewSecurityEvents(js nats.JetStreamContext, buffer int, perSecond float64) *SecurityEvents {
+	return &SecurityEvents{
+		js:      js,
+		events:  make(chan models.SecurityEvent, buffer),
+		limiter: rate.NewLimiter(rate.Limit(perSecond), max(1, int(2*perSecond))),
+	}
+}
+
+// securityEvents é o publicador usado pelos middlewares e handlers; nil só registra no log.
+var securityEvents *SecurityEvents
+
+// SetSecurityEvents liga a publicação dos eventos de segurança.
+func SetSecurityEvents(s *SecurityEvents) {
+	securityEvents = s
+}
+
+// Emit enfileira o evento; nunca bloqueia.
+func (s *SecurityEvents) Emit(event models.SecurityEvent) {
+	metrics.SecurityEventsTotal.WithLabelValues(event.Type).Inc()
+	if s == nil {
+		return
+	}
+	if !s.limiter.Allow() {
+		metrics.SecurityEventsDropped.Inc()
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		metrics.SecurityEventsDropped.Inc()
+	}
+}
+
+// Run publica os eventos enfileirados até ctx ser cancelado.
+func (s *SecurityEvents) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("falha ao codificar evento de segurança", "error", err)
+				continue
+			}
+			if _, err := s.js.Publish(messaging.SecurityEventsSubject, data); err != nil {
+				slog.Error("Falha ao publicar mensagem no NATS", "topic", messaging.SecurityEventsSubject, "error", err)
+				metrics.SecurityEventsDropped.Inc()
+			}
+		}
+	}
+}
+
+// clientIP é o endereço de origem da requisição, o mesmo usado pelo rate limiter.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// emitSecurityEvent registra uma requisição recusada. actor é o dono da chave, quando conhecido.
+func emitSecurityEvent(r *http.Request, eventType, actor, reason string) {
+	securityEvents.Emit(models.SecurityEvent{
+		Type:      eventType,
+		Source:    clientIP(r),
+		Actor:     actor,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Reason:    reason,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// sendValidationError responde 400 e registra a falha de validação como evento de segurança.
+func sendValidationError(w http.ResponseWriter, r *http.Request, message string) {
+	emitSecurityEvent(r, models.SecurityValidationFailed, "", message)
+	SendJSONError(w, message, http.StatusBadRequest)
+}
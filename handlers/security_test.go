@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"challenge-v3/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureSecurityEvents liga um publicador sem NATS e devolve a fila dele para o teste ler.
+func captureSecurityEvents(t *testing.T, perSecond float64) *SecurityEvents {
+	events := NewSecurityEvents(nil, 16, perSecond)
+	SetSecurityEvents(events)
+	t.Cleanup(func() { SetSecurityEvents(nil) })
+	return events
+}
+
+func nextSecurityEvent(t *testing.T, events *SecurityEvents) models.SecurityEvent {
+	t.Helper()
+	select {
+	case event := <-events.events:
+		return event
+	default:
+		t.Fatal("nenhum evento de segurança emitido")
+		return models.SecurityEvent{}
+	}
+}
+
+func TestSecurityEvents_EmittedForRejectedRequests(t *testing.T) {
+	t.Setenv("API_KEY", "chave-de-teste")
+	events := captureSecurityEvents(t, 1000)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/telemetry/gps", nil)
+	req.RemoteAddr = "10.1.1.1:5000"
+	AuthenticationMiddleware(ok).ServeHTTP(httptest.NewRecorder(), req)
+	event := nextSecurityEvent(t, events)
+	assert.Equal(t, models.SecurityAuthFailure, event.Type)
+	assert.Equal(t, "10.1.1.1", event.Source)
+	assert.Equal(t, "/telemetry/gps", event.Path)
+	assert.Equal(t, "chave de API ausente", event.Reason)
+
+	privileged, err := ParsePrivilegedKeys("ana:investigator:chave-ana")
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+	req.Header.Set("X-API-Key", "chave-ana")
+	RequireRole(privileged, RoleAdmin)(ok).ServeHTTP(httptest.NewRecorder(), req)
+	event = nextSecurityEvent(t, events)
+	assert.Equal(t, models.SecurityAccessDenied, event.Type)
+	assert.Equal(t, "ana", event.Actor)
+
+	req = httptest.NewRequest(http.MethodPost, "/telemetry/gps", bytes.NewBufferString(`{"device_id": ""}`))
+	rr := httptest.NewRecorder()
+	NewAPI(nil, nil, nil).HandleGPS(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	event = nextSecurityEvent(t, events)
+	assert.Equal(t, models.SecurityValidationFailed, event.Type)
+	assert.NotEmpty(t, event.Reason)
+
+	limited := RateLimiterMiddleware(ok)
+	for i := 0; i < 11; i++ {
+		req = httptest.NewRequest(http.MethodGet, "/devices/x/track", nil)
+		req.RemoteAddr = "10.9.9.9:5000"
+		limited.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	event = nextSecurityEvent(t, events)
+	assert.Equal(t, models.SecurityRateLimited, event.Type)
+	assert.Equal(t, "10.9.9.9", event.Source)
+
+	req = httptest.NewRequest(http.MethodPost, "/telemetry/gps", nil)
+	req.Header.Set("X-API-Key", "chave-de-teste")
+	AuthenticationMiddleware(ok).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, events.events, "requisições aceitas não geram eventos")
+}
+
+func TestSecurityEvents_DropsInsteadOfBlocking(t *testing.T) {
+	events := NewSecurityEvents(nil, 2, 1000)
+	for i := 0; i < 5; i++ {
+		events.Emit(models.SecurityEvent{Type: models.SecurityAuthFailure, Source: "10.0.0.1"})
+	}
+	assert.Len(t, events.events, 2, "com a fila cheia os eventos são descartados")
+
+	limited := NewSecurityEvents(nil, 100, 1)
+	for i := 0; i < 10; i++ {
+		limited.Emit(models.SecurityEvent{Type: models.SecurityRateLimited, Source: "10.0.0.1"})
+	}
+	assert.Len(t, limited.events, 2, "acima da taxa os eventos são descartados")
+
+	var disabled *SecurityEvents
+	disabled.Emit(models.SecurityEvent{Type: models.SecurityAuthFailure, Source: "10.0.0.1"})
+}
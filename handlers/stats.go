@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"challenge-v3/geo"
+	"challenge-v3/models"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Intervalos curtos são agregados direto das tabelas brutas (sempre atualizados);
+	// intervalos maiores usam os rollups para não varrer milhões de linhas.
+	rawStatsMaxRange    = 2 * time.Hour
+	minuteStatsMaxRange = 7 * 24 * time.Hour
+)
+
+func chooseResolution(from, to time.Time) string {
+	switch span := to.Sub(from); {
+	case span <= rawStatsMaxRange:
+		return models.ResolutionRaw
+	case span <= minuteStatsMaxRange:
+		return models.ResolutionMinute
+	default:
+		return models.ResolutionHour
+	}
+}
+
+// HandleDeviceStats consulta a telemetria agregada de um dispositivo
+// @Summary      Telemetria agregada por intervalo de tempo
+// @Description  Retorna, por minuto ou por hora, a contagem de pontos, distância percorrida, área coberta e magnitude do giroscópio. Com resolution=auto (padrão), intervalos de até 2h são calculados dos dados brutos, até 7 dias usam os rollups por minuto e acima disso os rollups por hora. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Tracks
+// @Produce      json
+// @Param        id          path      string  true   "ID do dispositivo"
+// @Param        from        query     string  false  "Início (RFC3339), padrão: 24h antes de 'to'"
+// @Param        to          query     string  false  "Fim (RFC3339), padrão: agora"
+// @Param        resolution  query     string  false  "auto, raw, minute ou hour"
+// @Success      200  {object}  models.TelemetryStats
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /devices/{id}/stats [get]
+func (a *API) HandleDeviceStats(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("id")
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	resolution := r.URL.Query().Get("resolution")
+	switch resolution {
+	case "", "auto":
+		resolution = chooseResolution(from, to)
+	case models.ResolutionRaw, models.ResolutionMinute, models.ResolutionHour:
+	default:
+		sendValidationError(w, r, "resolution inválida: use auto, raw, minute ou hour")
+		return
+	}
+
+	buckets, err := a.db.QueryRollups(r.Context(), deviceID, from, to, resolution)
+	if err != nil {
+		slog.Error("falha ao consultar telemetria agregada", "error", err, "device_id", deviceID)
+		SendJSONError(w, "Erro interno ao consultar a telemetria", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TelemetryStats{
+		DeviceID:   deviceID,
+		Resolution: resolution,
+		From:       from,
+		To:         to,
+		Buckets:    buckets,
+	})
+}
+
+// HandleGPSAreas agrega as leituras de GPS por região
+// @Summary      Leituras de GPS por célula de geohash
+// @Description  Conta leituras e dispositivos por célula de geohash no intervalo, a partir da coluna geohash gravada em claro. Funciona também com a cifragem das coordenadas ligada (GPS_ENCRYPTION), sem expor as posições exatas. Leituras gravadas antes da coluna existir não entram. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Tracks
+// @Produce      json
+// @Param        device_id  query     string  false  "ID do dispositivo (vazio para todos)"
+// @Param        from       query     string  false  "Início (RFC3339), padrão: 24h antes de 'to'"
+// @Param        to         query     string  false  "Fim (RFC3339), padrão: agora"
+// @Param        precision  query     int     false  "Caracteres do geohash, de 1 a 6 (padrão: 5, células de cerca de 5 km)"
+// @Success      200  {object}  models.GPSAreas
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /telemetry/areas [get]
+func (a *API) HandleGPSAreas(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	precision := 5
+	if raw := r.URL.Query().Get("precision"); raw != "" {
+		precision, err = strconv.Atoi(raw)
+		if err != nil || precision < 1 || precision > geo.CoarseGeohashPrecision {
+			sendValidationError(w, r, fmt.Sprintf("precision inválida: use de 1 a %d", geo.CoarseGeohashPrecision))
+			return
+		}
+	}
+	deviceID := r.URL.Query().Get("device_id")
+
+	areas, err := a.db.QueryGPSAreas(r.Context(), deviceID, from, to, precision)
+	if err != nil {
+		slog.Error("falha ao agregar leituras de gps por região", "error", err, "device_id", deviceID)
+		SendJSONError(w, "Erro interno ao consultar a telemetria", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GPSAreas{
+		DeviceID:  deviceID,
+		Precision: precision,
+		From:      from,
+		To:        to,
+		Areas:     areas,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) QueryRollups(ctx context.Context, deviceID string, from, to time.Time, resolution string) ([]models.TelemetryRollup, error) {
+	args := m.Called(deviceID, from, to, resolution)
+	return args.Get(0).([]models.TelemetryRollup), args.Error(1)
+}
+
+func (m *MockStorage) QueryGPSAreas(ctx context.Context, deviceID string, from, to time.Time, precision int) ([]models.GPSArea, error) {
+	args := m.Called(deviceID, from, to, precision)
+	return args.Get(0).([]models.GPSArea), args.Error(1)
+}
+
+func TestHandleDeviceStats_PicksResolutionByRange(t *testing.T) {
+	base := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		span     time.Duration
+		expected string
+	}{
+		{time.Hour, models.ResolutionRaw},
+		{48 * time.Hour, models.ResolutionMinute},
+		{30 * 24 * time.Hour, models.ResolutionHour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			mockDB := new(MockStorage)
+			mockDB.On("QueryRollups", "dev-1", base, base.Add(tc.span), tc.expected).
+				Return([]models.TelemetryRollup{{DeviceID: "dev-1", Bucket: base, GPSPoints: 3}}, nil)
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /devices/{id}/stats", NewAPI(mockDB, nil, nil).HandleDeviceStats)
+
+			url := "/devices/dev-1/stats?from=" + base.Format(time.RFC3339) + "&to=" + base.Add(tc.span).Format(time.RFC3339)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			var stats models.TelemetryStats
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+			assert.Equal(t, tc.expected, stats.Resolution)
+			assert.Len(t, stats.Buckets, 1)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleDeviceStats_InvalidResolution(t *testing.T) {
+	mockDB := new(MockStorage)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/stats", NewAPI(mockDB, nil, nil).HandleDeviceStats)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/devices/dev-1/stats?resolution=second", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockDB.AssertNotCalled(t, "QueryRollups", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleGPSAreas(t *testing.T) {
+	base := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	mockDB := new(MockStorage)
+	mockDB.On("QueryGPSAreas", "", base, base.Add(time.Hour), 4).
+		Return([]models.GPSArea{{Geohash: "6gyf", Points: 10, Devices: 2}}, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /telemetry/areas", NewAPI(mockDB, nil, nil).HandleGPSAreas)
+	query := "from=" + base.Format(time.RFC3339) + "&to=" + base.Add(time.Hour).Format(time.RFC3339)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/telemetry/areas?precision=4&"+query, nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var areas models.GPSAreas
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &areas))
+	assert.Equal(t, 4, areas.Precision)
+	require.Len(t, areas.Areas, 1)
+	assert.Equal(t, int64(2), areas.Areas[0].Devices)
+
+	for _, precision := range []string{"0", "7", "x"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/telemetry/areas?precision="+precision+"&"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "precisão acima da gravada não tem como ser respondida")
+	}
+	mockDB.AssertExpectations(t)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bufio"
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTrackRange = 24 * time.Hour
+	tripGap           = 10 * time.Minute
+)
+
+// parseTimeRange lê os parâmetros from/to (RFC3339). Sem eles, devolve as últimas 24 horas.
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parâmetro 'to' inválido, use RFC3339")
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultTrackRange)
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parâmetro 'from' inválido, use RFC3339")
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' deve ser anterior a 'to'")
+	}
+	return from, to, nil
+}
+
+// HandleDeviceTrack exporta o trajeto de um dispositivo
+// @Summary      Exporta o trajeto de um dispositivo
+// @Description  Transmite as leituras de GPS armazenadas no formato GPX, KML ou GeoJSON. Intervalos de mais de 10 minutos sem leituras separam as viagens. Exige uma chave de PRIVILEGED_API_KEYS com papel investigator ou admin.
+// @Tags         Tracks
+// @Produce      application/gpx+xml,application/vnd.google-earth.kml+xml,application/geo+json
+// @Param        id      path      string  true   "ID do dispositivo"
+// @Param        from    query     string  false  "Início (RFC3339), padrão: 24h antes de 'to'"
+// @Param        to      query     string  false  "Fim (RFC3339), padrão: agora"
+// @Param        format  query     string  false  "gpx, kml ou geojson (padrão: geojson)"
+// @Success      200  {file}    file
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /devices/{id}/track [get]
+func (a *API) HandleDeviceTrack(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("id")
+	if deviceID == "" {
+		sendValidationError(w, r, "campo obrigatório ausente: id")
+		return
+	}
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "geojson"
+	}
+
+	buffered := bufio.NewWriter(w)
+	encoder, err := export.NewTrackEncoder(format, buffered)
+	if err != nil {
+		sendValidationError(w, r, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", encoder.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", deviceID+"-track."+encoder.Extension()))
+
+	track, err := export.NewTrackWriter(encoder, deviceID, tripGap)
+	if err != nil {
+		slog.Error("falha ao iniciar exportação de trajeto", "error", err, "device_id", deviceID)
+		return
+	}
+	points := 0
+	err = a.db.StreamGPS(r.Context(), deviceID, from, to, func(p models.GPSData) error {
+		points++
+		return track.Write(p)
+	})
+	if err != nil && points == 0 {
+		// Nada foi enviado ainda (apenas o cabeçalho do arquivo está no buffer), então dá para responder com erro.
+		slog.Error("falha ao consultar trajeto", "error", err, "device_id", deviceID)
+		buffered.Reset(w)
+		w.Header().Del("Content-Disposition")
+		SendJSONError(w, "Erro interno ao consultar o trajeto", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// O cabeçalho já foi enviado; o cliente recebe um arquivo truncado e o erro fica no log.
+		slog.Error("falha ao exportar trajeto", "error", err, "device_id", deviceID, "points", points)
+		buffered.Flush()
+		return
+	}
+	if err := track.Close(); err != nil {
+		slog.Error("falha ao finalizar exportação de trajeto", "error", err, "device_id", deviceID)
+		return
+	}
+	if err := buffered.Flush(); err != nil {
+		slog.Error("falha ao enviar trajeto", "error", err, "device_id", deviceID)
+		return
+	}
+	slog.Info("trajeto exportado", "device_id", deviceID, "format", format, "points", points)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"challenge-v3/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func trackRequest(api *API, url string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices/{id}/track", api.HandleDeviceTrack)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+	return rr
+}
+
+func TestHandleDeviceTrack_GeoJSONSplitsTrips(t *testing.T) {
+	mockDB := new(MockStorage)
+	api := NewAPI(mockDB, nil, nil)
+	base := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	points := []models.GPSData{
+		{DeviceID: "dev-1", Latitude: float64Ptr(-8.0), Longitude: float64Ptr(-34.0), Timestamp: base},
+		{DeviceID: "dev-1", Latitude: float64Ptr(-8.1), Longitude: float64Ptr(-34.1), Timestamp: base.Add(time.Minute)},
+		{DeviceID: "dev-1", Latitude: float64Ptr(-8.2), Longitude: float64Ptr(-34.2), Timestamp: base.Add(2 * time.Hour)},
+	}
+	from, to := base.Add(-time.Hour), base.Add(3*time.Hour)
+	mockDB.On("StreamGPS", "dev-1", from, to).Return(points, nil)
+
+	rr := trackRequest(api, "/devices/dev-1/track?format=geojson&from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/geo+json", rr.Header().Get("Content-Type"))
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &collection))
+	require.Len(t, collection.Features, 2, "o intervalo de 2h deve separar duas viagens")
+	assert.Equal(t, "LineString", collection.Features[0].Geometry.Type)
+	assert.JSONEq(t, `[[-34,-8],[-34.1,-8.1]]`, string(collection.Features[0].Geometry.Coordinates))
+	// Uma viagem de uma leitura só vira um Point: a RFC 7946 exige duas posições num LineString.
+	assert.Equal(t, "Point", collection.Features[1].Geometry.Type)
+	assert.JSONEq(t, `[-34.2,-8.2]`, string(collection.Features[1].Geometry.Coordinates))
+	assert.Equal(t, float64(2), collection.Features[1].Properties["trip"])
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleDeviceTrack_GPXAndKML(t *testing.T) {
+	base := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	points := []models.GPSData{{DeviceID: "dev-<1>", Latitude: float64Ptr(-8.5), Longitude: float64Ptr(-34.5), Timestamp: base}}
+
+	for format, expected := range map[string]string{
+		"gpx": `<trkpt lat="-8.5" lon="-34.5"><time>2025-01-10T08:00:00Z</time></trkpt>`,
+		"kml": "-34.5,-8.5,0",
+	} {
+		t.Run(format, func(t *testing.T) {
+			mockDB := new(MockStorage)
+			mockDB.On("StreamGPS", "dev-<1>", mock.Anything, mock.Anything).Return(points, nil)
+			rr := trackRequest(NewAPI(mockDB, nil, nil), "/devices/dev-%3C1%3E/track?format="+format)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), expected)
+			assert.Contains(t, rr.Body.String(), "dev-&lt;1&gt;")
+			assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment"))
+		})
+	}
+}
+
+func TestHandleDeviceTrack_Errors(t *testing.T) {
+	t.Run("formato inválido", func(t *testing.T) {
+		rr := trackRequest(NewAPI(new(MockStorage), nil, nil), "/devices/dev-1/track?format=shp")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("intervalo inválido", func(t *testing.T) {
+		rr := trackRequest(NewAPI(new(MockStorage), nil, nil), "/devices/dev-1/track?from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("falha no banco antes do primeiro ponto", func(t *testing.T) {
+		mockDB := new(MockStorage)
+		mockDB.On("StreamGPS", "dev-1", mock.Anything, mock.Anything).Return(nil, errors.New("conexão perdida"))
+		rr := trackRequest(NewAPI(mockDB, nil, nil), "/devices/dev-1/track")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Empty(t, rr.Header().Get("Content-Disposition"))
+	})
+}
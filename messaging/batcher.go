@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Batcher acumula mensagens de uma assinatura e as entrega a handle em lotes de até size mensagens,
+// ou quando interval se passa desde a primeira mensagem pendente. O handle é responsável pelo ack de
+// cada mensagem, então o AckWait do consumidor precisa ser bem maior que interval.
+type Batcher struct {
+	size     int
+	interval time.Duration
+	deadline time.Duration
+	handle   func(ctx context.Context, batch []*nats.Msg)
+	msgs     chan *nats.Msg
+}
+
+// NewBatcher cria o acumulador. O contexto entregue a handle expira deadline depois da chegada da
+// primeira mensagem do lote, para que o processamento termine antes de o JetStream reenviá-la.
+func NewBatcher(size int, interval, deadline time.Duration, handle func(ctx context.Context, batch []*nats.Msg)) *Batcher {
+	return &Batcher{size: size, interval: interval, deadline: deadline, handle: handle, msgs: make(chan *nats.Msg, size)}
+}
+
+// Add é o nats.MsgHandler da assinatura. Bloqueia enquanto um lote cheio está sendo gravado,
+// o que segura a entrega de novas mensagens pelo servidor.
+func (b *Batcher) Add(msg *nats.Msg) {
+	b.msgs <- msg
+}
+
+// Run entrega os lotes até o contexto ser cancelado, gravando o que estiver pendente antes de sair.
+// O cancelamento de ctx não interrompe o lote em andamento, só o prazo de cada lote.
+func (b *Batcher) Run(ctx context.Context) {
+	batch := make([]*nats.Msg, 0, b.size)
+	var first time.Time
+	timer := time.NewTimer(b.interval)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		if len(batch) == 0 {
+			return
+		}
+		batchCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), first.Add(b.deadline))
+		b.handle(batchCtx, batch)
+		cancel()
+		batch = make([]*nats.Msg, 0, b.size)
+	}
+
+	for {
+		select {
+		case msg := <-b.msgs:
+			if len(batch) == 0 {
+				first = time.Now()
+				timer.Reset(b.interval)
+			}
+			batch = append(batch, msg)
+			if len(batch) >= b.size {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case msg := <-b.msgs:
+					if len(batch) == 0 {
+						first = time.Now()
+					}
+					batch = append(batch, msg)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
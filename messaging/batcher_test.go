@@ -0,0 +1,110 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]*nats.Msg
+	done    chan struct{}
+}
+
+func (r *batchRecorder) handle(ctx context.Context, batch []*nats.Msg) {
+	r.mu.Lock()
+	r.batches = append(r.batches, batch)
+	r.mu.Unlock()
+	r.done <- struct{}{}
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := []int{}
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func waitBatch(t *testing.T, r *batchRecorder) {
+	select {
+	case <-r.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("lote não foi entregue")
+	}
+}
+
+func TestBatcher_FlushesWhenFull(t *testing.T) {
+	rec := &batchRecorder{done: make(chan struct{}, 10)}
+	b := NewBatcher(3, time.Hour, time.Minute, rec.handle)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	for i := 0; i < 3; i++ {
+		b.Add(&nats.Msg{Subject: "telemetry.gps"})
+	}
+	waitBatch(t, rec)
+
+	assert.Equal(t, []int{3}, rec.sizes())
+}
+
+func TestBatcher_FlushesAfterInterval(t *testing.T) {
+	rec := &batchRecorder{done: make(chan struct{}, 10)}
+	b := NewBatcher(100, 20*time.Millisecond, time.Minute, rec.handle)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	b.Add(&nats.Msg{Subject: "telemetry.gps"})
+	b.Add(&nats.Msg{Subject: "telemetry.gps"})
+	waitBatch(t, rec)
+
+	assert.Equal(t, []int{2}, rec.sizes())
+}
+
+func TestBatcher_FlushesPendingOnShutdown(t *testing.T) {
+	rec := &batchRecorder{done: make(chan struct{}, 10)}
+	b := NewBatcher(100, time.Hour, time.Minute, rec.handle)
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(finished)
+	}()
+
+	b.Add(&nats.Msg{Subject: "telemetry.gyroscope"})
+	cancel()
+	<-finished
+
+	assert.Equal(t, []int{1}, rec.sizes())
+}
+
+func TestBatcher_DeadlineStartsAtFirstMessage(t *testing.T) {
+	deadlines := make(chan time.Time, 1)
+	b := NewBatcher(2, time.Hour, 5*time.Second, func(ctx context.Context, batch []*nats.Msg) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	start := time.Now()
+	b.Add(&nats.Msg{})
+	b.Add(&nats.Msg{})
+
+	select {
+	case deadline := <-deadlines:
+		assert.WithinDuration(t, start.Add(5*time.Second), deadline, time.Second)
+	case <-time.After(2 * time.Second):
+		t.Fatal("lote não foi entregue")
+	}
+}
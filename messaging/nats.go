@@ -7,6 +7,9 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+// SecurityEventsSubject é o tópico dos eventos de segurança da API, gravados pelo worker no audit_log.
+const SecurityEventsSubject = "security.events"
+
 func ConnectNATS(natsURL string) (*nats.Conn, error) {
 	nc, err := nats.Connect(natsURL, nats.ReconnectWait(10*time.Second), nats.MaxReconnects(5))
 	if err != nil {
@@ -22,13 +25,17 @@ func SetupJetStream(nc *nats.Conn) (nats.JetStreamContext, error) {
 		return nil, err
 	}
 
-	_, err = js.AddStream(&nats.StreamConfig{
-		Name:     "TELEMETRY",
-		Subjects: []string{"telemetry.*"},
-	})
-	if err != nil {
-		if err != nats.ErrStreamNameAlreadyInUse {
-			return nil, err
+	// SECURITY recebe os eventos de segurança da API (requisições recusadas), gravados pelo worker no audit_log.
+	streams := []*nats.StreamConfig{
+		{Name: "TELEMETRY", Subjects: []string{"telemetry.*"}},
+		{Name: "SECURITY", Subjects: []string{"security.*"}},
+	}
+	for _, stream := range streams {
+		_, err = js.AddStream(stream)
+		if err != nil {
+			if err != nats.ErrStreamNameAlreadyInUse {
+				return nil, err
+			}
 		}
 	}
 	slog.Info("JetStream configurado e pronto")
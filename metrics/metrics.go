@@ -34,6 +34,51 @@ var NatsMessagesProcessed = promauto.NewCounterVec(
 	[]string{"subject", "status"},
 )
 
+var OverspeedEventsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "overspeed_events_total",
+		Help: "Total de eventos de excesso de velocidade detectados pelo worker.",
+	},
+)
+
+var WorkerBatchSize = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "worker_batch_size",
+		Help:    "Quantidade de mensagens gravadas por lote no worker.",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	},
+	[]string{"subject"},
+)
+
+var SecurityEventsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "security_events_total",
+		Help: "Requisições recusadas pela API por tipo de evento de segurança.",
+	},
+	[]string{"type"},
+)
+
+var SecurityEventsDropped = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "security_events_dropped_total",
+		Help: "Eventos de segurança descartados pela API (fila cheia, limite de taxa ou falha ao publicar).",
+	},
+)
+
+var SecurityAlertsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "security_alerts_total",
+		Help: "Alertas de falhas repetidas de uma mesma origem detectados pelo worker.",
+	},
+)
+
+var PhotoReencryptionPending = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "photo_reencryption_pending",
+		Help: "Fotos que ainda não estão na versão atual da chave de criptografia.",
+	},
+)
+
 func PrometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -63,3 +108,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap permite que http.ResponseController alcance o Flusher do writer original (necessário para SSE).
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -1,10 +1,28 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// MaxClockSkew é o quanto o timestamp de uma leitura pode estar à frente do relógio do servidor. Leituras
+// mais adiantadas vêm de um relógio errado e cairiam na partição padrão, fora dos meses já criados.
+const MaxClockSkew = 24 * time.Hour
+
+func validateTimestamp(t time.Time) error {
+	if t.IsZero() {
+		return errors.New("campo obrigatório ausente: timestamp")
+	}
+	if t.After(time.Now().Add(MaxClockSkew)) {
+		return fmt.Errorf("timestamp no futuro: no máximo %s à frente do relógio do servidor", MaxClockSkew)
+	}
+	return nil
+}
+
 type GyroscopeData struct {
 	DeviceID  string    `json:"device_id"`
 	X         *float64  `json:"x"`
@@ -17,8 +35,8 @@ func (g *GyroscopeData) Validate() error {
 	if g.DeviceID == "" {
 		return errors.New("campo obrigatório ausente: device_id")
 	}
-	if g.Timestamp.IsZero() {
-		return errors.New("campo obrigatório ausente: timestamp")
+	if err := validateTimestamp(g.Timestamp); err != nil {
+		return err
 	}
 	if g.X == nil {
 		return errors.New("campo obrigatório ausente: x")
@@ -37,14 +55,17 @@ type GPSData struct {
 	Latitude  *float64  `json:"latitude"`
 	Longitude *float64  `json:"longitude"`
 	Timestamp time.Time `json:"timestamp"`
+	// Speed (km/h) e Heading (graus) são calculados pelo worker a partir da posição anterior do dispositivo.
+	Speed   *float64 `json:"speed,omitempty" swaggerignore:"true"`
+	Heading *float64 `json:"heading,omitempty" swaggerignore:"true"`
 }
 
 func (gps *GPSData) Validate() error {
 	if gps.DeviceID == "" {
 		return errors.New("campo obrigatório ausente: device_id")
 	}
-	if gps.Timestamp.IsZero() {
-		return errors.New("campo obrigatório ausente: timestamp")
+	if err := validateTimestamp(gps.Timestamp); err != nil {
+		return err
 	}
 	if gps.Latitude == nil {
 		return errors.New("campo obrigatório ausente: latitude")
@@ -55,6 +76,15 @@ func (gps *GPSData) Validate() error {
 	return nil
 }
 
+type OverspeedEvent struct {
+	DeviceID  string    `json:"device_id"`
+	Speed     float64   `json:"speed"`
+	Limit     float64   `json:"limit"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 type PhotoRequest struct {
 	DeviceID  string    `json:"device_id"`
 	Photo     string    `json:"photo"`
@@ -66,6 +96,10 @@ type PhotoData struct {
 	Photo      string    `json:"photo"`
 	Timestamp  time.Time `json:"timestamp"`
 	Recognized bool      `json:"recognized"`
+	// DriverID, FaceID e Similarity vêm da análise no worker e nunca do corpo recebido.
+	DriverID   string   `json:"-"`
+	FaceID     string   `json:"-"`
+	Similarity *float64 `json:"-"`
 }
 
 type AuditEvent struct {
@@ -74,12 +108,110 @@ type AuditEvent struct {
 	Details map[string]interface{} `json:"details"`
 }
 
+// AuditEntry é uma linha gravada do audit_log com os campos do encadeamento. Seq é a posição na cadeia
+// (zero nas linhas anteriores a ela), Hash cobre PrevHash e o conteúdo da linha, e HMAC é o de Hash com
+// AUDIT_HMAC_KEY (vazio quando a chave não estava configurada).
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Seq       int64           `json:"seq"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details" swaggertype:"object"`
+	PrevHash  []byte          `json:"prev_hash"`
+	Hash      []byte          `json:"hash"`
+	HMAC      []byte          `json:"hmac,omitempty"`
+}
+
+// Tipos dos eventos de segurança publicados pela API.
+const (
+	SecurityAuthFailure      = "AUTH_FAILURE"
+	SecurityAccessDenied     = "ACCESS_DENIED"
+	SecurityRateLimited      = "RATE_LIMITED"
+	SecurityValidationFailed = "VALIDATION_FAILED"
+)
+
+// SecurityEvent é uma requisição recusada pela API. Source é o IP de origem e Actor o dono da chave,
+// quando ela é conhecida.
+type SecurityEvent struct {
+	Type      string    `json:"type"`
+	Source    string    `json:"source"`
+	Actor     string    `json:"actor,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (e *SecurityEvent) Validate() error {
+	switch e.Type {
+	case SecurityAuthFailure, SecurityAccessDenied, SecurityRateLimited, SecurityValidationFailed:
+	case "":
+		return errors.New("campo obrigatório ausente: type")
+	default:
+		return fmt.Errorf("tipo de evento de segurança desconhecido: %s", e.Type)
+	}
+	if e.Source == "" {
+		return errors.New("campo obrigatório ausente: source")
+	}
+	if e.Timestamp.IsZero() {
+		return errors.New("campo obrigatório ausente: timestamp")
+	}
+	return nil
+}
+
+const (
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 1000
+)
+
+var auditDetailKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// AuditFilter seleciona linhas do audit_log, das mais novas para as mais antigas. Actor, Action e
+// Details vazios não filtram.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	From   time.Time
+	To     time.Time
+	// Details compara campos de primeiro nível de details com valores JSON (ex.: "device_id": "\"dev-1\"").
+	Details map[string]json.RawMessage
+	// BeforeID continua uma paginação: só linhas com id menor. Zero começa da mais nova.
+	BeforeID int64
+	// Limit zero não limita (exportações).
+	Limit int
+}
+
+func (f *AuditFilter) Validate() error {
+	if !f.From.Before(f.To) {
+		return errors.New("'from' deve ser anterior a 'to'")
+	}
+	for key, value := range f.Details {
+		if !auditDetailKeyPattern.MatchString(key) {
+			return fmt.Errorf("campo de details inválido: %q (use letras, números e _)", key)
+		}
+		if !json.Valid(value) {
+			return fmt.Errorf("valor inválido para details.%s", key)
+		}
+	}
+	if f.Limit < 0 || f.Limit > MaxAuditPageSize {
+		return fmt.Errorf("'limit' deve estar entre 1 e %d", MaxAuditPageSize)
+	}
+	return nil
+}
+
+// AuditPage é uma página da busca no audit_log. NextCursor, quando presente, é o cursor da próxima.
+type AuditPage struct {
+	Events     []AuditEntry `json:"events"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
 func (p *PhotoData) Validate() error {
 	if p.DeviceID == "" {
 		return errors.New("campo obrigatório ausente: device_id")
 	}
-	if p.Timestamp.IsZero() {
-		return errors.New("campo obrigatório ausente: timestamp")
+	if err := validateTimestamp(p.Timestamp); err != nil {
+		return err
 	}
 	if p.Photo == "" {
 		return errors.New("campo obrigatório ausente: photo")
@@ -87,6 +219,305 @@ func (p *PhotoData) Validate() error {
 	return nil
 }
 
+// PhotoMetadata inclui o rosto reconhecido: FaceID e Similarity são do melhor resultado do Rekognition e
+// DriverID é o motorista associado a esse rosto (vazio quando o rosto não está cadastrado).
+type PhotoMetadata struct {
+	ID         int64     `json:"id"`
+	DeviceID   string    `json:"device_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Recognized bool      `json:"recognized"`
+	DriverID   string    `json:"driver_id,omitempty"`
+	FaceID     string    `json:"face_id,omitempty"`
+	Similarity *float64  `json:"similarity,omitempty"`
+}
+
+// driverIDPattern segue o formato aceito pelo Rekognition em ExternalImageId, para que o id do motorista
+// possa identificar os rostos indexados para ele.
+var driverIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,255}$`)
+
+func ValidateDriverID(id string) error {
+	if id == "" {
+		return errors.New("campo obrigatório ausente: id")
+	}
+	if !driverIDPattern.MatchString(id) {
+		return errors.New("id do motorista inválido: use até 255 letras, números, '_', '.', ':' ou '-'")
+	}
+	return nil
+}
+
+// DriverInput cadastra ou atualiza um motorista. FaceIDs associa rostos já indexados na coleção do
+// Rekognition ao motorista; associações anteriores são mantidas.
+type DriverInput struct {
+	Name    string   `json:"name"`
+	FaceIDs []string `json:"face_ids,omitempty"`
+}
+
+func (d *DriverInput) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return errors.New("campo obrigatório ausente: name")
+	}
+	for _, faceID := range d.FaceIDs {
+		if faceID == "" {
+			return errors.New("face_ids não pode conter valores vazios")
+		}
+	}
+	return nil
+}
+
+const (
+	// DriverFaceSourceEnrolled é um rosto indexado a partir de uma foto de referência do cadastro.
+	DriverFaceSourceEnrolled = "enrolled"
+	// DriverFaceSourceAssociated é um rosto que já estava na coleção e foi associado ao motorista.
+	DriverFaceSourceAssociated = "associated"
+)
+
+type DriverFace struct {
+	FaceID    string    `json:"face_id"`
+	DriverID  string    `json:"driver_id"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FaceEnrollmentInput traz uma foto de referência do motorista em base64 (JPEG ou PNG, com um único rosto).
+type FaceEnrollmentInput struct {
+	Photo string `json:"photo"`
+}
+
+func (f *FaceEnrollmentInput) Validate() error {
+	if f.Photo == "" {
+		return errors.New("campo obrigatório ausente: photo")
+	}
+	return nil
+}
+
+type Driver struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	FaceIDs   []string  `json:"face_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	PhotoEncryptionNone = "none"
+	// PhotoEncryptionAES256GCM é o formato antigo (nonce||texto cifrado), sem indicação da chave usada.
+	PhotoEncryptionAES256GCM = "aes-256-gcm"
+	// PhotoEncryptionEnvelope é o envelope de crypto.Keyring, que carrega a versão da chave.
+	PhotoEncryptionEnvelope = "aes-256-gcm-envelope"
+	// PhotoEncryptionDataKey cifra a imagem com uma chave de dados própria, guardada embrulhada pelo
+	// crypto.KeyProvider em WrappedKey.
+	PhotoEncryptionDataKey = "aes-256-gcm-dek"
+	// PhotoEncryptionDataKeyAAD é PhotoEncryptionDataKey com o id, o device_id e o timestamp da linha como
+	// dados autenticados: o objeto não abre se for apontado por outra linha.
+	PhotoEncryptionDataKeyAAD = "aes-256-gcm-dek-aad"
+	// PhotoEncryptionStream tem a mesma chave de dados e os mesmos dados autenticados de
+	// PhotoEncryptionDataKeyAAD, mas cifra em blocos (crypto.StreamWriter): a imagem é gravada e lida sem
+	// ficar inteira em memória.
+	PhotoEncryptionStream = "aes-256-gcm-stream"
+)
+
+// PhotoContent descreve o objeto com a imagem no armazenamento de blobs. Size e SHA256 são do objeto
+// como foi gravado, ou seja, do texto cifrado quando Encryption não é PhotoEncryptionNone. KeyVersion
+// é a versão da chave mestra (do envelope ou da que embrulhou WrappedKey) e zero quando não há uma.
+type PhotoContent struct {
+	Key        string `json:"content_key"`
+	Size       int64  `json:"content_size"`
+	SHA256     string `json:"content_sha256"`
+	Encryption string `json:"encryption"`
+	KeyVersion uint32 `json:"key_version,omitempty"`
+	WrappedKey []byte `json:"-"`
+}
+
+// StoredPhoto é uma linha de photo com a referência para a imagem. Legacy só é preenchido nas linhas
+// que ainda não foram movidas para o armazenamento de blobs.
+type StoredPhoto struct {
+	PhotoMetadata
+	PhotoContent
+	Legacy string `json:"-"`
+}
+
+// LegacyPhoto é uma linha gravada antes do armazenamento de blobs, com a imagem em base64 (cifrada ou
+// não) na própria coluna photo.
+type LegacyPhoto struct {
+	ID        int64
+	DeviceID  string
+	Timestamp time.Time
+	Photo     string
+}
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+type ExportRequest struct {
+	Dataset  string    `json:"dataset"`
+	Format   string    `json:"format"`
+	DeviceID string    `json:"device_id,omitempty"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+func (e *ExportRequest) Validate() error {
+	switch e.Dataset {
+	case "gps", "gyroscope", "photo":
+	case "":
+		return errors.New("campo obrigatório ausente: dataset")
+	default:
+		return errors.New("dataset inválido: use gps, gyroscope ou photo")
+	}
+	switch e.Format {
+	case "csv", "parquet":
+	case "":
+		return errors.New("campo obrigatório ausente: format")
+	default:
+		return errors.New("formato inválido: use csv ou parquet")
+	}
+	if e.From.IsZero() {
+		return errors.New("campo obrigatório ausente: from")
+	}
+	if e.To.IsZero() {
+		return errors.New("campo obrigatório ausente: to")
+	}
+	if !e.From.Before(e.To) {
+		return errors.New("'from' deve ser anterior a 'to'")
+	}
+	return nil
+}
+
+type ExportJob struct {
+	ID int64 `json:"id"`
+	ExportRequest
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	Location    string     `json:"location,omitempty"`
+	Rows        int64      `json:"rows"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Pedidos de titulares (LGPD): o titular é identificado pelo dispositivo ou pelo motorista. Um pedido por
+// motorista alcança os dispositivos em que ele foi reconhecido e o cadastro dele.
+const (
+	SubjectTypeDevice = "device"
+	SubjectTypeDriver = "driver"
+
+	SubjectActionExport    = "export"
+	SubjectActionErase     = "erase"
+	SubjectActionAnonymize = "anonymize"
+)
+
+type DataSubjectRequestInput struct {
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	Action      string `json:"action"`
+	// Reason registra a base do pedido (ex.: protocolo do atendimento ao titular).
+	Reason string `json:"reason"`
+}
+
+func (d *DataSubjectRequestInput) Validate() error {
+	switch d.SubjectType {
+	case SubjectTypeDevice, SubjectTypeDriver:
+	case "":
+		return errors.New("campo obrigatório ausente: subject_type")
+	default:
+		return errors.New("subject_type inválido: use device ou driver")
+	}
+	if d.SubjectID == "" {
+		return errors.New("campo obrigatório ausente: subject_id")
+	}
+	if d.SubjectType == SubjectTypeDriver {
+		if err := ValidateDriverID(d.SubjectID); err != nil {
+			return err
+		}
+	}
+	switch d.Action {
+	case SubjectActionExport, SubjectActionErase, SubjectActionAnonymize:
+	case "":
+		return errors.New("campo obrigatório ausente: action")
+	default:
+		return errors.New("action inválida: use export, erase ou anonymize")
+	}
+	if d.Reason == "" {
+		return errors.New("campo obrigatório ausente: reason")
+	}
+	return nil
+}
+
+// DataSubjectRequest é um pedido de acesso ou eliminação executado pelo worker. Record é o registro de
+// conclusão assinado (ver auditchain.CompletionRecord), preenchido quando o pedido termina com sucesso.
+type DataSubjectRequest struct {
+	ID int64 `json:"id"`
+	DataSubjectRequestInput
+	Status      string          `json:"status"`
+	RequestedBy string          `json:"requested_by"`
+	Location    string          `json:"location,omitempty"`
+	Record      json.RawMessage `json:"record,omitempty" swaggertype:"object"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+const (
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+)
+
+// TelemetryRollup resume a telemetria de um dispositivo em um intervalo (minuto ou hora).
+type TelemetryRollup struct {
+	DeviceID       string    `json:"device_id"`
+	Bucket         time.Time `json:"bucket"`
+	GPSPoints      int64     `json:"gps_points"`
+	DistanceMeters float64   `json:"distance_meters"`
+	MinLatitude    *float64  `json:"min_latitude,omitempty"`
+	MaxLatitude    *float64  `json:"max_latitude,omitempty"`
+	MinLongitude   *float64  `json:"min_longitude,omitempty"`
+	MaxLongitude   *float64  `json:"max_longitude,omitempty"`
+	GyroPoints     int64     `json:"gyroscope_points"`
+	GyroMin        *float64  `json:"gyroscope_min_magnitude,omitempty"`
+	GyroMax        *float64  `json:"gyroscope_max_magnitude,omitempty"`
+	GyroAvg        *float64  `json:"gyroscope_avg_magnitude,omitempty"`
+}
+
+// GPSArea agrega as leituras de GPS de uma célula de geohash, sem expor as posições exatas.
+type GPSArea struct {
+	Geohash   string    `json:"geohash"`
+	Points    int64     `json:"points"`
+	Devices   int64     `json:"devices"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type GPSAreas struct {
+	DeviceID  string    `json:"device_id,omitempty"`
+	Precision int       `json:"precision"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Areas     []GPSArea `json:"areas"`
+}
+
+type TelemetryStats struct {
+	DeviceID   string            `json:"device_id"`
+	Resolution string            `json:"resolution"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Buckets    []TelemetryRollup `json:"buckets"`
+}
+
+// DevicePhotos lista os metadados das fotos de um dispositivo, com o motorista reconhecido em cada uma.
+type DevicePhotos struct {
+	DeviceID string          `json:"device_id"`
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Photos   []PhotoMetadata `json:"photos"`
+}
+
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
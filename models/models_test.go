@@ -36,6 +36,7 @@ func TestGyroscopeData_Validate(t *testing.T) {
 	}{
 		{"falha_sem_device_id", func(d *GyroscopeData) { d.DeviceID = "" }, "campo obrigatório ausente: device_id"},
 		{"falha_sem_timestamp", func(d *GyroscopeData) { d.Timestamp = time.Time{} }, "campo obrigatório ausente: timestamp"},
+		{"falha_timestamp_no_futuro", func(d *GyroscopeData) { d.Timestamp = time.Now().Add(48 * time.Hour) }, "timestamp no futuro: no máximo 24h0m0s à frente do relógio do servidor"},
 		{"falha_sem_x", func(d *GyroscopeData) { d.X = nil }, "campo obrigatório ausente: x"},
 		{"falha_sem_y", func(d *GyroscopeData) { d.Y = nil }, "campo obrigatório ausente: y"},
 		{"falha_sem_z", func(d *GyroscopeData) { d.Z = nil }, "campo obrigatório ausente: z"},
@@ -76,6 +77,7 @@ func TestGPSData_Validate(t *testing.T) {
 	}{
 		{"falha_sem_device_id", func(d *GPSData) { d.DeviceID = "" }, "campo obrigatório ausente: device_id"},
 		{"falha_sem_timestamp", func(d *GPSData) { d.Timestamp = time.Time{} }, "campo obrigatório ausente: timestamp"},
+		{"falha_timestamp_no_futuro", func(d *GPSData) { d.Timestamp = time.Now().Add(48 * time.Hour) }, "timestamp no futuro: no máximo 24h0m0s à frente do relógio do servidor"},
 		{"falha_sem_latitude", func(d *GPSData) { d.Latitude = nil }, "campo obrigatório ausente: latitude"},
 		{"falha_sem_longitude", func(d *GPSData) { d.Longitude = nil }, "campo obrigatório ausente: longitude"},
 	}
@@ -114,6 +116,7 @@ func TestPhotoData_Validate(t *testing.T) {
 	}{
 		{"falha_sem_device_id", func(d *PhotoData) { d.DeviceID = "" }, "campo obrigatório ausente: device_id"},
 		{"falha_sem_timestamp", func(d *PhotoData) { d.Timestamp = time.Time{} }, "campo obrigatório ausente: timestamp"},
+		{"falha_timestamp_no_futuro", func(d *PhotoData) { d.Timestamp = time.Now().Add(48 * time.Hour) }, "timestamp no futuro: no máximo 24h0m0s à frente do relógio do servidor"},
 		{"falha_sem_photo", func(d *PhotoData) { d.Photo = "" }, "campo obrigatório ausente: photo"},
 	}
 
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/auditchain"
+	"challenge-v3/blob"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Tipos de problema encontrados na verificação da cadeia do audit_log.
+const (
+	AuditProblemGap        = "lacuna"       // posições ausentes: linhas apagadas
+	AuditProblemLink       = "encadeamento" // prev_hash não é o hash da linha anterior
+	AuditProblemModified   = "alterada"     // o conteúdo não confere com o hash gravado
+	AuditProblemHMAC       = "hmac"         // HMAC ausente ou que não confere com AUDIT_HMAC_KEY
+	AuditProblemHead       = "cabeça"       // a cabeça da cadeia não confere com a última linha
+	AuditProblemCheckpoint = "checkpoint"   // checkpoint com assinatura inválida, ausente ou que não confere
+)
+
+// ErrAuditChainBroken é retornado quando a cadeia tem problemas e, por isso, não recebe checkpoint.
+var ErrAuditChainBroken = errors.New("cadeia do audit_log com problemas")
+
+type AuditChainProblem struct {
+	Seq    int64  `json:"seq"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+func (p AuditChainProblem) String() string {
+	return fmt.Sprintf("seq %d: %s: %s", p.Seq, p.Kind, p.Detail)
+}
+
+// AuditChainReport resume uma verificação. FirstSeq é a primeira linha encontrada: antes dela as linhas
+// foram removidas, o que é esperado da retenção. Compare FirstTimestamp com a política de retenção do
+// audit_log: uma primeira linha mais nova do que ela permite indica linhas apagadas do início.
+// Checkpoints conta os checkpoints conferidos e ExpiredCheckpoints os anteriores à primeira linha.
+type AuditChainReport struct {
+	FirstSeq           int64               `json:"first_seq"`
+	FirstTimestamp     time.Time           `json:"first_timestamp"`
+	LastSeq            int64               `json:"last_seq"`
+	Entries            int64               `json:"entries"`
+	Checkpoints        int                 `json:"checkpoints"`
+	ExpiredCheckpoints int                 `json:"expired_checkpoints"`
+	Problems           []AuditChainProblem `json:"problems"`
+}
+
+func (r *AuditChainReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *AuditChainReport) problem(seq int64, kind, format string, args ...any) {
+	r.Problems = append(r.Problems, AuditChainProblem{Seq: seq, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// AuditChainVerifier percorre a cadeia do audit_log recalculando hashes e HMACs.
+type AuditChainVerifier struct {
+	db storage.Storage
+	// hmacKey nil confere só o encadeamento, sem os HMACs.
+	hmacKey []byte
+}
+
+func NewAuditChainVerifier(db storage.Storage, hmacKey []byte) *AuditChainVerifier {
+	return &AuditChainVerifier{db: db, hmacKey: hmacKey}
+}
+
+// Verify confere as linhas de from (ou da primeira que existir, com from nil) até a cabeça atual, e cada
+// checkpoint em checkpoints contra a linha da sua posição. Checkpoints anteriores à primeira linha só
+// entram na contagem de ExpiredCheckpoints.
+func (v *AuditChainVerifier) Verify(ctx context.Context, from *auditchain.Checkpoint, checkpoints []*auditchain.Checkpoint) (*AuditChainReport, error) {
+	headSeq, headHash, err := v.db.AuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bySeq := make(map[int64]*auditchain.Checkpoint, len(checkpoints)+1)
+	for _, checkpoint := range checkpoints {
+		bySeq[checkpoint.Seq] = checkpoint
+	}
+	start := int64(1)
+	if from != nil {
+		start = from.Seq
+		bySeq[from.Seq] = from
+	}
+
+	report := &AuditChainReport{}
+	var prev []byte
+	err = v.db.StreamAuditChain(ctx, start, headSeq, func(entry models.AuditEntry) error {
+		switch {
+		case report.Entries == 0:
+			report.FirstSeq, report.FirstTimestamp = entry.Seq, entry.Timestamp
+			prev = entry.PrevHash
+			if entry.Seq == 1 {
+				prev = auditchain.Genesis
+			}
+			if from != nil && entry.Seq != from.Seq {
+				report.problem(from.Seq, AuditProblemGap, "a linha do checkpoint de partida não existe")
+			}
+		case entry.Seq != report.LastSeq+1:
+			report.problem(report.LastSeq+1, AuditProblemGap, "%d linha(s) ausente(s) antes de %d", entry.Seq-report.LastSeq-1, entry.Seq)
+			prev = entry.PrevHash
+		}
+		v.verifyEntry(report, entry, prev, bySeq[entry.Seq])
+		prev = entry.Hash
+		report.LastSeq = entry.Seq
+		report.Entries++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case report.Entries == 0 && headSeq >= start:
+		report.problem(headSeq, AuditProblemHead, "a cabeça está em %d, mas nenhuma linha a partir de %d existe", headSeq, start)
+	case report.Entries > 0 && report.LastSeq != headSeq:
+		report.problem(report.LastSeq+1, AuditProblemGap, "linhas %d a %d ausentes no fim da cadeia", report.LastSeq+1, headSeq)
+	case report.Entries > 0 && !bytes.Equal(prev, headHash):
+		report.problem(headSeq, AuditProblemHead, "o hash da última linha não confere com a cabeça da cadeia")
+	}
+	for _, checkpoint := range checkpoints {
+		switch {
+		case checkpoint.Seq > headSeq:
+			report.problem(checkpoint.Seq, AuditProblemCheckpoint, "checkpoint além da cabeça da cadeia (%d): linhas removidas do fim", headSeq)
+		case report.Entries == 0 || checkpoint.Seq < report.FirstSeq:
+			report.ExpiredCheckpoints++
+		}
+	}
+	return report, nil
+}
+
+func (v *AuditChainVerifier) verifyEntry(report *AuditChainReport, entry models.AuditEntry, prev []byte, checkpoint *auditchain.Checkpoint) {
+	if !bytes.Equal(entry.PrevHash, prev) {
+		report.problem(entry.Seq, AuditProblemLink, "prev_hash não é o hash da linha anterior")
+	}
+	hash, err := auditchain.Hash(entry.PrevHash, entry)
+	if err != nil || !bytes.Equal(hash, entry.Hash) {
+		report.problem(entry.Seq, AuditProblemModified, "o conteúdo (%s por %s) não confere com o hash gravado", entry.Action, entry.Actor)
+	}
+	if v.hmacKey != nil && !hmac.Equal(auditchain.MAC(v.hmacKey, entry.Hash), entry.HMAC) {
+		report.problem(entry.Seq, AuditProblemHMAC, "HMAC ausente ou inválido")
+	}
+	if checkpoint != nil {
+		if hex.EncodeToString(entry.Hash) != checkpoint.Hash {
+			report.problem(entry.Seq, AuditProblemCheckpoint, "o hash da linha não confere com o checkpoint de %s", checkpoint.CreatedAt.Format(time.RFC3339))
+		} else {
+			report.Checkpoints++
+		}
+	}
+}
+
+// LoadAuditCheckpoints lê os checkpoints do mais recente para o mais antigo, seguindo Previous, e
+// confere as assinaturas. Checkpoints ausentes ou com assinatura inválida viram problemas, e a lista
+// para neles.
+func LoadAuditCheckpoints(ctx context.Context, store blob.Store, key ed25519.PublicKey) ([]*auditchain.Checkpoint, []AuditChainProblem, error) {
+	var checkpoints []*auditchain.Checkpoint
+	var problems []AuditChainProblem
+	next := auditchain.LatestCheckpointKey
+	for next != "" {
+		checkpoint, err := auditchain.LoadCheckpoint(ctx, store, next)
+		if errors.Is(err, blob.ErrNotFound) {
+			if next != auditchain.LatestCheckpointKey {
+				problems = append(problems, AuditChainProblem{Kind: AuditProblemCheckpoint, Detail: fmt.Sprintf("checkpoint %s referenciado não existe", next)})
+			}
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkpoint.Verify(key); err != nil {
+			problems = append(problems, AuditChainProblem{Seq: checkpoint.Seq, Kind: AuditProblemCheckpoint, Detail: fmt.Sprintf("%s: %v", next, err)})
+			break
+		}
+		if len(checkpoints) > 0 && checkpoint.Seq >= checkpoints[len(checkpoints)-1].Seq {
+			problems = append(problems, AuditChainProblem{Seq: checkpoint.Seq, Kind: AuditProblemCheckpoint, Detail: fmt.Sprintf("%s fora de ordem", next)})
+			break
+		}
+		checkpoints = append(checkpoints, checkpoint)
+		next = checkpoint.Previous
+	}
+	return checkpoints, problems, nil
+}
+
+// AuditCheckpointService exporta periodicamente checkpoints assinados da cabeça da cadeia. Antes de
+// assinar, confere as linhas gravadas desde o checkpoint anterior: uma cadeia adulterada não é
+// "legitimada" por um checkpoint novo.
+type AuditCheckpointService struct {
+	db       storage.Storage
+	store    blob.Store
+	signer   ed25519.PrivateKey
+	verifier *AuditChainVerifier
+}
+
+func NewAuditCheckpointService(db storage.Storage, store blob.Store, signer ed25519.PrivateKey, hmacKey []byte) *AuditCheckpointService {
+	return &AuditCheckpointService{db: db, store: store, signer: signer, verifier: NewAuditChainVerifier(db, hmacKey)}
+}
+
+// Checkpoint assina e exporta a cabeça atual. Retorna nil, nil quando ela não andou desde o último
+// checkpoint, e ErrAuditChainBroken quando a verificação encontra problemas.
+func (s *AuditCheckpointService) Checkpoint(ctx context.Context, now time.Time) (*auditchain.Checkpoint, error) {
+	latest, err := auditchain.LoadCheckpoint(ctx, s.store, auditchain.LatestCheckpointKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		latest, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		if err := latest.Verify(s.signer.Public().(ed25519.PublicKey)); err != nil {
+			return nil, fmt.Errorf("%w: último checkpoint: %v", ErrAuditChainBroken, err)
+		}
+	}
+	seq, hash, err := s.db.AuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if seq == 0 || (latest != nil && latest.Seq == seq) {
+		return nil, nil
+	}
+
+	report, err := s.verifier.Verify(ctx, latest, nil)
+	if err == nil && latest != nil && report.FirstSeq > latest.Seq {
+		// A retenção já removeu a linha do último checkpoint; confere a partir da primeira que restou.
+		slog.Warn("linha do último checkpoint de auditoria não existe mais", "seq", latest.Seq, "first_seq", report.FirstSeq)
+		report, err = s.verifier.Verify(ctx, nil, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !report.OK() {
+		return nil, fmt.Errorf("%w: %d problema(s), o primeiro: %s", ErrAuditChainBroken, len(report.Problems), report.Problems[0])
+	}
+
+	previous := ""
+	if latest != nil {
+		previous = auditchain.CheckpointKey(latest.Seq)
+	}
+	checkpoint := auditchain.NewCheckpoint(seq, hash, now, previous)
+	checkpoint.Sign(s.signer)
+	if err := auditchain.SaveCheckpoint(ctx, s.store, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// Start gera um checkpoint a cada intervalo e registra na auditoria os gerados e as falhas de verificação.
+func (s *AuditCheckpointService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.checkpointAndAudit(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *AuditCheckpointService) checkpointAndAudit(ctx context.Context) {
+	checkpoint, err := s.Checkpoint(ctx, time.Now())
+	var event models.AuditEvent
+	switch {
+	case errors.Is(err, ErrAuditChainBroken):
+		slog.Error("cadeia do audit_log com problemas; checkpoint não gerado", "error", err)
+		event = models.AuditEvent{Actor: "audit-checkpoint", Action: "AUDIT_CHAIN_BROKEN", Details: map[string]interface{}{"error": err.Error()}}
+	case err != nil:
+		slog.Error("falha ao gerar checkpoint do audit_log", "error", err)
+		return
+	case checkpoint == nil:
+		return
+	default:
+		slog.Info("checkpoint do audit_log gerado", "seq", checkpoint.Seq)
+		event = models.AuditEvent{Actor: "audit-checkpoint", Action: "AUDIT_CHECKPOINT_CREATED",
+			Details: map[string]interface{}{"seq": checkpoint.Seq, "hash": checkpoint.Hash}}
+	}
+	if err := s.db.LogAuditEvent(ctx, event); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para checkpoint", "error", err)
+	}
+}
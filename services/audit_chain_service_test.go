@@ -0,0 +1,154 @@
+package services
+
+import (
+	"challenge-v3/auditchain"
+	"challenge-v3/models"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testAuditKey = []byte("chave-hmac-da-auditoria-com-32-bytes")
+
+func (m *MockStorage) AuditChainHead(ctx context.Context) (int64, []byte, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Get(1).([]byte), args.Error(2)
+}
+
+// StreamAuditChain entrega as linhas registradas no mock com o retorno de "AuditChainRows".
+func (m *MockStorage) StreamAuditChain(ctx context.Context, from, to int64, fn func(models.AuditEntry) error) error {
+	args := m.Called(from, to)
+	for _, entry := range m.MethodCalled("AuditChainRows").Get(0).([]models.AuditEntry) {
+		if entry.Seq >= from && entry.Seq <= to {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(0)
+}
+
+// buildAuditChain encadeia n linhas a partir da posição 1, como o storage faz ao gravar.
+func buildAuditChain(t *testing.T, n int) []models.AuditEntry {
+	t.Helper()
+	entries := make([]models.AuditEntry, 0, n)
+	prev := auditchain.Genesis
+	for i := 1; i <= n; i++ {
+		details, _ := json.Marshal(map[string]any{"photo_id": i})
+		entry := models.AuditEntry{Seq: int64(i), Timestamp: time.Date(2025, 3, 1, 0, 0, i, 0, time.UTC),
+			Actor: "dev-1", Action: "PHOTO_PROCESSED", Details: details, PrevHash: prev}
+		hash, err := auditchain.Hash(prev, entry)
+		require.NoError(t, err)
+		entry.Hash, entry.HMAC = hash, auditchain.MAC(testAuditKey, hash)
+		entries = append(entries, entry)
+		prev = hash
+	}
+	return entries
+}
+
+// auditChainDB devolve um mock cuja cabeça é headSeq/headHash e cujas linhas são entries.
+func auditChainDB(entries []models.AuditEntry, headSeq int64, headHash []byte) *MockStorage {
+	mockDB := new(MockStorage)
+	mockDB.On("AuditChainHead").Return(headSeq, headHash, nil)
+	mockDB.On("StreamAuditChain", mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("AuditChainRows").Return(entries)
+	return mockDB
+}
+
+func problemKinds(report *AuditChainReport) []string {
+	kinds := []string{}
+	for _, problem := range report.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	return kinds
+}
+
+func TestAuditChainVerifier_DetectsTampering(t *testing.T) {
+	chain := buildAuditChain(t, 5)
+	head := chain[4].Hash
+	without := func(i int) []models.AuditEntry {
+		return append(append([]models.AuditEntry{}, chain[:i]...), chain[i+1:]...)
+	}
+	modified := append([]models.AuditEntry{}, chain...)
+	modified[2].Details = json.RawMessage(`{"photo_id": 99}`)
+	// Quem tem acesso ao banco, mas não à chave, refaz os hashes a partir da linha alterada.
+	rehashed := append([]models.AuditEntry{}, modified...)
+	for i := 2; i < len(rehashed); i++ {
+		if i > 2 {
+			rehashed[i].PrevHash = rehashed[i-1].Hash
+		}
+		rehashed[i].Hash, _ = auditchain.Hash(rehashed[i].PrevHash, rehashed[i])
+	}
+
+	tests := []struct {
+		name    string
+		entries []models.AuditEntry
+		head    []byte
+		want    []string
+	}{
+		{"íntegra", chain, head, []string{}},
+		{"conteúdo alterado", modified, head, []string{AuditProblemModified}},
+		{"hashes refeitos sem a chave", rehashed, rehashed[4].Hash, []string{AuditProblemHMAC, AuditProblemHMAC, AuditProblemHMAC}},
+		{"linha do meio apagada", without(2), head, []string{AuditProblemGap}},
+		{"última linha apagada", chain[:4], head, []string{AuditProblemGap}},
+		{"início removido pela retenção", chain[2:], head, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := NewAuditChainVerifier(auditChainDB(tt.entries, 5, tt.head), testAuditKey).Verify(context.Background(), nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, problemKinds(report), report.Problems)
+		})
+	}
+}
+
+func TestAuditCheckpointService_SignsAndChainsCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	_, signer, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	store := newTestPhotoStore(t)
+	chain := buildAuditChain(t, 6)
+
+	first, err := NewAuditCheckpointService(auditChainDB(chain[:3], 3, chain[2].Hash), store, signer, testAuditKey).Checkpoint(ctx, time.Now())
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	assert.Equal(t, int64(3), first.Seq)
+
+	again, err := NewAuditCheckpointService(auditChainDB(chain[:3], 3, chain[2].Hash), store, signer, testAuditKey).Checkpoint(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, again, "sem linhas novas não há checkpoint novo")
+
+	second, err := NewAuditCheckpointService(auditChainDB(chain, 6, chain[5].Hash), store, signer, testAuditKey).Checkpoint(ctx, time.Now())
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	assert.Equal(t, auditchain.CheckpointKey(3), second.Previous)
+
+	checkpoints, problems, err := LoadAuditCheckpoints(ctx, store, signer.Public().(ed25519.PublicKey))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	require.Len(t, checkpoints, 2)
+	assert.Equal(t, []int64{6, 3}, []int64{checkpoints[0].Seq, checkpoints[1].Seq})
+
+	// As duas últimas linhas e a cabeça voltam para a posição 4: só o checkpoint mostra o que sumiu.
+	report, err := NewAuditChainVerifier(auditChainDB(chain[:4], 4, chain[3].Hash), testAuditKey).Verify(ctx, nil, checkpoints)
+	require.NoError(t, err)
+	assert.Equal(t, []string{AuditProblemCheckpoint}, problemKinds(report))
+	assert.Equal(t, 1, report.Checkpoints)
+
+	tampered := append([]models.AuditEntry{}, chain...)
+	tampered[4].Actor = "outro"
+	_, err = NewAuditCheckpointService(auditChainDB(append(tampered, chain[5]), 7, chain[5].Hash), store, signer, testAuditKey).Checkpoint(ctx, time.Now())
+	assert.ErrorIs(t, err, ErrAuditChainBroken, "uma cadeia adulterada não recebe checkpoint")
+
+	_, otherSigner, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, problems, err = LoadAuditCheckpoints(ctx, store, otherSigner.Public().(ed25519.PublicKey))
+	require.NoError(t, err)
+	assert.Len(t, problems, 1, "checkpoint assinado por outra chave")
+}
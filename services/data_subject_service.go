@@ -0,0 +1,609 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"challenge-v3/auditchain"
+	"challenge-v3/blob"
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+)
+
+const (
+	subjectPhotoPageSize = 100
+	// O Rekognition aceita até 4096 FaceIds por DeleteFaces.
+	deleteFacesBatchSize = 1000
+)
+
+// subjectDataFrom e subjectDataTo cobrem todo o histórico nas consultas por intervalo.
+var (
+	subjectDataFrom = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	subjectDataTo   = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var subjectCompletedActions = map[string]string{
+	models.SubjectActionExport:    "DATA_SUBJECT_EXPORTED",
+	models.SubjectActionErase:     "DATA_SUBJECT_ERASED",
+	models.SubjectActionAnonymize: "DATA_SUBJECT_ANONYMIZED",
+}
+
+// FaceCollection é o subconjunto do Rekognition usado para apagar os rostos de um titular.
+type FaceCollection interface {
+	DeleteFaces(ctx context.Context, params *rekognition.DeleteFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DeleteFacesOutput, error)
+}
+
+// DataSubjectService executa os pedidos de titulares: exporta os dados dos dispositivos do titular num zip
+// com as fotos decifradas, ou os apaga/anonimiza junto com os objetos das fotos e os rostos indexados. Cada
+// pedido concluído gera um auditchain.CompletionRecord assinado, gravado no pedido, no destino das
+// exportações e (pelo digest) no audit_log.
+type DataSubjectService struct {
+	db           storage.Storage
+	blobs        blob.Store
+	viewer       *PhotoViewer
+	faces        FaceCollection
+	collectionID string
+	dest         export.Destination
+	signer       ed25519.PrivateKey
+	// facesDeleted, se definido, recebe os rostos apagados da coleção (ver SetFacesDeletedHook).
+	facesDeleted func(faceIDs []string)
+}
+
+func NewDataSubjectService(db storage.Storage, blobs blob.Store, keys PhotoKeys, faces FaceCollection, collectionID string,
+	dest export.Destination, signer ed25519.PrivateKey) *DataSubjectService {
+	return &DataSubjectService{
+		db:           db,
+		blobs:        blobs,
+		viewer:       NewPhotoViewer(db, blobs, keys),
+		faces:        faces,
+		collectionID: collectionID,
+		dest:         dest,
+		signer:       signer,
+	}
+}
+
+// SetFacesDeletedHook registra fn para ser chamada com os rostos apagados da coleção, inclusive quando só
+// parte deles foi apagada. O worker a usa para limpar o cache de reconhecimento do PhotoAnalyzerService.
+func (s *DataSubjectService) SetFacesDeletedHook(fn func(faceIDs []string)) {
+	s.facesDeleted = fn
+}
+
+// subjectArchiveManifest é o manifest.json do arquivo entregue ao titular.
+type subjectArchiveManifest struct {
+	RequestID   int64            `json:"request_id"`
+	SubjectType string           `json:"subject_type"`
+	SubjectID   string           `json:"subject_id"`
+	Devices     []string         `json:"devices"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Rows        map[string]int64 `json:"rows"`
+	// MissingPhotos são as fotos cuja imagem não pôde ser recuperada; os metadados estão em photo.csv.
+	MissingPhotos []int64 `json:"missing_photos"`
+}
+
+// dataSubject é o titular resolvido: os dispositivos cujos dados são exportados ou apagados e, num pedido
+// por motorista, o cadastro e os rostos associados a ele.
+type dataSubject struct {
+	devices []string
+	// driverID é vazio nos pedidos por dispositivo.
+	driverID string
+	driver   *models.Driver
+	faces    []models.DriverFace
+}
+
+// resolveSubject encontra os dados do titular. Um motorista alcança os dispositivos em que foi reconhecido
+// (photo.driver_id) e os rostos de driver_faces; ele pode não ter cadastro em drivers quando só foi
+// identificado pelo ExternalImageId dos rostos.
+func (s *DataSubjectService) resolveSubject(ctx context.Context, req *models.DataSubjectRequest) (*dataSubject, error) {
+	if req.SubjectType != models.SubjectTypeDriver {
+		return &dataSubject{devices: []string{req.SubjectID}}, nil
+	}
+	subject := &dataSubject{driverID: req.SubjectID}
+	var err error
+	if subject.devices, err = s.db.ListDriverDevices(ctx, req.SubjectID); err != nil {
+		return nil, fmt.Errorf("falha ao listar os dispositivos do motorista: %w", err)
+	}
+	subject.driver, err = s.db.GetDriver(ctx, req.SubjectID)
+	if errors.Is(err, storage.ErrNotFound) {
+		if len(subject.devices) == 0 {
+			return nil, fmt.Errorf("motorista %s não encontrado", req.SubjectID)
+		}
+		return subject, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("falha ao consultar o motorista: %w", err)
+	}
+	if subject.faces, err = s.db.ListDriverFaces(ctx, req.SubjectID); err != nil {
+		return nil, fmt.Errorf("falha ao listar os rostos do motorista: %w", err)
+	}
+	return subject, nil
+}
+
+// Run executa um pedido já reivindicado e registra o resultado no pedido e na auditoria.
+func (s *DataSubjectService) Run(ctx context.Context, req *models.DataSubjectRequest) error {
+	slog.Info("iniciando pedido de titular", "request_id", req.ID, "action", req.Action, "subject_type", req.SubjectType)
+
+	record := &auditchain.CompletionRecord{
+		RequestID:   req.ID,
+		SubjectType: req.SubjectType,
+		SubjectID:   req.SubjectID,
+		Action:      req.Action,
+		Reason:      req.Reason,
+		RequestedBy: req.RequestedBy,
+		Rows:        map[string]int64{},
+	}
+	subject, runErr := s.resolveSubject(ctx, req)
+	if runErr == nil {
+		if subject.driverID != "" {
+			record.Devices = subject.devices
+		}
+		switch req.Action {
+		case models.SubjectActionExport:
+			runErr = s.exportSubject(ctx, req, subject, record)
+		case models.SubjectActionErase, models.SubjectActionAnonymize:
+			runErr = s.eraseSubject(ctx, req, subject, record)
+		default:
+			runErr = fmt.Errorf("ação desconhecida: %s", req.Action)
+		}
+	}
+
+	req.Status = models.ExportStatusCompleted
+	if runErr != nil {
+		slog.Error("falha no pedido de titular", "error", runErr, "request_id", req.ID)
+		req.Status = models.ExportStatusFailed
+		req.Error = runErr.Error()
+		auditEvent := models.AuditEvent{
+			Actor:  req.RequestedBy,
+			Action: "DATA_SUBJECT_REQUEST_FAILED",
+			Details: map[string]interface{}{
+				"request_id":    req.ID,
+				"subject_type":  req.SubjectType,
+				"subject_id":    req.SubjectID,
+				"action":        req.Action,
+				"faces_deleted": record.FacesDeleted,
+				"blobs_deleted": record.BlobsDeleted,
+				"error":         req.Error,
+			},
+		}
+		if err := s.db.LogAuditEvent(ctx, auditEvent); err != nil {
+			slog.Error("falha ao registrar evento de auditoria para pedido de titular", "error", err, "request_id", req.ID)
+		}
+	} else {
+		req.Record, _ = json.Marshal(record)
+	}
+	if err := s.db.FinishDataSubjectRequest(ctx, req); err != nil {
+		return fmt.Errorf("falha ao atualizar pedido de titular %d: %w", req.ID, err)
+	}
+	slog.Info("pedido de titular finalizado", "request_id", req.ID, "status", req.Status, "location", req.Location)
+	return nil
+}
+
+// exportSubject grava o zip no destino das exportações e só então assina e audita a conclusão.
+func (s *DataSubjectService) exportSubject(ctx context.Context, req *models.DataSubjectRequest, subject *dataSubject, record *auditchain.CompletionRecord) error {
+	obj, err := s.dest.Create(fmt.Sprintf("lgpd/request-%d.zip", req.ID))
+	if err != nil {
+		return err
+	}
+	digest := sha256.New()
+	archive := zip.NewWriter(io.MultiWriter(obj, digest))
+	err = s.writeArchive(ctx, req, subject, archive, record.Rows)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		obj.Abort()
+		return err
+	}
+	if req.Location, err = obj.Commit(ctx); err != nil {
+		return err
+	}
+	record.ArchiveLocation, record.ArchiveSHA256 = req.Location, hex.EncodeToString(digest.Sum(nil))
+	s.sign(record)
+	if err := s.db.LogAuditEvent(ctx, s.completionEvent(record)); err != nil {
+		return fmt.Errorf("falha ao registrar a conclusão na auditoria: %w", err)
+	}
+	if _, err := s.saveRecord(ctx, record); err != nil {
+		slog.Error("falha ao gravar o registro de conclusão no destino", "error", err, "request_id", req.ID)
+	}
+	return nil
+}
+
+// writeArchive grava os dados de cada dispositivo do titular. Num pedido por motorista os arquivos de
+// cada dispositivo ficam em devices/<id>/ e o cadastro vai em driver.json.
+func (s *DataSubjectService) writeArchive(ctx context.Context, req *models.DataSubjectRequest, subject *dataSubject,
+	archive *zip.Writer, rows map[string]int64) error {
+	manifest := subjectArchiveManifest{
+		RequestID:     req.ID,
+		SubjectType:   req.SubjectType,
+		SubjectID:     req.SubjectID,
+		Devices:       subject.devices,
+		GeneratedAt:   time.Now().UTC(),
+		Rows:          rows,
+		MissingPhotos: []int64{},
+	}
+
+	for _, deviceID := range subject.devices {
+		prefix := ""
+		if subject.driverID != "" {
+			prefix = "devices/" + deviceID + "/"
+		}
+		if err := s.writeDeviceData(ctx, archive, prefix, deviceID, rows, &manifest); err != nil {
+			return err
+		}
+	}
+
+	if subject.driverID != "" {
+		w, err := archive.Create("driver.json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]any{"driver": subject.driver, "faces": subject.faces}); err != nil {
+			return err
+		}
+	}
+
+	w, err := archive.Create("audit.ndjson")
+	if err != nil {
+		return err
+	}
+	if rows["audit_log"], err = s.writeSubjectAudit(ctx, subject, w); err != nil {
+		return fmt.Errorf("falha ao exportar audit_log: %w", err)
+	}
+
+	if w, err = archive.Create("manifest.json"); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// writeDeviceData grava a telemetria, os metadados e as imagens de um dispositivo, somando as linhas em rows.
+func (s *DataSubjectService) writeDeviceData(ctx context.Context, archive *zip.Writer, prefix, deviceID string,
+	rows map[string]int64, manifest *subjectArchiveManifest) error {
+	w, err := archive.Create(prefix + "gps.csv")
+	if err != nil {
+		return err
+	}
+	n, err := writeDataset("csv", w, func(emit func(export.GPSRow) error) error {
+		return s.db.StreamGPS(ctx, deviceID, subjectDataFrom, subjectDataTo, func(d models.GPSData) error { return emit(export.NewGPSRow(d)) })
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao exportar gps: %w", err)
+	}
+	rows["gps"] += n
+
+	if w, err = archive.Create(prefix + "gyroscope.csv"); err != nil {
+		return err
+	}
+	n, err = writeDataset("csv", w, func(emit func(export.GyroscopeRow) error) error {
+		return s.db.StreamGyroscope(ctx, deviceID, subjectDataFrom, subjectDataTo, func(d models.GyroscopeData) error { return emit(export.NewGyroscopeRow(d)) })
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao exportar gyroscope: %w", err)
+	}
+	rows["gyroscope"] += n
+
+	if w, err = archive.Create(prefix + "photo.csv"); err != nil {
+		return err
+	}
+	n, err = writeDataset("csv", w, func(emit func(export.PhotoRow) error) error {
+		return s.db.StreamPhotoMetadata(ctx, deviceID, subjectDataFrom, subjectDataTo, func(m models.PhotoMetadata) error { return emit(export.NewPhotoRow(m)) })
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao exportar photo: %w", err)
+	}
+	rows["photo"] += n
+
+	err = s.forEachPhoto(ctx, deviceID, func(photo models.StoredPhoto) error {
+		image, err := s.viewer.open(ctx, &photo)
+		if errors.Is(err, ErrPhotoContentUnavailable) {
+			slog.Warn("imagem indisponível na exportação do titular", "photo_id", photo.ID, "error", err)
+			manifest.MissingPhotos = append(manifest.MissingPhotos, photo.ID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer image.Close()
+		return writePhotoEntry(archive, photo.ID, image)
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao exportar as imagens: %w", err)
+	}
+	return nil
+}
+
+// writePhotoEntry grava a imagem em photos/<id>.<extensão>, com a extensão do tipo detectado.
+func writePhotoEntry(archive *zip.Writer, id int64, image io.Reader) error {
+	buffered := bufio.NewReader(image)
+	head, err := buffered.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	extension := "bin"
+	switch http.DetectContentType(head) {
+	case "image/jpeg":
+		extension = "jpg"
+	case "image/png":
+		extension = "png"
+	case "image/gif":
+		extension = "gif"
+	case "image/webp":
+		extension = "webp"
+	}
+	w, err := archive.Create(fmt.Sprintf("photos/%d.%s", id, extension))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, buffered)
+	return err
+}
+
+// writeSubjectAudit grava as linhas do audit_log em que um dispositivo do titular é o ator ou aparece em
+// details.device_id e, num pedido por motorista, as que têm o motorista em details.driver_id, cada uma
+// uma vez.
+func (s *DataSubjectService) writeSubjectAudit(ctx context.Context, subject *dataSubject, w io.Writer) (int64, error) {
+	writer, err := export.NewAuditWriter("ndjson", w)
+	if err != nil {
+		return 0, err
+	}
+	var filters []models.AuditFilter
+	for _, deviceID := range subject.devices {
+		quoted, _ := json.Marshal(deviceID)
+		filters = append(filters,
+			models.AuditFilter{Actor: deviceID, From: subjectDataFrom, To: subjectDataTo},
+			models.AuditFilter{Details: map[string]json.RawMessage{"device_id": quoted}, From: subjectDataFrom, To: subjectDataTo})
+	}
+	if subject.driverID != "" {
+		quoted, _ := json.Marshal(subject.driverID)
+		filters = append(filters, models.AuditFilter{Details: map[string]json.RawMessage{"driver_id": quoted}, From: subjectDataFrom, To: subjectDataTo})
+	}
+	seen := map[int64]bool{}
+	var rows int64
+	for _, filter := range filters {
+		err := s.db.StreamAuditLog(ctx, filter, func(e models.AuditEntry) error {
+			if seen[e.ID] {
+				return nil
+			}
+			seen[e.ID] = true
+			rows++
+			return writer.Write(export.NewAuditRow(e))
+		})
+		if err != nil {
+			return rows, err
+		}
+	}
+	return rows, writer.Close()
+}
+
+// eraseSubject apaga os rostos e os objetos das fotos e depois apaga ou anonimiza as linhas de cada
+// dispositivo (e, num pedido por motorista, o cadastro) na mesma transação que registra a conclusão na
+// auditoria. Os rostos apagados são os FaceIds gravados nas fotos (photo.face_id) sem motorista ou do
+// próprio motorista titular, mais os rostos dele em driver_faces; os de outros motoristas cadastrados
+// ficam para um pedido deles.
+func (s *DataSubjectService) eraseSubject(ctx context.Context, req *models.DataSubjectRequest, subject *dataSubject, record *auditchain.CompletionRecord) error {
+	var contentKeys []string
+	faceIDs := map[string]bool{}
+	for _, face := range subject.faces {
+		faceIDs[face.FaceID] = true
+	}
+	for _, deviceID := range subject.devices {
+		err := s.forEachPhoto(ctx, deviceID, func(photo models.StoredPhoto) error {
+			if photo.Key != "" {
+				contentKeys = append(contentKeys, photo.Key)
+			}
+			if photo.FaceID != "" && (photo.DriverID == "" || photo.DriverID == subject.driverID) {
+				faceIDs[photo.FaceID] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.deleteFaces(ctx, faceIDs, record); err != nil {
+		return err
+	}
+	for _, key := range contentKeys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			return fmt.Errorf("falha ao apagar o objeto %s: %w", key, err)
+		}
+		record.BlobsDeleted++
+	}
+
+	err := s.db.WithTx(ctx, func(tx storage.Storage) error {
+		rows := map[string]int64{}
+		for _, deviceID := range subject.devices {
+			var deviceRows map[string]int64
+			var err error
+			if req.Action == models.SubjectActionErase {
+				deviceRows, err = tx.EraseDeviceData(ctx, deviceID)
+			} else {
+				// Um pseudônimo por dispositivo, para que as linhas anonimizadas não liguem os veículos entre si.
+				var pseudonym string
+				if pseudonym, err = newPseudonym(); err == nil {
+					deviceRows, err = tx.AnonymizeDeviceData(ctx, deviceID, pseudonym)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			addRows(rows, deviceRows)
+		}
+		if subject.driverID != "" {
+			driverRows, err := tx.EraseDriver(ctx, subject.driverID)
+			if err != nil {
+				return err
+			}
+			addRows(rows, driverRows)
+		}
+		record.Rows = rows
+		s.sign(record)
+		return tx.LogAuditEvent(ctx, s.completionEvent(record))
+	})
+	if err != nil {
+		return err
+	}
+	if req.Location, err = s.saveRecord(ctx, record); err != nil {
+		slog.Error("falha ao gravar o registro de conclusão no destino", "error", err, "request_id", req.ID)
+	}
+	return nil
+}
+
+func addRows(total, rows map[string]int64) {
+	for table, n := range rows {
+		total[table] += n
+	}
+}
+
+// deleteFaces apaga os rostos da coleção. Rostos que já não estão nela (um pedido repetido, um rosto
+// removido do cadastro) não são erro, mas também não contam em FacesDeleted.
+func (s *DataSubjectService) deleteFaces(ctx context.Context, faceIDs map[string]bool, record *auditchain.CompletionRecord) error {
+	ids := make([]string, 0, len(faceIDs))
+	for id := range faceIDs {
+		ids = append(ids, id)
+	}
+	if s.facesDeleted != nil && len(ids) > 0 {
+		defer s.facesDeleted(ids)
+	}
+	for start := 0; start < len(ids); start += deleteFacesBatchSize {
+		batch := ids[start:min(start+deleteFacesBatchSize, len(ids))]
+		result, err := s.faces.DeleteFaces(ctx, &rekognition.DeleteFacesInput{CollectionId: aws.String(s.collectionID), FaceIds: batch})
+		if err != nil {
+			return fmt.Errorf("falha ao apagar rostos da coleção: %w", err)
+		}
+		record.FacesDeleted += int64(len(result.DeletedFaces))
+		failed := 0
+		for _, deletion := range result.UnsuccessfulFaceDeletions {
+			for _, reason := range deletion.Reasons {
+				if reason != types.UnsuccessfulFaceDeletionReasonFaceNotFound {
+					failed++
+					break
+				}
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("o Rekognition não apagou %d rosto(s) do titular", failed)
+		}
+	}
+	return nil
+}
+
+// forEachPhoto percorre as fotos do dispositivo pelo id, uma página por vez.
+func (s *DataSubjectService) forEachPhoto(ctx context.Context, deviceID string, fn func(models.StoredPhoto) error) error {
+	var afterID int64
+	for {
+		photos, err := s.db.ListDevicePhotos(ctx, deviceID, afterID, subjectPhotoPageSize)
+		if err != nil {
+			return err
+		}
+		for _, photo := range photos {
+			if err := fn(photo); err != nil {
+				return err
+			}
+		}
+		if len(photos) < subjectPhotoPageSize {
+			return nil
+		}
+		afterID = photos[len(photos)-1].ID
+	}
+}
+
+func (s *DataSubjectService) sign(record *auditchain.CompletionRecord) {
+	record.CompletedAt = time.Now()
+	record.Sign(s.signer)
+}
+
+func (s *DataSubjectService) completionEvent(record *auditchain.CompletionRecord) models.AuditEvent {
+	return models.AuditEvent{
+		Actor:  record.RequestedBy,
+		Action: subjectCompletedActions[record.Action],
+		Details: map[string]interface{}{
+			"request_id":     record.RequestID,
+			"subject_type":   record.SubjectType,
+			"subject_id":     record.SubjectID,
+			"rows":           record.Rows,
+			"faces_deleted":  record.FacesDeleted,
+			"blobs_deleted":  record.BlobsDeleted,
+			"archive_sha256": record.ArchiveSHA256,
+			"record_digest":  record.Digest(),
+		},
+	}
+}
+
+// saveRecord grava uma cópia do registro assinado ao lado das exportações.
+func (s *DataSubjectService) saveRecord(ctx context.Context, record *auditchain.CompletionRecord) (string, error) {
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	obj, err := s.dest.Create(fmt.Sprintf("lgpd/request-%d-record.json", record.RequestID))
+	if err != nil {
+		return "", err
+	}
+	if _, err := obj.Write(content); err != nil {
+		obj.Abort()
+		return "", err
+	}
+	return obj.Commit(ctx)
+}
+
+// newPseudonym gera o identificador que substitui o dispositivo na anonimização. Ele não é guardado em
+// lugar nenhum, para que as linhas anonimizadas não possam ser ligadas de volta ao titular.
+func newPseudonym() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "anon-" + hex.EncodeToString(raw), nil
+}
+
+// RunPending executa pedidos pendentes até a fila esvaziar.
+func (s *DataSubjectService) RunPending(ctx context.Context) error {
+	for {
+		req, err := s.db.ClaimDataSubjectRequest(ctx)
+		if err != nil {
+			return err
+		}
+		if req == nil {
+			return nil
+		}
+		if err := s.Run(ctx, req); err != nil {
+			return err
+		}
+	}
+}
+
+// Start consulta a fila de pedidos periodicamente até o contexto ser cancelado.
+func (s *DataSubjectService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.RunPending(ctx); err != nil {
+			slog.Error("falha ao processar fila de pedidos de titulares", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
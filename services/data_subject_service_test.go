@@ -0,0 +1,377 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"challenge-v3/auditchain"
+	"challenge-v3/blob"
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockRekognitionClient) DeleteFaces(ctx context.Context, params *rekognition.DeleteFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DeleteFacesOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*rekognition.DeleteFacesOutput), args.Error(1)
+}
+
+func (m *MockStorage) StreamGyroscope(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GyroscopeData) error) error {
+	args := m.Called(deviceID, from, to)
+	for _, g := range args.Get(0).([]models.GyroscopeData) {
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+func (m *MockStorage) StreamAuditLog(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	args := m.Called(filter)
+	for _, e := range args.Get(0).([]models.AuditEntry) {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+func (m *MockStorage) ListDevicePhotos(ctx context.Context, deviceID string, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	args := m.Called(deviceID, afterID, limit)
+	return args.Get(0).([]models.StoredPhoto), args.Error(1)
+}
+func (m *MockStorage) EraseDeviceData(ctx context.Context, deviceID string) (map[string]int64, error) {
+	args := m.Called(deviceID)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+func (m *MockStorage) AnonymizeDeviceData(ctx context.Context, deviceID, pseudonym string) (map[string]int64, error) {
+	args := m.Called(deviceID, pseudonym)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+func (m *MockStorage) ListDriverDevices(ctx context.Context, driverID string) ([]string, error) {
+	args := m.Called(driverID)
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *MockStorage) EraseDriver(ctx context.Context, driverID string) (map[string]int64, error) {
+	args := m.Called(driverID)
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+func (m *MockStorage) GetDriver(ctx context.Context, id string) (*models.Driver, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Driver), args.Error(1)
+}
+func (m *MockStorage) ListDriverFaces(ctx context.Context, driverID string) ([]models.DriverFace, error) {
+	args := m.Called(driverID)
+	return args.Get(0).([]models.DriverFace), args.Error(1)
+}
+func (m *MockStorage) FinishDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	return m.Called(req).Error(0)
+}
+
+// jpegImage começa com a assinatura de JPEG para que a extensão detectada na exportação seja .jpg.
+var jpegImage = append([]byte{0xff, 0xd8, 0xff, 0xe0}, []byte("imagem-do-titular")...)
+
+// storeSubjectPhoto grava a imagem cifrada como o worker faria e devolve a linha correspondente.
+func storeSubjectPhoto(t *testing.T, store blob.Store, keys PhotoKeys, id int64) models.StoredPhoto {
+	meta := models.PhotoMetadata{ID: id, DeviceID: "dev-1", Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	content, err := storePhotoContent(context.Background(), store, keys, meta, bytes.NewReader(jpegImage), int64(len(jpegImage)))
+	require.NoError(t, err)
+	return models.StoredPhoto{PhotoMetadata: meta, PhotoContent: content}
+}
+
+func newTestSubjectRequest(action string) *models.DataSubjectRequest {
+	return &models.DataSubjectRequest{
+		ID: 3,
+		DataSubjectRequestInput: models.DataSubjectRequestInput{
+			SubjectType: models.SubjectTypeDevice, SubjectID: "dev-1", Action: action, Reason: "protocolo 99",
+		},
+		Status:      models.ExportStatusRunning,
+		RequestedBy: "bia",
+	}
+}
+
+func TestDataSubjectService_EraseDeletesFacesObjectsAndSignsRecord(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	store, keys := newTestPhotoStore(t), testStreamKeys(t)
+	photo := storeSubjectPhoto(t, store, keys, 11)
+	photo.FaceID = "face-1"
+	driverPhoto := storeSubjectPhoto(t, store, keys, 12)
+	driverPhoto.FaceID, driverPhoto.DriverID = "face-ana", "ana"
+	mockDB, mockRek := new(MockStorage), new(MockRekognitionClient)
+
+	mockDB.On("ListDevicePhotos", "dev-1", int64(0), subjectPhotoPageSize).Return([]models.StoredPhoto{photo, driverPhoto}, nil)
+	mockRek.On("DeleteFaces", mock.Anything, mock.MatchedBy(func(in *rekognition.DeleteFacesInput) bool {
+		return assert.ObjectsAreEqual([]string{"face-1"}, in.FaceIds)
+	})).Return(&rekognition.DeleteFacesOutput{DeletedFaces: []string{"face-1"}}, nil).Once()
+	rows := map[string]int64{"gps": 5, "photo": 1}
+	mockDB.On("EraseDeviceData", "dev-1").Return(rows, nil)
+	var audited models.AuditEvent
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DATA_SUBJECT_ERASED" })).
+		Run(func(args mock.Arguments) { audited = args.Get(0).(models.AuditEvent) }).Return(nil)
+	mockDB.On("FinishDataSubjectRequest", mock.Anything).Return(nil)
+
+	req := newTestSubjectRequest(models.SubjectActionErase)
+	service := NewDataSubjectService(mockDB, store, keys, mockRek, "test-collection", dest, private)
+	require.NoError(t, service.Run(context.Background(), req))
+
+	mockDB.AssertExpectations(t)
+	mockRek.AssertExpectations(t)
+	assert.Equal(t, models.ExportStatusCompleted, req.Status)
+	_, err = store.Get(context.Background(), photo.Key)
+	assert.ErrorIs(t, err, blob.ErrNotFound, "o objeto da foto é apagado")
+
+	var record auditchain.CompletionRecord
+	require.NoError(t, json.Unmarshal(req.Record, &record))
+	require.NoError(t, record.Verify(public))
+	assert.Equal(t, rows, record.Rows)
+	assert.Equal(t, int64(1), record.FacesDeleted, "o rosto do motorista cadastrado fica para o pedido dele")
+	assert.Equal(t, int64(2), record.BlobsDeleted)
+	assert.Equal(t, record.Digest(), audited.Details["record_digest"])
+
+	saved, err := os.ReadFile(filepath.Join(dir, "lgpd", "request-3-record.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "file://"+filepath.Join(dir, "lgpd", "request-3-record.json"), req.Location)
+	var copied auditchain.CompletionRecord
+	require.NoError(t, json.Unmarshal(saved, &copied))
+	assert.NoError(t, copied.Verify(public))
+}
+
+func TestDataSubjectService_ExportArchiveHasDecryptedPhotosAndAudit(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	store, keys := newTestPhotoStore(t), testStreamKeys(t)
+	photo := storeSubjectPhoto(t, store, keys, 11)
+	mockDB := new(MockStorage)
+
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockDB.On("StreamGPS", "dev-1", subjectDataFrom, subjectDataTo).
+		Return([]models.GPSData{{DeviceID: "dev-1", Latitude: float64Ptr(-10), Longitude: float64Ptr(-35), Timestamp: at}}, nil)
+	mockDB.On("StreamGyroscope", "dev-1", subjectDataFrom, subjectDataTo).Return([]models.GyroscopeData{}, nil)
+	mockDB.On("StreamPhotoMetadata", "dev-1", subjectDataFrom, subjectDataTo).Return([]models.PhotoMetadata{photo.PhotoMetadata}, nil)
+	mockDB.On("ListDevicePhotos", "dev-1", int64(0), subjectPhotoPageSize).Return([]models.StoredPhoto{photo}, nil)
+	// A mesma linha atende aos dois filtros (ator e details.device_id) e só entra uma vez.
+	entry := models.AuditEntry{ID: 40, Seq: 40, Timestamp: at, Actor: "dev-1", Action: "PHOTO_PROCESSED", Details: json.RawMessage(`{"device_id":"dev-1"}`)}
+	mockDB.On("StreamAuditLog", mock.Anything).Return([]models.AuditEntry{entry}, nil).Twice()
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DATA_SUBJECT_EXPORTED" })).Return(nil)
+	mockDB.On("FinishDataSubjectRequest", mock.Anything).Return(nil)
+
+	req := newTestSubjectRequest(models.SubjectActionExport)
+	service := NewDataSubjectService(mockDB, store, keys, new(MockRekognitionClient), "test-collection", dest, private)
+	require.NoError(t, service.Run(context.Background(), req))
+	mockDB.AssertExpectations(t)
+	require.Equal(t, models.ExportStatusCompleted, req.Status, req.Error)
+
+	archivePath := filepath.Join(dir, "lgpd", "request-3.zip")
+	assert.Equal(t, "file://"+archivePath, req.Location)
+	raw, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	var record auditchain.CompletionRecord
+	require.NoError(t, json.Unmarshal(req.Record, &record))
+	require.NoError(t, record.Verify(public))
+	sum := sha256.Sum256(raw)
+	assert.Equal(t, hex.EncodeToString(sum[:]), record.ArchiveSHA256)
+	assert.Equal(t, map[string]int64{"gps": 1, "gyroscope": 0, "photo": 1, "audit_log": 1}, record.Rows)
+
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+	}
+	assert.Equal(t, jpegImage, files["photos/11.jpg"], "a imagem vai decifrada")
+	lines := 0
+	scanner := bufio.NewScanner(bytes.NewReader(files["audit.ndjson"]))
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(t, 1, lines)
+	assert.Contains(t, string(files["gps.csv"]), "dev-1")
+	var manifest subjectArchiveManifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, record.Rows, manifest.Rows)
+	assert.Empty(t, manifest.MissingPhotos)
+}
+
+func TestDataSubjectService_DeleteFacesToleratesFacesAlreadyGone(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockRek.On("DeleteFaces", mock.Anything, mock.Anything).Return(&rekognition.DeleteFacesOutput{
+		DeletedFaces: []string{"face-1"},
+		UnsuccessfulFaceDeletions: []types.UnsuccessfulFaceDeletion{
+			{FaceId: aws.String("face-2"), Reasons: []types.UnsuccessfulFaceDeletionReason{types.UnsuccessfulFaceDeletionReasonFaceNotFound}},
+		},
+	}, nil).Once()
+	mockRek.On("DeleteFaces", mock.Anything, mock.Anything).Return(&rekognition.DeleteFacesOutput{
+		UnsuccessfulFaceDeletions: []types.UnsuccessfulFaceDeletion{
+			{FaceId: aws.String("face-3"), Reasons: []types.UnsuccessfulFaceDeletionReason{types.UnsuccessfulFaceDeletionReasonAssociatedToAnExistingUser}},
+		},
+	}, nil).Once()
+	service := NewDataSubjectService(new(MockStorage), nil, PhotoKeys{}, mockRek, "test-collection", nil, nil)
+
+	record := &auditchain.CompletionRecord{}
+	require.NoError(t, service.deleteFaces(context.Background(), map[string]bool{"face-1": true, "face-2": true}, record))
+	assert.Equal(t, int64(1), record.FacesDeleted)
+	assert.Error(t, service.deleteFaces(context.Background(), map[string]bool{"face-3": true}, record))
+}
+
+func TestDataSubjectService_DeletedFacesLeaveThePhotoCache(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockRek.On("DeleteFaces", mock.Anything, mock.Anything).Return(&rekognition.DeleteFacesOutput{DeletedFaces: []string{"face-1"}}, nil).Once()
+	analyzer := NewPhotoAnalyzerService(mockRek, "test-collection", new(MockStorage), nil, PhotoKeys{})
+	analyzer.cache.Set("imagem-apagada", &faceMatch{faceID: "face-1", similarity: 99}, cache.DefaultExpiration)
+	analyzer.cache.Set("imagem-de-outro", &faceMatch{faceID: "face-outro", similarity: 98}, cache.DefaultExpiration)
+	service := NewDataSubjectService(new(MockStorage), nil, PhotoKeys{}, mockRek, "test-collection", nil, nil)
+	service.SetFacesDeletedHook(analyzer.ForgetFaces)
+
+	require.NoError(t, service.deleteFaces(context.Background(), map[string]bool{"face-1": true}, &auditchain.CompletionRecord{}))
+
+	_, found := analyzer.cache.Get("imagem-apagada")
+	assert.False(t, found, "uma imagem repetida não pode voltar a ser associada ao rosto apagado")
+	_, found = analyzer.cache.Get("imagem-de-outro")
+	assert.True(t, found)
+}
+
+func newTestDriverRequest(action string) *models.DataSubjectRequest {
+	req := newTestSubjectRequest(action)
+	req.SubjectType, req.SubjectID = models.SubjectTypeDriver, "ana"
+	return req
+}
+
+func TestDataSubjectService_DriverAnonymizeCoversDevicesFacesAndRegistration(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	dest, err := export.NewLocalDestination(t.TempDir())
+	require.NoError(t, err)
+	store, keys := newTestPhotoStore(t), testStreamKeys(t)
+	mockDB, mockRek := new(MockStorage), new(MockRekognitionClient)
+
+	own := storeSubjectPhoto(t, store, keys, 11)
+	own.FaceID, own.DriverID = "face-ana-1", "ana"
+	other := storeSubjectPhoto(t, store, keys, 12)
+	other.FaceID, other.DriverID = "face-bruno", "bruno"
+	second := storeSubjectPhoto(t, store, keys, 13)
+	second.DeviceID, second.FaceID, second.DriverID = "dev-2", "face-ana-2", "ana"
+
+	mockDB.On("ListDriverDevices", "ana").Return([]string{"dev-1", "dev-2"}, nil)
+	mockDB.On("GetDriver", "ana").Return(&models.Driver{ID: "ana", Name: "Ana"}, nil)
+	mockDB.On("ListDriverFaces", "ana").Return([]models.DriverFace{{FaceID: "face-ana-enrolled", DriverID: "ana"}}, nil)
+	mockDB.On("ListDevicePhotos", "dev-1", int64(0), subjectPhotoPageSize).Return([]models.StoredPhoto{own, other}, nil)
+	mockDB.On("ListDevicePhotos", "dev-2", int64(0), subjectPhotoPageSize).Return([]models.StoredPhoto{second}, nil)
+	mockRek.On("DeleteFaces", mock.Anything, mock.MatchedBy(func(in *rekognition.DeleteFacesInput) bool {
+		return assert.ElementsMatch(t, []string{"face-ana-1", "face-ana-2", "face-ana-enrolled"}, in.FaceIds)
+	})).Return(&rekognition.DeleteFacesOutput{DeletedFaces: []string{"face-ana-1", "face-ana-2", "face-ana-enrolled"}}, nil).Once()
+	pseudonyms := map[string]bool{}
+	mockDB.On("AnonymizeDeviceData", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { pseudonyms[args.String(1)] = true }).Return(map[string]int64{"gps": 2, "photo": 1}, nil).Twice()
+	mockDB.On("EraseDriver", "ana").Return(map[string]int64{"drivers": 1, "driver_faces": 1}, nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DATA_SUBJECT_ANONYMIZED" })).Return(nil)
+	mockDB.On("FinishDataSubjectRequest", mock.Anything).Return(nil)
+
+	req := newTestDriverRequest(models.SubjectActionAnonymize)
+	service := NewDataSubjectService(mockDB, store, keys, mockRek, "test-collection", dest, private)
+	require.NoError(t, service.Run(context.Background(), req))
+
+	mockDB.AssertExpectations(t)
+	mockRek.AssertExpectations(t)
+	require.Equal(t, models.ExportStatusCompleted, req.Status, req.Error)
+	assert.Len(t, pseudonyms, 2, "cada dispositivo recebe um pseudônimo próprio")
+
+	var record auditchain.CompletionRecord
+	require.NoError(t, json.Unmarshal(req.Record, &record))
+	require.NoError(t, record.Verify(public))
+	assert.Equal(t, []string{"dev-1", "dev-2"}, record.Devices)
+	assert.Equal(t, map[string]int64{"gps": 4, "photo": 2, "drivers": 1, "driver_faces": 1}, record.Rows)
+	assert.Equal(t, int64(3), record.FacesDeleted, "o rosto de outro motorista fica na coleção")
+	assert.Equal(t, int64(3), record.BlobsDeleted)
+}
+
+func TestDataSubjectService_UnknownDriverFails(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("ListDriverDevices", "ana").Return([]string{}, nil)
+	mockDB.On("GetDriver", "ana").Return(nil, storage.ErrNotFound)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DATA_SUBJECT_REQUEST_FAILED" })).Return(nil)
+	mockDB.On("FinishDataSubjectRequest", mock.Anything).Return(nil)
+
+	req := newTestDriverRequest(models.SubjectActionErase)
+	service := NewDataSubjectService(mockDB, nil, PhotoKeys{}, new(MockRekognitionClient), "test-collection", nil, nil)
+	require.NoError(t, service.Run(context.Background(), req))
+
+	mockDB.AssertExpectations(t)
+	assert.Equal(t, models.ExportStatusFailed, req.Status)
+	assert.Contains(t, req.Error, "não encontrado")
+}
+
+func TestDataSubjectService_DriverExportGroupsFilesByDevice(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	store, keys := newTestPhotoStore(t), testStreamKeys(t)
+	photo := storeSubjectPhoto(t, store, keys, 11)
+	photo.DriverID = "ana"
+	mockDB := new(MockStorage)
+
+	mockDB.On("ListDriverDevices", "ana").Return([]string{"dev-1"}, nil)
+	mockDB.On("GetDriver", "ana").Return(&models.Driver{ID: "ana", Name: "Ana", FaceIDs: []string{"face-ana"}}, nil)
+	mockDB.On("ListDriverFaces", "ana").Return([]models.DriverFace{{FaceID: "face-ana", DriverID: "ana", Source: models.DriverFaceSourceEnrolled}}, nil)
+	mockDB.On("StreamGPS", "dev-1", subjectDataFrom, subjectDataTo).Return([]models.GPSData{}, nil)
+	mockDB.On("StreamGyroscope", "dev-1", subjectDataFrom, subjectDataTo).Return([]models.GyroscopeData{}, nil)
+	mockDB.On("StreamPhotoMetadata", "dev-1", subjectDataFrom, subjectDataTo).Return([]models.PhotoMetadata{photo.PhotoMetadata}, nil)
+	mockDB.On("ListDevicePhotos", "dev-1", int64(0), subjectPhotoPageSize).Return([]models.StoredPhoto{photo}, nil)
+	var filters []models.AuditFilter
+	mockDB.On("StreamAuditLog", mock.Anything).Run(func(args mock.Arguments) { filters = append(filters, args.Get(0).(models.AuditFilter)) }).
+		Return([]models.AuditEntry{}, nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "DATA_SUBJECT_EXPORTED" })).Return(nil)
+	mockDB.On("FinishDataSubjectRequest", mock.Anything).Return(nil)
+
+	req := newTestDriverRequest(models.SubjectActionExport)
+	service := NewDataSubjectService(mockDB, store, keys, new(MockRekognitionClient), "test-collection", dest, private)
+	require.NoError(t, service.Run(context.Background(), req))
+	require.Equal(t, models.ExportStatusCompleted, req.Status, req.Error)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "lgpd", "request-3.zip"))
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.ElementsMatch(t, []string{"devices/dev-1/gps.csv", "devices/dev-1/gyroscope.csv", "devices/dev-1/photo.csv",
+		"photos/11.jpg", "driver.json", "audit.ndjson", "manifest.json"}, names)
+	require.Len(t, filters, 3)
+	assert.JSONEq(t, `"ana"`, string(filters[2].Details["driver_id"]), "as linhas com o motorista em details também entram")
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+)
+
+// Limites da foto de referência. Brightness e Sharpness vão de 0 a 100 no Rekognition; o ângulo é o
+// desvio máximo de frente, em graus, para cima/baixo (pitch) e para os lados (yaw).
+const (
+	MaxReferencePhotoBytes  = 5 << 20
+	referenceMinConfidence  = 90
+	referenceMinBrightness  = 30
+	referenceMinSharpness   = 30
+	referenceMaxPoseDegrees = 30
+)
+
+// ErrReferencePhotoRejected indica uma foto de referência que não serve para identificar o motorista.
+var ErrReferencePhotoRejected = errors.New("foto de referência recusada")
+
+// FaceEnroller é o subconjunto do Rekognition usado no cadastro dos rostos de referência.
+type FaceEnroller interface {
+	DetectFaces(ctx context.Context, params *rekognition.DetectFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DetectFacesOutput, error)
+	IndexFaces(ctx context.Context, params *rekognition.IndexFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.IndexFacesOutput, error)
+	DeleteFaces(ctx context.Context, params *rekognition.DeleteFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DeleteFacesOutput, error)
+}
+
+// DriverFaceService indexa e remove os rostos de referência dos motoristas na coleção. A associação com o
+// motorista no banco fica com quem chama, junto com o registro de auditoria.
+type DriverFaceService struct {
+	faces        FaceEnroller
+	collectionID string
+}
+
+func NewDriverFaceService(faces FaceEnroller, collectionID string) *DriverFaceService {
+	return &DriverFaceService{faces: faces, collectionID: collectionID}
+}
+
+// IndexReferenceFace confere a foto (um único rosto, de frente, nítido e iluminado) e indexa o rosto com
+// ExternalImageId igual ao id do motorista. Fotos fora dos limites retornam ErrReferencePhotoRejected.
+func (s *DriverFaceService) IndexReferenceFace(ctx context.Context, driverID string, image []byte) (string, error) {
+	if len(image) > MaxReferencePhotoBytes {
+		return "", fmt.Errorf("%w: a imagem deve ter no máximo %d bytes", ErrReferencePhotoRejected, MaxReferencePhotoBytes)
+	}
+	detected, err := s.faces.DetectFaces(ctx, &rekognition.DetectFacesInput{
+		Image: &types.Image{Bytes: image}, Attributes: []types.Attribute{types.AttributeDefault},
+	})
+	if err != nil {
+		return "", rekognitionImageError(err)
+	}
+	if err := checkReferenceFaces(detected.FaceDetails); err != nil {
+		return "", err
+	}
+
+	indexed, err := s.faces.IndexFaces(ctx, &rekognition.IndexFacesInput{
+		CollectionId:    aws.String(s.collectionID),
+		Image:           &types.Image{Bytes: image},
+		ExternalImageId: aws.String(driverID),
+		MaxFaces:        aws.Int32(1),
+		QualityFilter:   types.QualityFilterHigh,
+	})
+	if err != nil {
+		return "", rekognitionImageError(err)
+	}
+	if len(indexed.FaceRecords) == 0 {
+		reasons := []string{}
+		for _, unindexed := range indexed.UnindexedFaces {
+			for _, reason := range unindexed.Reasons {
+				reasons = append(reasons, string(reason))
+			}
+		}
+		return "", fmt.Errorf("%w: o Rekognition não indexou o rosto (%s)", ErrReferencePhotoRejected, strings.Join(reasons, ", "))
+	}
+	faceID := aws.ToString(indexed.FaceRecords[0].Face.FaceId)
+	slog.Info("rosto de referência indexado", "driver_id", driverID, "face_id", faceID)
+	return faceID, nil
+}
+
+func checkReferenceFaces(details []types.FaceDetail) error {
+	switch {
+	case len(details) == 0:
+		return fmt.Errorf("%w: nenhum rosto encontrado", ErrReferencePhotoRejected)
+	case len(details) > 1:
+		return fmt.Errorf("%w: %d rostos encontrados, envie uma foto só do motorista", ErrReferencePhotoRejected, len(details))
+	}
+	face := details[0]
+	if aws.ToFloat32(face.Confidence) < referenceMinConfidence {
+		return fmt.Errorf("%w: rosto detectado com confiança baixa", ErrReferencePhotoRejected)
+	}
+	if face.Quality != nil {
+		if aws.ToFloat32(face.Quality.Brightness) < referenceMinBrightness {
+			return fmt.Errorf("%w: imagem escura demais", ErrReferencePhotoRejected)
+		}
+		if aws.ToFloat32(face.Quality.Sharpness) < referenceMinSharpness {
+			return fmt.Errorf("%w: imagem sem nitidez", ErrReferencePhotoRejected)
+		}
+	}
+	if face.Pose != nil && (math.Abs(float64(aws.ToFloat32(face.Pose.Yaw))) > referenceMaxPoseDegrees ||
+		math.Abs(float64(aws.ToFloat32(face.Pose.Pitch))) > referenceMaxPoseDegrees) {
+		return fmt.Errorf("%w: o rosto deve estar de frente para a câmera", ErrReferencePhotoRejected)
+	}
+	return nil
+}
+
+// rekognitionImageError trata como recusa os erros do Rekognition causados pela própria imagem.
+func rekognitionImageError(err error) error {
+	var invalidFormat *types.InvalidImageFormatException
+	var tooLarge *types.ImageTooLargeException
+	var invalidParameter *types.InvalidParameterException
+	if errors.As(err, &invalidFormat) || errors.As(err, &tooLarge) || errors.As(err, &invalidParameter) {
+		return fmt.Errorf("%w: imagem inválida para o Rekognition", ErrReferencePhotoRejected)
+	}
+	return fmt.Errorf("falha ao consultar o Rekognition: %w", err)
+}
+
+// DeleteFace remove o rosto da coleção. Um rosto que já não está nela não é erro.
+func (s *DriverFaceService) DeleteFace(ctx context.Context, faceID string) error {
+	result, err := s.faces.DeleteFaces(ctx, &rekognition.DeleteFacesInput{CollectionId: aws.String(s.collectionID), FaceIds: []string{faceID}})
+	if err != nil {
+		return fmt.Errorf("falha ao apagar o rosto %s da coleção: %w", faceID, err)
+	}
+	for _, failed := range result.UnsuccessfulFaceDeletions {
+		for _, reason := range failed.Reasons {
+			if reason != types.UnsuccessfulFaceDeletionReasonFaceNotFound {
+				return fmt.Errorf("o Rekognition não apagou o rosto %s: %s", faceID, reason)
+			}
+		}
+	}
+	return nil
+}
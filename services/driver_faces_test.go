@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockRekognitionClient) DetectFaces(ctx context.Context, params *rekognition.DetectFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.DetectFacesOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*rekognition.DetectFacesOutput), args.Error(1)
+}
+
+// goodFace é um rosto de frente, nítido e bem iluminado.
+func goodFace() types.FaceDetail {
+	return types.FaceDetail{
+		Confidence: aws.Float32(99.9),
+		Quality:    &types.ImageQuality{Brightness: aws.Float32(80), Sharpness: aws.Float32(70)},
+		Pose:       &types.Pose{Yaw: aws.Float32(5), Pitch: aws.Float32(-3)},
+	}
+}
+
+func TestDriverFaceService_IndexesWithDriverID(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockRek.On("DetectFaces", mock.Anything, mock.Anything).Return(&rekognition.DetectFacesOutput{FaceDetails: []types.FaceDetail{goodFace()}}, nil)
+	mockRek.On("IndexFaces", mock.Anything, mock.MatchedBy(func(in *rekognition.IndexFacesInput) bool {
+		return aws.ToString(in.ExternalImageId) == "drv-1" && aws.ToInt32(in.MaxFaces) == 1 && in.QualityFilter == types.QualityFilterHigh
+	})).Return(&rekognition.IndexFacesOutput{FaceRecords: []types.FaceRecord{{Face: &types.Face{FaceId: aws.String("face-1")}}}}, nil)
+
+	faceID, err := NewDriverFaceService(mockRek, "test-collection").IndexReferenceFace(context.Background(), "drv-1", jpegImage)
+
+	require.NoError(t, err)
+	assert.Equal(t, "face-1", faceID)
+	mockRek.AssertExpectations(t)
+}
+
+func TestDriverFaceService_RejectsBadReferencePhotos(t *testing.T) {
+	dark, sideways := goodFace(), goodFace()
+	dark.Quality.Brightness = aws.Float32(10)
+	sideways.Pose.Yaw = aws.Float32(-50)
+	tests := []struct {
+		name  string
+		faces []types.FaceDetail
+	}{
+		{"sem rosto", nil},
+		{"dois rostos", []types.FaceDetail{goodFace(), goodFace()}},
+		{"escura", []types.FaceDetail{dark}},
+		{"de lado", []types.FaceDetail{sideways}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRek := new(MockRekognitionClient)
+			mockRek.On("DetectFaces", mock.Anything, mock.Anything).Return(&rekognition.DetectFacesOutput{FaceDetails: tt.faces}, nil)
+
+			_, err := NewDriverFaceService(mockRek, "test-collection").IndexReferenceFace(context.Background(), "drv-1", jpegImage)
+
+			assert.ErrorIs(t, err, ErrReferencePhotoRejected)
+			mockRek.AssertNotCalled(t, "IndexFaces", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestDriverFaceService_UnindexedFaceIsRejected(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockRek.On("DetectFaces", mock.Anything, mock.Anything).Return(&rekognition.DetectFacesOutput{FaceDetails: []types.FaceDetail{goodFace()}}, nil)
+	mockRek.On("IndexFaces", mock.Anything, mock.Anything).Return(&rekognition.IndexFacesOutput{
+		UnindexedFaces: []types.UnindexedFace{{Reasons: []types.Reason{types.ReasonLowFaceQuality}}},
+	}, nil)
+
+	_, err := NewDriverFaceService(mockRek, "test-collection").IndexReferenceFace(context.Background(), "drv-1", jpegImage)
+
+	assert.ErrorIs(t, err, ErrReferencePhotoRejected)
+	assert.Contains(t, err.Error(), "LOW_FACE_QUALITY")
+}
+
+func TestDriverFaceService_DeleteFaceToleratesMissingFace(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockRek.On("DeleteFaces", mock.Anything, mock.Anything).Return(&rekognition.DeleteFacesOutput{
+		UnsuccessfulFaceDeletions: []types.UnsuccessfulFaceDeletion{{FaceId: aws.String("face-1"),
+			Reasons: []types.UnsuccessfulFaceDeletionReason{types.UnsuccessfulFaceDeletionReasonFaceNotFound}}},
+	}, nil)
+
+	assert.NoError(t, NewDriverFaceService(mockRek, "test-collection").DeleteFace(context.Background(), "face-1"))
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+var exportDatasets = []string{"gps", "gyroscope", "photo"}
+
+// DefaultExportJobTimeout é o tempo máximo de um job de exportação. Um job em execução há mais que isso,
+// somado a exportLeaseMargin, foi abandonado por um worker que parou e volta para a fila.
+const (
+	DefaultExportJobTimeout = 30 * time.Minute
+	exportLeaseMargin       = 5 * time.Minute
+)
+
+type ExportService struct {
+	db         storage.Storage
+	dest       export.Destination
+	jobTimeout time.Duration
+}
+
+func NewExportService(db storage.Storage, dest export.Destination) *ExportService {
+	return &ExportService{db: db, dest: dest, jobTimeout: DefaultExportJobTimeout}
+}
+
+// SetJobTimeout muda o tempo máximo de cada job e, com ele, o prazo para um job em execução ser
+// considerado abandonado.
+func (s *ExportService) SetJobTimeout(timeout time.Duration) {
+	s.jobTimeout = timeout
+}
+
+func writeDataset[T export.Row](format string, w io.Writer, stream func(emit func(T) error) error) (int64, error) {
+	writer, err := export.NewDatasetWriter[T](format, w)
+	if err != nil {
+		return 0, err
+	}
+	var rows int64
+	err = stream(func(row T) error {
+		rows++
+		return writer.Write(row)
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, writer.Close()
+}
+
+func (s *ExportService) write(ctx context.Context, job *models.ExportJob, w io.Writer) (int64, error) {
+	switch job.Dataset {
+	case "gps":
+		return writeDataset(job.Format, w, func(emit func(export.GPSRow) error) error {
+			return s.db.StreamGPS(ctx, job.DeviceID, job.From, job.To, func(d models.GPSData) error { return emit(export.NewGPSRow(d)) })
+		})
+	case "gyroscope":
+		return writeDataset(job.Format, w, func(emit func(export.GyroscopeRow) error) error {
+			return s.db.StreamGyroscope(ctx, job.DeviceID, job.From, job.To, func(d models.GyroscopeData) error { return emit(export.NewGyroscopeRow(d)) })
+		})
+	case "photo":
+		return writeDataset(job.Format, w, func(emit func(export.PhotoRow) error) error {
+			return s.db.StreamPhotoMetadata(ctx, job.DeviceID, job.From, job.To, func(m models.PhotoMetadata) error { return emit(export.NewPhotoRow(m)) })
+		})
+	default:
+		return 0, fmt.Errorf("dataset desconhecido: %s", job.Dataset)
+	}
+}
+
+func objectName(job *models.ExportJob) string {
+	return fmt.Sprintf("%s/%s-%s-%s-job%d.%s", job.Dataset, job.Dataset,
+		job.From.UTC().Format("20060102T150405"), job.To.UTC().Format("20060102T150405"), job.ID, job.Format)
+}
+
+// Run executa um job já reivindicado, grava o resultado no destino e registra a exportação na auditoria.
+// A leitura e o envio param no tempo máximo do job; o resultado é registrado com o contexto de fora.
+func (s *ExportService) Run(ctx context.Context, job *models.ExportJob) error {
+	slog.Info("iniciando exportação", "job_id", job.ID, "dataset", job.Dataset, "format", job.Format)
+
+	runErr := func() error {
+		jobCtx, cancel := context.WithTimeout(ctx, s.jobTimeout)
+		defer cancel()
+		obj, err := s.dest.Create(objectName(job))
+		if err != nil {
+			return err
+		}
+		rows, err := s.write(jobCtx, job, obj)
+		job.Rows = rows
+		if err != nil {
+			obj.Abort()
+			return err
+		}
+		job.Location, err = obj.Commit(jobCtx)
+		return err
+	}()
+
+	action := "EXPORT_COMPLETED"
+	job.Status = models.ExportStatusCompleted
+	if runErr != nil {
+		slog.Error("falha na exportação", "error", runErr, "job_id", job.ID)
+		action = "EXPORT_FAILED"
+		job.Status = models.ExportStatusFailed
+		job.Error = runErr.Error()
+	}
+	if err := s.db.FinishExportJob(ctx, job); err != nil {
+		return fmt.Errorf("falha ao atualizar job de exportação %d: %w", job.ID, err)
+	}
+
+	auditEvent := models.AuditEvent{
+		Actor:  job.RequestedBy,
+		Action: action,
+		Details: map[string]interface{}{
+			"job_id":    job.ID,
+			"dataset":   job.Dataset,
+			"format":    job.Format,
+			"device_id": job.DeviceID,
+			"from":      job.From,
+			"to":        job.To,
+			"rows":      job.Rows,
+			"location":  job.Location,
+			"error":     job.Error,
+		},
+	}
+	if err := s.db.LogAuditEvent(ctx, auditEvent); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para exportação", "error", err, "job_id", job.ID)
+	}
+	slog.Info("exportação finalizada", "job_id", job.ID, "status", job.Status, "rows", job.Rows, "location", job.Location)
+	return nil
+}
+
+// RunPending devolve à fila os jobs abandonados e executa jobs pendentes até a fila esvaziar.
+func (s *ExportService) RunPending(ctx context.Context) error {
+	reclaimed, err := s.db.ReclaimExportJobs(ctx, time.Now().Add(-(s.jobTimeout + exportLeaseMargin)))
+	if err != nil {
+		return err
+	}
+	if reclaimed > 0 {
+		slog.Warn("jobs de exportação abandonados voltaram para a fila", "count", reclaimed)
+	}
+	for {
+		job, err := s.db.ClaimExportJob(ctx)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return nil
+		}
+		if err := s.Run(ctx, job); err != nil {
+			return err
+		}
+	}
+}
+
+// ScheduleDaily enfileira a exportação do dia anterior (UTC) de todos os datasets.
+// Jobs do agendador são únicos por período, então vários workers podem chamar isto ao mesmo tempo.
+func (s *ExportService) ScheduleDaily(ctx context.Context, format string, now time.Time) error {
+	to := now.UTC().Truncate(24 * time.Hour)
+	from := to.Add(-24 * time.Hour)
+	for _, dataset := range exportDatasets {
+		job := &models.ExportJob{
+			ExportRequest: models.ExportRequest{Dataset: dataset, Format: format, From: from, To: to},
+			RequestedBy:   "scheduler",
+		}
+		err := s.db.CreateExportJob(ctx, job)
+		if errors.Is(err, storage.ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("exportação diária agendada", "job_id", job.ID, "dataset", dataset, "from", from)
+	}
+	return nil
+}
+
+// Start consulta a fila de exportações periodicamente até o contexto ser cancelado.
+// Com dailyFormat preenchido, também agenda as exportações diárias.
+func (s *ExportService) Start(ctx context.Context, interval time.Duration, dailyFormat string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if dailyFormat != "" {
+			if err := s.ScheduleDaily(ctx, dailyFormat, time.Now()); err != nil {
+				slog.Error("falha ao agendar exportação diária", "error", err)
+			}
+		}
+		if err := s.RunPending(ctx); err != nil {
+			slog.Error("falha ao processar fila de exportações", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"challenge-v3/export"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) StreamGPS(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GPSData) error) error {
+	args := m.Called(deviceID, from, to)
+	for _, p := range args.Get(0).([]models.GPSData) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+func (m *MockStorage) StreamPhotoMetadata(ctx context.Context, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error {
+	args := m.Called(deviceID, from, to)
+	for _, p := range args.Get(0).([]models.PhotoMetadata) {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+func (m *MockStorage) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	return m.Called(job).Error(0)
+}
+func (m *MockStorage) FinishExportJob(ctx context.Context, job *models.ExportJob) error {
+	return m.Called(job).Error(0)
+}
+func (m *MockStorage) ClaimExportJob(ctx context.Context) (*models.ExportJob, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ExportJob), args.Error(1)
+}
+
+func (m *MockStorage) ReclaimExportJobs(ctx context.Context, startedBefore time.Time) (int64, error) {
+	args := m.Called(startedBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// slowObject só conclui o envio quando o contexto do Commit termina, como um upload travado.
+type slowObject struct{ strings.Builder }
+
+func (o *slowObject) Commit(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(2 * time.Second):
+		return "s3://bucket/lento", nil
+	}
+}
+func (o *slowObject) Abort() {}
+
+type slowDestination struct{}
+
+func (slowDestination) Create(name string) (export.Object, error) { return &slowObject{}, nil }
+
+func newTestExportJob(dataset, format string) *models.ExportJob {
+	from := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	return &models.ExportJob{
+		ID:            7,
+		ExportRequest: models.ExportRequest{Dataset: dataset, Format: format, From: from, To: from.Add(24 * time.Hour)},
+		RequestedBy:   "analista",
+		Status:        models.ExportStatusRunning,
+	}
+}
+
+func TestExportService_WritesParquetAndAudits(t *testing.T) {
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, dest)
+	job := newTestExportJob("gps", "parquet")
+
+	points := []models.GPSData{
+		{DeviceID: "dev-1", Latitude: float64Ptr(-8), Longitude: float64Ptr(-34), Speed: float64Ptr(42), Timestamp: job.From.Add(time.Hour)},
+		{DeviceID: "dev-2", Latitude: float64Ptr(-9), Longitude: float64Ptr(-35), Timestamp: job.From.Add(2 * time.Hour)},
+	}
+	mockDB.On("StreamGPS", "", job.From, job.To).Return(points, nil)
+	mockDB.On("FinishExportJob", mock.MatchedBy(func(j *models.ExportJob) bool {
+		return j.Status == models.ExportStatusCompleted && j.Rows == 2
+	})).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "EXPORT_COMPLETED" && e.Actor == "analista" && e.Details["job_id"] == int64(7)
+	})).Return(nil)
+
+	require.NoError(t, service.Run(context.Background(), job))
+	mockDB.AssertExpectations(t)
+
+	path := strings.TrimPrefix(job.Location, "file://")
+	assert.Equal(t, filepath.Join(dir, "gps", "gps-20250110T000000-20250111T000000-job7.parquet"), path)
+	rows, err := parquet.ReadFile[export.GPSRow](path)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "dev-1", rows[0].DeviceID)
+	assert.Equal(t, 42.0, *rows[0].Speed)
+	assert.Nil(t, rows[1].Speed)
+	assert.True(t, points[1].Timestamp.Equal(rows[1].Timestamp))
+}
+
+func TestExportService_PhotoCSVHasNoImageData(t *testing.T) {
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, dest)
+	job := newTestExportJob("photo", "csv")
+
+	similarity := 98.5
+	photos := []models.PhotoMetadata{
+		{ID: 1, DeviceID: "dev-1", Recognized: true, DriverID: "drv-1", FaceID: "face-1", Similarity: &similarity, Timestamp: job.From},
+		{ID: 2, DeviceID: "dev-1", Timestamp: job.From},
+	}
+	mockDB.On("StreamPhotoMetadata", "", job.From, job.To).Return(photos, nil)
+	mockDB.On("FinishExportJob", mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+
+	require.NoError(t, service.Run(context.Background(), job))
+
+	content, err := os.ReadFile(strings.TrimPrefix(job.Location, "file://"))
+	require.NoError(t, err)
+	assert.Equal(t, "id,device_id,recognized,driver_id,face_id,similarity,timestamp\n"+
+		"1,dev-1,true,drv-1,face-1,98.5,2025-01-10T00:00:00Z\n"+
+		"2,dev-1,false,,,,2025-01-10T00:00:00Z\n", string(content))
+}
+
+func TestExportService_FailureLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	dest, err := export.NewLocalDestination(dir)
+	require.NoError(t, err)
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, dest)
+	job := newTestExportJob("gps", "csv")
+
+	mockDB.On("StreamGPS", "", job.From, job.To).Return([]models.GPSData{}, errors.New("conexão perdida"))
+	mockDB.On("FinishExportJob", mock.MatchedBy(func(j *models.ExportJob) bool {
+		return j.Status == models.ExportStatusFailed && j.Error == "conexão perdida"
+	})).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool { return e.Action == "EXPORT_FAILED" })).Return(nil)
+
+	require.NoError(t, service.Run(context.Background(), job))
+	mockDB.AssertExpectations(t)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "gps"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "arquivos parciais devem ser removidos")
+}
+
+func TestExportService_ScheduleDailyIsIdempotent(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, nil)
+	now := time.Date(2025, 1, 11, 3, 30, 0, 0, time.UTC)
+
+	mockDB.On("CreateExportJob", mock.MatchedBy(func(j *models.ExportJob) bool { return j.Dataset == "gps" })).Return(storage.ErrDuplicate)
+	mockDB.On("CreateExportJob", mock.MatchedBy(func(j *models.ExportJob) bool {
+		return j.Dataset != "gps" && j.RequestedBy == "scheduler" &&
+			j.From.Equal(time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)) && j.To.Equal(time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC))
+	})).Return(nil)
+
+	require.NoError(t, service.ScheduleDaily(context.Background(), "parquet", now))
+	mockDB.AssertNumberOfCalls(t, "CreateExportJob", 3)
+}
+
+func TestExportService_JobTimeoutStopsTheUpload(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, slowDestination{})
+	service.SetJobTimeout(20 * time.Millisecond)
+	job := newTestExportJob("gps", "csv")
+
+	mockDB.On("StreamGPS", "", job.From, job.To).Return([]models.GPSData{}, nil)
+	mockDB.On("FinishExportJob", mock.MatchedBy(func(j *models.ExportJob) bool {
+		return j.Status == models.ExportStatusFailed && strings.Contains(j.Error, "deadline")
+	})).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+
+	require.NoError(t, service.Run(context.Background(), job))
+	mockDB.AssertExpectations(t)
+}
+
+func TestExportService_RunPendingReclaimsAbandonedJobs(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewExportService(mockDB, nil)
+	lease := DefaultExportJobTimeout + exportLeaseMargin
+
+	mockDB.On("ReclaimExportJobs", mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) >= lease && time.Since(before) < lease+time.Minute
+	})).Return(int64(2), nil).Once()
+	mockDB.On("ClaimExportJob").Return(nil, nil).Once()
+
+	require.NoError(t, service.RunPending(context.Background()))
+	mockDB.AssertExpectations(t)
+}
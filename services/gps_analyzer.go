@@ -0,0 +1,311 @@
+package services
+
+import (
+	"challenge-v3/geo"
+	"challenge-v3/ierr"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+type GPSAnalyzer interface {
+	AnalyzeAndSaveGPS(ctx context.Context, data *models.GPSData) (*models.OverspeedEvent, error)
+	AnalyzeAndSaveGPSBatch(ctx context.Context, batch []*models.GPSData) ([]*models.OverspeedEvent, error)
+}
+
+// SpeedConfig define os limites de velocidade e os filtros contra ruído de GPS.
+type SpeedConfig struct {
+	DefaultLimit float64            // km/h; 0 desativa o alerta global
+	DeviceLimits map[string]float64 // km/h por dispositivo, sobrepõe o limite global
+	MinDistance  float64            // metros; deslocamentos menores são tratados como veículo parado
+	MinInterval  time.Duration      // leituras mais próximas que isso não geram velocidade
+	MaxSpeed     float64            // km/h; acima disso a leitura é considerada salto de GPS
+	ConfirmFixes int                // leituras consecutivas acima do limite antes de gerar o evento
+}
+
+func DefaultSpeedConfig() SpeedConfig {
+	return SpeedConfig{
+		DeviceLimits: map[string]float64{},
+		MinDistance:  15,
+		MinInterval:  time.Second,
+		MaxSpeed:     250,
+		ConfirmFixes: 2,
+	}
+}
+
+// ParseDeviceLimits interpreta o formato "device-a=80,device-b=60".
+func ParseDeviceLimits(raw string) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		deviceID, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("limite de velocidade inválido: %q", entry)
+		}
+		limit, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("limite de velocidade inválido para %s: %w", deviceID, err)
+		}
+		limits[strings.TrimSpace(deviceID)] = limit
+	}
+	return limits, nil
+}
+
+type deviceTrack struct {
+	latitude  float64
+	longitude float64
+	timestamp time.Time
+	overCount int
+	alerting  bool
+}
+
+// gpsLockStripes é o número de travas entre as quais os dispositivos são distribuídos: leituras do mesmo
+// dispositivo são avaliadas uma de cada vez, e dispositivos diferentes quase nunca disputam a mesma trava.
+const gpsLockStripes = 64
+
+type GPSAnalyzerService struct {
+	db     storage.Storage
+	config SpeedConfig
+	tracks *cache.Cache
+	locks  [gpsLockStripes]sync.Mutex
+}
+
+func NewGPSAnalyzerService(db storage.Storage, cfg SpeedConfig) *GPSAnalyzerService {
+	return &GPSAnalyzerService{
+		db:     db,
+		config: cfg,
+		tracks: cache.New(30*time.Minute, 10*time.Minute),
+	}
+}
+
+func (s *GPSAnalyzerService) limitFor(deviceID string) float64 {
+	if limit, ok := s.config.DeviceLimits[deviceID]; ok {
+		return limit
+	}
+	return s.config.DefaultLimit
+}
+
+// evaluate calcula velocidade e rumo em relação à última posição conhecida (prev, nil se não houver)
+// e devolve o novo estado do dispositivo. Não mexe no cache; ver analyzeAndSave para quando o estado avança.
+func (s *GPSAnalyzerService) evaluate(data *models.GPSData, prev *deviceTrack) (*deviceTrack, *models.OverspeedEvent) {
+	lat, lon := *data.Latitude, *data.Longitude
+	next := &deviceTrack{latitude: lat, longitude: lon, timestamp: data.Timestamp}
+
+	if prev == nil {
+		return next, nil
+	}
+	next.overCount, next.alerting = prev.overCount, prev.alerting
+
+	elapsed := data.Timestamp.Sub(prev.timestamp)
+	if elapsed <= 0 {
+		slog.Warn("leitura de gps fora de ordem, velocidade não calculada", "device_id", data.DeviceID)
+		return prev, nil
+	}
+	if elapsed < s.config.MinInterval {
+		return prev, nil
+	}
+
+	distance := geo.Haversine(prev.latitude, prev.longitude, lat, lon)
+	if distance < s.config.MinDistance {
+		// Ruído de GPS com o veículo parado: mantém a âncora para não acumular deslocamentos falsos.
+		stopped := 0.0
+		data.Speed = &stopped
+		anchor := *prev
+		anchor.overCount, anchor.alerting = 0, false
+		return &anchor, nil
+	}
+
+	speed := distance / elapsed.Seconds() * 3.6
+	if s.config.MaxSpeed > 0 && speed > s.config.MaxSpeed {
+		// A leitura do salto não vira referência: a próxima leitura válida é comparada com a âncora anterior.
+		slog.Warn("salto de gps descartado", "device_id", data.DeviceID, "speed", speed)
+		return prev, nil
+	}
+	heading := geo.Bearing(prev.latitude, prev.longitude, lat, lon)
+	data.Speed = &speed
+	data.Heading = &heading
+
+	limit := s.limitFor(data.DeviceID)
+	if limit <= 0 || speed <= limit {
+		next.overCount, next.alerting = 0, false
+		return next, nil
+	}
+
+	next.overCount++
+	if next.alerting || next.overCount < s.config.ConfirmFixes {
+		return next, nil
+	}
+	next.alerting = true
+	return next, &models.OverspeedEvent{
+		DeviceID:  data.DeviceID,
+		Speed:     speed,
+		Limit:     limit,
+		Latitude:  lat,
+		Longitude: lon,
+		Timestamp: data.Timestamp,
+	}
+}
+
+func (s *GPSAnalyzerService) AnalyzeAndSaveGPS(ctx context.Context, data *models.GPSData) (*models.OverspeedEvent, error) {
+	events, err := s.analyzeAndSave(ctx, []*models.GPSData{data}, func(tx storage.Storage) error { return tx.SaveGPS(ctx, data) })
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return events[0], nil
+}
+
+// AnalyzeAndSaveGPSBatch analisa as leituras em ordem, encadeando o estado de cada dispositivo dentro do
+// lote, e grava todas de uma vez. Se qualquer leitura for inválida, nada é gravado.
+func (s *GPSAnalyzerService) AnalyzeAndSaveGPSBatch(ctx context.Context, batch []*models.GPSData) ([]*models.OverspeedEvent, error) {
+	return s.analyzeAndSave(ctx, batch, func(tx storage.Storage) error { return tx.SaveGPSBatch(ctx, batch) })
+}
+
+func gpsAuditEvents(batch []*models.GPSData, events []*models.OverspeedEvent) []models.AuditEvent {
+	audit := make([]models.AuditEvent, 0, len(batch)+len(events))
+	for _, event := range events {
+		audit = append(audit, models.AuditEvent{
+			Actor:  event.DeviceID,
+			Action: "OVERSPEED_DETECTED",
+			Details: map[string]interface{}{
+				"speed": event.Speed,
+				"limit": event.Limit,
+			},
+		})
+	}
+	for _, data := range batch {
+		audit = append(audit, models.AuditEvent{
+			Actor:   data.DeviceID,
+			Action:  "GPS_DATA_PROCESSED",
+			Details: gpsAuditDetails(data),
+		})
+	}
+	return audit
+}
+
+// gpsAuditDetails guarda só o geohash grosso. O audit_log não pode ser alterado sem quebrar a cadeia,
+// nem por um pedido de eliminação do titular, então a posição exata nunca vai para ele.
+func gpsAuditDetails(data *models.GPSData) map[string]interface{} {
+	return map[string]interface{}{"geohash": geo.Geohash(*data.Latitude, *data.Longitude, geo.CoarseGeohashPrecision)}
+}
+
+func deviceStripe(deviceID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return int(h.Sum32() % gpsLockStripes)
+}
+
+// lockDevices trava os dispositivos do lote, sempre em ordem crescente de trava para que dois lotes com
+// dispositivos em comum não se bloqueiem mutuamente, e devolve a função que as libera.
+func (s *GPSAnalyzerService) lockDevices(batch []*models.GPSData) func() {
+	seen := map[int]bool{}
+	var stripes []int
+	for _, data := range batch {
+		if stripe := deviceStripe(data.DeviceID); !seen[stripe] {
+			seen[stripe] = true
+			stripes = append(stripes, stripe)
+		}
+	}
+	sort.Ints(stripes)
+	for _, stripe := range stripes {
+		s.locks[stripe].Lock()
+	}
+	return func() {
+		for _, stripe := range stripes {
+			s.locks[stripe].Unlock()
+		}
+	}
+}
+
+// analyzeAndSave grava as leituras, os eventos de excesso de velocidade e a auditoria numa única
+// transação. O estado dos dispositivos avança antes da transação, para que as travas não fiquem presas
+// durante a gravação, e é desfeito se ela falhar.
+func (s *GPSAnalyzerService) analyzeAndSave(ctx context.Context, batch []*models.GPSData, save func(tx storage.Storage) error) ([]*models.OverspeedEvent, error) {
+	for _, data := range batch {
+		if err := data.Validate(); err != nil {
+			return nil, ierr.NewValidationError("dados de gps inválidos: %w", err)
+		}
+		data.Speed, data.Heading = nil, nil
+	}
+
+	unlock := s.lockDevices(batch)
+	previous := map[string]*deviceTrack{}
+	pending := map[string]*deviceTrack{}
+	var events []*models.OverspeedEvent
+	for _, data := range batch {
+		prev, found := pending[data.DeviceID]
+		if !found {
+			if cached, ok := s.tracks.Get(data.DeviceID); ok {
+				prev = cached.(*deviceTrack)
+			}
+			previous[data.DeviceID] = prev
+		}
+		track, event := s.evaluate(data, prev)
+		pending[data.DeviceID] = track
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	for deviceID, track := range pending {
+		s.tracks.Set(deviceID, track, cache.DefaultExpiration)
+	}
+	unlock()
+
+	err := s.db.WithTx(ctx, func(tx storage.Storage) error {
+		if err := save(tx); err != nil {
+			slog.Error("falha ao salvar dados de gps no banco de dados", "error", err, "count", len(batch))
+			return err
+		}
+		for _, event := range events {
+			if err := tx.SaveOverspeedEvent(ctx, event); err != nil {
+				slog.Error("falha ao salvar evento de excesso de velocidade", "error", err)
+				return err
+			}
+		}
+		if err := tx.LogAuditEvents(ctx, gpsAuditEvents(batch, events)); err != nil {
+			slog.Error("falha ao registrar eventos de auditoria para gps", "error", err, "count", len(batch))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		s.restoreTracks(batch, previous, pending)
+		return nil, err
+	}
+	for _, event := range events {
+		slog.Warn("excesso de velocidade detectado", "device_id", event.DeviceID, "speed", event.Speed, "limit", event.Limit)
+	}
+
+	return events, nil
+}
+
+// restoreTracks devolve os dispositivos ao estado anterior a um lote que não foi gravado. Um dispositivo
+// que outro lote já avançou fica como está; a leitura reenviada chega depois dele e é tratada como fora de
+// ordem.
+func (s *GPSAnalyzerService) restoreTracks(batch []*models.GPSData, previous, pending map[string]*deviceTrack) {
+	unlock := s.lockDevices(batch)
+	defer unlock()
+	for deviceID, track := range pending {
+		current, ok := s.tracks.Get(deviceID)
+		if !ok || current.(*deviceTrack) != track {
+			continue
+		}
+		if prev := previous[deviceID]; prev != nil {
+			s.tracks.Set(deviceID, prev, cache.DefaultExpiration)
+		} else {
+			s.tracks.Delete(deviceID)
+		}
+	}
+}
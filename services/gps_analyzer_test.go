@@ -0,0 +1,275 @@
+package services
+
+import (
+	"challenge-v3/geo"
+	"challenge-v3/ierr"
+	"challenge-v3/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func float64Ptr(f float64) *float64 { return &f }
+
+// gpsFix desloca a leitura para o norte; 0.001 grau de latitude equivale a ~111 metros.
+func gpsFix(deviceID string, base time.Time, seconds int, latOffset float64) models.GPSData {
+	return models.GPSData{
+		DeviceID:  deviceID,
+		Latitude:  float64Ptr(-8.0 + latOffset),
+		Longitude: float64Ptr(-34.0),
+		Timestamp: base.Add(time.Duration(seconds) * time.Second),
+	}
+}
+
+func (m *MockStorage) SaveGPSBatch(ctx context.Context, batch []*models.GPSData) error {
+	return m.Called(batch).Error(0)
+}
+
+// newTestGPSAnalyzer já aceita a auditoria gravada junto com cada leitura; os testes de auditoria
+// verificam o conteúdo pelas chamadas registradas.
+func newTestGPSAnalyzer(limit float64) (*GPSAnalyzerService, *MockStorage) {
+	mockDB := new(MockStorage)
+	mockDB.On("LogAuditEvents", mock.Anything).Return(nil).Maybe()
+	cfg := DefaultSpeedConfig()
+	cfg.DefaultLimit = limit
+	return NewGPSAnalyzerService(mockDB, cfg), mockDB
+}
+
+func TestGPSAnalyzer_ComputesSpeedAndHeading(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(0)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	base := time.Now()
+
+	first := gpsFix("dev-speed", base, 0, 0)
+	_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &first)
+	require.NoError(t, err)
+	assert.Nil(t, first.Speed, "a primeira leitura não tem referência para calcular velocidade")
+
+	second := gpsFix("dev-speed", base, 10, 0.001)
+	_, err = analyzer.AnalyzeAndSaveGPS(context.Background(), &second)
+	require.NoError(t, err)
+	require.NotNil(t, second.Speed)
+	require.NotNil(t, second.Heading)
+	assert.InDelta(t, 40.0, *second.Speed, 0.5)
+	assert.InDelta(t, 0.0, *second.Heading, 0.5)
+}
+
+func TestGPSAnalyzer_OverspeedRequiresConsecutiveFixes(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(80)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	mockDB.On("SaveOverspeedEvent", mock.MatchedBy(func(e *models.OverspeedEvent) bool {
+		return e.DeviceID == "dev-fast" && e.Limit == 80 && e.Speed > 80
+	})).Return(nil).Once()
+	base := time.Now()
+
+	var events []*models.OverspeedEvent
+	// ~111 metros a cada 3 segundos = ~133 km/h
+	for i := 0; i < 5; i++ {
+		fix := gpsFix("dev-fast", base, i*3, float64(i)*0.001)
+		event, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+		require.NoError(t, err)
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+
+	assert.Len(t, events, 1, "um episódio contínuo de excesso deve gerar um único evento")
+	mockDB.AssertExpectations(t)
+}
+
+func TestGPSAnalyzer_JitterDoesNotTriggerOverspeed(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(30)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	base := time.Now()
+
+	// Oscilações de ~5 metros a cada segundo com o veículo parado.
+	for i := 0; i < 6; i++ {
+		fix := gpsFix("dev-parked", base, i, float64(i%2)*0.00005)
+		event, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+		require.NoError(t, err)
+		assert.Nil(t, event)
+		if i > 0 {
+			require.NotNil(t, fix.Speed)
+			assert.Equal(t, 0.0, *fix.Speed)
+		}
+	}
+
+	// Um salto impossível também não deve gerar alerta.
+	jump := gpsFix("dev-parked", base, 7, 0.5)
+	event, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &jump)
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Nil(t, jump.Speed)
+	mockDB.AssertNotCalled(t, "SaveOverspeedEvent", mock.Anything)
+}
+
+func TestGPSAnalyzer_JumpKeepsPreviousAnchor(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(80)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	base := time.Now()
+
+	for _, fix := range []models.GPSData{gpsFix("dev-jump", base, 0, 0), gpsFix("dev-jump", base, 5, 0.5)} {
+		_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+		require.NoError(t, err)
+	}
+
+	// Comparada com o salto seria outro salto; comparada com a âncora, ~111 metros em 10s ≈ 40 km/h.
+	next := gpsFix("dev-jump", base, 10, 0.001)
+	event, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &next)
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	require.NotNil(t, next.Speed)
+	assert.InDelta(t, 40.0, *next.Speed, 0.5)
+}
+
+func TestGPSAnalyzer_DevicesDoNotWaitForEachOthersWrites(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(0)
+	released := make(chan struct{})
+	mockDB.On("SaveGPS", mock.MatchedBy(func(d *models.GPSData) bool { return d.DeviceID == "dev-slow" })).
+		Run(func(mock.Arguments) {
+			select {
+			case <-released:
+			case <-time.After(2 * time.Second):
+			}
+		}).Return(nil)
+	mockDB.On("SaveGPS", mock.MatchedBy(func(d *models.GPSData) bool { return d.DeviceID == "dev-fast" })).
+		Run(func(mock.Arguments) { close(released) }).Return(nil)
+
+	slowDone := make(chan time.Time, 1)
+	go func() {
+		fix := gpsFix("dev-slow", time.Now(), 0, 0)
+		analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+		slowDone <- time.Now()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	fix := gpsFix("dev-fast", time.Now(), 0, 0)
+	_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+	require.NoError(t, err)
+	fastDone := time.Now()
+
+	assert.True(t, (<-slowDone).After(fastDone), "a gravação de um dispositivo não deve segurar a de outro")
+}
+
+func TestGPSAnalyzer_DeviceLimitOverridesDefault(t *testing.T) {
+	limits, err := ParseDeviceLimits("dev-truck=50, dev-car = 120")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"dev-truck": 50, "dev-car": 120}, limits)
+
+	_, err = ParseDeviceLimits("dev-truck")
+	assert.Error(t, err)
+
+	analyzer, _ := newTestGPSAnalyzer(100)
+	analyzer.config.DeviceLimits = limits
+	assert.Equal(t, 50.0, analyzer.limitFor("dev-truck"))
+	assert.Equal(t, 100.0, analyzer.limitFor("dev-other"))
+}
+
+func TestGPSAnalyzer_ValidationFail(t *testing.T) {
+	analyzer, _ := newTestGPSAnalyzer(80)
+	data := models.GPSData{DeviceID: "dev-invalid"}
+
+	_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &data)
+
+	var validationErr *ierr.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+}
+
+func TestGPSAnalyzer_BatchChainsStateWithinBatch(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(80)
+	base := time.Now()
+	// 0.003 grau em 10s ≈ 120 km/h; duas leituras seguidas acima do limite confirmam o evento.
+	f1, f2, f3 := gpsFix("dev-batch", base, 0, 0), gpsFix("dev-batch", base, 10, 0.003), gpsFix("dev-batch", base, 20, 0.006)
+	other := gpsFix("dev-other", base, 5, 0)
+	batch := []*models.GPSData{&f1, &other, &f2, &f3}
+
+	mockDB.On("SaveGPSBatch", batch).Return(nil).Once()
+	mockDB.On("SaveOverspeedEvent", mock.Anything).Return(nil).Once()
+
+	events, err := analyzer.AnalyzeAndSaveGPSBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "dev-batch", events[0].DeviceID)
+	require.NotNil(t, f2.Speed)
+	assert.InDelta(t, 120.0, *f2.Speed, 2)
+	assert.Nil(t, other.Speed)
+	mockDB.AssertNotCalled(t, "SaveGPS", mock.Anything)
+
+	// O estado encadeado foi gravado no cache: a próxima leitura parte de f3.
+	next := gpsFix("dev-batch", base, 30, 0.009)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	_, err = analyzer.AnalyzeAndSaveGPS(context.Background(), &next)
+	require.NoError(t, err)
+	require.NotNil(t, next.Speed)
+}
+
+func TestGPSAnalyzer_BatchFailureKeepsState(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(80)
+	base := time.Now()
+	f1 := gpsFix("dev-retry", base, 0, 0)
+
+	mockDB.On("SaveGPSBatch", mock.Anything).Return(assert.AnError).Once()
+	_, err := analyzer.AnalyzeAndSaveGPSBatch(context.Background(), []*models.GPSData{&f1})
+	require.Error(t, err)
+
+	_, found := analyzer.tracks.Get("dev-retry")
+	assert.False(t, found, "o estado só avança depois que o lote for gravado")
+}
+
+func TestGPSAnalyzer_AuditsReadingsAndOverspeedTogether(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(80)
+	base := time.Now()
+	f1, f2, f3 := gpsFix("dev-audit", base, 0, 0), gpsFix("dev-audit", base, 10, 0.003), gpsFix("dev-audit", base, 20, 0.006)
+	batch := []*models.GPSData{&f1, &f2, &f3}
+	mockDB.On("SaveGPSBatch", batch).Return(nil)
+	mockDB.On("SaveOverspeedEvent", mock.Anything).Return(nil)
+
+	_, err := analyzer.AnalyzeAndSaveGPSBatch(context.Background(), batch)
+	require.NoError(t, err)
+
+	var audit []models.AuditEvent
+	for _, call := range mockDB.Calls {
+		if call.Method == "LogAuditEvents" {
+			audit = call.Arguments.Get(0).([]models.AuditEvent)
+		}
+	}
+	require.Len(t, audit, 4)
+	assert.Equal(t, "OVERSPEED_DETECTED", audit[0].Action)
+	assert.Equal(t, "GPS_DATA_PROCESSED", audit[3].Action)
+}
+
+func TestGPSAnalyzer_AuditHasNoCoordinates(t *testing.T) {
+	analyzer, mockDB := newTestGPSAnalyzer(0)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	fix := gpsFix("dev-redact", time.Now(), 0, 0)
+
+	_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+	require.NoError(t, err)
+
+	var audit []models.AuditEvent
+	for _, call := range mockDB.Calls {
+		if call.Method == "LogAuditEvents" {
+			audit = call.Arguments.Get(0).([]models.AuditEvent)
+		}
+	}
+	require.Len(t, audit, 1)
+	assert.Equal(t, map[string]interface{}{"geohash": geo.Geohash(-8.0, -34.0, geo.CoarseGeohashPrecision)}, audit[0].Details)
+}
+
+func TestGPSAnalyzer_AuditFailureRollsBackState(t *testing.T) {
+	mockDB := new(MockStorage)
+	analyzer := NewGPSAnalyzerService(mockDB, DefaultSpeedConfig())
+	fix := gpsFix("dev-audit-fail", time.Now(), 0, 0)
+	mockDB.On("SaveGPS", mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvents", mock.Anything).Return(assert.AnError)
+
+	_, err := analyzer.AnalyzeAndSaveGPS(context.Background(), &fix)
+
+	require.Error(t, err)
+	_, found := analyzer.tracks.Get("dev-audit-fail")
+	assert.False(t, found)
+}
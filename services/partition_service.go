@@ -0,0 +1,44 @@
+package services
+
+import (
+	"challenge-v3/storage"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PartitionService mantém criadas as partições mensais dos próximos meses, para que as inserções
+// nunca caiam na partição padrão por falta de partição.
+type PartitionService struct {
+	db     storage.Storage
+	tables []string
+	ahead  int
+}
+
+func NewPartitionService(db storage.Storage) *PartitionService {
+	return &PartitionService{db: db, tables: storage.PartitionedTables(), ahead: storage.PartitionsAhead}
+}
+
+func (s *PartitionService) EnsureFuturePartitions(ctx context.Context, now time.Time) error {
+	for _, table := range s.tables {
+		if err := s.db.EnsurePartitions(ctx, table, now, s.ahead); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PartitionService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.EnsureFuturePartitions(ctx, time.Now()); err != nil {
+			slog.Error("falha ao criar partições futuras", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockStorage) EnsurePartitions(ctx context.Context, table string, from time.Time, months int) error {
+	return m.Called(table, from, months).Error(0)
+}
+
+func TestPartitionService_EnsuresEveryTable(t *testing.T) {
+	mockDB := new(MockStorage)
+	now := time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC)
+	for _, table := range []string{"gyroscope", "gps", "photo", "audit_log"} {
+		mockDB.On("EnsurePartitions", table, now, 3).Return(nil).Once()
+	}
+
+	assert.NoError(t, NewPartitionService(mockDB).EnsureFuturePartitions(context.Background(), now))
+	mockDB.AssertExpectations(t)
+}
+
+func TestPartitionService_StopsOnError(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("EnsurePartitions", "gyroscope", mock.Anything, mock.Anything).Return(errors.New("permission denied"))
+
+	assert.Error(t, NewPartitionService(mockDB).EnsureFuturePartitions(context.Background(), time.Now()))
+	mockDB.AssertNumberOfCalls(t, "EnsurePartitions", 1)
+}
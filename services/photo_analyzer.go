@@ -1,16 +1,17 @@
 package services
 
 import (
-	"challenge-v3/crypto"
+	"bytes"
+	"challenge-v3/blob"
 	"challenge-v3/ierr"
 	"challenge-v3/models"
 	"challenge-v3/storage"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -20,29 +21,64 @@ import (
 )
 
 type PhotoAnalyzer interface {
-	AnalyzeAndSavePhoto(data *models.PhotoData) (bool, error)
+	AnalyzeAndSavePhoto(ctx context.Context, data *models.PhotoData) (bool, error)
 }
 type RekognitionClient interface {
 	SearchFacesByImage(ctx context.Context, params *rekognition.SearchFacesByImageInput, optFns ...func(*rekognition.Options)) (*rekognition.SearchFacesByImageOutput, error)
 	IndexFaces(ctx context.Context, params *rekognition.IndexFacesInput, optFns ...func(*rekognition.Options)) (*rekognition.IndexFacesOutput, error)
 }
+
+// faceMatch é o melhor resultado da busca na coleção; é o que fica no cache, por hash da imagem.
+type faceMatch struct {
+	faceID          string
+	externalImageID string
+	similarity      float64
+}
+
 type PhotoAnalyzerService struct {
 	rekognitionClient RekognitionClient
 	collectionID      string
 	cache             *cache.Cache
 	db                storage.Storage
+	blobs             blob.Store
+	// keys sem Provider grava as imagens sem criptografia.
+	keys PhotoKeys
+	// autoIndex indexa na coleção, sem identidade, os rostos não reconhecidos.
+	autoIndex bool
 }
 
-func NewPhotoAnalyzerService(rekClient RekognitionClient, collID string, db storage.Storage) *PhotoAnalyzerService {
+func NewPhotoAnalyzerService(rekClient RekognitionClient, collID string, db storage.Storage, blobs blob.Store, keys PhotoKeys) *PhotoAnalyzerService {
 	return &PhotoAnalyzerService{
 		rekognitionClient: rekClient,
 		collectionID:      collID,
 		cache:             cache.New(5*time.Minute, 10*time.Minute),
 		db:                db,
+		blobs:             blobs,
+		keys:              keys,
+	}
+}
+
+// SetAutoIndex liga a indexação automática dos rostos não reconhecidos. Desligada (o padrão), a coleção só
+// recebe os rostos cadastrados por POST /drivers/{id}/faces.
+func (s *PhotoAnalyzerService) SetAutoIndex(enabled bool) {
+	s.autoIndex = enabled
+}
+
+// ForgetFaces tira do cache as imagens reconhecidas como um dos rostos, para que uma imagem repetida não
+// volte a ser associada a um rosto já apagado da coleção.
+func (s *PhotoAnalyzerService) ForgetFaces(faceIDs []string) {
+	forget := make(map[string]bool, len(faceIDs))
+	for _, id := range faceIDs {
+		forget[id] = true
+	}
+	for key, item := range s.cache.Items() {
+		if match, ok := item.Object.(*faceMatch); ok && forget[match.faceID] {
+			s.cache.Delete(key)
+		}
 	}
 }
 
-func (s *PhotoAnalyzerService) AnalyzeAndSavePhoto(data *models.PhotoData) (bool, error) {
+func (s *PhotoAnalyzerService) AnalyzeAndSavePhoto(ctx context.Context, data *models.PhotoData) (bool, error) {
 	if err := data.Validate(); err != nil {
 		return false, ierr.NewValidationError("dados da foto inválidos: %w", err)
 	}
@@ -57,15 +93,15 @@ func (s *PhotoAnalyzerService) AnalyzeAndSavePhoto(data *models.PhotoData) (bool
 	cacheKey := fmt.Sprintf("%x", sha256.Sum256(imageBytes))
 	slog.Debug("chave de cache gerada para a imagem", "key", cacheKey)
 
-	var recognized bool
+	var match *faceMatch
 
-	if rec, found := s.cache.Get(cacheKey); found {
+	if cached, found := s.cache.Get(cacheKey); found {
 		slog.Info("cache hit para imagem", "key", cacheKey)
-		recognized = rec.(bool)
+		match = cached.(*faceMatch)
 	} else {
 		slog.Info("cache miss para imagem", "key", cacheKey)
 
-		searchResult, searchErr := s.rekognitionClient.SearchFacesByImage(context.TODO(), &rekognition.SearchFacesByImageInput{
+		searchResult, searchErr := s.rekognitionClient.SearchFacesByImage(ctx, &rekognition.SearchFacesByImageInput{
 			CollectionId: aws.String(s.collectionID), Image: &types.Image{Bytes: imageBytes}, MaxFaces: aws.Int32(1), FaceMatchThreshold: aws.Float32(90.0),
 		})
 		if searchErr != nil {
@@ -74,12 +110,16 @@ func (s *PhotoAnalyzerService) AnalyzeAndSavePhoto(data *models.PhotoData) (bool
 		}
 
 		if len(searchResult.FaceMatches) > 0 {
-			recognized = true
-			slog.Info("rosto reconhecido", "similarity", *searchResult.FaceMatches[0].Similarity, "face_id", *searchResult.FaceMatches[0].Face.FaceId)
-		} else {
-			recognized = false
+			best := searchResult.FaceMatches[0]
+			match = &faceMatch{
+				faceID:          aws.ToString(best.Face.FaceId),
+				externalImageID: aws.ToString(best.Face.ExternalImageId),
+				similarity:      float64(aws.ToFloat32(best.Similarity)),
+			}
+			slog.Info("rosto reconhecido", "similarity", match.similarity, "face_id", match.faceID)
+		} else if s.autoIndex {
 			slog.Warn("rosto não reconhecido, tentando indexar", "device_id", data.DeviceID)
-			indexResult, indexErr := s.rekognitionClient.IndexFaces(context.TODO(), &rekognition.IndexFacesInput{
+			indexResult, indexErr := s.rekognitionClient.IndexFaces(ctx, &rekognition.IndexFacesInput{
 				CollectionId: aws.String(s.collectionID), Image: &types.Image{Bytes: imageBytes}, MaxFaces: aws.Int32(1), DetectionAttributes: []types.Attribute{types.AttributeDefault},
 			})
 			if indexErr != nil || len(indexResult.FaceRecords) == 0 {
@@ -87,34 +127,79 @@ func (s *PhotoAnalyzerService) AnalyzeAndSavePhoto(data *models.PhotoData) (bool
 			} else {
 				slog.Info("novo rosto indexado com sucesso", "face_id", *indexResult.FaceRecords[0].Face.FaceId)
 			}
+		} else {
+			slog.Warn("rosto não reconhecido", "device_id", data.DeviceID)
 		}
 
-		if recognized {
-			slog.Info("cache set para imagem", "key", cacheKey, "value", true)
-			s.cache.Set(cacheKey, true, cache.DefaultExpiration)
+		if match != nil {
+			slog.Info("cache set para imagem", "key", cacheKey, "face_id", match.faceID)
+			s.cache.Set(cacheKey, match, cache.DefaultExpiration)
 		}
 	}
 
+	recognized := match != nil
 	data.Recognized = recognized
-
-	encryptionKey := []byte(os.Getenv("ENCRYPTION_KEY"))
-	if len(encryptionKey) == 32 {
-		slog.Info("criptografando dados da foto antes de salvar", "device_id", data.DeviceID)
-
-		originalPhotoB64 := data.Photo
-		encryptedPhotoBytes, err := crypto.Encrypt([]byte(originalPhotoB64), encryptionKey)
-		if err != nil {
-			slog.Error("falha ao criptografar foto", "error", err)
-			return false, fmt.Errorf("erro interno de criptografia")
+	data.DriverID, data.FaceID, data.Similarity = "", "", nil
+	if match != nil {
+		// O motorista é resolvido a cada foto (e não guardado no cache) para que uma associação feita
+		// depois do reconhecimento já valha para as próximas.
+		driverID, err := s.db.ResolveDriver(ctx, match.faceID, match.externalImageID)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			slog.Warn("rosto reconhecido sem motorista cadastrado", "face_id", match.faceID, "device_id", data.DeviceID)
+		case err != nil:
+			slog.Error("falha ao identificar o motorista", "error", err, "face_id", match.faceID)
+			return false, fmt.Errorf("erro ao identificar o motorista: %w", err)
 		}
-		data.Photo = base64.StdEncoding.EncodeToString(encryptedPhotoBytes)
+		similarity := match.similarity
+		data.DriverID, data.FaceID, data.Similarity = driverID, match.faceID, &similarity
 	}
 
-	if err := s.db.SavePhoto(data); err != nil {
-		slog.Error("falha ao salvar foto no banco de dados", "error", err)
+	// A linha é criada primeiro porque o id entra nos dados autenticados da imagem. A foto, a referência ao
+	// objeto e o registro de auditoria são confirmados juntos; sem um, os outros também não ficam.
+	var content models.PhotoContent
+	err = s.db.WithTx(ctx, func(tx storage.Storage) error {
+		photo, err := tx.SavePhoto(ctx, data)
+		if err != nil {
+			slog.Error("falha ao salvar foto no banco de dados", "error", err)
+			return err
+		}
+		// A imagem vai (cifrada) para o armazenamento de blobs; o banco guarda só a referência.
+		stored, err := storePhotoContent(ctx, s.blobs, s.keys, *photo, bytes.NewReader(imageBytes), int64(len(imageBytes)))
+		if err != nil {
+			slog.Error("falha ao armazenar conteúdo da foto", "error", err, "device_id", data.DeviceID)
+			return fmt.Errorf("erro ao armazenar a foto: %w", err)
+		}
+		content = stored
+		if err := tx.SetPhotoContent(ctx, photo.ID, content); err != nil {
+			slog.Error("falha ao salvar referência da foto no banco de dados", "error", err)
+			return err
+		}
+		auditEvent := models.AuditEvent{
+			Actor:   data.DeviceID,
+			Action:  "PHOTO_PROCESSED",
+			Details: map[string]interface{}{"photo_id": photo.ID, "recognized": data.Recognized, "content_key": content.Key, "content_size": content.Size},
+		}
+		if data.Recognized {
+			auditEvent.Details["face_id"] = data.FaceID
+			auditEvent.Details["driver_id"] = data.DriverID
+		}
+		if err := tx.LogAuditEvent(ctx, auditEvent); err != nil {
+			slog.Error("falha ao registrar evento de auditoria para foto", "error", err, "device_id", data.DeviceID)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		// Sem a linha, o objeto ficaria órfão; a mensagem será reenviada e gravará outro.
+		if content.Key != "" {
+			if delErr := s.blobs.Delete(context.WithoutCancel(ctx), content.Key); delErr != nil {
+				slog.Error("falha ao remover conteúdo de foto não confirmada", "error", delErr, "content_key", content.Key)
+			}
+		}
 		return false, err
 	}
 
-	slog.Info("análise e salvamento da foto concluídos", "device_id", data.DeviceID, "recognized", data.Recognized)
+	slog.Info("análise e salvamento da foto concluídos", "device_id", data.DeviceID, "recognized", data.Recognized, "driver_id", data.DriverID)
 	return recognized, nil
 }
@@ -1,17 +1,21 @@
 package services
 
 import (
+	"bytes"
+	"challenge-v3/blob"
 	"challenge-v3/crypto"
 	"challenge-v3/ierr"
 	"challenge-v3/models"
+	"challenge-v3/storage"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"os"
+	"io"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
 	"github.com/joho/godotenv"
@@ -38,15 +42,55 @@ func (m *MockRekognitionClient) IndexFaces(ctx context.Context, params *rekognit
 	return args.Get(0).(*rekognition.IndexFacesOutput), args.Error(1)
 }
 
-type MockStorage struct{ mock.Mock }
+type MockStorage struct {
+	storage.Storage
+	mock.Mock
+}
 
-func (m *MockStorage) SavePhoto(data *models.PhotoData) error         { return m.Called(data).Error(0) }
-func (m *MockStorage) SaveGyroscope(data *models.GyroscopeData) error { return m.Called(data).Error(0) }
-func (m *MockStorage) SaveGPS(data *models.GPSData) error             { return m.Called(data).Error(0) }
-func (m *MockStorage) LogAuditEvent(event models.AuditEvent) error {
+func (m *MockStorage) SavePhoto(ctx context.Context, data *models.PhotoData) (*models.PhotoMetadata, error) {
+	args := m.Called(data)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PhotoMetadata), args.Error(1)
+}
+func (m *MockStorage) ResolveDriver(ctx context.Context, faceID, externalImageID string) (string, error) {
+	args := m.Called(faceID, externalImageID)
+	return args.String(0), args.Error(1)
+}
+func (m *MockStorage) SaveGyroscope(ctx context.Context, data *models.GyroscopeData) error {
+	return m.Called(data).Error(0)
+}
+func (m *MockStorage) SaveGPS(ctx context.Context, data *models.GPSData) error {
+	return m.Called(data).Error(0)
+}
+func (m *MockStorage) SaveOverspeedEvent(ctx context.Context, event *models.OverspeedEvent) error {
+	return m.Called(event).Error(0)
+}
+func (m *MockStorage) LogAuditEvent(ctx context.Context, event models.AuditEvent) error {
 	args := m.Called(event)
 	return args.Error(0)
 }
+func (m *MockStorage) LogAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	return m.Called(events).Error(0)
+}
+
+// WithTx executa a unidade de trabalho sobre o próprio mock; as gravações feitas dentro dela
+// continuam verificáveis pelas expectativas normais.
+func (m *MockStorage) WithTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return fn(m)
+}
+
+func newTestPhotoStore(t *testing.T) *blob.LocalStore {
+	store, err := blob.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	return store
+}
+
+// testPhotoRow é a linha que o mock de SavePhoto devolve para validTestPhoto.
+func testPhotoRow(id int64) *models.PhotoMetadata {
+	return &models.PhotoMetadata{ID: id, DeviceID: "test-device", Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
 
 func validTestPhoto() models.PhotoData {
 	return models.PhotoData{
@@ -60,62 +104,87 @@ func TestPhotoAnalyzer_FaceRecognized(t *testing.T) {
 	if err := godotenv.Load("../.env"); err != nil {
 		t.Log("Aviso: Arquivo .env não encontrado, usando variáveis de ambiente do sistema/CI.")
 	}
-	encryptionKey := []byte(os.Getenv("ENCRYPTION_KEY"))
-	require.Len(t, encryptionKey, 32, "A chave de criptografia deve ter 32 bytes")
+	keys, err := PhotoKeysFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, keys.Provider, "ENCRYPTION_KEY (32 bytes) ou ENCRYPTION_KEYS deve estar configurada")
 
 	mockRek := new(MockRekognitionClient)
 	mockDB := new(MockStorage)
-	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB)
+	photoStore := newTestPhotoStore(t)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, photoStore, keys)
 	testPhoto := validTestPhoto()
 	originalPhotoB64 := testPhoto.Photo
 
-	faceID, similarity := "test-face-id", float32(99.9)
+	faceID, similarity := "test-face-id", float32(99.5)
 	searchOutput := &rekognition.SearchFacesByImageOutput{
-		FaceMatches: []types.FaceMatch{{Face: &types.Face{FaceId: &faceID}, Similarity: &similarity}},
+		FaceMatches: []types.FaceMatch{{Face: &types.Face{FaceId: &faceID, ExternalImageId: aws.String("drv-7")}, Similarity: &similarity}},
 	}
 	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(searchOutput, nil)
+	mockDB.On("ResolveDriver", faceID, "drv-7").Return("drv-7", nil)
+	var saved models.PhotoContent
 	mockDB.On("SavePhoto", mock.MatchedBy(func(p *models.PhotoData) bool {
-		if !p.Recognized {
-			return false
-		}
-		if p.Photo == originalPhotoB64 {
-			return false
-		}
-		encryptedBytes, _ := base64.StdEncoding.DecodeString(p.Photo)
-		decryptedBytes, err := crypto.Decrypt(encryptedBytes, encryptionKey)
-		if err != nil {
-			return false
-		}
-		return string(decryptedBytes) == originalPhotoB64
+		return p.Recognized && p.DriverID == "drv-7" && p.FaceID == faceID && p.Similarity != nil && *p.Similarity == 99.5
+	})).Return(testPhotoRow(7), nil)
+	mockDB.On("SetPhotoContent", int64(7), mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(models.PhotoContent)
+	}).Return(nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "PHOTO_PROCESSED" && e.Details["recognized"] == true && e.Details["photo_id"] == int64(7) &&
+			e.Details["driver_id"] == "drv-7" && e.Details["face_id"] == faceID
 	})).Return(nil)
 
-	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(&testPhoto)
+	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
 
 	assert.NoError(t, err)
 	assert.True(t, recognized)
 	mockRek.AssertExpectations(t)
 	mockDB.AssertExpectations(t)
 
+	assert.Equal(t, models.PhotoEncryptionStream, saved.Encryption)
+	current, err := keys.Provider.CurrentVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, current, saved.KeyVersion)
+	reader, err := photoStore.Get(context.Background(), saved.Key)
+	require.NoError(t, err)
+	defer reader.Close()
+	stored, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, saved.Size, int64(len(stored)))
+	assert.Equal(t, saved.SHA256, fmt.Sprintf("%x", sha256.Sum256(stored)))
+	dataKey, err := keys.Provider.UnwrapKey(context.Background(), saved.WrappedKey)
+	require.NoError(t, err)
+	stream, err := crypto.NewStreamReader(bytes.NewReader(stored), dataKey, photoAAD(*testPhotoRow(7)))
+	require.NoError(t, err)
+	decrypted, err := io.ReadAll(stream)
+	require.NoError(t, err, "o objeto gravado deve ser a imagem cifrada com a chave de dados embrulhada")
+	originalImage, _ := base64.StdEncoding.DecodeString(originalPhotoB64)
+	assert.Equal(t, originalImage, decrypted)
+	_, err = readPhotoContent(context.Background(), photoStore, keys, *testPhotoRow(8), saved)
+	assert.ErrorIs(t, err, ErrPhotoContentUnavailable, "o objeto não abre apontado por outra linha")
+
 	imageBytes, _ := base64.StdEncoding.DecodeString(originalPhotoB64)
 	cacheKey := fmt.Sprintf("%x", sha256.Sum256(imageBytes))
 	cachedResult, found := photoAnalyzer.cache.Get(cacheKey)
-	assert.True(t, found, "O resultado 'true' deveria ter sido salvo no cache")
-	assert.Equal(t, true, cachedResult)
+	assert.True(t, found, "O rosto reconhecido deveria ter sido salvo no cache")
+	assert.Equal(t, &faceMatch{faceID: faceID, externalImageID: "drv-7", similarity: 99.5}, cachedResult)
 }
 
 func TestPhotoAnalyzer_FaceNotRecognized_AndIndexed(t *testing.T) {
 	mockRek := new(MockRekognitionClient)
 	mockDB := new(MockStorage)
-	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
+	photoAnalyzer.SetAutoIndex(true)
 	testPhoto := validTestPhoto()
 
 	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(&rekognition.SearchFacesByImageOutput{}, nil)
 	faceID := "new-face-id"
 	indexOutput := &rekognition.IndexFacesOutput{FaceRecords: []types.FaceRecord{{Face: &types.Face{FaceId: &faceID}}}}
 	mockRek.On("IndexFaces", mock.Anything, mock.Anything).Return(indexOutput, nil)
-	mockDB.On("SavePhoto", mock.Anything).Return(nil)
+	mockDB.On("SavePhoto", mock.Anything).Return(testPhotoRow(1), nil)
+	mockDB.On("SetPhotoContent", int64(1), mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
 
-	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(&testPhoto)
+	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
 
 	assert.NoError(t, err)
 	assert.False(t, recognized)
@@ -128,19 +197,44 @@ func TestPhotoAnalyzer_FaceNotRecognized_AndIndexed(t *testing.T) {
 	assert.False(t, found, "Um resultado 'false' não deveria ser salvo no cache")
 }
 
+func TestPhotoAnalyzer_UnknownFaceIsNotIndexedByDefault(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockDB := new(MockStorage)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
+	testPhoto := validTestPhoto()
+
+	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(&rekognition.SearchFacesByImageOutput{}, nil)
+	mockDB.On("SavePhoto", mock.MatchedBy(func(p *models.PhotoData) bool { return !p.Recognized })).Return(testPhotoRow(1), nil)
+	mockDB.On("SetPhotoContent", int64(1), mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+
+	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
+
+	assert.NoError(t, err)
+	assert.False(t, recognized)
+	mockDB.AssertExpectations(t)
+	mockRek.AssertNotCalled(t, "IndexFaces", mock.Anything, mock.Anything)
+}
+
 func TestPhotoAnalyzer_CacheHit(t *testing.T) {
 	mockRek := new(MockRekognitionClient)
 	mockDB := new(MockStorage)
-	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
 	testPhoto := validTestPhoto()
 
 	imageBytes, _ := base64.StdEncoding.DecodeString(testPhoto.Photo)
 	cacheKey := fmt.Sprintf("%x", sha256.Sum256(imageBytes))
-	photoAnalyzer.cache.Set(cacheKey, true, cache.DefaultExpiration)
+	photoAnalyzer.cache.Set(cacheKey, &faceMatch{faceID: "face-cache", similarity: 97}, cache.DefaultExpiration)
 
-	mockDB.On("SavePhoto", mock.Anything).Return(nil)
+	// O motorista não vem do cache: é resolvido de novo para valer a associação mais recente.
+	mockDB.On("ResolveDriver", "face-cache", "").Return("drv-novo", nil)
+	mockDB.On("SavePhoto", mock.MatchedBy(func(p *models.PhotoData) bool {
+		return p.Recognized && p.DriverID == "drv-novo" && p.FaceID == "face-cache"
+	})).Return(testPhotoRow(1), nil)
+	mockDB.On("SetPhotoContent", int64(1), mock.Anything).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
 
-	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(&testPhoto)
+	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
 
 	assert.NoError(t, err)
 	assert.True(t, recognized)
@@ -149,14 +243,31 @@ func TestPhotoAnalyzer_CacheHit(t *testing.T) {
 	mockRek.AssertNotCalled(t, "IndexFaces", mock.Anything, mock.Anything)
 }
 
+func TestPhotoAnalyzer_DriverLookupFailureIsRetried(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockDB := new(MockStorage)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
+	testPhoto := validTestPhoto()
+
+	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(&rekognition.SearchFacesByImageOutput{
+		FaceMatches: []types.FaceMatch{{Face: &types.Face{FaceId: aws.String("face-1")}, Similarity: aws.Float32(98)}},
+	}, nil)
+	mockDB.On("ResolveDriver", "face-1", "").Return("", fmt.Errorf("banco fora"))
+
+	_, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
+
+	assert.Error(t, err, "a foto não é gravada sem saber se há motorista, para que a mensagem seja reentregue")
+	mockDB.AssertNotCalled(t, "SavePhoto", mock.Anything)
+}
+
 func TestPhotoAnalyzer_ValidationFail(t *testing.T) {
 	mockRek := new(MockRekognitionClient)
 	mockDB := new(MockStorage)
-	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
 
 	testPhoto := models.PhotoData{Photo: "dGVzdA=="}
 
-	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(&testPhoto)
+	recognized, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
 
 	assert.False(t, recognized)
 	assert.Error(t, err)
@@ -164,3 +275,84 @@ func TestPhotoAnalyzer_ValidationFail(t *testing.T) {
 	var validationErr *ierr.ValidationError
 	assert.ErrorAs(t, err, &validationErr, "O erro deveria ser do tipo ValidationError")
 }
+
+func TestPhotoAnalyzer_AuditFailureFailsTheUnitOfWork(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockDB := new(MockStorage)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
+	testPhoto := validTestPhoto()
+
+	faceID, similarity := "face-audit", float32(95)
+	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(&rekognition.SearchFacesByImageOutput{
+		FaceMatches: []types.FaceMatch{{Face: &types.Face{FaceId: &faceID}, Similarity: &similarity}},
+	}, nil)
+	mockDB.On("ResolveDriver", faceID, "").Return("", storage.ErrNotFound)
+	mockDB.On("SavePhoto", mock.Anything).Return(testPhotoRow(1), nil)
+	var content models.PhotoContent
+	mockDB.On("SetPhotoContent", int64(1), mock.Anything).Run(func(args mock.Arguments) {
+		content = args.Get(1).(models.PhotoContent)
+	}).Return(nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(fmt.Errorf("audit_log indisponível"))
+
+	_, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
+
+	assert.Error(t, err, "sem o registro de auditoria a foto não pode ser confirmada")
+	_, err = photoAnalyzer.blobs.Get(context.Background(), content.Key)
+	assert.ErrorIs(t, err, blob.ErrNotFound, "o objeto da foto não confirmada é removido")
+}
+
+func TestPhotoAnalyzer_StrictModeRefusesPlaintext(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockDB := new(MockStorage)
+	photoStore := newTestPhotoStore(t)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, photoStore, PhotoKeys{Strict: true})
+	testPhoto := validTestPhoto()
+	mockRek.On("SearchFacesByImage", mock.Anything, mock.Anything).Return(&rekognition.SearchFacesByImageOutput{}, nil)
+	mockRek.On("IndexFaces", mock.Anything, mock.Anything).Return(&rekognition.IndexFacesOutput{}, nil)
+	mockDB.On("SavePhoto", mock.Anything).Return(testPhotoRow(1), nil)
+
+	_, err := photoAnalyzer.AnalyzeAndSavePhoto(context.Background(), &testPhoto)
+
+	assert.ErrorIs(t, err, ErrEncryptionRequired)
+	mockDB.AssertNotCalled(t, "SetPhotoContent", mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "LogAuditEvent", mock.Anything)
+}
+
+func TestPhotoKeysFromEnv_StrictByDefault(t *testing.T) {
+	t.Setenv("KEY_PROVIDER", "")
+	t.Setenv("ENCRYPTION_KEYS", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("PHOTO_ENCRYPTION_STRICT", "")
+	_, err := PhotoKeysFromEnv()
+	assert.ErrorIs(t, err, ErrEncryptionRequired, "sem chave o processo não sobe")
+
+	t.Setenv("ENCRYPTION_KEY", "curta-demais")
+	_, err = PhotoKeysFromEnv()
+	assert.Error(t, err, "chave com tamanho errado não vira gravação em claro")
+
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("PHOTO_ENCRYPTION_STRICT", "false")
+	keys, err := PhotoKeysFromEnv()
+	require.NoError(t, err)
+	assert.False(t, keys.Strict)
+	assert.Nil(t, keys.Provider)
+}
+
+func TestPhotoAnalyzer_PropagatesDeadlineToRekognition(t *testing.T) {
+	mockRek := new(MockRekognitionClient)
+	mockDB := new(MockStorage)
+	photoAnalyzer := NewPhotoAnalyzerService(mockRek, "test-collection", mockDB, newTestPhotoStore(t), PhotoKeys{})
+	testPhoto := validTestPhoto()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mockRek.On("SearchFacesByImage", mock.MatchedBy(func(c context.Context) bool {
+		return c.Err() == context.Canceled
+	}), mock.Anything).Return(nil, context.Canceled)
+
+	_, err := photoAnalyzer.AnalyzeAndSavePhoto(ctx, &testPhoto)
+
+	assert.Error(t, err)
+	mockRek.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "SavePhoto", mock.Anything)
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrPhotoContentUnavailable indica uma linha de foto cuja imagem não existe mais ou não pode ser lida
+// (objeto apagado pela retenção, hash divergente, chave de criptografia ausente).
+var ErrPhotoContentUnavailable = errors.New("imagem da foto indisponível")
+
+// ErrEncryptionRequired é retornado no modo estrito quando não há chave para cifrar a imagem: a foto é
+// recusada em vez de gravada em claro.
+var ErrEncryptionRequired = errors.New("criptografia obrigatória: nenhuma chave configurada para cifrar a foto")
+
+// PhotoKeys reúne o provedor das chaves mestras, que embrulha a chave de dados de cada foto, e o chaveiro
+// local que ainda abre os formatos anteriores (envelope e aes-256-gcm sem versão). Sem Provider as imagens
+// são gravadas sem criptografia, a menos que Strict esteja ligado; Legacy pode ser nil quando não há fotos
+// nesses formatos.
+type PhotoKeys struct {
+	Provider crypto.KeyProvider
+	Legacy   *crypto.Keyring
+	// Strict recusa gravar imagens em claro.
+	Strict bool
+}
+
+// PhotoKeysFromEnv monta o provedor de KEY_PROVIDER e o chaveiro de ENCRYPTION_KEYS/ENCRYPTION_KEY. O modo
+// estrito (PHOTO_ENCRYPTION_STRICT) vem ligado: sem chave configurada o processo não sobe. Desligue só em
+// desenvolvimento.
+func PhotoKeysFromEnv() (PhotoKeys, error) {
+	strict := true
+	if raw := os.Getenv("PHOTO_ENCRYPTION_STRICT"); raw != "" {
+		var err error
+		if strict, err = strconv.ParseBool(raw); err != nil {
+			return PhotoKeys{}, fmt.Errorf("PHOTO_ENCRYPTION_STRICT inválido: %w", err)
+		}
+	}
+	provider, err := crypto.KeyProviderFromEnv()
+	if err != nil {
+		return PhotoKeys{}, err
+	}
+	legacy, err := crypto.KeyringFromEnv()
+	if err != nil {
+		return PhotoKeys{}, err
+	}
+	if strict && provider == nil {
+		return PhotoKeys{}, fmt.Errorf("%w; configure ENCRYPTION_KEY, ENCRYPTION_KEYS ou KEY_PROVIDER, ou defina PHOTO_ENCRYPTION_STRICT=false", ErrEncryptionRequired)
+	}
+	return PhotoKeys{Provider: provider, Legacy: legacy, Strict: strict}, nil
+}
+
+// unwrapKey usa o provedor e, para chaves embrulhadas localmente antes de uma troca de provedor, o chaveiro.
+func (k PhotoKeys) unwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if k.Legacy != nil {
+		if _, err := crypto.EnvelopeKeyVersion(wrapped); err == nil {
+			return k.Legacy.Open(wrapped)
+		}
+	}
+	if k.Provider == nil {
+		return nil, errors.New("nenhum provedor de chaves configurado")
+	}
+	return k.Provider.UnwrapKey(ctx, wrapped)
+}
+
+// photoAAD são os dados autenticados da imagem: a identidade da linha como está no banco. O JSON evita
+// ambiguidade entre os campos, já que device_id é texto livre.
+func photoAAD(photo models.PhotoMetadata) []byte {
+	aad, _ := json.Marshal([]any{"photo", photo.ID, photo.DeviceID, photo.Timestamp.UTC().Format(time.RFC3339Nano)})
+	return aad
+}
+
+// photoContentKey monta a chave do objeto: photos/<dispositivo>/<AAAA>/<MM>/<DD>/<aleatório>. O sufixo
+// aleatório evita colisão entre fotos do mesmo instante e não revela nada sobre o conteúdo.
+func photoContentKey(deviceID string, timestamp time.Time) (string, error) {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("photos/%s/%s/%s", url.PathEscape(deviceID), timestamp.UTC().Format("2006/01/02"), hex.EncodeToString(suffix)), nil
+}
+
+// storePhotoContent cifra a imagem com uma chave de dados nova, embrulhada pelo provedor (quando há um)
+// e amarrada à linha photo, e grava o resultado em blobs. A imagem passa em blocos, de image direto para o
+// armazenamento, sem uma cópia cifrada inteira em memória; size é o tamanho de image em bytes. A linha já
+// precisa existir, com id.
+func storePhotoContent(ctx context.Context, blobs blob.Store, keys PhotoKeys, photo models.PhotoMetadata, image io.Reader, size int64) (models.PhotoContent, error) {
+	content := models.PhotoContent{Encryption: models.PhotoEncryptionNone, Size: size}
+	if keys.Provider == nil && keys.Strict {
+		return content, ErrEncryptionRequired
+	}
+	stored := image
+	if keys.Provider != nil {
+		dataKey, err := crypto.NewDataKey()
+		if err != nil {
+			return content, err
+		}
+		wrapped, version, err := keys.Provider.WrapKey(ctx, dataKey)
+		if err != nil {
+			return content, fmt.Errorf("falha ao embrulhar a chave de dados: %w", err)
+		}
+		content.Encryption = models.PhotoEncryptionStream
+		content.KeyVersion = version
+		content.WrappedKey = wrapped
+		content.Size = crypto.StreamCiphertextSize(size)
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() { pw.CloseWithError(sealPhotoStream(pw, image, dataKey, photoAAD(photo))) }()
+		stored = pr
+	}
+
+	key, err := photoContentKey(photo.DeviceID, photo.Timestamp)
+	if err != nil {
+		return content, err
+	}
+	content.Key = key
+
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(stored, hash)}
+	if err := blobs.Put(ctx, key, counted, content.Size); err != nil {
+		return content, err
+	}
+	if counted.n != content.Size {
+		if err := blobs.Delete(context.WithoutCancel(ctx), key); err != nil {
+			slog.Error("falha ao remover objeto de foto com tamanho divergente", "error", err, "content_key", key)
+		}
+		return content, fmt.Errorf("imagem com %d bytes gravados, esperados %d", counted.n, content.Size)
+	}
+	content.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return content, nil
+}
+
+func sealPhotoStream(dst io.Writer, image io.Reader, dataKey, aad []byte) error {
+	w, err := crypto.NewStreamWriter(dst, dataKey, aad)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, image); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readPhotoContent lê a imagem inteira de openPhotoContent.
+func readPhotoContent(ctx context.Context, blobs blob.Store, keys PhotoKeys, photo models.PhotoMetadata, content models.PhotoContent) ([]byte, error) {
+	image, err := openPhotoContent(ctx, blobs, keys, photo, content)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+	return io.ReadAll(image)
+}
+
+// openPhotoContent abre o objeto, confere o tamanho e o SHA-256 registrados no banco e devolve a imagem
+// decifrada. photo é a linha que aponta para content; nos formatos com dados autenticados, um objeto
+// trocado entre linhas não decifra. No formato em blocos a imagem é decifrada enquanto é lida: cada bloco
+// é autenticado antes de ser entregue, e um objeto cortado, adulterado ou com hash divergente termina a
+// leitura com ErrPhotoContentUnavailable em vez de io.EOF. Os demais formatos são lidos e conferidos
+// inteiros antes de retornar.
+func openPhotoContent(ctx context.Context, blobs blob.Store, keys PhotoKeys, photo models.PhotoMetadata, content models.PhotoContent) (io.ReadCloser, error) {
+	reader, err := blobs.Get(ctx, content.Key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, fmt.Errorf("%w: objeto %s não existe", ErrPhotoContentUnavailable, content.Key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	verified := &verifiedReader{r: io.LimitReader(reader, content.Size+1), hash: sha256.New(), content: content}
+
+	if content.Encryption == models.PhotoEncryptionStream {
+		dataKey, err := keys.unwrapDataKey(ctx, content)
+		if err == nil {
+			var stream *crypto.StreamReader
+			if stream, err = crypto.NewStreamReader(verified, dataKey, photoAAD(photo)); err == nil {
+				return readCloser{&unavailableReader{stream}, reader}, nil
+			}
+			err = unavailable(err)
+		}
+		reader.Close()
+		return nil, err
+	}
+
+	defer reader.Close()
+	stored, err := io.ReadAll(verified)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	image, err := keys.decrypt(ctx, photo, content, stored)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(image)), nil
+}
+
+// decrypt abre os formatos gravados de uma vez só.
+func (k PhotoKeys) decrypt(ctx context.Context, photo models.PhotoMetadata, content models.PhotoContent, stored []byte) ([]byte, error) {
+	var image []byte
+	var err error
+	switch content.Encryption {
+	case models.PhotoEncryptionNone:
+		return stored, nil
+	case models.PhotoEncryptionDataKey, models.PhotoEncryptionDataKeyAAD:
+		var dataKey []byte
+		if dataKey, err = k.unwrapDataKey(ctx, content); err != nil {
+			return nil, err
+		}
+		var aad []byte
+		if content.Encryption == models.PhotoEncryptionDataKeyAAD {
+			aad = photoAAD(photo)
+		}
+		image, err = crypto.DecryptWithAAD(stored, dataKey, aad)
+	case models.PhotoEncryptionAES256GCM, models.PhotoEncryptionEnvelope:
+		if k.Legacy == nil {
+			return nil, fmt.Errorf("%w: nenhuma chave em ENCRYPTION_KEYS para o formato %s", ErrPhotoContentUnavailable, content.Encryption)
+		}
+		if content.Encryption == models.PhotoEncryptionEnvelope {
+			image, err = k.Legacy.Open(stored)
+		} else {
+			image, err = k.Legacy.OpenLegacy(stored)
+		}
+	default:
+		err = fmt.Errorf("criptografia desconhecida %q", content.Encryption)
+	}
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	return image, nil
+}
+
+// unwrapDataKey recupera a chave de dados da linha. Falhas do provedor (ex.: Vault fora do ar) são
+// transitórias e não tornam a foto indisponível; chave desconhecida ou embrulho inválido, sim.
+func (k PhotoKeys) unwrapDataKey(ctx context.Context, content models.PhotoContent) ([]byte, error) {
+	dataKey, err := k.unwrapKey(ctx, content.WrappedKey)
+	if errors.Is(err, crypto.ErrUnknownKey) || errors.Is(err, crypto.ErrInvalidEnvelope) {
+		return nil, unavailable(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("falha ao desembrulhar a chave de dados: %w", err)
+	}
+	return dataKey, nil
+}
+
+func unavailable(err error) error {
+	if errors.Is(err, ErrPhotoContentUnavailable) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrPhotoContentUnavailable, err)
+}
+
+// verifiedReader confere tamanho e SHA-256 do objeto ao chegar ao fim dele.
+type verifiedReader struct {
+	r       io.Reader
+	hash    hash.Hash
+	n       int64
+	content models.PhotoContent
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	v.n += int64(n)
+	if err == io.EOF && (v.n != v.content.Size || hex.EncodeToString(v.hash.Sum(nil)) != v.content.SHA256) {
+		return n, fmt.Errorf("%w: conteúdo de %s não confere com o registrado", ErrPhotoContentUnavailable, v.content.Key)
+	}
+	return n, err
+}
+
+// unavailableReader marca os erros de decifragem no meio da leitura como ErrPhotoContentUnavailable.
+type unavailableReader struct {
+	r io.Reader
+}
+
+func (u *unavailableReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = unavailable(err)
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStreamKeys(t *testing.T) PhotoKeys {
+	keyring, err := crypto.NewKeyring(map[uint32][]byte{1: []byte("este-e-um-segredo-de-32-bytes!!*")})
+	require.NoError(t, err)
+	return PhotoKeys{Provider: crypto.NewLocalKeyProvider(keyring), Strict: true}
+}
+
+func TestPhotoContent_StreamsAcrossChunks(t *testing.T) {
+	keys := testStreamKeys(t)
+	photoStore := newTestPhotoStore(t)
+	image := make([]byte, 3*crypto.StreamChunkSize+123)
+	_, err := rand.Read(image)
+	require.NoError(t, err)
+
+	content, err := storePhotoContent(context.Background(), photoStore, keys, *testPhotoRow(1), bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+	assert.Equal(t, models.PhotoEncryptionStream, content.Encryption)
+	assert.Equal(t, crypto.StreamCiphertextSize(int64(len(image))), content.Size)
+
+	opened, err := readPhotoContent(context.Background(), photoStore, keys, *testPhotoRow(1), content)
+	require.NoError(t, err)
+	assert.Equal(t, image, opened)
+
+	_, err = readPhotoContent(context.Background(), photoStore, keys, *testPhotoRow(2), content)
+	assert.ErrorIs(t, err, ErrPhotoContentUnavailable, "o objeto não abre apontado por outra linha")
+}
+
+func TestPhotoContent_TruncatedObjectFailsMidStream(t *testing.T) {
+	keys := testStreamKeys(t)
+	photoStore := newTestPhotoStore(t)
+	image := bytes.Repeat([]byte("imagem"), crypto.StreamChunkSize)
+	content, err := storePhotoContent(context.Background(), photoStore, keys, *testPhotoRow(1), bytes.NewReader(image), int64(len(image)))
+	require.NoError(t, err)
+
+	// Objeto cortado numa fronteira de bloco, com tamanho e hash do banco ajustados a ele: só o
+	// formato em blocos percebe que falta o fim.
+	reader, err := photoStore.Get(context.Background(), content.Key)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	truncated := stored[:content.Size-(crypto.StreamCiphertextSize(int64(len(image)))-crypto.StreamCiphertextSize(2*crypto.StreamChunkSize))]
+	sum := sha256.Sum256(truncated)
+	cut := putTestContent(t, photoStore, "photos/cortada", truncated, content)
+	require.Equal(t, hex.EncodeToString(sum[:]), cut.SHA256)
+
+	opened, err := openPhotoContent(context.Background(), photoStore, keys, *testPhotoRow(1), cut)
+	require.NoError(t, err, "o cabeçalho e os primeiros blocos estão íntegros")
+	defer opened.Close()
+	_, err = io.ReadAll(opened)
+	assert.ErrorIs(t, err, ErrPhotoContentUnavailable)
+	assert.ErrorIs(t, err, crypto.ErrStreamTruncated)
+}
+
+func TestPhotoContent_StreamingReaderFailureLeavesNoObject(t *testing.T) {
+	keys := testStreamKeys(t)
+	photoStore := newTestPhotoStore(t)
+
+	// O leitor entrega menos bytes do que o tamanho declarado.
+	_, err := storePhotoContent(context.Background(), photoStore, keys, *testPhotoRow(1), bytes.NewReader([]byte("curta")), 100)
+	assert.Error(t, err)
+	var objects []string
+	require.NoError(t, filepath.WalkDir(photoStore.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			objects = append(objects, path)
+		}
+		return err
+	}))
+	assert.Empty(t, objects, "o objeto com tamanho divergente é apagado")
+}
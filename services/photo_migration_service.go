@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const photoMigrationBatchSize = 100
+
+// PhotoMigrationService move as fotos gravadas antes do armazenamento de blobs, com a imagem em base64
+// na coluna photo, para o blob store no mesmo formato das fotos novas.
+type PhotoMigrationService struct {
+	db    storage.Storage
+	blobs blob.Store
+	keys  PhotoKeys
+}
+
+func NewPhotoMigrationService(db storage.Storage, blobs blob.Store, keys PhotoKeys) *PhotoMigrationService {
+	return &PhotoMigrationService{db: db, blobs: blobs, keys: keys}
+}
+
+var errUnreadableLegacyPhoto = errors.New("conteúdo não pôde ser decifrado nem reconhecido como imagem")
+
+// legacyPhotoImage recupera a imagem de uma linha antiga. Com ENCRYPTION_KEY definida o worker gravava
+// base64(Encrypt(base64 da imagem)); sem ela, o próprio base64 recebido. Como a linha não diz qual foi o
+// caso, o conteúdo que não decifra com nenhuma das chaves só é aceito se parecer uma imagem; o resto
+// fica onde está.
+func legacyPhotoImage(photo string, keys *crypto.Keyring) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		if plaintext, err := keys.OpenLegacy(raw); err == nil {
+			return base64.StdEncoding.DecodeString(string(plaintext))
+		}
+	}
+	if !strings.HasPrefix(http.DetectContentType(raw), "image/") {
+		return nil, errUnreadableLegacyPhoto
+	}
+	return raw, nil
+}
+
+// Run migra todas as linhas pendentes e retorna quantas foram movidas e quantas ficaram para trás por
+// terem conteúdo ilegível. Falhas do blob store ou do banco interrompem a execução; como cada linha é
+// confirmada individualmente, a próxima execução continua de onde parou.
+func (s *PhotoMigrationService) Run(ctx context.Context) (int, int, error) {
+	migrated, skipped := 0, 0
+	var afterID int64
+	for {
+		photos, err := s.db.ListLegacyPhotos(ctx, afterID, photoMigrationBatchSize)
+		if err != nil {
+			return migrated, skipped, err
+		}
+		for _, photo := range photos {
+			afterID = photo.ID
+			image, err := legacyPhotoImage(photo.Photo, s.keys.Legacy)
+			if err != nil {
+				slog.Warn("foto antiga não migrada", "error", err, "photo_id", photo.ID, "device_id", photo.DeviceID)
+				skipped++
+				continue
+			}
+			content, err := storePhotoContent(ctx, s.blobs, s.keys,
+				models.PhotoMetadata{ID: photo.ID, DeviceID: photo.DeviceID, Timestamp: photo.Timestamp}, bytes.NewReader(image), int64(len(image)))
+			if err != nil {
+				return migrated, skipped, err
+			}
+			if err := s.db.SetPhotoContent(ctx, photo.ID, content); err != nil {
+				if delErr := s.blobs.Delete(context.WithoutCancel(ctx), content.Key); delErr != nil {
+					slog.Error("falha ao remover conteúdo de foto não migrada", "error", delErr, "content_key", content.Key)
+				}
+				return migrated, skipped, err
+			}
+			migrated++
+		}
+		if len(photos) < photoMigrationBatchSize {
+			return migrated, skipped, nil
+		}
+	}
+}
+
+// Start executa a migração uma vez e registra o resultado na auditoria quando havia algo a migrar.
+func (s *PhotoMigrationService) Start(ctx context.Context) {
+	migrated, skipped, err := s.Run(ctx)
+	if migrated == 0 && skipped == 0 && err == nil {
+		return
+	}
+	details := map[string]interface{}{"migrated": migrated, "skipped": skipped}
+	action := "PHOTO_CONTENT_MIGRATED"
+	if err != nil {
+		slog.Error("falha ao migrar fotos para o armazenamento de blobs", "error", err, "migrated", migrated)
+		action = "PHOTO_CONTENT_MIGRATION_FAILED"
+		details["error"] = err.Error()
+	} else {
+		slog.Info("fotos antigas migradas para o armazenamento de blobs", "migrated", migrated, "skipped", skipped)
+	}
+	if err := s.db.LogAuditEvent(ctx, models.AuditEvent{Actor: "photo-migration", Action: action, Details: details}); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para migração de fotos", "error", err)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) ListLegacyPhotos(ctx context.Context, afterID int64, limit int) ([]models.LegacyPhoto, error) {
+	args := m.Called(afterID, limit)
+	return args.Get(0).([]models.LegacyPhoto), args.Error(1)
+}
+
+func (m *MockStorage) SetPhotoContent(ctx context.Context, id int64, content models.PhotoContent) error {
+	return m.Called(id, content).Error(0)
+}
+
+// testPNG é o começo de um PNG, suficiente para ser reconhecido como imagem.
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestPhotoMigration_MovesLegacyRows(t *testing.T) {
+	oldKey := []byte("este-e-um-segredo-de-32-bytes!!*")
+	keys, err := crypto.NewKeyring(map[uint32][]byte{1: oldKey, 2: []byte("outro-segredo-de-exatos-32-bytes")})
+	require.NoError(t, err)
+	encrypted, err := crypto.Encrypt([]byte(base64.StdEncoding.EncodeToString(testPNG)), oldKey)
+	require.NoError(t, err)
+
+	mockDB := new(MockStorage)
+	photoStore := newTestPhotoStore(t)
+	photoKeys := PhotoKeys{Provider: crypto.NewLocalKeyProvider(keys), Legacy: keys}
+	service := NewPhotoMigrationService(mockDB, photoStore, photoKeys)
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockDB.On("ListLegacyPhotos", int64(0), photoMigrationBatchSize).Return([]models.LegacyPhoto{
+		{ID: 1, DeviceID: "dev", Timestamp: ts, Photo: base64.StdEncoding.EncodeToString(encrypted)},
+		{ID: 2, DeviceID: "dev", Timestamp: ts, Photo: base64.StdEncoding.EncodeToString(testPNG)},
+		{ID: 3, DeviceID: "dev", Timestamp: ts, Photo: base64.StdEncoding.EncodeToString([]byte("cifrado com outra chave"))},
+	}, nil)
+	contents := map[int64]models.PhotoContent{}
+	mockDB.On("SetPhotoContent", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		contents[args.Get(0).(int64)] = args.Get(1).(models.PhotoContent)
+	}).Return(nil)
+
+	migrated, skipped, err := service.Run(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+	assert.Equal(t, 1, skipped, "conteúdo que não decifra nem parece imagem fica na coluna antiga")
+	mockDB.AssertNotCalled(t, "SetPhotoContent", int64(3), mock.Anything)
+	require.Len(t, contents, 2)
+	for id, content := range contents {
+		assert.Equal(t, models.PhotoEncryptionStream, content.Encryption)
+		assert.Equal(t, uint32(2), content.KeyVersion, "a migração já grava com a chave mais nova")
+		image, err := readPhotoContent(context.Background(), photoStore, photoKeys,
+			models.PhotoMetadata{ID: id, DeviceID: "dev", Timestamp: ts}, content)
+		require.NoError(t, err)
+		assert.Equal(t, testPNG, image)
+	}
+}
+
+func TestPhotoMigration_DatabaseFailureRemovesContent(t *testing.T) {
+	mockDB := new(MockStorage)
+	photoStore := newTestPhotoStore(t)
+	service := NewPhotoMigrationService(mockDB, photoStore, PhotoKeys{})
+	mockDB.On("ListLegacyPhotos", int64(0), photoMigrationBatchSize).Return([]models.LegacyPhoto{
+		{ID: 7, DeviceID: "dev", Timestamp: time.Now(), Photo: base64.StdEncoding.EncodeToString(testPNG)},
+	}, nil)
+	var content models.PhotoContent
+	mockDB.On("SetPhotoContent", int64(7), mock.Anything).Run(func(args mock.Arguments) {
+		content = args.Get(1).(models.PhotoContent)
+	}).Return(errors.New("conexão perdida"))
+
+	migrated, _, err := service.Run(context.Background())
+
+	assert.Error(t, err)
+	assert.Zero(t, migrated)
+	assert.Equal(t, models.PhotoEncryptionNone, content.Encryption)
+	_, err = photoStore.Get(context.Background(), content.Key)
+	assert.Error(t, err, "o objeto de uma linha não atualizada não pode ficar órfão")
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/metrics"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const photoReencryptionBatchSize = 100
+
+// PhotoReencryptionService leva as fotos para a versão atual da chave mestra. Nas que já têm chave de
+// dados amarrada à linha (inteira ou em blocos), só a chave embrulhada é refeita. As dos formatos anteriores (chave de dados sem
+// dados autenticados, envelope, aes-256-gcm sem versão ou sem criptografia) ganham um objeto novo; a linha só passa a apontar para ele depois de gravado, e o
+// objeto antigo é apagado por último. Como o progresso fica na própria linha (encryption e key_version),
+// uma execução interrompida continua de onde parou.
+type PhotoReencryptionService struct {
+	db    storage.Storage
+	blobs blob.Store
+	keys  PhotoKeys
+}
+
+func NewPhotoReencryptionService(db storage.Storage, blobs blob.Store, keys PhotoKeys) *PhotoReencryptionService {
+	return &PhotoReencryptionService{db: db, blobs: blobs, keys: keys}
+}
+
+// Run processa todas as linhas abaixo de current e retorna quantas foram atualizadas e quantas ficaram
+// para trás por terem o objeto ilegível (apagado, corrompido ou cifrado com uma chave que já foi retirada).
+func (s *PhotoReencryptionService) Run(ctx context.Context, current uint32) (int, int, error) {
+	pending, err := s.db.CountPhotosBelowKeyVersion(ctx, current)
+	if err != nil {
+		return 0, 0, err
+	}
+	metrics.PhotoReencryptionPending.Set(float64(pending))
+	if pending == 0 {
+		return 0, 0, nil
+	}
+	slog.Info("iniciando re-cifragem de fotos", "key_version", current, "pending", pending)
+
+	done, failed := 0, 0
+	var afterID int64
+	for {
+		photos, err := s.db.ListPhotosBelowKeyVersion(ctx, current, afterID, photoReencryptionBatchSize)
+		if err != nil {
+			return done, failed, err
+		}
+		for _, photo := range photos {
+			afterID = photo.ID
+			err := s.reencrypt(ctx, photo)
+			if errors.Is(err, ErrPhotoContentUnavailable) {
+				slog.Warn("foto não re-cifrada", "error", err, "photo_id", photo.ID)
+				failed++
+				continue
+			}
+			if err != nil {
+				return done, failed, err
+			}
+			done++
+			metrics.PhotoReencryptionPending.Dec()
+		}
+		slog.Info("re-cifragem de fotos em andamento", "key_version", current, "done", done, "failed", failed, "pending", pending)
+		if len(photos) < photoReencryptionBatchSize {
+			return done, failed, nil
+		}
+	}
+}
+
+func (s *PhotoReencryptionService) reencrypt(ctx context.Context, photo models.StoredPhoto) error {
+	if photo.Encryption == models.PhotoEncryptionDataKeyAAD || photo.Encryption == models.PhotoEncryptionStream {
+		return s.rewrap(ctx, photo)
+	}
+	image, err := readPhotoContent(ctx, s.blobs, s.keys, photo.PhotoMetadata, photo.PhotoContent)
+	if err != nil {
+		return err
+	}
+	content, err := storePhotoContent(ctx, s.blobs, s.keys, photo.PhotoMetadata, bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		return err
+	}
+	err = s.db.ReplacePhotoContent(ctx, photo.ID, photo.Key, content)
+	stale := photo.Key
+	if err != nil {
+		// A linha mudou ou sumiu desde a listagem (retenção, outra réplica): o objeto novo é que sobra.
+		stale = content.Key
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.deleteBlob(context.WithoutCancel(ctx), stale)
+			return err
+		}
+	}
+	s.deleteBlob(ctx, stale)
+	return nil
+}
+
+// rewrap embrulha de novo a chave de dados com a versão atual; o objeto não muda.
+func (s *PhotoReencryptionService) rewrap(ctx context.Context, photo models.StoredPhoto) error {
+	dataKey, err := s.keys.unwrapKey(ctx, photo.WrappedKey)
+	if errors.Is(err, crypto.ErrUnknownKey) || errors.Is(err, crypto.ErrInvalidEnvelope) {
+		return fmt.Errorf("%w: %v", ErrPhotoContentUnavailable, err)
+	}
+	if err != nil {
+		return err
+	}
+	content := photo.PhotoContent
+	if content.WrappedKey, content.KeyVersion, err = s.keys.Provider.WrapKey(ctx, dataKey); err != nil {
+		return err
+	}
+	err = s.db.ReplacePhotoContent(ctx, photo.ID, photo.Key, content)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *PhotoReencryptionService) deleteBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		slog.Error("falha ao remover objeto de foto substituído", "error", err, "content_key", key)
+	}
+}
+
+// Start re-cifra as pendências a cada intervalo e registra na auditoria as execuções que fizeram algo.
+func (s *PhotoReencryptionService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.runAndAudit(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PhotoReencryptionService) runAndAudit(ctx context.Context) {
+	current, err := s.keys.Provider.CurrentVersion(ctx)
+	if err != nil {
+		slog.Error("falha ao consultar a versão atual da chave mestra", "error", err)
+		return
+	}
+	done, failed, err := s.Run(ctx, current)
+	if done == 0 && failed == 0 && err == nil {
+		return
+	}
+	details := map[string]interface{}{"key_version": current, "reencrypted": done, "failed": failed}
+	action := "PHOTO_REENCRYPTED"
+	if err != nil {
+		slog.Error("falha ao re-cifrar fotos", "error", err, "done", done)
+		action = "PHOTO_REENCRYPTION_FAILED"
+		details["error"] = err.Error()
+	} else {
+		slog.Info("re-cifragem de fotos concluída", "key_version", current, "done", done, "failed", failed)
+	}
+	if err := s.db.LogAuditEvent(ctx, models.AuditEvent{Actor: "photo-reencryption", Action: action, Details: details}); err != nil {
+		slog.Error("falha ao registrar evento de auditoria para re-cifragem de fotos", "error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) ListPhotosBelowKeyVersion(ctx context.Context, version uint32, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	args := m.Called(version, afterID, limit)
+	return args.Get(0).([]models.StoredPhoto), args.Error(1)
+}
+
+func (m *MockStorage) CountPhotosBelowKeyVersion(ctx context.Context, version uint32) (int64, error) {
+	args := m.Called(version)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) ReplacePhotoContent(ctx context.Context, id int64, oldKey string, content models.PhotoContent) error {
+	return m.Called(id, oldKey, content).Error(0)
+}
+
+func putTestContent(t *testing.T, store blob.Store, key string, stored []byte, content models.PhotoContent) models.PhotoContent {
+	require.NoError(t, store.Put(context.Background(), key, bytes.NewReader(stored), int64(len(stored))))
+	sum := sha256.Sum256(stored)
+	content.Key, content.Size, content.SHA256 = key, int64(len(stored)), hex.EncodeToString(sum[:])
+	return content
+}
+
+func TestPhotoReencryption_MovesRowsToCurrentKey(t *testing.T) {
+	keyV1 := []byte("este-e-um-segredo-de-32-bytes!!*")
+	v1, err := crypto.NewKeyring(map[uint32][]byte{1: keyV1})
+	require.NoError(t, err)
+	keyring, err := crypto.NewKeyring(map[uint32][]byte{1: keyV1, 2: []byte("outro-segredo-de-exatos-32-bytes")})
+	require.NoError(t, err)
+	keys := PhotoKeys{Provider: crypto.NewLocalKeyProvider(keyring), Legacy: keyring}
+
+	photoStore := newTestPhotoStore(t)
+	envelopeV1, err := v1.Seal(testPNG)
+	require.NoError(t, err)
+	legacy, err := crypto.Encrypt(testPNG, keyV1)
+	require.NoError(t, err)
+	dataKey, err := crypto.NewDataKey()
+	require.NoError(t, err)
+	wrappedV1, err := v1.Seal(dataKey)
+	require.NoError(t, err)
+	withoutAAD, err := crypto.Encrypt(testPNG, dataKey)
+	require.NoError(t, err)
+	boundRow := models.PhotoMetadata{ID: 5, DeviceID: "dev", Timestamp: time.Now()}
+	bound, err := crypto.EncryptWithAAD(testPNG, dataKey, photoAAD(boundRow))
+	require.NoError(t, err)
+	photos := []models.StoredPhoto{
+		{PhotoMetadata: models.PhotoMetadata{ID: 1, DeviceID: "dev", Timestamp: time.Now()},
+			PhotoContent: putTestContent(t, photoStore, "photos/v1", envelopeV1, models.PhotoContent{Encryption: models.PhotoEncryptionEnvelope, KeyVersion: 1})},
+		{PhotoMetadata: models.PhotoMetadata{ID: 2, DeviceID: "dev", Timestamp: time.Now()},
+			PhotoContent: putTestContent(t, photoStore, "photos/legado", legacy, models.PhotoContent{Encryption: models.PhotoEncryptionAES256GCM})},
+		{PhotoMetadata: models.PhotoMetadata{ID: 3, DeviceID: "dev", Timestamp: time.Now()},
+			PhotoContent: models.PhotoContent{Key: "photos/apagada", Encryption: models.PhotoEncryptionEnvelope, KeyVersion: 1}},
+		{PhotoMetadata: models.PhotoMetadata{ID: 4, DeviceID: "dev", Timestamp: time.Now()},
+			PhotoContent: putTestContent(t, photoStore, "photos/dek", withoutAAD, models.PhotoContent{
+				Encryption: models.PhotoEncryptionDataKey, KeyVersion: 2, WrappedKey: wrappedV1})},
+		{PhotoMetadata: boundRow,
+			PhotoContent: putTestContent(t, photoStore, "photos/dek-aad", bound, models.PhotoContent{
+				Encryption: models.PhotoEncryptionDataKeyAAD, KeyVersion: 1, WrappedKey: wrappedV1})},
+	}
+	rows := map[int64]models.PhotoMetadata{}
+	for _, photo := range photos {
+		rows[photo.ID] = photo.PhotoMetadata
+	}
+
+	mockDB := new(MockStorage)
+	mockDB.On("CountPhotosBelowKeyVersion", uint32(2)).Return(int64(5), nil)
+	mockDB.On("ListPhotosBelowKeyVersion", uint32(2), int64(0), photoReencryptionBatchSize).Return(photos, nil)
+	replaced := map[int64]models.PhotoContent{}
+	mockDB.On("ReplacePhotoContent", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		replaced[args.Get(0).(int64)] = args.Get(2).(models.PhotoContent)
+	}).Return(nil)
+
+	done, failed, err := NewPhotoReencryptionService(mockDB, photoStore, keys).Run(context.Background(), 2)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, done)
+	assert.Equal(t, 1, failed, "objeto ausente não interrompe a execução")
+	mockDB.AssertCalled(t, "ReplacePhotoContent", int64(1), "photos/v1", mock.Anything)
+	mockDB.AssertCalled(t, "ReplacePhotoContent", int64(2), "photos/legado", mock.Anything)
+	assert.NotEqual(t, "photos/dek", replaced[4].Key, "chave de dados sem AAD ganha um objeto amarrado à linha")
+	assert.Equal(t, "photos/dek-aad", replaced[5].Key, "com chave de dados amarrada à linha só a chave embrulhada muda")
+	assert.NotEqual(t, wrappedV1, replaced[5].WrappedKey)
+	assert.Equal(t, models.PhotoEncryptionDataKeyAAD, replaced[5].Encryption)
+	for id, content := range replaced {
+		if id != 5 {
+			assert.Equal(t, models.PhotoEncryptionStream, content.Encryption, id)
+		}
+		assert.Equal(t, uint32(2), content.KeyVersion, id)
+		image, err := readPhotoContent(context.Background(), photoStore, keys, rows[id], content)
+		require.NoError(t, err)
+		assert.Equal(t, testPNG, image)
+	}
+	for _, old := range []string{"photos/v1", "photos/legado", "photos/dek"} {
+		_, err := photoStore.Get(context.Background(), old)
+		assert.Error(t, err, "o objeto antigo é apagado depois da troca")
+	}
+}
+
+func TestPhotoReencryption_NothingPending(t *testing.T) {
+	keyring, err := crypto.NewKeyring(map[uint32][]byte{3: []byte("este-e-um-segredo-de-32-bytes!!*")})
+	require.NoError(t, err)
+	keys := PhotoKeys{Provider: crypto.NewLocalKeyProvider(keyring), Legacy: keyring}
+	mockDB := new(MockStorage)
+	mockDB.On("CountPhotosBelowKeyVersion", uint32(3)).Return(int64(0), nil)
+
+	done, failed, err := NewPhotoReencryptionService(mockDB, newTestPhotoStore(t), keys).Run(context.Background(), 3)
+
+	require.NoError(t, err)
+	assert.Zero(t, done+failed)
+	mockDB.AssertNotCalled(t, "ListPhotosBelowKeyVersion", mock.Anything, mock.Anything, mock.Anything)
+}
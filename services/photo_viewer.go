@@ -0,0 +1,50 @@
+package services
+
+import (
+	"bytes"
+	"challenge-v3/blob"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"fmt"
+	"io"
+)
+
+// PhotoViewer recupera a imagem original de uma foto, decifrando o objeto gravado pelo worker.
+type PhotoViewer struct {
+	db    storage.Storage
+	blobs blob.Store
+	keys  PhotoKeys
+}
+
+func NewPhotoViewer(db storage.Storage, blobs blob.Store, keys PhotoKeys) *PhotoViewer {
+	return &PhotoViewer{db: db, blobs: blobs, keys: keys}
+}
+
+// Open retorna a linha da foto e a imagem decifrada. No formato em blocos a imagem é decifrada enquanto é
+// lida, e um objeto cortado ou adulterado interrompe a leitura com ErrPhotoContentUnavailable; nos demais
+// ela só é entregue depois de conferidos o tamanho e o SHA-256 registrados no banco. Retorna
+// storage.ErrNotFound quando o id não existe.
+func (v *PhotoViewer) Open(ctx context.Context, id int64) (*models.StoredPhoto, io.ReadCloser, error) {
+	photo, err := v.db.GetPhoto(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	image, err := v.open(ctx, photo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return photo, image, nil
+}
+
+// open decifra a imagem de uma linha já lida do banco.
+func (v *PhotoViewer) open(ctx context.Context, photo *models.StoredPhoto) (io.ReadCloser, error) {
+	if photo.Key != "" {
+		return openPhotoContent(ctx, v.blobs, v.keys, photo.PhotoMetadata, photo.PhotoContent)
+	}
+	image, err := legacyPhotoImage(photo.Legacy, v.keys.Legacy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPhotoContentUnavailable, err)
+	}
+	return io.NopCloser(bytes.NewReader(image)), nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"challenge-v3/blob"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPurgeBatchSize = 5000
+
+// RetentionPolicy define por quanto tempo as linhas de uma tabela são mantidas.
+type RetentionPolicy struct {
+	Table  string
+	MaxAge time.Duration
+}
+
+// ParseRetentionPolicies lê políticas no formato "photo=30d,gps=365d,audit_log=8760h".
+// Aceita dias (d) ou qualquer unidade de time.ParseDuration.
+func ParseRetentionPolicies(raw string) ([]RetentionPolicy, error) {
+	policies := []RetentionPolicy{}
+	known := storage.RetentionTables()
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		table, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("política de retenção inválida: %q", entry)
+		}
+		table = strings.TrimSpace(table)
+		if !slices.Contains(known, table) {
+			return nil, fmt.Errorf("tabela sem suporte a retenção: %s", table)
+		}
+		maxAge, err := parseRetentionAge(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("política de retenção inválida para %s: %w", table, err)
+		}
+		policies = append(policies, RetentionPolicy{Table: table, MaxAge: maxAge})
+	}
+	return policies, nil
+}
+
+func parseRetentionAge(value string) (time.Duration, error) {
+	var age time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+		age = parsed
+	}
+	if age <= 0 {
+		return 0, fmt.Errorf("a retenção deve ser positiva: %s", value)
+	}
+	return age, nil
+}
+
+type RetentionService struct {
+	db storage.Storage
+	// blobs, quando definido, recebe a remoção das imagens das fotos vencidas.
+	blobs     blob.Store
+	policies  []RetentionPolicy
+	batchSize int
+	// detachOnly mantém as partições vencidas no banco (desanexadas) em vez de apagá-las.
+	detachOnly bool
+}
+
+func NewRetentionService(db storage.Storage, blobs blob.Store, policies []RetentionPolicy, batchSize int, detachOnly bool) *RetentionService {
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatchSize
+	}
+	return &RetentionService{db: db, blobs: blobs, policies: policies, batchSize: batchSize, detachOnly: detachOnly}
+}
+
+// purgePhotoContent apaga os objetos das fotos anteriores ao corte. Roda antes das linhas saírem, para
+// que uma falha no meio deixe no máximo linhas sem imagem, nunca imagens sem dono.
+func (s *RetentionService) purgePhotoContent(ctx context.Context, cutoff time.Time) (int, error) {
+	deleted := 0
+	err := s.db.StreamPhotoContentKeys(ctx, cutoff, func(key string) error {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
+
+// purgeTable apaga em lotes até não restar nada anterior ao corte, para não segurar locks por muito tempo.
+func (s *RetentionService) purgeTable(ctx context.Context, table string, cutoff time.Time) (int64, int, error) {
+	var total int64
+	batches := 0
+	for ctx.Err() == nil {
+		deleted, err := s.db.PurgeBefore(ctx, table, cutoff, s.batchSize)
+		if err != nil {
+			return total, batches, err
+		}
+		batches++
+		total += deleted
+		if deleted < int64(s.batchSize) {
+			return total, batches, nil
+		}
+	}
+	return total, batches, ctx.Err()
+}
+
+// Purge aplica todas as políticas e registra cada execução na auditoria, inclusive as que falharam.
+// Em tabelas particionadas, os meses inteiros vencidos saem com a remoção da partição e só o restante
+// passa pela limpeza em lotes. As imagens das fotos vencidas são apagadas do blob store antes das linhas;
+// com detachOnly as partições saem primeiro e as imagens delas ficam para acompanhar o arquivo.
+func (s *RetentionService) Purge(ctx context.Context, now time.Time) {
+	partitioned := storage.PartitionedTables()
+	for _, policy := range s.policies {
+		cutoff := now.UTC().Add(-policy.MaxAge)
+		start := time.Now()
+
+		var removed []string
+		var err error
+		var blobsDeleted int
+		hasPartitions := slices.Contains(partitioned, policy.Table)
+		if hasPartitions && s.detachOnly {
+			removed, err = s.db.DropPartitionsBefore(ctx, policy.Table, cutoff, true)
+		}
+		if err == nil && policy.Table == "photo" && s.blobs != nil {
+			blobsDeleted, err = s.purgePhotoContent(ctx, cutoff)
+		}
+		if err == nil && hasPartitions && !s.detachOnly {
+			removed, err = s.db.DropPartitionsBefore(ctx, policy.Table, cutoff, false)
+		}
+		var deleted int64
+		var batches int
+		if err == nil {
+			deleted, batches, err = s.purgeTable(ctx, policy.Table, cutoff)
+		}
+
+		details := map[string]interface{}{
+			"table":       policy.Table,
+			"max_age":     policy.MaxAge.String(),
+			"cutoff":      cutoff,
+			"deleted":     deleted,
+			"batches":     batches,
+			"partitions":  removed,
+			"blobs":       blobsDeleted,
+			"detach_only": s.detachOnly,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		action := "RETENTION_PURGE"
+		if err != nil {
+			slog.Error("falha ao aplicar política de retenção", "error", err, "table", policy.Table, "deleted", deleted)
+			action = "RETENTION_PURGE_FAILED"
+			details["error"] = err.Error()
+		} else {
+			slog.Info("política de retenção aplicada", "table", policy.Table, "cutoff", cutoff, "deleted", deleted, "partitions", removed)
+		}
+		auditEvent := models.AuditEvent{Actor: "retention", Action: action, Details: details}
+		if err := s.db.LogAuditEvent(ctx, auditEvent); err != nil {
+			slog.Error("falha ao registrar evento de auditoria para retenção", "error", err, "table", policy.Table)
+		}
+	}
+}
+
+func (s *RetentionService) Start(ctx context.Context, interval time.Duration) {
+	if len(s.policies) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Purge(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
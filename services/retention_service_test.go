@@ -0,0 +1,127 @@
+package services
+
+import (
+	"challenge-v3/blob"
+	"challenge-v3/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) PurgeBefore(ctx context.Context, table string, cutoff time.Time, limit int) (int64, error) {
+	args := m.Called(table, cutoff, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) DropPartitionsBefore(ctx context.Context, table string, cutoff time.Time, detachOnly bool) ([]string, error) {
+	args := m.Called(table, cutoff, detachOnly)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) StreamPhotoContentKeys(ctx context.Context, before time.Time, fn func(key string) error) error {
+	args := m.Called(before)
+	for _, key := range args.Get(0).([]string) {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func TestParseRetentionPolicies(t *testing.T) {
+	policies, err := ParseRetentionPolicies("photo=30d, telemetry_rollup_hour=730d,audit_log=36h")
+	require.NoError(t, err)
+	assert.Equal(t, []RetentionPolicy{
+		{Table: "photo", MaxAge: 30 * 24 * time.Hour},
+		{Table: "telemetry_rollup_hour", MaxAge: 730 * 24 * time.Hour},
+		{Table: "audit_log", MaxAge: 36 * time.Hour},
+	}, policies)
+
+	for _, invalid := range []string{"photo", "photo=abc", "photo=0d", "users=30d"} {
+		_, err := ParseRetentionPolicies(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRetentionService_PurgesInBatchesAndAudits(t *testing.T) {
+	mockDB := new(MockStorage)
+	now := time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	photoStore := newTestPhotoStore(t)
+	require.NoError(t, photoStore.Put(context.Background(), "photos/velha", strings.NewReader("x"), 1))
+	service := NewRetentionService(mockDB, photoStore, []RetentionPolicy{{Table: "photo", MaxAge: 30 * 24 * time.Hour}}, 100, false)
+
+	mockDB.On("StreamPhotoContentKeys", cutoff).Return([]string{"photos/velha"}, nil)
+	mockDB.On("DropPartitionsBefore", "photo", cutoff, false).Return([]string{"photo_p202501"}, nil)
+	mockDB.On("PurgeBefore", "photo", cutoff, 100).Return(int64(100), nil).Twice()
+	mockDB.On("PurgeBefore", "photo", cutoff, 100).Return(int64(42), nil).Once()
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "RETENTION_PURGE" && e.Details["table"] == "photo" &&
+			e.Details["deleted"] == int64(242) && e.Details["batches"] == 3 && e.Details["blobs"] == 1 &&
+			assert.ObjectsAreEqual([]string{"photo_p202501"}, e.Details["partitions"])
+	})).Return(nil)
+
+	service.Purge(context.Background(), now)
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNumberOfCalls(t, "PurgeBefore", 3)
+	_, err := photoStore.Get(context.Background(), "photos/velha")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+}
+
+func TestRetentionService_PhotoContentFailureKeepsRows(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewRetentionService(mockDB, newTestPhotoStore(t), []RetentionPolicy{{Table: "photo", MaxAge: time.Hour}}, 10, false)
+
+	mockDB.On("StreamPhotoContentKeys", mock.Anything).Return([]string{}, errors.New("bucket indisponível"))
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "RETENTION_PURGE_FAILED"
+	})).Return(nil)
+
+	service.Purge(context.Background(), time.Now())
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "PurgeBefore", mock.Anything, mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "DropPartitionsBefore", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRetentionService_FailureIsAudited(t *testing.T) {
+	mockDB := new(MockStorage)
+	now := time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)
+	service := NewRetentionService(mockDB, nil, []RetentionPolicy{
+		{Table: "gps", MaxAge: 24 * time.Hour},
+		{Table: "audit_log", MaxAge: 48 * time.Hour},
+	}, 10, true)
+
+	mockDB.On("DropPartitionsBefore", mock.Anything, mock.Anything, true).Return([]string{}, nil)
+	mockDB.On("PurgeBefore", "gps", mock.Anything, 10).Return(int64(0), errors.New("lock timeout"))
+	mockDB.On("PurgeBefore", "audit_log", mock.Anything, 10).Return(int64(3), nil)
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "RETENTION_PURGE_FAILED" && e.Details["error"] == "lock timeout"
+	})).Return(nil).Once()
+	mockDB.On("LogAuditEvent", mock.MatchedBy(func(e models.AuditEvent) bool {
+		return e.Action == "RETENTION_PURGE" && e.Details["table"] == "audit_log"
+	})).Return(nil).Once()
+
+	service.Purge(context.Background(), now)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestRetentionService_UnpartitionedTableSkipsPartitionDrop(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewRetentionService(mockDB, nil, []RetentionPolicy{{Table: "telemetry_rollup_minute", MaxAge: time.Hour}}, 10, false)
+
+	mockDB.On("PurgeBefore", "telemetry_rollup_minute", mock.Anything, 10).Return(int64(0), nil)
+	mockDB.On("LogAuditEvent", mock.Anything).Return(nil)
+
+	service.Purge(context.Background(), time.Now())
+
+	mockDB.AssertNotCalled(t, "DropPartitionsBefore", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"challenge-v3/storage"
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// rollupLateness é a janela recalculada a cada execução para absorver telemetria que chega atrasada.
+	rollupLateness = 15 * time.Minute
+	// rollupMaxChunk limita o quanto é recalculado de uma vez ao recuperar um atraso longo.
+	rollupMaxChunk = 6 * time.Hour
+	// rollupInitialBackfill define até onde voltar na primeira execução.
+	rollupInitialBackfill = 24 * time.Hour
+)
+
+type RollupService struct {
+	db storage.Storage
+}
+
+func NewRollupService(db storage.Storage) *RollupService {
+	return &RollupService{db: db}
+}
+
+// Refresh atualiza os rollups até o último minuto fechado antes de now, avançando em blocos de
+// no máximo rollupMaxChunk a partir da marca d'água salva.
+func (s *RollupService) Refresh(ctx context.Context, now time.Time) error {
+	to := now.UTC().Truncate(time.Minute)
+	watermark, err := s.db.RollupWatermark(ctx)
+	if err != nil {
+		return err
+	}
+	if watermark.IsZero() {
+		watermark = to.Add(-rollupInitialBackfill)
+	}
+	from := watermark.Add(-rollupLateness).Truncate(time.Minute)
+
+	for from.Before(to) {
+		chunkEnd := from.Add(rollupMaxChunk)
+		if chunkEnd.After(to) {
+			chunkEnd = to
+		}
+		start := time.Now()
+		if err := s.db.RefreshRollups(ctx, from, chunkEnd); err != nil {
+			return err
+		}
+		if err := s.db.SetRollupWatermark(ctx, chunkEnd); err != nil {
+			return err
+		}
+		slog.Debug("rollups de telemetria atualizados", "from", from, "to", chunkEnd, "duration", time.Since(start).String())
+		from = chunkEnd
+	}
+	return nil
+}
+
+func (s *RollupService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(ctx, time.Now()); err != nil {
+			slog.Error("falha ao atualizar rollups de telemetria", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"challenge-v3/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (m *MockStorage) RefreshRollups(ctx context.Context, from, to time.Time) error {
+	return m.Called(from, to).Error(0)
+}
+func (m *MockStorage) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	return m.Called(watermark).Error(0)
+}
+func (m *MockStorage) RollupWatermark(ctx context.Context) (time.Time, error) {
+	args := m.Called()
+	return args.Get(0).(time.Time), args.Error(1)
+}
+func (m *MockStorage) QueryRollups(ctx context.Context, deviceID string, from, to time.Time, resolution string) ([]models.TelemetryRollup, error) {
+	args := m.Called(deviceID, from, to, resolution)
+	return args.Get(0).([]models.TelemetryRollup), args.Error(1)
+}
+
+func TestRollupService_RecomputesLatenessWindow(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewRollupService(mockDB)
+	now := time.Date(2025, 1, 10, 12, 30, 45, 0, time.UTC)
+	watermark := time.Date(2025, 1, 10, 12, 29, 0, 0, time.UTC)
+
+	mockDB.On("RollupWatermark").Return(watermark, nil)
+	mockDB.On("RefreshRollups", watermark.Add(-rollupLateness), now.Truncate(time.Minute)).Return(nil)
+	mockDB.On("SetRollupWatermark", now.Truncate(time.Minute)).Return(nil)
+
+	require.NoError(t, service.Refresh(context.Background(), now))
+	mockDB.AssertExpectations(t)
+}
+
+func TestRollupService_CatchesUpInChunks(t *testing.T) {
+	mockDB := new(MockStorage)
+	service := NewRollupService(mockDB)
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	mockDB.On("RollupWatermark").Return(time.Time{}, nil)
+	mockDB.On("RefreshRollups", mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(nil)
+	mockDB.On("SetRollupWatermark", mock.AnythingOfType("time.Time")).Return(nil)
+
+	require.NoError(t, service.Refresh(context.Background(), now))
+
+	// 24h de backfill + 15 min de atraso em blocos de 6h = 5 blocos
+	mockDB.AssertNumberOfCalls(t, "RefreshRollups", 5)
+	last := mockDB.Calls[len(mockDB.Calls)-1]
+	assert.Equal(t, now, last.Arguments.Get(0))
+}
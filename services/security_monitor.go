@@ -0,0 +1,148 @@
+package services
+
+import (
+	"challenge-v3/metrics"
+	"challenge-v3/models"
+	"challenge-v3/storage"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SecurityAlertConfig define quando as falhas de uma mesma origem viram alerta.
+type SecurityAlertConfig struct {
+	Threshold int           // falhas dentro de Window que disparam o alerta
+	Window    time.Duration // janela deslizante; uma origem só volta a alertar depois dela
+}
+
+func DefaultSecurityAlertConfig() SecurityAlertConfig {
+	return SecurityAlertConfig{Threshold: 10, Window: 5 * time.Minute}
+}
+
+type securityFailure struct {
+	at        time.Time
+	eventType string
+}
+
+type securitySource struct {
+	failures  []securityFailure
+	alertedAt time.Time
+}
+
+// SecurityMonitor grava no audit_log os eventos de segurança publicados pela API e alerta quando uma
+// mesma origem acumula falhas. As janelas ficam em memória: com várias réplicas do worker, cada uma
+// conta só as mensagens que recebe.
+type SecurityMonitor struct {
+	db      storage.Storage
+	config  SecurityAlertConfig
+	mu      sync.Mutex
+	sources map[string]*securitySource
+}
+
+func NewSecurityMonitor(db storage.Storage, config SecurityAlertConfig) *SecurityMonitor {
+	return &SecurityMonitor{db: db, config: config, sources: map[string]*securitySource{}}
+}
+
+// RecordSecurityEvents grava os eventos e, no mesmo lote do audit_log, um SECURITY_ALERT para cada
+// origem que chegou a Threshold falhas dentro de Window. As janelas só avançam depois da gravação, então
+// um lote reenviado pelo JetStream não conta em dobro. Retorna os alertas gerados.
+func (m *SecurityMonitor) RecordSecurityEvents(ctx context.Context, events []*models.SecurityEvent) ([]models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sorted := slices.Clone(events)
+	slices.SortStableFunc(sorted, func(a, b *models.SecurityEvent) int { return a.Timestamp.Compare(b.Timestamp) })
+
+	auditEvents := make([]models.AuditEvent, 0, len(sorted))
+	var alerts []models.AuditEvent
+	next := map[string]*securitySource{}
+	for _, event := range sorted {
+		actor := event.Actor
+		if actor == "" {
+			actor = event.Source
+		}
+		auditEvents = append(auditEvents, models.AuditEvent{
+			Actor:  actor,
+			Action: "SECURITY_" + event.Type,
+			Details: map[string]interface{}{
+				"source":      event.Source,
+				"method":      event.Method,
+				"path":        event.Path,
+				"reason":      event.Reason,
+				"occurred_at": event.Timestamp,
+			},
+		})
+
+		source := next[event.Source]
+		if source == nil {
+			source = &securitySource{}
+			if current := m.sources[event.Source]; current != nil {
+				source.failures, source.alertedAt = slices.Clone(current.failures), current.alertedAt
+			}
+			next[event.Source] = source
+		}
+		if alert, ok := m.observe(source, event); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	if err := m.db.LogAuditEvents(ctx, append(auditEvents, alerts...)); err != nil {
+		return nil, err
+	}
+	for address, source := range next {
+		m.sources[address] = source
+	}
+	m.forgetIdleSources(time.Now())
+	for _, alert := range alerts {
+		metrics.SecurityAlertsTotal.Inc()
+		slog.Warn("falhas repetidas de uma mesma origem", "source", alert.Details["source"], "failures", alert.Details["failures"],
+			"types", alert.Details["types"])
+	}
+	return alerts, nil
+}
+
+// observe acrescenta a falha à janela da origem e devolve o alerta quando ela chega ao limite.
+func (m *SecurityMonitor) observe(source *securitySource, event *models.SecurityEvent) (models.AuditEvent, bool) {
+	start := event.Timestamp.Add(-m.config.Window)
+	source.failures = slices.DeleteFunc(source.failures, func(f securityFailure) bool { return !f.at.After(start) })
+	source.failures = append(source.failures, securityFailure{at: event.Timestamp, eventType: event.Type})
+	if len(source.failures) < m.config.Threshold {
+		return models.AuditEvent{}, false
+	}
+	if !source.alertedAt.IsZero() && event.Timestamp.Sub(source.alertedAt) < m.config.Window {
+		return models.AuditEvent{}, false
+	}
+	source.alertedAt = event.Timestamp
+	types := map[string]int{}
+	for _, f := range source.failures {
+		types[f.eventType]++
+	}
+	return models.AuditEvent{
+		Actor:  "security-monitor",
+		Action: "SECURITY_ALERT",
+		Details: map[string]interface{}{
+			"source":         event.Source,
+			"failures":       len(source.failures),
+			"window_seconds": int(m.config.Window.Seconds()),
+			"types":          types,
+			"first_at":       source.failures[0].at,
+			"last_at":        event.Timestamp,
+		},
+	}, true
+}
+
+// forgetIdleSources descarta as origens sem falhas nem alerta dentro da janela.
+func (m *SecurityMonitor) forgetIdleSources(now time.Time) {
+	start := now.Add(-m.config.Window)
+	for address, source := range m.sources {
+		if len(source.failures) > 0 && source.failures[len(source.failures)-1].at.After(start) {
+			continue
+		}
+		if source.alertedAt.After(start) {
+			continue
+		}
+		delete(m.sources, address)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"challenge-v3/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func securityEvents(source, eventType string, start time.Time, count int, step time.Duration) []*models.SecurityEvent {
+	events := make([]*models.SecurityEvent, 0, count)
+	for i := 0; i < count; i++ {
+		events = append(events, &models.SecurityEvent{Type: eventType, Source: source, Method: "POST", Path: "/telemetry/gps",
+			Timestamp: start.Add(time.Duration(i) * step)})
+	}
+	return events
+}
+
+func TestSecurityMonitor_AlertsOnRepeatedFailuresFromOneSource(t *testing.T) {
+	mockDB := new(MockStorage)
+	var written [][]models.AuditEvent
+	mockDB.On("LogAuditEvents", mock.Anything).Run(func(args mock.Arguments) {
+		written = append(written, args.Get(0).([]models.AuditEvent))
+	}).Return(nil)
+	monitor := NewSecurityMonitor(mockDB, SecurityAlertConfig{Threshold: 3, Window: time.Minute})
+	ctx := context.Background()
+	start := time.Now().Add(-30 * time.Second)
+
+	// Duas falhas de cada origem: nenhuma chega ao limite.
+	batch := append(securityEvents("10.0.0.1", models.SecurityAuthFailure, start, 2, time.Second),
+		securityEvents("10.0.0.2", models.SecurityAuthFailure, start, 2, time.Second)...)
+	alerts, err := monitor.RecordSecurityEvents(ctx, batch)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+	require.Len(t, written[0], 4)
+	assert.Equal(t, "SECURITY_AUTH_FAILURE", written[0][0].Action)
+	assert.Equal(t, "10.0.0.1", written[0][0].Actor, "sem chave conhecida o ator é a origem")
+
+	// A terceira falha de 10.0.0.1, em outro lote, dispara o alerta no mesmo lote do audit_log.
+	alerts, err = monitor.RecordSecurityEvents(ctx, securityEvents("10.0.0.1", models.SecurityRateLimited, start.Add(5*time.Second), 1, 0))
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "10.0.0.1", alerts[0].Details["source"])
+	assert.Equal(t, 3, alerts[0].Details["failures"])
+	assert.Equal(t, map[string]int{models.SecurityAuthFailure: 2, models.SecurityRateLimited: 1}, alerts[0].Details["types"])
+	require.Len(t, written[1], 2)
+	assert.Equal(t, "SECURITY_ALERT", written[1][1].Action)
+
+	// Dentro da janela a mesma origem não alerta de novo.
+	alerts, err = monitor.RecordSecurityEvents(ctx, securityEvents("10.0.0.1", models.SecurityAuthFailure, start.Add(10*time.Second), 5, time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	// Falhas espaçadas mais que a janela nunca acumulam.
+	spaced := securityEvents("10.0.0.3", models.SecurityValidationFailed, time.Now().Add(-3*time.Minute), 3, 61*time.Second)
+	alerts, err = monitor.RecordSecurityEvents(ctx, spaced)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func TestSecurityMonitor_FailedWriteDoesNotCount(t *testing.T) {
+	mockDB := new(MockStorage)
+	mockDB.On("LogAuditEvents", mock.Anything).Return(errors.New("banco indisponível")).Once()
+	mockDB.On("LogAuditEvents", mock.Anything).Return(nil)
+	monitor := NewSecurityMonitor(mockDB, SecurityAlertConfig{Threshold: 3, Window: time.Minute})
+	batch := securityEvents("10.0.0.1", models.SecurityAuthFailure, time.Now(), 2, time.Second)
+
+	_, err := monitor.RecordSecurityEvents(context.Background(), batch)
+	require.Error(t, err)
+	// O JetStream reenvia o mesmo lote: as falhas contam uma vez só.
+	alerts, err := monitor.RecordSecurityEvents(context.Background(), batch)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"challenge-v3/auditchain"
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var auditColumns = []string{"timestamp", "actor", "action", "details", "seq", "prev_hash", "hash", "hmac"}
+
+// chainAuditEvents reserva as próximas posições da cadeia e devolve as linhas de events prontas para
+// auditColumns. O UPDATE em audit_chain_head trava a cabeça até o fim da transação (db precisa ser uma),
+// então gravações concorrentes entram uma depois da outra, cada uma encadeada na anterior.
+func chainAuditEvents(ctx context.Context, db querier, key []byte, events []models.AuditEvent) ([][]any, error) {
+	var seq int64
+	var prev []byte
+	if err := db.QueryRowContext(ctx, "UPDATE audit_chain_head SET seq = seq WHERE id = 1 RETURNING seq, hash").Scan(&seq, &prev); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	rows := make([][]any, 0, len(events))
+	for _, event := range events {
+		details, err := json.Marshal(event.Details)
+		if err != nil {
+			return nil, err
+		}
+		seq++
+		entry := models.AuditEntry{Seq: seq, Timestamp: now, Actor: event.Actor, Action: event.Action, Details: details}
+		hash, err := auditchain.Hash(prev, entry)
+		if err != nil {
+			return nil, err
+		}
+		// No COPY, []byte seria enviado como bytea; o jsonb precisa do texto.
+		rows = append(rows, []any{now, event.Actor, event.Action, string(details), seq, prev, hash, auditchain.MAC(key, hash)})
+		prev = hash
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE audit_chain_head SET seq = $1, hash = $2 WHERE id = 1", seq, prev); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func auditChainHead(ctx context.Context, db querier) (int64, []byte, error) {
+	var seq int64
+	var hash []byte
+	err := db.QueryRowContext(ctx, "SELECT seq, hash FROM audit_chain_head WHERE id = 1").Scan(&seq, &hash)
+	return seq, hash, err
+}
+
+// streamAuditChain percorre as linhas encadeadas com from <= seq <= to, em ordem.
+func streamAuditChain(ctx context.Context, db querier, from, to int64, fn func(models.AuditEntry) error) error {
+	query := `SELECT id, seq, timestamp, actor, action, details, prev_hash, hash, hmac FROM audit_log
+		WHERE seq >= $1 AND seq <= $2 ORDER BY seq`
+	rows, err := db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scanAuditEntry(rows *sql.Rows) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var details []byte
+	if err := rows.Scan(&entry.ID, &entry.Seq, timestampDest{&entry.Timestamp}, &entry.Actor, &entry.Action, &details,
+		&entry.PrevHash, &entry.Hash, &entry.HMAC); err != nil {
+		return entry, err
+	}
+	entry.Timestamp = entry.Timestamp.UTC()
+	entry.Details = details
+	return entry, nil
+}
+
+// Comparação de um campo de primeiro nível de details com um valor JSON (parâmetros: chave e valor).
+const (
+	postgresAuditDetailsMatch = "details -> %s::text = %s::jsonb"
+	sqliteAuditDetailsMatch   = "json_extract(details, '$.' || %s) = json_extract(%s, '$')"
+)
+
+// streamAuditLog percorre as linhas que atendem filter, do maior id para o menor. detailsMatch é a
+// comparação de details do banco.
+func streamAuditLog(ctx context.Context, db querier, detailsMatch string, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds = append(conds, "timestamp >= "+arg(filter.From), "timestamp < "+arg(filter.To))
+	if filter.Actor != "" {
+		conds = append(conds, "actor = "+arg(filter.Actor))
+	}
+	if filter.Action != "" {
+		conds = append(conds, "action = "+arg(filter.Action))
+	}
+	keys := make([]string, 0, len(filter.Details))
+	for key := range filter.Details {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		conds = append(conds, fmt.Sprintf(detailsMatch, arg(key), arg(string(filter.Details[key]))))
+	}
+	if filter.BeforeID > 0 {
+		conds = append(conds, "id < "+arg(filter.BeforeID))
+	}
+	query := `SELECT id, COALESCE(seq, 0), timestamp, actor, action, details, prev_hash, hash, hmac FROM audit_log
+		WHERE ` + strings.Join(conds, " AND ") + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// copyRows grava as linhas com COPY numa única transação (a corrente, dentro de WithTx): ou o lote
+// inteiro entra, ou nada entra.
+func (s *PostgresStorage) copyRows(ctx context.Context, table string, columns []string, count int, row func(i int) ([]any, error)) error {
+	if count == 0 {
+		return nil
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return copyInto(ctx, tx, table, columns, count, row)
+	})
+}
+
+func copyInto(ctx context.Context, tx *sql.Tx, table string, columns []string, count int, row func(i int) ([]any, error)) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < count; i++ {
+		values, err := row(i)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+func (s *PostgresStorage) SaveGyroscopeBatch(ctx context.Context, batch []*models.GyroscopeData) error {
+	return s.copyRows(ctx, "gyroscope", []string{"device_id", "x", "y", "z", "timestamp"}, len(batch), func(i int) ([]any, error) {
+		d := batch[i]
+		return []any{d.DeviceID, *d.X, *d.Y, *d.Z, d.Timestamp}, nil
+	})
+}
+
+func (s *PostgresStorage) SaveGPSBatch(ctx context.Context, batch []*models.GPSData) error {
+	return s.copyRows(ctx, "gps", gpsColumns, len(batch), func(i int) ([]any, error) {
+		return gpsRow(s.locations, batch[i])
+	})
+}
+
+func (s *PostgresStorage) LogAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := chainAuditEvents(ctx, tx, s.auditKey, events)
+		if err != nil {
+			return err
+		}
+		return copyInto(ctx, tx, "audit_log", auditColumns, len(rows), func(i int) ([]any, error) {
+			return rows[i], nil
+		})
+	})
+}
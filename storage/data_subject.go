@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// As consultas dos pedidos de titulares são as mesmas nos dois backends; só mudam o querier e a
+// expressão de "agora" (now).
+
+// AnonymizedGeohashPrecision é a precisão que o geohash mantém nas linhas anonimizadas: 4 caracteres,
+// uma célula de cerca de 39 x 20 km.
+const AnonymizedGeohashPrecision = 4
+
+// deviceDataTables são as tabelas com dados pessoais de um dispositivo, na ordem em que são apagadas.
+var deviceDataTables = []string{"gps", "gyroscope", "photo", "overspeed_event", "telemetry_rollup_minute", "telemetry_rollup_hour"}
+
+// anonymizeStatements trocam o dispositivo pelo pseudônimo ($2) e descartam as posições exatas. As
+// tabelas fora do mapa (as fotos) não têm versão anônima e são apagadas.
+var anonymizeStatements = map[string]string{
+	"gps": fmt.Sprintf(`UPDATE gps SET device_id = $2, latitude = NULL, longitude = NULL, location = NULL,
+		geohash = substr(geohash, 1, %d) WHERE device_id = $1`, AnonymizedGeohashPrecision),
+	"gyroscope": `UPDATE gyroscope SET device_id = $2 WHERE device_id = $1`,
+	"overspeed_event": fmt.Sprintf(`UPDATE overspeed_event SET device_id = $2, latitude = NULL, longitude = NULL,
+		location = NULL, geohash = substr(geohash, 1, %d) WHERE device_id = $1`, AnonymizedGeohashPrecision),
+	"telemetry_rollup_minute": `UPDATE telemetry_rollup_minute SET device_id = $2, min_lat = NULL, max_lat = NULL,
+		min_lon = NULL, max_lon = NULL WHERE device_id = $1`,
+	"telemetry_rollup_hour": `UPDATE telemetry_rollup_hour SET device_id = $2, min_lat = NULL, max_lat = NULL,
+		min_lon = NULL, max_lon = NULL WHERE device_id = $1`,
+}
+
+const dataSubjectRequestColumns = `id, subject_type, subject_id, action, reason, status, requested_by, location, record, error,
+	created_at, started_at, finished_at`
+
+func scanDataSubjectRequest(row rowScanner) (*models.DataSubjectRequest, error) {
+	var req models.DataSubjectRequest
+	var record string
+	err := row.Scan(&req.ID, &req.SubjectType, &req.SubjectID, &req.Action, &req.Reason, &req.Status, &req.RequestedBy,
+		&req.Location, &record, &req.Error, &req.CreatedAt, &req.StartedAt, &req.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if record != "" {
+		req.Record = json.RawMessage(record)
+	}
+	return &req, nil
+}
+
+func createDataSubjectRequest(ctx context.Context, db querier, req *models.DataSubjectRequest) error {
+	query := `INSERT INTO data_subject_request(subject_type, subject_id, action, reason, status, requested_by)
+		VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	req.Status = models.ExportStatusPending
+	return db.QueryRowContext(ctx, query, req.SubjectType, req.SubjectID, req.Action, req.Reason, req.Status, req.RequestedBy).
+		Scan(&req.ID, &req.CreatedAt)
+}
+
+func getDataSubjectRequest(ctx context.Context, db querier, id int64) (*models.DataSubjectRequest, error) {
+	req, err := scanDataSubjectRequest(db.QueryRowContext(ctx, "SELECT "+dataSubjectRequestColumns+" FROM data_subject_request WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return req, err
+}
+
+// claimDataSubjectRequest marca o pedido pendente mais antigo como em execução; lock é o "FOR UPDATE
+// SKIP LOCKED" do Postgres ou vazio no SQLite, que só tem um escritor por vez.
+func claimDataSubjectRequest(ctx context.Context, db querier, now, lock string) (*models.DataSubjectRequest, error) {
+	query := `UPDATE data_subject_request SET status = $1, started_at = ` + now + `
+		WHERE id = (SELECT id FROM data_subject_request WHERE status = $2 ORDER BY id ` + lock + ` LIMIT 1)
+		RETURNING ` + dataSubjectRequestColumns
+	req, err := scanDataSubjectRequest(db.QueryRowContext(ctx, query, models.ExportStatusRunning, models.ExportStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return req, err
+}
+
+func finishDataSubjectRequest(ctx context.Context, db querier, now string, req *models.DataSubjectRequest) error {
+	query := `UPDATE data_subject_request SET status = $1, location = $2, record = $3, error = $4, finished_at = ` + now + `
+		WHERE id = $5 RETURNING finished_at`
+	return db.QueryRowContext(ctx, query, req.Status, req.Location, string(req.Record), req.Error, req.ID).Scan(&req.FinishedAt)
+}
+
+// listDevicePhotos pagina pelo id as fotos do dispositivo, com a referência para a imagem.
+func listDevicePhotos(ctx context.Context, db querier, deviceID string, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	query := "SELECT " + storedPhotoColumns + " FROM photo WHERE device_id = $1 AND id > $2 ORDER BY id LIMIT $3"
+	rows, err := db.QueryContext(ctx, query, deviceID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []models.StoredPhoto{}
+	for rows.Next() {
+		p, err := scanStoredPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, *p)
+	}
+	return photos, rows.Err()
+}
+
+// listDriverDevices devolve os dispositivos em que o motorista foi reconhecido em alguma foto.
+func listDriverDevices(ctx context.Context, db querier, driverID string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT device_id FROM photo WHERE driver_id = $1 ORDER BY device_id", driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []string{}
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		devices = append(devices, deviceID)
+	}
+	return devices, rows.Err()
+}
+
+// eraseDriver apaga o cadastro do motorista e os rostos associados. driver_faces é apagada antes, sem
+// depender do ON DELETE CASCADE, que o SQLite só aplica com foreign_keys ligado.
+func eraseDriver(ctx context.Context, db querier, driverID string) (map[string]int64, error) {
+	statements := []struct{ table, query string }{
+		{"driver_faces", "DELETE FROM driver_faces WHERE driver_id = $1"},
+		{"drivers", "DELETE FROM drivers WHERE id = $1"},
+	}
+	counts := make(map[string]int64, len(statements))
+	for _, statement := range statements {
+		result, err := db.ExecContext(ctx, statement.query, driverID)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao apagar %s: %w", statement.table, err)
+		}
+		if counts[statement.table], err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// eraseDeviceData apaga as linhas do dispositivo e retorna quantas saíram de cada tabela. Quem chama
+// deve usar uma transação para que a eliminação seja completa ou nenhuma.
+func eraseDeviceData(ctx context.Context, db querier, deviceID string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(deviceDataTables))
+	for _, table := range deviceDataTables {
+		result, err := db.ExecContext(ctx, "DELETE FROM "+table+" WHERE device_id = $1", deviceID)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao apagar %s: %w", table, err)
+		}
+		if counts[table], err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// anonymizeDeviceData aplica anonymizeStatements e retorna quantas linhas mudaram em cada tabela.
+func anonymizeDeviceData(ctx context.Context, db querier, deviceID, pseudonym string) (map[string]int64, error) {
+	if pseudonym == "" || pseudonym == deviceID {
+		return nil, errors.New("pseudônimo inválido")
+	}
+	counts := make(map[string]int64, len(deviceDataTables))
+	for _, table := range deviceDataTables {
+		var result sql.Result
+		var err error
+		if statement, ok := anonymizeStatements[table]; ok {
+			result, err = db.ExecContext(ctx, statement, deviceID, pseudonym)
+		} else {
+			result, err = db.ExecContext(ctx, "DELETE FROM "+table+" WHERE device_id = $1", deviceID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("falha ao anonimizar %s: %w", table, err)
+		}
+		if counts[table], err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func (s *PostgresStorage) CreateDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	return createDataSubjectRequest(ctx, s.db, req)
+}
+
+func (s *PostgresStorage) GetDataSubjectRequest(ctx context.Context, id int64) (*models.DataSubjectRequest, error) {
+	return getDataSubjectRequest(ctx, s.db, id)
+}
+
+// ClaimDataSubjectRequest retorna nil quando não há pedidos pendentes.
+func (s *PostgresStorage) ClaimDataSubjectRequest(ctx context.Context) (*models.DataSubjectRequest, error) {
+	return claimDataSubjectRequest(ctx, s.db, "NOW()", "FOR UPDATE SKIP LOCKED")
+}
+
+func (s *PostgresStorage) FinishDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	return finishDataSubjectRequest(ctx, s.db, "NOW()", req)
+}
+
+func (s *PostgresStorage) ListDevicePhotos(ctx context.Context, deviceID string, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	return listDevicePhotos(ctx, s.db, deviceID, afterID, limit)
+}
+
+func (s *PostgresStorage) ListDriverDevices(ctx context.Context, driverID string) ([]string, error) {
+	return listDriverDevices(ctx, s.db, driverID)
+}
+
+func (s *PostgresStorage) EraseDriver(ctx context.Context, driverID string) (map[string]int64, error) {
+	return eraseDriver(ctx, s.db, driverID)
+}
+
+func (s *PostgresStorage) EraseDeviceData(ctx context.Context, deviceID string) (map[string]int64, error) {
+	return eraseDeviceData(ctx, s.db, deviceID)
+}
+
+func (s *PostgresStorage) AnonymizeDeviceData(ctx context.Context, deviceID, pseudonym string) (map[string]int64, error) {
+	return anonymizeDeviceData(ctx, s.db, deviceID, pseudonym)
+}
+
+func (s *SQLiteStorage) CreateDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	return createDataSubjectRequest(ctx, s.db, req)
+}
+
+func (s *SQLiteStorage) GetDataSubjectRequest(ctx context.Context, id int64) (*models.DataSubjectRequest, error) {
+	return getDataSubjectRequest(ctx, s.db, id)
+}
+
+func (s *SQLiteStorage) ClaimDataSubjectRequest(ctx context.Context) (*models.DataSubjectRequest, error) {
+	return claimDataSubjectRequest(ctx, s.db, sqliteNow, "")
+}
+
+func (s *SQLiteStorage) FinishDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error {
+	return finishDataSubjectRequest(ctx, s.db, sqliteNow, req)
+}
+
+func (s *SQLiteStorage) ListDevicePhotos(ctx context.Context, deviceID string, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	return listDevicePhotos(ctx, s.db, deviceID, afterID, limit)
+}
+
+func (s *SQLiteStorage) ListDriverDevices(ctx context.Context, driverID string) ([]string, error) {
+	return listDriverDevices(ctx, s.db, driverID)
+}
+
+func (s *SQLiteStorage) EraseDriver(ctx context.Context, driverID string) (map[string]int64, error) {
+	return eraseDriver(ctx, s.db, driverID)
+}
+
+func (s *SQLiteStorage) EraseDeviceData(ctx context.Context, deviceID string) (map[string]int64, error) {
+	return eraseDeviceData(ctx, s.db, deviceID)
+}
+
+func (s *SQLiteStorage) AnonymizeDeviceData(ctx context.Context, deviceID, pseudonym string) (map[string]int64, error) {
+	return anonymizeDeviceData(ctx, s.db, deviceID, pseudonym)
+}
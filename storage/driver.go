@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// As consultas de motoristas são as mesmas nos dois backends; só mudam o querier e a expressão de
+// "agora" (now).
+
+// saveDriver cria o motorista ou atualiza o nome de um já cadastrado.
+func saveDriver(ctx context.Context, db querier, now string, driver *models.Driver) error {
+	query := `INSERT INTO drivers(id, name) VALUES($1, $2)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, updated_at = ` + now + `
+		RETURNING created_at, updated_at`
+	return db.QueryRowContext(ctx, query, driver.ID, driver.Name).Scan(&driver.CreatedAt, &driver.UpdatedAt)
+}
+
+// addDriverFaces associa os rostos ao motorista. Associar de novo um rosto do mesmo motorista não muda
+// nada (nem a origem); um rosto de outro motorista interrompe com ErrFaceAssigned.
+func addDriverFaces(ctx context.Context, db querier, driverID, source string, faceIDs []string) error {
+	// O DO UPDATE sem efeito faz o RETURNING devolver também o dono de um rosto já associado.
+	query := `INSERT INTO driver_faces(face_id, driver_id, source) VALUES($1, $2, $3)
+		ON CONFLICT (face_id) DO UPDATE SET driver_id = driver_faces.driver_id RETURNING driver_id`
+	for _, faceID := range faceIDs {
+		var owner string
+		if err := db.QueryRowContext(ctx, query, faceID, driverID, source).Scan(&owner); err != nil {
+			return err
+		}
+		if owner != driverID {
+			return fmt.Errorf("%w: %s", ErrFaceAssigned, faceID)
+		}
+	}
+	return nil
+}
+
+func getDriver(ctx context.Context, db querier, id string) (*models.Driver, error) {
+	driver := models.Driver{ID: id, FaceIDs: []string{}}
+	err := db.QueryRowContext(ctx, "SELECT name, created_at, updated_at FROM drivers WHERE id = $1", id).
+		Scan(&driver.Name, &driver.CreatedAt, &driver.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT face_id FROM driver_faces WHERE driver_id = $1 ORDER BY created_at, face_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var faceID string
+		if err := rows.Scan(&faceID); err != nil {
+			return nil, err
+		}
+		driver.FaceIDs = append(driver.FaceIDs, faceID)
+	}
+	return &driver, rows.Err()
+}
+
+// listDriverFaces retorna ErrNotFound quando o motorista não existe.
+func listDriverFaces(ctx context.Context, db querier, driverID string) ([]models.DriverFace, error) {
+	var exists int
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM drivers WHERE id = $1", driverID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT face_id, driver_id, source, created_at FROM driver_faces
+		WHERE driver_id = $1 ORDER BY created_at, face_id`, driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	faces := []models.DriverFace{}
+	for rows.Next() {
+		var face models.DriverFace
+		if err := rows.Scan(&face.FaceID, &face.DriverID, &face.Source, &face.CreatedAt); err != nil {
+			return nil, err
+		}
+		faces = append(faces, face)
+	}
+	return faces, rows.Err()
+}
+
+func removeDriverFace(ctx context.Context, db querier, driverID, faceID string) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM driver_faces WHERE driver_id = $1 AND face_id = $2", driverID, faceID)
+	return expectAffected(result, err)
+}
+
+// resolveDriver prefere a associação explícita do FaceId; sem ela, o ExternalImageId identifica o
+// motorista quando é o id de um cadastrado.
+func resolveDriver(ctx context.Context, db querier, faceID, externalImageID string) (string, error) {
+	query := `SELECT driver_id, 0 AS priority FROM driver_faces WHERE face_id = $1
+		UNION ALL
+		SELECT id, 1 AS priority FROM drivers WHERE id = $2
+		ORDER BY priority LIMIT 1`
+	var driverID string
+	var priority int
+	err := db.QueryRowContext(ctx, query, faceID, externalImageID).Scan(&driverID, &priority)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return driverID, err
+}
+
+func (s *PostgresStorage) SaveDriver(ctx context.Context, driver *models.Driver) error {
+	return saveDriver(ctx, s.db, "NOW()", driver)
+}
+
+func (s *PostgresStorage) AddDriverFaces(ctx context.Context, driverID, source string, faceIDs []string) error {
+	return addDriverFaces(ctx, s.db, driverID, source, faceIDs)
+}
+
+func (s *PostgresStorage) ListDriverFaces(ctx context.Context, driverID string) ([]models.DriverFace, error) {
+	return listDriverFaces(ctx, s.db, driverID)
+}
+
+func (s *PostgresStorage) RemoveDriverFace(ctx context.Context, driverID, faceID string) error {
+	return removeDriverFace(ctx, s.db, driverID, faceID)
+}
+
+func (s *PostgresStorage) GetDriver(ctx context.Context, id string) (*models.Driver, error) {
+	return getDriver(ctx, s.db, id)
+}
+
+func (s *PostgresStorage) ResolveDriver(ctx context.Context, faceID, externalImageID string) (string, error) {
+	return resolveDriver(ctx, s.db, faceID, externalImageID)
+}
+
+func (s *SQLiteStorage) SaveDriver(ctx context.Context, driver *models.Driver) error {
+	return saveDriver(ctx, s.db, sqliteNow, driver)
+}
+
+func (s *SQLiteStorage) AddDriverFaces(ctx context.Context, driverID, source string, faceIDs []string) error {
+	return addDriverFaces(ctx, s.db, driverID, source, faceIDs)
+}
+
+func (s *SQLiteStorage) ListDriverFaces(ctx context.Context, driverID string) ([]models.DriverFace, error) {
+	return listDriverFaces(ctx, s.db, driverID)
+}
+
+func (s *SQLiteStorage) RemoveDriverFace(ctx context.Context, driverID, faceID string) error {
+	return removeDriverFace(ctx, s.db, driverID, faceID)
+}
+
+func (s *SQLiteStorage) GetDriver(ctx context.Context, id string) (*models.Driver, error) {
+	return getDriver(ctx, s.db, id)
+}
+
+func (s *SQLiteStorage) ResolveDriver(ctx context.Context, faceID, externalImageID string) (string, error) {
+	return resolveDriver(ctx, s.db, faceID, externalImageID)
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"challenge-v3/crypto"
+	"challenge-v3/geo"
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// As posições são gravadas e lidas do mesmo jeito nos dois backends; só muda o querier. Com um
+// LocationCipher configurado, latitude e longitude ficam nulas e a posição vai cifrada em location.
+// geohash é sempre preenchido, em claro.
+
+var gpsColumns = []string{"device_id", "latitude", "longitude", "timestamp", "speed", "heading", "location", "geohash"}
+
+const insertGPSQuery = `INSERT INTO gps(device_id, latitude, longitude, timestamp, speed, heading, location, geohash)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+
+// locationValues devolve latitude, longitude, location e geohash como vão para o banco.
+func locationValues(locations *crypto.LocationCipher, deviceID string, lat, lon float64) (any, any, []byte, string, error) {
+	hash := geo.Geohash(lat, lon, geo.CoarseGeohashPrecision)
+	if locations == nil {
+		return lat, lon, nil, hash, nil
+	}
+	sealed, err := locations.Seal(deviceID, lat, lon)
+	if err != nil {
+		return nil, nil, nil, "", fmt.Errorf("falha ao cifrar a posição: %w", err)
+	}
+	return nil, nil, sealed, hash, nil
+}
+
+// gpsRow segue a ordem de gpsColumns.
+func gpsRow(locations *crypto.LocationCipher, d *models.GPSData) ([]any, error) {
+	lat, lon, sealed, hash, err := locationValues(locations, d.DeviceID, *d.Latitude, *d.Longitude)
+	if err != nil {
+		return nil, err
+	}
+	return []any{d.DeviceID, lat, lon, d.Timestamp, d.Speed, d.Heading, sealed, hash}, nil
+}
+
+func saveGPS(ctx context.Context, db querier, locations *crypto.LocationCipher, data *models.GPSData) error {
+	row, err := gpsRow(locations, data)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, insertGPSQuery, row...)
+	return err
+}
+
+func saveOverspeedEvent(ctx context.Context, db querier, locations *crypto.LocationCipher, event *models.OverspeedEvent) error {
+	lat, lon, sealed, hash, err := locationValues(locations, event.DeviceID, event.Latitude, event.Longitude)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO overspeed_event(device_id, speed, speed_limit, latitude, longitude, timestamp, location, geohash)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = db.ExecContext(ctx, query, event.DeviceID, event.Speed, event.Limit, lat, lon, event.Timestamp, sealed, hash)
+	return err
+}
+
+// errNoPosition indica uma linha sem posição nenhuma, como as anonimizadas (ver anonymizeStatements).
+var errNoPosition = errors.New("linha sem posição")
+
+// openLocation devolve a posição em claro ou decifra location. Leituras gravadas antes de ligar a
+// cifragem continuam em claro e são lidas normalmente. Sem nenhuma das duas, retorna errNoPosition.
+func openLocation(locations *crypto.LocationCipher, deviceID string, lat, lon sql.NullFloat64, sealed []byte) (float64, float64, error) {
+	if sealed == nil {
+		if !lat.Valid || !lon.Valid {
+			return 0, 0, errNoPosition
+		}
+		return lat.Float64, lon.Float64, nil
+	}
+	if locations == nil {
+		return 0, 0, errors.New("posição cifrada e GPS_ENCRYPTION não configurado")
+	}
+	return locations.Open(deviceID, sealed)
+}
+
+// streamGPS decifra as posições que estiverem cifradas antes de entregá-las a fn. Linhas sem posição
+// (anonimizadas) são puladas, em vez de virarem leituras falsas em 0,0.
+func streamGPS(ctx context.Context, db querier, locations *crypto.LocationCipher, deviceID string, from, to time.Time, fn func(models.GPSData) error) error {
+	query := `SELECT device_id, latitude, longitude, timestamp, speed, heading, location FROM gps
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3 ORDER BY timestamp`
+	rows, err := db.QueryContext(ctx, query, deviceID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data models.GPSData
+		var lat, lon sql.NullFloat64
+		var sealed []byte
+		if err := rows.Scan(&data.DeviceID, &lat, &lon, &data.Timestamp, &data.Speed, &data.Heading, &sealed); err != nil {
+			return err
+		}
+		latitude, longitude, err := openLocation(locations, data.DeviceID, lat, lon, sealed)
+		if errors.Is(err, errNoPosition) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("falha ao ler a posição de %s em %s: %w", data.DeviceID, data.Timestamp.Format(time.RFC3339), err)
+		}
+		data.Latitude, data.Longitude = &latitude, &longitude
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// queryGPSAreas agrega as leituras por prefixo de geohash. Leituras gravadas antes da coluna existir
+// (geohash nulo) não entram.
+func queryGPSAreas(ctx context.Context, db querier, deviceID string, from, to time.Time, precision int) ([]models.GPSArea, error) {
+	query := `SELECT substr(geohash, 1, $4) AS cell, COUNT(*), COUNT(DISTINCT device_id), MIN(timestamp), MAX(timestamp)
+		FROM gps
+		WHERE geohash IS NOT NULL AND ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3
+		GROUP BY cell ORDER BY cell`
+	rows, err := db.QueryContext(ctx, query, deviceID, from, to, precision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	areas := []models.GPSArea{}
+	for rows.Next() {
+		var a models.GPSArea
+		if err := rows.Scan(&a.Geohash, &a.Points, &a.Devices, timestampDest{&a.FirstSeen}, timestampDest{&a.LastSeen}); err != nil {
+			return nil, err
+		}
+		areas = append(areas, a)
+	}
+	return areas, rows.Err()
+}
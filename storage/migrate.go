@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// sqliteMigrationFiles tem as mesmas versões de migrations/, reescritas no dialeto do SQLite.
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationFiles embed.FS
+
+// migrationLockID identifica o advisory lock das migrações; qualquer valor fixo serve, desde que
+// todos os processos usem o mesmo.
+const migrationLockID = 4711203301
+
+// Migration é um par de arquivos migrations/<versão>_<nome>.up.sql e .down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("nome de migração inválido: %s", entry.Name())
+		}
+		rawVersion, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("versão de migração inválida: %s", entry.Name())
+		}
+		content, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migração %d com nomes diferentes: %s e %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migração %d_%s precisa dos arquivos up e down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// migrator aplica as migrações de um backend. Cada backend informa onde estão os seus arquivos, o DDL
+// da tabela schema_migrations e como impedir que dois processos migrem o mesmo banco ao mesmo tempo.
+type migrator struct {
+	pool        *sql.DB
+	files       fs.FS
+	dir         string
+	createTable string
+	// lock, quando definido, é obtido na conexão usada pelas migrações; o unlock retornado é sempre chamado.
+	lock func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+}
+
+func (s *PostgresStorage) migrator() *migrator {
+	return &migrator{
+		pool:  s.pool,
+		files: migrationFiles,
+		dir:   "migrations",
+		createTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);`,
+		lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+			if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+				return nil, fmt.Errorf("falha ao obter o lock de migrações: %w", err)
+			}
+			// O lock é liberado mesmo com ctx cancelado, senão a conexão voltaria ao pool ainda com ele.
+			return func() { conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID) }, nil
+		},
+	}
+}
+
+// withLock executa fn com o lock das migrações, para que vários workers iniciando ao mesmo tempo não
+// apliquem a mesma migração. O lock é de sessão, então tudo roda na mesma conexão.
+func (mg *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]time.Time) error) error {
+	conn, err := mg.pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if mg.lock != nil {
+		unlock, err := mg.lock(ctx, conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if _, err := conn.ExecContext(ctx, mg.createTable); err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = appliedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// runMigrationStep executa o SQL de uma migração e atualiza schema_migrations na mesma transação.
+func runMigrationStep(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrate aplica, em ordem, todas as migrações ainda não aplicadas e retorna quantas foram executadas.
+func (s *PostgresStorage) Migrate(ctx context.Context) (int, error) {
+	return s.migrator().migrate(ctx)
+}
+
+// Rollback desfaz as últimas steps migrações aplicadas, da mais nova para a mais antiga.
+func (s *PostgresStorage) Rollback(ctx context.Context, steps int) (int, error) {
+	return s.migrator().rollback(ctx, steps)
+}
+
+// MigrationStatus lista as migrações conhecidas pelo binário e quando cada uma foi aplicada.
+func (s *PostgresStorage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return s.migrator().status(ctx)
+}
+
+func (mg *migrator) migrate(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(mg.files, mg.dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = mg.withLock(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			start := time.Now()
+			err := runMigrationStep(ctx, conn, m.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("falha na migração %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("migração aplicada", "version", m.Version, "name", m.Name, "duration", time.Since(start).String())
+			count++
+		}
+		if len(migrations) > 0 {
+			latest := migrations[len(migrations)-1].Version
+			for version := range applied {
+				if version > latest {
+					slog.Warn("o banco tem migrações mais novas que este binário", "version", version, "latest_known", latest)
+				}
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (mg *migrator) rollback(ctx context.Context, steps int) (int, error) {
+	migrations, err := loadMigrations(mg.files, mg.dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = mg.withLock(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err := runMigrationStep(ctx, conn, m.Down, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			if err != nil {
+				return fmt.Errorf("falha ao desfazer a migração %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("migração desfeita", "version", m.Version, "name", m.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (mg *migrator) status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(mg.files, mg.dir)
+	if err != nil {
+		return nil, err
+	}
+	var status []MigrationStatus
+	err = mg.withLock(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, m := range migrations {
+			entry := MigrationStatus{Version: m.Version, Name: m.Name}
+			if appliedAt, ok := applied[m.Version]; ok {
+				entry.AppliedAt = &appliedAt
+			}
+			status = append(status, entry)
+		}
+		return nil
+	})
+	return status, err
+}
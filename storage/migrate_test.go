@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "baseline", migrations[0].Name)
+	for i := 1; i < len(migrations); i++ {
+		assert.Greater(t, migrations[i].Version, migrations[i-1].Version)
+	}
+}
+
+func TestLoadMigrations_OrdersAndValidates(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0010_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON b (c);")},
+		"migrations/0010_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+		"migrations/0002_init.up.sql":        {Data: []byte("CREATE TABLE b (c INT);")},
+		"migrations/0002_init.down.sql":      {Data: []byte("DROP TABLE b;")},
+	}
+	migrations, err := loadMigrations(files, "migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, "add_index", migrations[1].Name)
+	assert.Equal(t, "DROP INDEX a;", migrations[1].Down)
+
+	delete(files, "migrations/0010_add_index.down.sql")
+	_, err = loadMigrations(files, "migrations")
+	assert.Error(t, err, "migração sem down deve ser rejeitada")
+
+	files["migrations/abc_x.up.sql"] = &fstest.MapFile{Data: []byte("")}
+	_, err = loadMigrations(files, "migrations")
+	assert.Error(t, err)
+}
+
+func TestLoadMigrations_BackendsInSync(t *testing.T) {
+	postgres, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	sqlite, err := loadMigrations(sqliteMigrationFiles, "migrations/sqlite")
+	require.NoError(t, err)
+
+	require.Len(t, sqlite, len(postgres), "cada migração precisa existir nos dois dialetos")
+	for i := range postgres {
+		assert.Equal(t, postgres[i].Version, sqlite[i].Version)
+		assert.Equal(t, postgres[i].Name, sqlite[i].Name)
+	}
+}
+
+func TestSQLiteStorage_MigrateRollbackAndStatus(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "migrations.db"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	migrations, err := loadMigrations(sqliteMigrationFiles, "migrations/sqlite")
+	require.NoError(t, err)
+
+	applied, err := storage.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), applied)
+	applied, err = storage.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied, "migrações já aplicadas não rodam de novo")
+
+	status, err := storage.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, len(migrations))
+	assert.NotNil(t, status[len(status)-1].AppliedAt)
+
+	rolledBack, err := storage.Rollback(ctx, len(migrations))
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), rolledBack)
+	status, err = storage.MigrationStatus(ctx)
+	require.NoError(t, err)
+	for _, m := range status {
+		assert.Nil(t, m.AppliedAt)
+	}
+}
@@ -0,0 +1,168 @@
+-- Esquema equivalente ao antigo InitTables. Tudo usa IF NOT EXISTS para que bancos criados por ele sejam
+-- adotados sem alterações. Tabelas de telemetria ainda sem particionamento são convertidas: a tabela antiga
+-- vira a partição <tabela>_legacy, com todos os dados até o mês seguinte ao registro mais recente.
+SET LOCAL TIME ZONE 'UTC';
+
+ALTER TABLE IF EXISTS gps
+    ADD COLUMN IF NOT EXISTS speed REAL,
+    ADD COLUMN IF NOT EXISTS heading REAL;
+
+DO $$
+DECLARE
+    tbl TEXT;
+    idx TEXT;
+BEGIN
+    FOREACH tbl IN ARRAY ARRAY['gyroscope', 'gps', 'photo', 'audit_log'] LOOP
+        IF EXISTS (SELECT 1 FROM pg_class WHERE oid = to_regclass(tbl) AND relkind = 'r') THEN
+            RAISE NOTICE 'convertendo % para particionamento por tempo', tbl;
+            EXECUTE format('LOCK TABLE %I IN ACCESS EXCLUSIVE MODE', tbl);
+            -- Libera os nomes dos índices para os índices da tabela particionada.
+            FOR idx IN SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = tbl LOOP
+                EXECUTE format('ALTER INDEX %I RENAME TO %I', idx, tbl || '_legacy_' || regexp_replace(idx, '^' || tbl || '_', ''));
+            END LOOP;
+            EXECUTE format('ALTER TABLE %I RENAME TO %I', tbl, tbl || '_legacy');
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN id TYPE BIGINT', tbl || '_legacy');
+        END IF;
+    END LOOP;
+END $$;
+
+CREATE TABLE IF NOT EXISTS gyroscope (
+    id BIGSERIAL,
+    device_id TEXT NOT NULL,
+    x REAL NOT NULL,
+    y REAL NOT NULL,
+    z REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE TABLE IF NOT EXISTS gps (
+    id BIGSERIAL,
+    device_id TEXT NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    speed REAL,
+    heading REAL,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE TABLE IF NOT EXISTS photo (
+    id BIGSERIAL,
+    device_id TEXT NOT NULL,
+    photo TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    recognized BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    details JSONB,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+DO $$
+DECLARE
+    tbl TEXT;
+    max_ts TIMESTAMP;
+    max_id BIGINT;
+    bound TIMESTAMP;
+BEGIN
+    FOREACH tbl IN ARRAY ARRAY['gyroscope', 'gps', 'photo', 'audit_log'] LOOP
+        IF EXISTS (SELECT 1 FROM pg_class WHERE oid = to_regclass(tbl || '_legacy') AND NOT relispartition) THEN
+            EXECUTE format('SELECT MAX(timestamp), MAX(id) FROM %I', tbl || '_legacy') INTO max_ts, max_id;
+            bound := date_trunc('month', GREATEST(COALESCE(max_ts, LOCALTIMESTAMP), LOCALTIMESTAMP)) + INTERVAL '1 month';
+            EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (MINVALUE) TO (%L)', tbl, tbl || '_legacy', bound);
+            IF max_id IS NOT NULL THEN
+                PERFORM setval(pg_get_serial_sequence(tbl, 'id'), max_id);
+            END IF;
+        END IF;
+    END LOOP;
+END $$;
+
+CREATE TABLE IF NOT EXISTS gyroscope_default PARTITION OF gyroscope DEFAULT;
+CREATE TABLE IF NOT EXISTS gps_default PARTITION OF gps DEFAULT;
+CREATE TABLE IF NOT EXISTS photo_default PARTITION OF photo DEFAULT;
+CREATE TABLE IF NOT EXISTS audit_log_default PARTITION OF audit_log DEFAULT;
+
+CREATE TABLE IF NOT EXISTS overspeed_event (
+    id SERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    speed REAL NOT NULL,
+    speed_limit REAL NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS export_job (
+    id SERIAL PRIMARY KEY,
+    dataset TEXT NOT NULL,
+    format TEXT NOT NULL,
+    device_id TEXT NOT NULL DEFAULT '',
+    from_ts TIMESTAMP NOT NULL,
+    to_ts TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    row_count BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS export_job_schedule_idx ON export_job (dataset, format, from_ts, to_ts)
+    WHERE requested_by = 'scheduler';
+
+CREATE TABLE IF NOT EXISTS telemetry_rollup_minute (
+    device_id TEXT NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    gps_points BIGINT NOT NULL DEFAULT 0,
+    distance_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min_lat DOUBLE PRECISION,
+    max_lat DOUBLE PRECISION,
+    min_lon DOUBLE PRECISION,
+    max_lon DOUBLE PRECISION,
+    gyro_points BIGINT NOT NULL DEFAULT 0,
+    gyro_min DOUBLE PRECISION,
+    gyro_max DOUBLE PRECISION,
+    gyro_sum DOUBLE PRECISION,
+    PRIMARY KEY (device_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS telemetry_rollup_hour (
+    device_id TEXT NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    gps_points BIGINT NOT NULL DEFAULT 0,
+    distance_m DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min_lat DOUBLE PRECISION,
+    max_lat DOUBLE PRECISION,
+    min_lon DOUBLE PRECISION,
+    max_lon DOUBLE PRECISION,
+    gyro_points BIGINT NOT NULL DEFAULT 0,
+    gyro_min DOUBLE PRECISION,
+    gyro_max DOUBLE PRECISION,
+    gyro_sum DOUBLE PRECISION,
+    PRIMARY KEY (device_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS rollup_state (
+    name TEXT PRIMARY KEY,
+    watermark TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS gps_device_timestamp_idx ON gps (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS gps_timestamp_idx ON gps (timestamp);
+CREATE INDEX IF NOT EXISTS gyroscope_timestamp_idx ON gyroscope (timestamp);
+CREATE INDEX IF NOT EXISTS gyroscope_device_timestamp_idx ON gyroscope (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS photo_timestamp_idx ON photo (timestamp);
+CREATE INDEX IF NOT EXISTS overspeed_event_timestamp_idx ON overspeed_event (timestamp);
+CREATE INDEX IF NOT EXISTS audit_log_timestamp_idx ON audit_log (timestamp);
+CREATE INDEX IF NOT EXISTS export_job_created_at_idx ON export_job (created_at);
+CREATE INDEX IF NOT EXISTS telemetry_rollup_minute_bucket_idx ON telemetry_rollup_minute (bucket);
+CREATE INDEX IF NOT EXISTS telemetry_rollup_hour_bucket_idx ON telemetry_rollup_hour (bucket);
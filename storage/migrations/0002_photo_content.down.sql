@@ -0,0 +1,12 @@
+-- As fotos que já estão no armazenamento de blobs não cabem no esquema antigo: as linhas são apagadas,
+-- mas os objetos continuam no bucket/diretório.
+DROP INDEX IF EXISTS photo_legacy_idx;
+DELETE FROM photo WHERE photo IS NULL;
+
+ALTER TABLE photo
+    DROP COLUMN IF EXISTS content_key,
+    DROP COLUMN IF EXISTS content_size,
+    DROP COLUMN IF EXISTS content_sha256,
+    DROP COLUMN IF EXISTS encryption;
+
+ALTER TABLE photo ALTER COLUMN photo SET NOT NULL;
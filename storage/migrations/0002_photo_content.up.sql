@@ -0,0 +1,11 @@
+-- A imagem sai da coluna photo e vai para o armazenamento de blobs; a linha guarda só a referência.
+-- As linhas antigas mantêm a coluna photo preenchida até o worker movê-las (ver services.PhotoMigrationService).
+ALTER TABLE photo ALTER COLUMN photo DROP NOT NULL;
+
+ALTER TABLE photo
+    ADD COLUMN IF NOT EXISTS content_key TEXT,
+    ADD COLUMN IF NOT EXISTS content_size BIGINT,
+    ADD COLUMN IF NOT EXISTS content_sha256 TEXT,
+    ADD COLUMN IF NOT EXISTS encryption TEXT;
+
+CREATE INDEX IF NOT EXISTS photo_legacy_idx ON photo (id) WHERE photo IS NOT NULL;
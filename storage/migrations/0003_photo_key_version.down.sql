@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS photo_key_version_idx;
+ALTER TABLE photo DROP COLUMN IF EXISTS key_version;
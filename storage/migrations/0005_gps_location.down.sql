@@ -0,0 +1,16 @@
+-- As leituras com a posição cifrada não cabem no esquema antigo e são apagadas.
+DROP INDEX IF EXISTS gps_geohash_timestamp_idx;
+
+DELETE FROM gps WHERE latitude IS NULL OR longitude IS NULL;
+ALTER TABLE gps
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS geohash,
+    ALTER COLUMN latitude SET NOT NULL,
+    ALTER COLUMN longitude SET NOT NULL;
+
+DELETE FROM overspeed_event WHERE latitude IS NULL OR longitude IS NULL;
+ALTER TABLE overspeed_event
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS geohash,
+    ALTER COLUMN latitude SET NOT NULL,
+    ALTER COLUMN longitude SET NOT NULL;
@@ -0,0 +1,16 @@
+-- Cifragem opcional das coordenadas (GPS_ENCRYPTION): com ela ligada, latitude e longitude ficam nulas e a
+-- posição vai cifrada em location (envelope de crypto.LocationCipher). geohash fica sempre em claro, com
+-- precisão de cerca de 1 km, para as consultas agregadas por região.
+ALTER TABLE gps
+    ALTER COLUMN latitude DROP NOT NULL,
+    ALTER COLUMN longitude DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS location BYTEA,
+    ADD COLUMN IF NOT EXISTS geohash TEXT;
+
+ALTER TABLE overspeed_event
+    ALTER COLUMN latitude DROP NOT NULL,
+    ALTER COLUMN longitude DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS location BYTEA,
+    ADD COLUMN IF NOT EXISTS geohash TEXT;
+
+CREATE INDEX IF NOT EXISTS gps_geohash_timestamp_idx ON gps (geohash, timestamp);
@@ -0,0 +1,15 @@
+-- Encadeamento do audit_log: cada linha guarda o hash da anterior (prev_hash), o próprio hash e o HMAC
+-- dele com AUDIT_HMAC_KEY. audit_chain_head tem uma linha só, com a última posição da cadeia; ela é
+-- travada em cada gravação para que as posições não se repitam. Linhas anteriores ficam com seq nulo.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS prev_hash BYTEA;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS hash BYTEA;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS hmac BYTEA;
+CREATE INDEX IF NOT EXISTS audit_log_seq_idx ON audit_log (seq);
+
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    seq BIGINT NOT NULL,
+    hash BYTEA NOT NULL
+);
+INSERT INTO audit_chain_head (id, seq, hash) VALUES (1, 0, decode(repeat('00', 32), 'hex')) ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS photo_driver_timestamp_idx;
+
+ALTER TABLE photo
+    DROP COLUMN IF EXISTS similarity,
+    DROP COLUMN IF EXISTS face_id,
+    DROP COLUMN IF EXISTS driver_id;
+
+DROP TABLE IF EXISTS driver_faces;
+DROP TABLE IF EXISTS drivers;
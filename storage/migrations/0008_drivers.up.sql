@@ -0,0 +1,25 @@
+-- Cadastro de motoristas. driver_faces associa os FaceIds da coleção do Rekognition ao motorista; um
+-- rosto indexado com ExternalImageId igual ao id do motorista também o identifica, sem linha aqui.
+CREATE TABLE IF NOT EXISTS drivers (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS driver_faces (
+    face_id TEXT PRIMARY KEY,
+    driver_id TEXT NOT NULL REFERENCES drivers (id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS driver_faces_driver_idx ON driver_faces (driver_id);
+
+-- O rosto reconhecido em cada foto. driver_id fica vazio quando o rosto não está associado a um motorista
+-- e não referencia drivers: a foto continua dizendo quem estava ao volante mesmo se o cadastro mudar.
+ALTER TABLE photo
+    ADD COLUMN IF NOT EXISTS driver_id TEXT,
+    ADD COLUMN IF NOT EXISTS face_id TEXT,
+    ADD COLUMN IF NOT EXISTS similarity DOUBLE PRECISION;
+
+CREATE INDEX IF NOT EXISTS photo_driver_timestamp_idx ON photo (driver_id, timestamp) WHERE driver_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE driver_faces DROP COLUMN IF EXISTS source;
@@ -0,0 +1,3 @@
+-- Origem de cada rosto do motorista: 'enrolled' para as fotos de referência indexadas pelo cadastro
+-- (POST /drivers/{id}/faces) e 'associated' para rostos que já estavam na coleção.
+ALTER TABLE driver_faces ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'associated';
@@ -0,0 +1,10 @@
+-- Remove todo o esquema, inclusive os dados.
+DROP TABLE IF EXISTS rollup_state;
+DROP TABLE IF EXISTS telemetry_rollup_hour;
+DROP TABLE IF EXISTS telemetry_rollup_minute;
+DROP TABLE IF EXISTS export_job;
+DROP TABLE IF EXISTS overspeed_event;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS photo;
+DROP TABLE IF EXISTS gps;
+DROP TABLE IF EXISTS gyroscope;
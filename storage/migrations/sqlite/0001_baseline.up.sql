@@ -0,0 +1,114 @@
+-- Mesmo esquema de migrations/0001_baseline.up.sql no dialeto do SQLite. Não há particionamento; os
+-- instantes são gravados como texto UTC de largura fixa (ver sqliteTimeLayout), que ordena como o tempo.
+CREATE TABLE IF NOT EXISTS gyroscope (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    x REAL NOT NULL,
+    y REAL NOT NULL,
+    z REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS gps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    speed REAL,
+    heading REAL
+);
+
+CREATE TABLE IF NOT EXISTS photo (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    photo TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    recognized BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now')),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    details TEXT
+);
+
+CREATE TABLE IF NOT EXISTS overspeed_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    speed REAL NOT NULL,
+    speed_limit REAL NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS export_job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    dataset TEXT NOT NULL,
+    format TEXT NOT NULL,
+    device_id TEXT NOT NULL DEFAULT '',
+    from_ts TIMESTAMP NOT NULL,
+    to_ts TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    row_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now')),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS export_job_schedule_idx ON export_job (dataset, format, from_ts, to_ts)
+    WHERE requested_by = 'scheduler';
+
+CREATE TABLE IF NOT EXISTS telemetry_rollup_minute (
+    device_id TEXT NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    gps_points INTEGER NOT NULL DEFAULT 0,
+    distance_m REAL NOT NULL DEFAULT 0,
+    min_lat REAL,
+    max_lat REAL,
+    min_lon REAL,
+    max_lon REAL,
+    gyro_points INTEGER NOT NULL DEFAULT 0,
+    gyro_min REAL,
+    gyro_max REAL,
+    gyro_sum REAL,
+    PRIMARY KEY (device_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS telemetry_rollup_hour (
+    device_id TEXT NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    gps_points INTEGER NOT NULL DEFAULT 0,
+    distance_m REAL NOT NULL DEFAULT 0,
+    min_lat REAL,
+    max_lat REAL,
+    min_lon REAL,
+    max_lon REAL,
+    gyro_points INTEGER NOT NULL DEFAULT 0,
+    gyro_min REAL,
+    gyro_max REAL,
+    gyro_sum REAL,
+    PRIMARY KEY (device_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS rollup_state (
+    name TEXT PRIMARY KEY,
+    watermark TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS gps_device_timestamp_idx ON gps (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS gps_timestamp_idx ON gps (timestamp);
+CREATE INDEX IF NOT EXISTS gyroscope_timestamp_idx ON gyroscope (timestamp);
+CREATE INDEX IF NOT EXISTS gyroscope_device_timestamp_idx ON gyroscope (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS photo_timestamp_idx ON photo (timestamp);
+CREATE INDEX IF NOT EXISTS overspeed_event_timestamp_idx ON overspeed_event (timestamp);
+CREATE INDEX IF NOT EXISTS audit_log_timestamp_idx ON audit_log (timestamp);
+CREATE INDEX IF NOT EXISTS export_job_created_at_idx ON export_job (created_at);
+CREATE INDEX IF NOT EXISTS telemetry_rollup_minute_bucket_idx ON telemetry_rollup_minute (bucket);
+CREATE INDEX IF NOT EXISTS telemetry_rollup_hour_bucket_idx ON telemetry_rollup_hour (bucket);
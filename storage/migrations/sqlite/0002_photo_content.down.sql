@@ -0,0 +1,17 @@
+-- As fotos que já estão no armazenamento de blobs não cabem no esquema antigo: as linhas são apagadas,
+-- mas os objetos continuam no diretório.
+CREATE TABLE photo_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    photo TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    recognized BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO photo_old (id, device_id, photo, timestamp, recognized)
+    SELECT id, device_id, photo, timestamp, recognized FROM photo WHERE photo IS NOT NULL;
+
+DROP TABLE photo;
+ALTER TABLE photo_old RENAME TO photo;
+
+CREATE INDEX IF NOT EXISTS photo_timestamp_idx ON photo (timestamp);
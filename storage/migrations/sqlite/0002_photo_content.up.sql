@@ -0,0 +1,21 @@
+-- O SQLite não remove NOT NULL de uma coluna, então a tabela é recriada.
+CREATE TABLE photo_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    photo TEXT,
+    timestamp TIMESTAMP NOT NULL,
+    recognized BOOLEAN NOT NULL DEFAULT FALSE,
+    content_key TEXT,
+    content_size INTEGER,
+    content_sha256 TEXT,
+    encryption TEXT
+);
+
+INSERT INTO photo_new (id, device_id, photo, timestamp, recognized)
+    SELECT id, device_id, photo, timestamp, recognized FROM photo;
+
+DROP TABLE photo;
+ALTER TABLE photo_new RENAME TO photo;
+
+CREATE INDEX IF NOT EXISTS photo_timestamp_idx ON photo (timestamp);
+CREATE INDEX IF NOT EXISTS photo_legacy_idx ON photo (id) WHERE photo IS NOT NULL;
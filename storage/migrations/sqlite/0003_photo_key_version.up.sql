@@ -0,0 +1,5 @@
+-- Versão da chave do envelope de cada foto; NULL para objetos sem envelope (formato antigo ou sem
+-- criptografia). O job de re-cifragem busca as linhas abaixo da versão atual por este índice.
+ALTER TABLE photo ADD COLUMN key_version INTEGER;
+
+CREATE INDEX IF NOT EXISTS photo_key_version_idx ON photo (key_version, id) WHERE content_key IS NOT NULL;
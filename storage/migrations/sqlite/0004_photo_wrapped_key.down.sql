@@ -0,0 +1,2 @@
+-- As fotos cifradas com chave de dados ficam ilegíveis sem esta coluna.
+ALTER TABLE photo DROP COLUMN wrapped_key;
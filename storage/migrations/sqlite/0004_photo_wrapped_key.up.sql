@@ -0,0 +1,3 @@
+-- Chave de dados da foto, embrulhada pelo provedor de chaves (crypto.KeyProvider). A imagem no
+-- armazenamento de blobs é cifrada com ela; key_version passa a ser a versão da chave mestra que a embrulhou.
+ALTER TABLE photo ADD COLUMN wrapped_key BLOB;
@@ -0,0 +1,39 @@
+-- As leituras com a posição cifrada não cabem no esquema antigo e são apagadas.
+CREATE TABLE gps_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL,
+    speed REAL,
+    heading REAL
+);
+
+INSERT INTO gps_old (id, device_id, latitude, longitude, timestamp, speed, heading)
+    SELECT id, device_id, latitude, longitude, timestamp, speed, heading FROM gps
+    WHERE latitude IS NOT NULL AND longitude IS NOT NULL;
+
+DROP TABLE gps;
+ALTER TABLE gps_old RENAME TO gps;
+
+CREATE INDEX IF NOT EXISTS gps_device_timestamp_idx ON gps (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS gps_timestamp_idx ON gps (timestamp);
+
+CREATE TABLE overspeed_event_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    speed REAL NOT NULL,
+    speed_limit REAL NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    timestamp TIMESTAMP NOT NULL
+);
+
+INSERT INTO overspeed_event_old (id, device_id, speed, speed_limit, latitude, longitude, timestamp)
+    SELECT id, device_id, speed, speed_limit, latitude, longitude, timestamp FROM overspeed_event
+    WHERE latitude IS NOT NULL AND longitude IS NOT NULL;
+
+DROP TABLE overspeed_event;
+ALTER TABLE overspeed_event_old RENAME TO overspeed_event;
+
+CREATE INDEX IF NOT EXISTS overspeed_event_timestamp_idx ON overspeed_event (timestamp);
@@ -0,0 +1,45 @@
+-- Cifragem opcional das coordenadas (GPS_ENCRYPTION): com ela ligada, latitude e longitude ficam nulas e a
+-- posição vai cifrada em location (envelope de crypto.LocationCipher). geohash fica sempre em claro, com
+-- precisão de cerca de 1 km, para as consultas agregadas por região.
+-- O SQLite não remove NOT NULL de uma coluna, então as tabelas são recriadas.
+CREATE TABLE gps_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    latitude REAL,
+    longitude REAL,
+    timestamp TIMESTAMP NOT NULL,
+    speed REAL,
+    heading REAL,
+    location BLOB,
+    geohash TEXT
+);
+
+INSERT INTO gps_new (id, device_id, latitude, longitude, timestamp, speed, heading)
+    SELECT id, device_id, latitude, longitude, timestamp, speed, heading FROM gps;
+
+DROP TABLE gps;
+ALTER TABLE gps_new RENAME TO gps;
+
+CREATE INDEX IF NOT EXISTS gps_device_timestamp_idx ON gps (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS gps_timestamp_idx ON gps (timestamp);
+CREATE INDEX IF NOT EXISTS gps_geohash_timestamp_idx ON gps (geohash, timestamp);
+
+CREATE TABLE overspeed_event_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    speed REAL NOT NULL,
+    speed_limit REAL NOT NULL,
+    latitude REAL,
+    longitude REAL,
+    timestamp TIMESTAMP NOT NULL,
+    location BLOB,
+    geohash TEXT
+);
+
+INSERT INTO overspeed_event_new (id, device_id, speed, speed_limit, latitude, longitude, timestamp)
+    SELECT id, device_id, speed, speed_limit, latitude, longitude, timestamp FROM overspeed_event;
+
+DROP TABLE overspeed_event;
+ALTER TABLE overspeed_event_new RENAME TO overspeed_event;
+
+CREATE INDEX IF NOT EXISTS overspeed_event_timestamp_idx ON overspeed_event (timestamp);
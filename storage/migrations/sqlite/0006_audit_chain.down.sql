@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS audit_chain_head;
+DROP INDEX IF EXISTS audit_log_seq_idx;
+ALTER TABLE audit_log DROP COLUMN seq;
+ALTER TABLE audit_log DROP COLUMN prev_hash;
+ALTER TABLE audit_log DROP COLUMN hash;
+ALTER TABLE audit_log DROP COLUMN hmac;
@@ -0,0 +1,15 @@
+-- Encadeamento do audit_log: cada linha guarda o hash da anterior (prev_hash), o próprio hash e o HMAC
+-- dele com AUDIT_HMAC_KEY. audit_chain_head tem uma linha só, com a última posição da cadeia; ela é
+-- travada em cada gravação para que as posições não se repitam. Linhas anteriores ficam com seq nulo.
+ALTER TABLE audit_log ADD COLUMN seq INTEGER;
+ALTER TABLE audit_log ADD COLUMN prev_hash BLOB;
+ALTER TABLE audit_log ADD COLUMN hash BLOB;
+ALTER TABLE audit_log ADD COLUMN hmac BLOB;
+CREATE INDEX IF NOT EXISTS audit_log_seq_idx ON audit_log (seq);
+
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    seq INTEGER NOT NULL,
+    hash BLOB NOT NULL
+);
+INSERT OR IGNORE INTO audit_chain_head (id, seq, hash) VALUES (1, 0, zeroblob(32));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS overspeed_event_device_idx;
+DROP INDEX IF EXISTS photo_device_timestamp_idx;
+DROP TABLE IF EXISTS data_subject_request;
@@ -0,0 +1,21 @@
+-- Pedidos de titulares (LGPD): exportação, eliminação ou anonimização dos dados de um dispositivo,
+-- executados pelo worker. record guarda o registro de conclusão assinado.
+CREATE TABLE IF NOT EXISTS data_subject_request (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    record TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now')),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- A eliminação seleciona as linhas pelo dispositivo, sem intervalo de datas.
+CREATE INDEX IF NOT EXISTS photo_device_timestamp_idx ON photo (device_id, timestamp);
+CREATE INDEX IF NOT EXISTS overspeed_event_device_idx ON overspeed_event (device_id);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS photo_driver_timestamp_idx;
+
+ALTER TABLE photo DROP COLUMN similarity;
+ALTER TABLE photo DROP COLUMN face_id;
+ALTER TABLE photo DROP COLUMN driver_id;
+
+DROP TABLE IF EXISTS driver_faces;
+DROP TABLE IF EXISTS drivers;
@@ -0,0 +1,24 @@
+-- Cadastro de motoristas. driver_faces associa os FaceIds da coleção do Rekognition ao motorista; um
+-- rosto indexado com ExternalImageId igual ao id do motorista também o identifica, sem linha aqui.
+CREATE TABLE IF NOT EXISTS drivers (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS driver_faces (
+    face_id TEXT PRIMARY KEY,
+    driver_id TEXT NOT NULL REFERENCES drivers (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS driver_faces_driver_idx ON driver_faces (driver_id);
+
+-- O rosto reconhecido em cada foto. driver_id fica vazio quando o rosto não está associado a um motorista
+-- e não referencia drivers: a foto continua dizendo quem estava ao volante mesmo se o cadastro mudar.
+ALTER TABLE photo ADD COLUMN driver_id TEXT;
+ALTER TABLE photo ADD COLUMN face_id TEXT;
+ALTER TABLE photo ADD COLUMN similarity REAL;
+
+CREATE INDEX IF NOT EXISTS photo_driver_timestamp_idx ON photo (driver_id, timestamp) WHERE driver_id IS NOT NULL;
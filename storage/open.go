@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"challenge-v3/crypto"
+	"context"
+	"fmt"
+	"os"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
+
+// Backend é um Storage que também gerencia o próprio esquema.
+type Backend interface {
+	Storage
+	Migrate(ctx context.Context) (int, error)
+	Rollback(ctx context.Context, steps int) (int, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	SetLocationCipher(locations *crypto.LocationCipher)
+	SetAuditKey(key []byte)
+}
+
+// OpenFromEnv abre o backend escolhido por STORAGE_BACKEND: postgres (padrão, configurado por DB_HOST,
+// DB_PORT, DB_USER, DB_PASSWORD e DB_NAME) ou sqlite (arquivo em SQLITE_PATH).
+func OpenFromEnv() (Backend, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", BackendPostgres:
+		connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+		db, err := NewPostgresStorage(connStr)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case BackendSQLite:
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "challenge.db"
+		}
+		db, err := NewSQLiteStorage(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND inválido: %s", backend)
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// partitionedTables são particionadas por mês na coluna timestamp (ver migrations/0001_baseline.up.sql).
+var partitionedTables = []string{"gyroscope", "gps", "photo", "audit_log"}
+
+// PartitionedTables lista as tabelas particionadas por tempo.
+func PartitionedTables() []string {
+	return slices.Clone(partitionedTables)
+}
+
+const partitionSuffixLayout = "200601"
+
+// PartitionsAhead é quantos meses à frente ficam com partição criada.
+const PartitionsAhead = 3
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(table string, month time.Time) string {
+	return table + "_p" + month.Format(partitionSuffixLayout)
+}
+
+// partitionBound é o literal usado nos limites das partições; o "+00" é ignorado nas colunas sem fuso.
+func partitionBound(t time.Time) string {
+	return "'" + t.UTC().Format("2006-01-02 15:04:05") + "+00'"
+}
+
+// EnsurePartitions cria as partições mensais de table de from até months meses à frente, além da partição
+// padrão que recebe leituras fora desse intervalo (ex.: relógio do dispositivo errado). Meses já cobertos
+// pela partição _legacy são ignorados.
+func (s *PostgresStorage) EnsurePartitions(ctx context.Context, table string, from time.Time, months int) error {
+	defaultPartition := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_default PARTITION OF %s DEFAULT", table, table)
+	if _, err := s.db.ExecContext(ctx, defaultPartition); err != nil {
+		return err
+	}
+	month := monthStart(from)
+	for i := 0; i <= months; i++ {
+		err := s.createMonthPartition(ctx, table, month)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && (pqErr.Code == "42P17" || pqErr.Code == "42P07") {
+			// Sobrepõe outra partição (normalmente a _legacy) ou outro worker a criou antes: o mês já está coberto.
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("falha ao criar partição %s: %w", partitionName(table, month), err)
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return nil
+}
+
+// createMonthPartition cria a partição do mês. Se a partição padrão já tiver linhas do mês, o CREATE ...
+// PARTITION OF falharia (23514); a partição é então criada solta, recebe essas linhas e é anexada, tudo
+// na mesma transação.
+func (s *PostgresStorage) createMonthPartition(ctx context.Context, table string, month time.Time) error {
+	name := partitionName(table, month)
+	lower, upper := partitionBound(month), partitionBound(month.AddDate(0, 1, 0))
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		inRange := fmt.Sprintf("timestamp >= %s AND timestamp < %s", lower, upper)
+		var stranded int64
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s_default WHERE %s", table, inRange)
+		if err := tx.QueryRowContext(ctx, query).Scan(&stranded); err != nil {
+			return err
+		}
+		if stranded == 0 {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)",
+				name, table, lower, upper))
+			return err
+		}
+
+		steps := []string{
+			fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name, table),
+			fmt.Sprintf("WITH moved AS (DELETE FROM %s_default WHERE %s RETURNING *) INSERT INTO %s SELECT * FROM moved",
+				table, inRange, name),
+			fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)", table, name, lower, upper),
+		}
+		for _, step := range steps {
+			if _, err := tx.ExecContext(ctx, step); err != nil {
+				return err
+			}
+		}
+		slog.Warn("linhas da partição padrão movidas para a nova partição", "table", table, "partition", name, "rows", stranded)
+		return nil
+	})
+}
+
+// DropPartitionsBefore remove as partições mensais de table que terminam até cutoff. Com detachOnly, as
+// partições são apenas desanexadas e continuam no banco para arquivamento. As partições _legacy e _default
+// não são tocadas; o que sobra nelas é apagado pela limpeza em lotes.
+func (s *PostgresStorage) DropPartitionsBefore(ctx context.Context, table string, cutoff time.Time, detachOnly bool) ([]string, error) {
+	query := `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass($1) ORDER BY c.relname`
+	rows, err := s.db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		suffix, ok := strings.CutPrefix(name, table+"_p")
+		if !ok {
+			continue
+		}
+		month, err := time.Parse(partitionSuffixLayout, suffix)
+		if err != nil {
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, name := range expired {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", table, name)); err != nil {
+			return removed, err
+		}
+		if !detachOnly {
+			if _, err := s.db.ExecContext(ctx, "DROP TABLE "+name); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// As consultas de foto são as mesmas nos dois backends; só muda o querier.
+
+// keyVersionArg grava NULL para objetos sem chave mestra associada.
+func keyVersionArg(content models.PhotoContent) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(content.KeyVersion), Valid: content.KeyVersion > 0}
+}
+
+// savePhoto devolve a linha como o banco a guardou: o timestamp lido de volta é o que entra nos dados
+// autenticados da imagem, e não o recebido (o Postgres arredonda para microssegundos e descarta o fuso).
+func savePhoto(ctx context.Context, db querier, data *models.PhotoData) (*models.PhotoMetadata, error) {
+	query := `INSERT INTO photo(device_id, timestamp, recognized, driver_id, face_id, similarity) VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING ` + photoMetadataColumns
+	return scanPhotoMetadata(db.QueryRowContext(ctx, query, data.DeviceID, data.Timestamp, data.Recognized,
+		nullIfEmpty(data.DriverID), nullIfEmpty(data.FaceID), data.Similarity))
+}
+
+// nullIfEmpty grava NULL no lugar do texto vazio.
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+const photoMetadataColumns = `id, device_id, timestamp, recognized, driver_id, face_id, similarity`
+
+// photoMatch recebe as colunas anuláveis do rosto reconhecido.
+type photoMatch struct {
+	driverID, faceID sql.NullString
+	similarity       sql.NullFloat64
+}
+
+func (m *photoMatch) apply(p *models.PhotoMetadata) {
+	p.DriverID, p.FaceID = m.driverID.String, m.faceID.String
+	if m.similarity.Valid {
+		p.Similarity = &m.similarity.Float64
+	}
+}
+
+func scanPhotoMetadata(row rowScanner) (*models.PhotoMetadata, error) {
+	var p models.PhotoMetadata
+	var match photoMatch
+	if err := row.Scan(&p.ID, &p.DeviceID, &p.Timestamp, &p.Recognized, &match.driverID, &match.faceID, &match.similarity); err != nil {
+		return nil, err
+	}
+	match.apply(&p)
+	return &p, nil
+}
+
+// streamPhotoMetadata nunca lê a coluna photo, apenas os metadados.
+func streamPhotoMetadata(ctx context.Context, db querier, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error {
+	query := "SELECT " + photoMetadataColumns + ` FROM photo
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3 ORDER BY timestamp`
+	rows, err := db.QueryContext(ctx, query, deviceID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		meta, err := scanPhotoMetadata(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(*meta); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const storedPhotoColumns = photoMetadataColumns + `, content_key, content_size, content_sha256, encryption,
+	key_version, wrapped_key, photo`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStoredPhoto(row rowScanner) (*models.StoredPhoto, error) {
+	var p models.StoredPhoto
+	var key, sha, encryption, legacy sql.NullString
+	var size, keyVersion sql.NullInt64
+	var match photoMatch
+	if err := row.Scan(&p.ID, &p.DeviceID, &p.Timestamp, &p.Recognized, &match.driverID, &match.faceID, &match.similarity,
+		&key, &size, &sha, &encryption, &keyVersion, &p.WrappedKey, &legacy); err != nil {
+		return nil, err
+	}
+	match.apply(&p.PhotoMetadata)
+	p.Key, p.Size, p.SHA256, p.Encryption, p.Legacy = key.String, size.Int64, sha.String, encryption.String, legacy.String
+	p.KeyVersion = uint32(keyVersion.Int64)
+	return &p, nil
+}
+
+func getPhoto(ctx context.Context, db querier, id int64) (*models.StoredPhoto, error) {
+	p, err := scanStoredPhoto(db.QueryRowContext(ctx, "SELECT "+storedPhotoColumns+" FROM photo WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+// photosBelowKeyVersion são as linhas com objeto que ainda não usam chave de dados amarrada à linha ou
+// cuja chave de dados foi embrulhada com uma versão anterior da chave mestra.
+const photosBelowKeyVersion = `content_key IS NOT NULL AND (encryption NOT IN ('` + models.PhotoEncryptionDataKeyAAD + `', '` + models.PhotoEncryptionStream + `')
+	OR key_version IS NULL OR key_version < $1)`
+
+// listPhotosBelowKeyVersion pagina pelo id as linhas pendentes para a versão de chave informada.
+func listPhotosBelowKeyVersion(ctx context.Context, db querier, version uint32, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	query := "SELECT " + storedPhotoColumns + " FROM photo WHERE " + photosBelowKeyVersion + " AND id > $2 ORDER BY id LIMIT $3"
+	rows, err := db.QueryContext(ctx, query, version, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []models.StoredPhoto{}
+	for rows.Next() {
+		p, err := scanStoredPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, *p)
+	}
+	return photos, rows.Err()
+}
+
+func countPhotosBelowKeyVersion(ctx context.Context, db querier, version uint32) (int64, error) {
+	var count int64
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM photo WHERE "+photosBelowKeyVersion, version).Scan(&count)
+	return count, err
+}
+
+// listLegacyPhotos pagina pelo id as linhas que ainda têm a imagem na coluna photo.
+func listLegacyPhotos(ctx context.Context, db querier, afterID int64, limit int) ([]models.LegacyPhoto, error) {
+	query := `SELECT id, device_id, timestamp, photo FROM photo
+		WHERE photo IS NOT NULL AND id > $1 ORDER BY id LIMIT $2`
+	rows, err := db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []models.LegacyPhoto{}
+	for rows.Next() {
+		var p models.LegacyPhoto
+		if err := rows.Scan(&p.ID, &p.DeviceID, &p.Timestamp, &p.Photo); err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// setPhotoContent aponta a linha para o objeto e libera a coluna photo (quando a linha é antiga).
+func setPhotoContent(ctx context.Context, db querier, id int64, content models.PhotoContent) error {
+	query := `UPDATE photo SET photo = NULL, content_key = $1, content_size = $2, content_sha256 = $3, encryption = $4,
+		key_version = $5, wrapped_key = $6 WHERE id = $7`
+	result, err := db.ExecContext(ctx, query, content.Key, content.Size, content.SHA256, content.Encryption,
+		keyVersionArg(content), content.WrappedKey, id)
+	return expectAffected(result, err)
+}
+
+// replacePhotoContent troca o objeto (ou só a chave embrulhada) da linha somente se ela ainda aponta para
+// oldKey, para que duas execuções concorrentes não sobrescrevam uma à outra.
+func replacePhotoContent(ctx context.Context, db querier, id int64, oldKey string, content models.PhotoContent) error {
+	query := `UPDATE photo SET content_key = $1, content_size = $2, content_sha256 = $3, encryption = $4, key_version = $5,
+		wrapped_key = $6 WHERE id = $7 AND content_key = $8`
+	result, err := db.ExecContext(ctx, query, content.Key, content.Size, content.SHA256, content.Encryption,
+		keyVersionArg(content), content.WrappedKey, id, oldKey)
+	return expectAffected(result, err)
+}
+
+func expectAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func streamPhotoContentKeys(ctx context.Context, db querier, before time.Time, fn func(key string) error) error {
+	rows, err := db.QueryContext(ctx, "SELECT content_key FROM photo WHERE content_key IS NOT NULL AND timestamp < $1", before)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// retentionTable descreve como apagar linhas antigas de uma tabela: a coluna de data usada no corte e
+// a chave usada para selecionar cada lote.
+type retentionTable struct {
+	timeColumn string
+	key        string
+}
+
+var retentionTables = map[string]retentionTable{
+	"gps":                     {timeColumn: "timestamp", key: "id"},
+	"gyroscope":               {timeColumn: "timestamp", key: "id"},
+	"photo":                   {timeColumn: "timestamp", key: "id"},
+	"overspeed_event":         {timeColumn: "timestamp", key: "id"},
+	"audit_log":               {timeColumn: "timestamp", key: "id"},
+	"export_job":              {timeColumn: "created_at", key: "id"},
+	"telemetry_rollup_minute": {timeColumn: "bucket", key: "device_id, bucket"},
+	"telemetry_rollup_hour":   {timeColumn: "bucket", key: "device_id, bucket"},
+}
+
+// RetentionTables lista as tabelas que aceitam política de retenção.
+func RetentionTables() []string {
+	names := make([]string, 0, len(retentionTables))
+	for name := range retentionTables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// PurgeBefore apaga no máximo limit linhas de table anteriores a cutoff e retorna quantas foram apagadas.
+// Cada chamada é uma transação curta; quem chama repete até o retorno ser menor que limit.
+func (s *PostgresStorage) PurgeBefore(ctx context.Context, table string, cutoff time.Time, limit int) (int64, error) {
+	cfg, ok := retentionTables[table]
+	if !ok {
+		return 0, fmt.Errorf("tabela sem política de retenção: %s", table)
+	}
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE (%[2]s) IN (
+		SELECT %[2]s FROM %[1]s WHERE %[3]s < $1 LIMIT $2
+	)`, table, cfg.key, cfg.timeColumn)
+	result, err := s.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
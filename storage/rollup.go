@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"challenge-v3/crypto"
+	"challenge-v3/geo"
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxStepGap limita quais leituras consecutivas somam distância: acima disso é considerada uma nova viagem.
+const maxStepGap = 10 * time.Minute
+
+var rollupTables = map[string]string{
+	models.ResolutionMinute: "telemetry_rollup_minute",
+	models.ResolutionHour:   "telemetry_rollup_hour",
+}
+
+// gpsBucketsQuery agrega o gps bruto por dispositivo e intervalo. A distância de cada leitura é a
+// haversine até a leitura anterior do mesmo dispositivo; leituras com velocidade 0 (ruído de GPS
+// com o veículo parado, ver GPSAnalyzerService) não somam distância.
+// Parâmetros: $1 device_id (vazio para todos), $2 início, $3 fim.
+func gpsBucketsQuery(unit string) string {
+	return fmt.Sprintf(`
+	SELECT device_id, date_trunc('%[1]s', timestamp) AS bucket, COUNT(*) AS gps_points,
+		COALESCE(SUM(step), 0) AS distance_m,
+		MIN(latitude) AS min_lat, MAX(latitude) AS max_lat, MIN(longitude) AS min_lon, MAX(longitude) AS max_lon
+	FROM (
+		SELECT device_id, timestamp, latitude, longitude,
+			CASE WHEN prev_ts IS NOT NULL AND timestamp - prev_ts <= INTERVAL '%[2]d seconds' AND COALESCE(speed, -1) <> 0 THEN
+				2 * 6371000 * ASIN(LEAST(1, SQRT(
+					POWER(SIN(RADIANS(latitude - prev_lat) / 2), 2) +
+					COS(RADIANS(prev_lat)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - prev_lon) / 2), 2))))
+			END AS step
+		FROM (
+			SELECT device_id, timestamp, latitude, longitude, speed,
+				LAG(timestamp) OVER w AS prev_ts, LAG(latitude) OVER w AS prev_lat, LAG(longitude) OVER w AS prev_lon
+			FROM gps
+			WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2::timestamp - INTERVAL '%[2]d seconds' AND timestamp < $3
+			WINDOW w AS (PARTITION BY device_id ORDER BY timestamp)
+		) ordered
+	) steps
+	WHERE timestamp >= $2
+	GROUP BY device_id, bucket`, unit, int(maxStepGap.Seconds()))
+}
+
+// gyroBucketsQuery agrega a magnitude do giroscópio (sqrt(x²+y²+z²)). Parâmetros iguais a gpsBucketsQuery.
+func gyroBucketsQuery(unit string) string {
+	return fmt.Sprintf(`
+	SELECT device_id, date_trunc('%s', timestamp) AS bucket, COUNT(*) AS gyro_points,
+		MIN(magnitude) AS gyro_min, MAX(magnitude) AS gyro_max, SUM(magnitude) AS gyro_sum
+	FROM (
+		SELECT device_id, timestamp, SQRT(x * x + y * y + z * z) AS magnitude
+		FROM gyroscope
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3
+	) g
+	GROUP BY device_id, bucket`, unit)
+}
+
+// gpsBuckets calcula em Go os mesmos intervalos de minuto de gpsBucketsQuery. É o caminho usado com
+// GPS_ENCRYPTION: latitude e longitude ficam nulas no banco e só dá para somar a distância depois de
+// decifrar cada posição. A área coberta fica nula: com uma leitura por minuto, a bounding box seria a
+// própria posição, em claro.
+func gpsBuckets(ctx context.Context, db querier, locations *crypto.LocationCipher, deviceID string, from, to time.Time) ([]models.TelemetryRollup, error) {
+	type position struct {
+		lat, lon  float64
+		timestamp time.Time
+	}
+	previous := map[string]position{}
+	index := map[string]int{}
+	buckets := []models.TelemetryRollup{}
+
+	err := streamGPS(ctx, db, locations, deviceID, from.Add(-maxStepGap), to, func(d models.GPSData) error {
+		lat, lon := *d.Latitude, *d.Longitude
+		prev, hasPrev := previous[d.DeviceID]
+		previous[d.DeviceID] = position{lat, lon, d.Timestamp}
+		if d.Timestamp.Before(from) {
+			return nil
+		}
+
+		bucket := d.Timestamp.UTC().Truncate(time.Minute)
+		key := d.DeviceID + "|" + bucket.Format(time.RFC3339)
+		i, ok := index[key]
+		if !ok {
+			buckets = append(buckets, models.TelemetryRollup{DeviceID: d.DeviceID, Bucket: bucket})
+			i = len(buckets) - 1
+			index[key] = i
+		}
+		r := &buckets[i]
+		r.GPSPoints++
+		if hasPrev && d.Timestamp.Sub(prev.timestamp) <= maxStepGap && (d.Speed == nil || *d.Speed != 0) {
+			r.DistanceMeters += geo.Haversine(prev.lat, prev.lon, lat, lon)
+		}
+		return nil
+	})
+	return buckets, err
+}
+
+// saveGPSBuckets grava em telemetry_rollup_minute os intervalos calculados por gpsBuckets, apagando a
+// bounding box que um cálculo anterior em claro tenha deixado.
+func saveGPSBuckets(ctx context.Context, db querier, buckets []models.TelemetryRollup) error {
+	query := `INSERT INTO telemetry_rollup_minute (device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon)
+		VALUES ($1, $2, $3, $4, NULL, NULL, NULL, NULL)
+		ON CONFLICT (device_id, bucket) DO UPDATE SET gps_points = EXCLUDED.gps_points, distance_m = EXCLUDED.distance_m,
+			min_lat = NULL, max_lat = NULL, min_lon = NULL, max_lon = NULL`
+	for _, r := range buckets {
+		if _, err := db.ExecContext(ctx, query, r.DeviceID, r.Bucket, r.GPSPoints, r.DistanceMeters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshGPSBuckets é o passo de GPS de RefreshRollups com as posições cifradas.
+func refreshGPSBuckets(ctx context.Context, db querier, locations *crypto.LocationCipher, from, to time.Time) error {
+	buckets, err := gpsBuckets(ctx, db, locations, "", from, to)
+	if err != nil {
+		return err
+	}
+	return saveGPSBuckets(ctx, db, buckets)
+}
+
+// withGyroBuckets junta aos intervalos de gpsBuckets as linhas de gyroBucketsQuery (device_id, bucket,
+// gyro_points, gyro_min, gyro_max, gyro_sum), devolvendo tudo em ordem de intervalo.
+func withGyroBuckets(buckets []models.TelemetryRollup, rows *sql.Rows) ([]models.TelemetryRollup, error) {
+	defer rows.Close()
+	index := map[string]int{}
+	for i, r := range buckets {
+		index[r.DeviceID+"|"+r.Bucket.Format(time.RFC3339)] = i
+	}
+	for rows.Next() {
+		var deviceID string
+		var bucket time.Time
+		var points int64
+		var gyroMin, gyroMax, gyroSum sql.NullFloat64
+		if err := rows.Scan(&deviceID, timestampDest{&bucket}, &points, &gyroMin, &gyroMax, &gyroSum); err != nil {
+			return nil, err
+		}
+		bucket = bucket.UTC()
+		key := deviceID + "|" + bucket.Format(time.RFC3339)
+		i, ok := index[key]
+		if !ok {
+			buckets = append(buckets, models.TelemetryRollup{DeviceID: deviceID, Bucket: bucket})
+			i = len(buckets) - 1
+			index[key] = i
+		}
+		r := &buckets[i]
+		r.GyroPoints = points
+		if gyroMin.Valid {
+			r.GyroMin, r.GyroMax = &gyroMin.Float64, &gyroMax.Float64
+		}
+		if gyroSum.Valid && points > 0 {
+			avg := gyroSum.Float64 / float64(points)
+			r.GyroAvg = &avg
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket.Before(buckets[j].Bucket) })
+	return buckets, nil
+}
+
+// RefreshRollups recalcula os intervalos de minuto em [from, to) a partir dos dados brutos e as horas
+// correspondentes a partir dos minutos. É idempotente, então pode ser repetido para absorver dados atrasados.
+func (s *PostgresStorage) RefreshRollups(ctx context.Context, from, to time.Time) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return refreshRollups(ctx, tx, s.locations, from, to)
+	})
+}
+
+// refreshRollups soma a distância e monta a área coberta no próprio banco; com um LocationCipher
+// configurado, esse passo vai para refreshGPSBuckets.
+func refreshRollups(ctx context.Context, tx *sql.Tx, locations *crypto.LocationCipher, from, to time.Time) error {
+	if locations != nil {
+		if err := refreshGPSBuckets(ctx, tx, locations, from, to); err != nil {
+			return err
+		}
+	} else {
+		gpsMinutes := `INSERT INTO telemetry_rollup_minute (device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon)
+		` + gpsBucketsQuery("minute") + `
+		ON CONFLICT (device_id, bucket) DO UPDATE SET gps_points = EXCLUDED.gps_points, distance_m = EXCLUDED.distance_m,
+			min_lat = EXCLUDED.min_lat, max_lat = EXCLUDED.max_lat, min_lon = EXCLUDED.min_lon, max_lon = EXCLUDED.max_lon`
+		if _, err := tx.ExecContext(ctx, gpsMinutes, "", from, to); err != nil {
+			return err
+		}
+	}
+	gyroMinutes := `INSERT INTO telemetry_rollup_minute (device_id, bucket, gyro_points, gyro_min, gyro_max, gyro_sum)
+		` + gyroBucketsQuery("minute") + `
+		ON CONFLICT (device_id, bucket) DO UPDATE SET gyro_points = EXCLUDED.gyro_points,
+			gyro_min = EXCLUDED.gyro_min, gyro_max = EXCLUDED.gyro_max, gyro_sum = EXCLUDED.gyro_sum`
+	if _, err := tx.ExecContext(ctx, gyroMinutes, "", from, to); err != nil {
+		return err
+	}
+
+	hourQuery := `
+	INSERT INTO telemetry_rollup_hour (device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon,
+		gyro_points, gyro_min, gyro_max, gyro_sum)
+	SELECT device_id, date_trunc('hour', bucket), SUM(gps_points), SUM(distance_m), MIN(min_lat), MAX(max_lat),
+		MIN(min_lon), MAX(max_lon), SUM(gyro_points), MIN(gyro_min), MAX(gyro_max), SUM(gyro_sum)
+	FROM telemetry_rollup_minute
+	WHERE bucket >= date_trunc('hour', $1::timestamp) AND bucket < $2
+	GROUP BY device_id, date_trunc('hour', bucket)
+	ON CONFLICT (device_id, bucket) DO UPDATE SET gps_points = EXCLUDED.gps_points, distance_m = EXCLUDED.distance_m,
+		min_lat = EXCLUDED.min_lat, max_lat = EXCLUDED.max_lat, min_lon = EXCLUDED.min_lon, max_lon = EXCLUDED.max_lon,
+		gyro_points = EXCLUDED.gyro_points, gyro_min = EXCLUDED.gyro_min, gyro_max = EXCLUDED.gyro_max, gyro_sum = EXCLUDED.gyro_sum`
+	_, err := tx.ExecContext(ctx, hourQuery, from, to)
+	return err
+}
+
+// RollupWatermark retorna até onde os rollups já foram calculados; zero quando nunca rodaram.
+func (s *PostgresStorage) RollupWatermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+	err := s.db.QueryRowContext(ctx, "SELECT watermark FROM rollup_state WHERE name = 'telemetry'").Scan(&watermark)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return watermark, err
+}
+
+func (s *PostgresStorage) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	query := `INSERT INTO rollup_state (name, watermark) VALUES ('telemetry', $1)
+		ON CONFLICT (name) DO UPDATE SET watermark = GREATEST(rollup_state.watermark, EXCLUDED.watermark)`
+	_, err := s.db.ExecContext(ctx, query, watermark)
+	return err
+}
+
+// timestampDest lê um instante tanto como time.Time quanto como o texto que o SQLite devolve em
+// colunas calculadas, onde o driver não sabe que o valor é uma data.
+type timestampDest struct{ t *time.Time }
+
+func (d timestampDest) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d.t = v
+	case string:
+		parsed, err := time.Parse(sqliteTimeLayout, v)
+		if err != nil {
+			return err
+		}
+		*d.t = parsed
+	default:
+		return fmt.Errorf("instante com tipo inesperado: %T", src)
+	}
+	return nil
+}
+
+func scanRollups(rows *sql.Rows) ([]models.TelemetryRollup, error) {
+	defer rows.Close()
+	buckets := []models.TelemetryRollup{}
+	for rows.Next() {
+		var r models.TelemetryRollup
+		var gyroSum sql.NullFloat64
+		if err := rows.Scan(&r.DeviceID, timestampDest{&r.Bucket}, &r.GPSPoints, &r.DistanceMeters, &r.MinLatitude, &r.MaxLatitude,
+			&r.MinLongitude, &r.MaxLongitude, &r.GyroPoints, &r.GyroMin, &r.GyroMax, &gyroSum); err != nil {
+			return nil, err
+		}
+		if gyroSum.Valid && r.GyroPoints > 0 {
+			avg := gyroSum.Float64 / float64(r.GyroPoints)
+			r.GyroAvg = &avg
+		}
+		buckets = append(buckets, r)
+	}
+	return buckets, rows.Err()
+}
+
+// QueryRollups devolve os intervalos de um dispositivo na resolução pedida. Em ResolutionRaw os
+// intervalos de minuto são calculados na hora a partir das tabelas brutas.
+func (s *PostgresStorage) QueryRollups(ctx context.Context, deviceID string, from, to time.Time, resolution string) ([]models.TelemetryRollup, error) {
+	if resolution == models.ResolutionRaw && s.locations != nil {
+		buckets, err := gpsBuckets(ctx, s.db, s.locations, deviceID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := s.db.QueryContext(ctx, gyroBucketsQuery("minute"), deviceID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		return withGyroBuckets(buckets, rows)
+	}
+	if resolution == models.ResolutionRaw {
+		query := `
+		SELECT COALESCE(g.device_id, y.device_id), COALESCE(g.bucket, y.bucket), COALESCE(g.gps_points, 0), COALESCE(g.distance_m, 0),
+			g.min_lat, g.max_lat, g.min_lon, g.max_lon, COALESCE(y.gyro_points, 0), y.gyro_min, y.gyro_max, y.gyro_sum
+		FROM (` + gpsBucketsQuery("minute") + `) g
+		FULL OUTER JOIN (` + gyroBucketsQuery("minute") + `) y ON g.device_id = y.device_id AND g.bucket = y.bucket
+		ORDER BY 2`
+		rows, err := s.db.QueryContext(ctx, query, deviceID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		return scanRollups(rows)
+	}
+
+	table, ok := rollupTables[resolution]
+	if !ok {
+		return nil, fmt.Errorf("resolução inválida: %s", resolution)
+	}
+	query := `SELECT device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon,
+		gyro_points, gyro_min, gyro_max, gyro_sum
+		FROM ` + table + ` WHERE device_id = $1 AND bucket >= date_trunc('` + resolution + `', $2::timestamp) AND bucket < $3
+		ORDER BY bucket`
+	rows, err := s.db.QueryContext(ctx, query, deviceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanRollups(rows)
+}
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeLayout é o formato de todos os instantes gravados no SQLite: UTC, sem fuso e com largura
+// fixa, para que a comparação de texto das consultas (timestamp >= $2) siga a ordem do tempo.
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000"
+
+// sqliteNow é o equivalente de NOW() no formato de sqliteTimeLayout (o SQLite só tem milissegundos).
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f000000', 'now')"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteArgs converte os instantes dos parâmetros para sqliteTimeLayout; o driver gravaria RFC 3339,
+// que tem largura variável.
+func sqliteArgs(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = sqliteTime(v)
+		case *time.Time:
+			if v == nil {
+				converted[i] = nil
+			} else {
+				converted[i] = sqliteTime(*v)
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// sqliteQuerier aplica sqliteArgs a todas as consultas. Statements preparados recebem os parâmetros
+// direto, então quem os usa converte com sqliteArgs.
+type sqliteQuerier struct{ q querier }
+
+func (s sqliteQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.q.ExecContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (s sqliteQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.q.QueryContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (s sqliteQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.q.QueryRowContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (s sqliteQuerier) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.q.PrepareContext(ctx, query)
+}
+
+// SQLiteStorage implementa Storage sobre um arquivo SQLite, para desenvolvimento local e instalações
+// sem PostgreSQL. O esquema e a semântica são os mesmos; a diferença é que não há particionamento
+// e as gravações são serializadas pelo próprio SQLite.
+type SQLiteStorage struct {
+	pool *sql.DB
+	// db é o pool ou, dentro de WithTx, a transação corrente (tx).
+	db querier
+	tx *sql.Tx
+	// locations cifra as posições de GPS; nil grava em claro.
+	locations *crypto.LocationCipher
+	// auditKey assina o encadeamento do audit_log; nil grava a cadeia sem HMAC.
+	auditKey []byte
+}
+
+// NewSQLiteStorage abre (ou cria) o banco em path. As transações começam com BEGIN IMMEDIATE e esperam
+// até 5s pelo lock de escrita, em vez de falhar quando o worker e a API gravam ao mesmo tempo.
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("não foi possível abrir o banco sqlite: %w", err)
+	}
+	return &SQLiteStorage{pool: db, db: sqliteQuerier{db}}, nil
+}
+
+func (s *SQLiteStorage) migrator() *migrator {
+	return &migrator{
+		pool:  s.pool,
+		files: sqliteMigrationFiles,
+		dir:   "migrations/sqlite",
+		createTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT (` + sqliteNow + `)
+		);`,
+	}
+}
+
+// Migrate aplica as migrações de migrations/sqlite. Não há lock entre processos: só o worker migra.
+func (s *SQLiteStorage) Migrate(ctx context.Context) (int, error) {
+	return s.migrator().migrate(ctx)
+}
+
+func (s *SQLiteStorage) Rollback(ctx context.Context, steps int) (int, error) {
+	return s.migrator().rollback(ctx, steps)
+}
+
+func (s *SQLiteStorage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return s.migrator().status(ctx)
+}
+
+// inTx executa fn na transação corrente, se houver, ou numa nova transação confirmada ao final.
+func (s *SQLiteStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	tx, err := s.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTx tem a mesma semântica de PostgresStorage.WithTx.
+func (s *SQLiteStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SQLiteStorage{pool: s.pool, db: sqliteQuerier{tx}, tx: tx, locations: s.locations, auditKey: s.auditKey})
+	})
+}
+
+func (s *SQLiteStorage) LogAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	return s.LogAuditEvents(ctx, []models.AuditEvent{event})
+}
+
+// SetAuditKey tem a mesma semântica de PostgresStorage.SetAuditKey.
+func (s *SQLiteStorage) SetAuditKey(key []byte) {
+	s.auditKey = key
+}
+
+func (s *SQLiteStorage) AuditChainHead(ctx context.Context) (int64, []byte, error) {
+	return auditChainHead(ctx, s.db)
+}
+
+func (s *SQLiteStorage) StreamAuditChain(ctx context.Context, from, to int64, fn func(models.AuditEntry) error) error {
+	return streamAuditChain(ctx, s.db, from, to, fn)
+}
+
+func (s *SQLiteStorage) StreamAuditLog(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	return streamAuditLog(ctx, s.db, sqliteAuditDetailsMatch, filter, fn)
+}
+
+func (s *SQLiteStorage) SaveGyroscope(ctx context.Context, data *models.GyroscopeData) error {
+	query := "INSERT INTO gyroscope(device_id, x, y, z, timestamp) VALUES($1, $2, $3, $4, $5)"
+	_, err := s.db.ExecContext(ctx, query, data.DeviceID, *data.X, *data.Y, *data.Z, data.Timestamp)
+	return err
+}
+
+// SetLocationCipher tem a mesma semântica de PostgresStorage.SetLocationCipher.
+func (s *SQLiteStorage) SetLocationCipher(locations *crypto.LocationCipher) {
+	s.locations = locations
+}
+
+func (s *SQLiteStorage) SaveGPS(ctx context.Context, data *models.GPSData) error {
+	return saveGPS(ctx, s.db, s.locations, data)
+}
+
+func (s *SQLiteStorage) SaveOverspeedEvent(ctx context.Context, event *models.OverspeedEvent) error {
+	return saveOverspeedEvent(ctx, s.db, s.locations, event)
+}
+
+func (s *SQLiteStorage) SavePhoto(ctx context.Context, data *models.PhotoData) (*models.PhotoMetadata, error) {
+	return savePhoto(ctx, s.db, data)
+}
+
+func (s *SQLiteStorage) GetPhoto(ctx context.Context, id int64) (*models.StoredPhoto, error) {
+	return getPhoto(ctx, s.db, id)
+}
+
+func (s *SQLiteStorage) ListPhotosBelowKeyVersion(ctx context.Context, version uint32, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	return listPhotosBelowKeyVersion(ctx, s.db, version, afterID, limit)
+}
+
+func (s *SQLiteStorage) CountPhotosBelowKeyVersion(ctx context.Context, version uint32) (int64, error) {
+	return countPhotosBelowKeyVersion(ctx, s.db, version)
+}
+
+func (s *SQLiteStorage) ReplacePhotoContent(ctx context.Context, id int64, oldKey string, content models.PhotoContent) error {
+	return replacePhotoContent(ctx, s.db, id, oldKey, content)
+}
+
+func (s *SQLiteStorage) ListLegacyPhotos(ctx context.Context, afterID int64, limit int) ([]models.LegacyPhoto, error) {
+	return listLegacyPhotos(ctx, s.db, afterID, limit)
+}
+
+func (s *SQLiteStorage) SetPhotoContent(ctx context.Context, id int64, content models.PhotoContent) error {
+	return setPhotoContent(ctx, s.db, id, content)
+}
+
+func (s *SQLiteStorage) StreamPhotoContentKeys(ctx context.Context, before time.Time, fn func(key string) error) error {
+	return streamPhotoContentKeys(ctx, s.db, before, fn)
+}
+
+// insertRows é o equivalente do COPY: um INSERT preparado por linha, todos na mesma transação.
+func (s *SQLiteStorage) insertRows(ctx context.Context, query string, count int, row func(i int) ([]any, error)) error {
+	if count == 0 {
+		return nil
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := 0; i < count; i++ {
+			values, err := row(i)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, sqliteArgs(values)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) SaveGyroscopeBatch(ctx context.Context, batch []*models.GyroscopeData) error {
+	query := "INSERT INTO gyroscope(device_id, x, y, z, timestamp) VALUES($1, $2, $3, $4, $5)"
+	return s.insertRows(ctx, query, len(batch), func(i int) ([]any, error) {
+		d := batch[i]
+		return []any{d.DeviceID, *d.X, *d.Y, *d.Z, d.Timestamp}, nil
+	})
+}
+
+func (s *SQLiteStorage) SaveGPSBatch(ctx context.Context, batch []*models.GPSData) error {
+	return s.insertRows(ctx, insertGPSQuery, len(batch), func(i int) ([]any, error) {
+		return gpsRow(s.locations, batch[i])
+	})
+}
+
+func (s *SQLiteStorage) LogAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := chainAuditEvents(ctx, sqliteQuerier{tx}, s.auditKey, events)
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO audit_log(timestamp, actor, action, details, seq, prev_hash, hash, hmac)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range rows {
+			if _, err := stmt.ExecContext(ctx, sqliteArgs(row)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) StreamGPS(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GPSData) error) error {
+	return streamGPS(ctx, s.db, s.locations, deviceID, from, to, fn)
+}
+
+func (s *SQLiteStorage) QueryGPSAreas(ctx context.Context, deviceID string, from, to time.Time, precision int) ([]models.GPSArea, error) {
+	return queryGPSAreas(ctx, s.db, deviceID, from, to, precision)
+}
+
+func (s *SQLiteStorage) StreamGyroscope(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GyroscopeData) error) error {
+	query := `SELECT device_id, x, y, z, timestamp FROM gyroscope
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3 ORDER BY timestamp`
+	rows, err := s.db.QueryContext(ctx, query, deviceID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data models.GyroscopeData
+		var x, y, z float64
+		if err := rows.Scan(&data.DeviceID, &x, &y, &z, &data.Timestamp); err != nil {
+			return err
+		}
+		data.X, data.Y, data.Z = &x, &y, &z
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStorage) StreamPhotoMetadata(ctx context.Context, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error {
+	return streamPhotoMetadata(ctx, s.db, deviceID, from, to, fn)
+}
+
+func (s *SQLiteStorage) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	query := `INSERT INTO export_job(dataset, format, device_id, from_ts, to_ts, status, requested_by)
+		VALUES($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING RETURNING id, created_at`
+	job.Status = models.ExportStatusPending
+	err := s.db.QueryRowContext(ctx, query, job.Dataset, job.Format, job.DeviceID, job.From, job.To, job.Status, job.RequestedBy).
+		Scan(&job.ID, &job.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *SQLiteStorage) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	job, err := scanExportJob(s.db.QueryRowContext(ctx, "SELECT "+exportJobColumns+" FROM export_job WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// ClaimExportJob não precisa de SKIP LOCKED: o SQLite só tem um escritor por vez, então o UPDATE já é atômico.
+func (s *SQLiteStorage) ClaimExportJob(ctx context.Context) (*models.ExportJob, error) {
+	query := `UPDATE export_job SET status = $1, started_at = ` + sqliteNow + `
+		WHERE id = (SELECT id FROM export_job WHERE status = $2 ORDER BY id LIMIT 1)
+		RETURNING ` + exportJobColumns
+	job, err := scanExportJob(s.db.QueryRowContext(ctx, query, models.ExportStatusRunning, models.ExportStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+func (s *SQLiteStorage) FinishExportJob(ctx context.Context, job *models.ExportJob) error {
+	query := `UPDATE export_job SET status = $1, location = $2, row_count = $3, error = $4, finished_at = ` + sqliteNow + `
+		WHERE id = $5 RETURNING finished_at`
+	return s.db.QueryRowContext(ctx, query, job.Status, job.Location, job.Rows, job.Error, job.ID).Scan(&job.FinishedAt)
+}
+
+func (s *SQLiteStorage) ReclaimExportJobs(ctx context.Context, startedBefore time.Time) (int64, error) {
+	return reclaimExportJobs(ctx, s.db, startedBefore)
+}
+
+// EnsurePartitions não faz nada: o SQLite não tem particionamento.
+func (s *SQLiteStorage) EnsurePartitions(ctx context.Context, table string, from time.Time, months int) error {
+	return nil
+}
+
+// DropPartitionsBefore não remove nada; sem partições, a retenção apaga tudo pela limpeza em lotes.
+func (s *SQLiteStorage) DropPartitionsBefore(ctx context.Context, table string, cutoff time.Time, detachOnly bool) ([]string, error) {
+	return []string{}, nil
+}
+
+// PurgeBefore seleciona cada lote pelo rowid, que existe em todas as tabelas do SQLite.
+func (s *SQLiteStorage) PurgeBefore(ctx context.Context, table string, cutoff time.Time, limit int) (int64, error) {
+	cfg, ok := retentionTables[table]
+	if !ok {
+		return 0, fmt.Errorf("tabela sem política de retenção: %s", table)
+	}
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE rowid IN (
+		SELECT rowid FROM %[1]s WHERE %[2]s < $1 LIMIT $2
+	)`, table, cfg.timeColumn)
+	result, err := s.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
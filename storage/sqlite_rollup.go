@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"challenge-v3/crypto"
+	"challenge-v3/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqliteBucketFormats truncam um instante com strftime, mantendo sqliteTimeLayout.
+var sqliteBucketFormats = map[string]string{
+	models.ResolutionMinute: "%Y-%m-%d %H:%M:00.000000000",
+	models.ResolutionHour:   "%Y-%m-%d %H:00:00.000000000",
+}
+
+// sqliteGPSBucketsQuery é o gpsBucketsQuery no dialeto do SQLite. Como não há aritmética de datas com
+// INTERVAL, o início da janela das leituras anteriores vem pronto em $4.
+// Parâmetros: $1 device_id (vazio para todos), $2 início, $3 fim, $4 início - maxStepGap.
+func sqliteGPSBucketsQuery(resolution string) string {
+	return strings.NewReplacer("{bucket}", sqliteBucketFormats[resolution], "{gap}", fmt.Sprint(int(maxStepGap.Seconds()))).Replace(`
+	SELECT device_id, strftime('{bucket}', timestamp) AS bucket, COUNT(*) AS gps_points,
+		COALESCE(SUM(step), 0) AS distance_m,
+		MIN(latitude) AS min_lat, MAX(latitude) AS max_lat, MIN(longitude) AS min_lon, MAX(longitude) AS max_lon
+	FROM (
+		SELECT device_id, timestamp, latitude, longitude,
+			CASE WHEN prev_ts IS NOT NULL AND (julianday(timestamp) - julianday(prev_ts)) * 86400 <= {gap} AND COALESCE(speed, -1) <> 0 THEN
+				2 * 6371000 * ASIN(MIN(1, SQRT(
+					POWER(SIN(RADIANS(latitude - prev_lat) / 2), 2) +
+					COS(RADIANS(prev_lat)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - prev_lon) / 2), 2))))
+			END AS step
+		FROM (
+			SELECT device_id, timestamp, latitude, longitude, speed,
+				LAG(timestamp) OVER w AS prev_ts, LAG(latitude) OVER w AS prev_lat, LAG(longitude) OVER w AS prev_lon
+			FROM gps
+			WHERE ($1 = '' OR device_id = $1) AND timestamp >= $4 AND timestamp < $3
+			WINDOW w AS (PARTITION BY device_id ORDER BY timestamp)
+		) ordered
+	) steps
+	WHERE timestamp >= $2
+	GROUP BY device_id, bucket`)
+}
+
+// sqliteGyroBucketsQuery é o gyroBucketsQuery no dialeto do SQLite. Parâmetros: $1 a $3 de sqliteGPSBucketsQuery.
+func sqliteGyroBucketsQuery(resolution string) string {
+	return strings.ReplaceAll(`
+	SELECT device_id, strftime('{bucket}', timestamp) AS bucket, COUNT(*) AS gyro_points,
+		MIN(magnitude) AS gyro_min, MAX(magnitude) AS gyro_max, SUM(magnitude) AS gyro_sum
+	FROM (
+		SELECT device_id, timestamp, SQRT(x * x + y * y + z * z) AS magnitude
+		FROM gyroscope
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3
+	) g
+	GROUP BY device_id, bucket`, "{bucket}", sqliteBucketFormats[resolution])
+}
+
+// truncateTo trunca t (em UTC) para o início do minuto ou da hora, como o date_trunc do PostgreSQL.
+func truncateTo(t time.Time, resolution string) time.Time {
+	if resolution == models.ResolutionHour {
+		return t.UTC().Truncate(time.Hour)
+	}
+	return t.UTC().Truncate(time.Minute)
+}
+
+func (s *SQLiteStorage) RefreshRollups(ctx context.Context, from, to time.Time) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return sqliteRefreshRollups(ctx, sqliteQuerier{tx}, s.locations, from, to)
+	})
+}
+
+func sqliteRefreshRollups(ctx context.Context, tx querier, locations *crypto.LocationCipher, from, to time.Time) error {
+	if locations != nil {
+		if err := refreshGPSBuckets(ctx, tx, locations, from, to); err != nil {
+			return err
+		}
+	} else {
+		gpsMinutes := `INSERT INTO telemetry_rollup_minute (device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon)
+		` + sqliteGPSBucketsQuery(models.ResolutionMinute) + `
+		ON CONFLICT (device_id, bucket) DO UPDATE SET gps_points = excluded.gps_points, distance_m = excluded.distance_m,
+			min_lat = excluded.min_lat, max_lat = excluded.max_lat, min_lon = excluded.min_lon, max_lon = excluded.max_lon`
+		if _, err := tx.ExecContext(ctx, gpsMinutes, "", from, to, from.Add(-maxStepGap)); err != nil {
+			return err
+		}
+	}
+	gyroMinutes := `INSERT INTO telemetry_rollup_minute (device_id, bucket, gyro_points, gyro_min, gyro_max, gyro_sum)
+		` + sqliteGyroBucketsQuery(models.ResolutionMinute) + `
+		ON CONFLICT (device_id, bucket) DO UPDATE SET gyro_points = excluded.gyro_points,
+			gyro_min = excluded.gyro_min, gyro_max = excluded.gyro_max, gyro_sum = excluded.gyro_sum`
+	if _, err := tx.ExecContext(ctx, gyroMinutes, "", from, to); err != nil {
+		return err
+	}
+
+	hourQuery := `
+	INSERT INTO telemetry_rollup_hour (device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon,
+		gyro_points, gyro_min, gyro_max, gyro_sum)
+	SELECT device_id, strftime('` + sqliteBucketFormats[models.ResolutionHour] + `', bucket) AS hour, SUM(gps_points), SUM(distance_m),
+		MIN(min_lat), MAX(max_lat), MIN(min_lon), MAX(max_lon), SUM(gyro_points), MIN(gyro_min), MAX(gyro_max), SUM(gyro_sum)
+	FROM telemetry_rollup_minute
+	WHERE bucket >= $1 AND bucket < $2
+	GROUP BY device_id, hour
+	ON CONFLICT (device_id, bucket) DO UPDATE SET gps_points = excluded.gps_points, distance_m = excluded.distance_m,
+		min_lat = excluded.min_lat, max_lat = excluded.max_lat, min_lon = excluded.min_lon, max_lon = excluded.max_lon,
+		gyro_points = excluded.gyro_points, gyro_min = excluded.gyro_min, gyro_max = excluded.gyro_max, gyro_sum = excluded.gyro_sum`
+	_, err := tx.ExecContext(ctx, hourQuery, truncateTo(from, models.ResolutionHour), to)
+	return err
+}
+
+func (s *SQLiteStorage) RollupWatermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+	err := s.db.QueryRowContext(ctx, "SELECT watermark FROM rollup_state WHERE name = 'telemetry'").Scan(&watermark)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return watermark, err
+}
+
+func (s *SQLiteStorage) SetRollupWatermark(ctx context.Context, watermark time.Time) error {
+	query := `INSERT INTO rollup_state (name, watermark) VALUES ('telemetry', $1)
+		ON CONFLICT (name) DO UPDATE SET watermark = MAX(rollup_state.watermark, excluded.watermark)`
+	_, err := s.db.ExecContext(ctx, query, watermark)
+	return err
+}
+
+func (s *SQLiteStorage) QueryRollups(ctx context.Context, deviceID string, from, to time.Time, resolution string) ([]models.TelemetryRollup, error) {
+	if resolution == models.ResolutionRaw && s.locations != nil {
+		buckets, err := gpsBuckets(ctx, s.db, s.locations, deviceID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := s.db.QueryContext(ctx, sqliteGyroBucketsQuery(models.ResolutionMinute), deviceID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		return withGyroBuckets(buckets, rows)
+	}
+	if resolution == models.ResolutionRaw {
+		query := `
+		SELECT COALESCE(g.device_id, y.device_id), COALESCE(g.bucket, y.bucket), COALESCE(g.gps_points, 0), COALESCE(g.distance_m, 0),
+			g.min_lat, g.max_lat, g.min_lon, g.max_lon, COALESCE(y.gyro_points, 0), y.gyro_min, y.gyro_max, y.gyro_sum
+		FROM (` + sqliteGPSBucketsQuery(models.ResolutionMinute) + `) g
+		FULL OUTER JOIN (` + sqliteGyroBucketsQuery(models.ResolutionMinute) + `) y ON g.device_id = y.device_id AND g.bucket = y.bucket
+		ORDER BY 2`
+		rows, err := s.db.QueryContext(ctx, query, deviceID, from, to, from.Add(-maxStepGap))
+		if err != nil {
+			return nil, err
+		}
+		return scanRollups(rows)
+	}
+
+	table, ok := rollupTables[resolution]
+	if !ok {
+		return nil, fmt.Errorf("resolução inválida: %s", resolution)
+	}
+	query := `SELECT device_id, bucket, gps_points, distance_m, min_lat, max_lat, min_lon, max_lon,
+		gyro_points, gyro_min, gyro_max, gyro_sum
+		FROM ` + table + ` WHERE device_id = $1 AND bucket >= $2 AND bucket < $3
+		ORDER BY bucket`
+	rows, err := s.db.QueryContext(ctx, query, deviceID, truncateTo(from, resolution), to)
+	if err != nil {
+		return nil, err
+	}
+	return scanRollups(rows)
+}
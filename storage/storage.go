@@ -1,24 +1,112 @@
 package storage
 
 import (
+	"challenge-v3/crypto"
 	"challenge-v3/models"
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
 type Storage interface {
-	SaveGyroscope(data *models.GyroscopeData) error
-	SaveGPS(data *models.GPSData) error
-	SavePhoto(data *models.PhotoData) error
-	LogAuditEvent(event models.AuditEvent) error
+	SaveGyroscope(ctx context.Context, data *models.GyroscopeData) error
+	SaveGPS(ctx context.Context, data *models.GPSData) error
+	SaveGyroscopeBatch(ctx context.Context, batch []*models.GyroscopeData) error
+	SaveGPSBatch(ctx context.Context, batch []*models.GPSData) error
+	SaveOverspeedEvent(ctx context.Context, event *models.OverspeedEvent) error
+	StreamGPS(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GPSData) error) error
+	// QueryGPSAreas agrega as leituras por célula de geohash com precision caracteres (1 a
+	// geo.CoarseGeohashPrecision). Um deviceID vazio inclui todos os dispositivos.
+	QueryGPSAreas(ctx context.Context, deviceID string, from, to time.Time, precision int) ([]models.GPSArea, error)
+	StreamGyroscope(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GyroscopeData) error) error
+	StreamPhotoMetadata(ctx context.Context, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error
+	CreateExportJob(ctx context.Context, job *models.ExportJob) error
+	GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error)
+	ClaimExportJob(ctx context.Context) (*models.ExportJob, error)
+	FinishExportJob(ctx context.Context, job *models.ExportJob) error
+	ReclaimExportJobs(ctx context.Context, startedBefore time.Time) (int64, error)
+	RefreshRollups(ctx context.Context, from, to time.Time) error
+	RollupWatermark(ctx context.Context) (time.Time, error)
+	SetRollupWatermark(ctx context.Context, watermark time.Time) error
+	QueryRollups(ctx context.Context, deviceID string, from, to time.Time, resolution string) ([]models.TelemetryRollup, error)
+	EnsurePartitions(ctx context.Context, table string, from time.Time, months int) error
+	DropPartitionsBefore(ctx context.Context, table string, cutoff time.Time, detachOnly bool) ([]string, error)
+	PurgeBefore(ctx context.Context, table string, cutoff time.Time, limit int) (int64, error)
+	SavePhoto(ctx context.Context, data *models.PhotoData) (*models.PhotoMetadata, error)
+	// GetPhoto retorna ErrNotFound quando o id não existe.
+	GetPhoto(ctx context.Context, id int64) (*models.StoredPhoto, error)
+	ListLegacyPhotos(ctx context.Context, afterID int64, limit int) ([]models.LegacyPhoto, error)
+	SetPhotoContent(ctx context.Context, id int64, content models.PhotoContent) error
+	StreamPhotoContentKeys(ctx context.Context, before time.Time, fn func(key string) error) error
+	// ListPhotosBelowKeyVersion e CountPhotosBelowKeyVersion consideram as linhas com objeto que ainda não
+	// usam chave de dados ou cuja chave de dados foi embrulhada com uma versão da chave mestra menor que version.
+	ListPhotosBelowKeyVersion(ctx context.Context, version uint32, afterID int64, limit int) ([]models.StoredPhoto, error)
+	CountPhotosBelowKeyVersion(ctx context.Context, version uint32) (int64, error)
+	// ReplacePhotoContent retorna ErrNotFound quando a linha não aponta mais para oldKey.
+	ReplacePhotoContent(ctx context.Context, id int64, oldKey string, content models.PhotoContent) error
+	// LogAuditEvent e LogAuditEvents encadeiam os eventos no audit_log (ver auditchain); as gravações de
+	// auditoria são serializadas pela cabeça da cadeia até o fim da transação.
+	LogAuditEvent(ctx context.Context, event models.AuditEvent) error
+	LogAuditEvents(ctx context.Context, events []models.AuditEvent) error
+	// AuditChainHead retorna a última posição da cadeia e o hash dela.
+	AuditChainHead(ctx context.Context) (int64, []byte, error)
+	// StreamAuditChain percorre em ordem as linhas com from <= seq <= to.
+	StreamAuditChain(ctx context.Context, from, to int64, fn func(models.AuditEntry) error) error
+	// StreamAuditLog percorre as linhas do audit_log que atendem filter, das mais novas para as mais antigas.
+	StreamAuditLog(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error
+	CreateDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error
+	// GetDataSubjectRequest retorna ErrNotFound quando o id não existe.
+	GetDataSubjectRequest(ctx context.Context, id int64) (*models.DataSubjectRequest, error)
+	ClaimDataSubjectRequest(ctx context.Context) (*models.DataSubjectRequest, error)
+	FinishDataSubjectRequest(ctx context.Context, req *models.DataSubjectRequest) error
+	ListDevicePhotos(ctx context.Context, deviceID string, afterID int64, limit int) ([]models.StoredPhoto, error)
+	// ListDriverDevices devolve os dispositivos em que o motorista foi reconhecido (photo.driver_id).
+	ListDriverDevices(ctx context.Context, driverID string) ([]string, error)
+	// EraseDriver apaga o cadastro do motorista e os rostos associados em driver_faces, retornando as
+	// linhas apagadas por tabela.
+	EraseDriver(ctx context.Context, driverID string) (map[string]int64, error)
+	// EraseDeviceData e AnonymizeDeviceData retornam as linhas afetadas por tabela. A anonimização troca o
+	// dispositivo por pseudonym, descarta as posições exatas (o geohash fica com AnonymizedGeohashPrecision
+	// caracteres) e apaga as fotos. O audit_log não é alterado.
+	EraseDeviceData(ctx context.Context, deviceID string) (map[string]int64, error)
+	AnonymizeDeviceData(ctx context.Context, deviceID, pseudonym string) (map[string]int64, error)
+	// SaveDriver cria o motorista ou atualiza o nome e preenche CreatedAt e UpdatedAt.
+	SaveDriver(ctx context.Context, driver *models.Driver) error
+	// AddDriverFaces grava os rostos com a origem informada (models.DriverFaceSource*) e retorna
+	// ErrFaceAssigned quando um deles já pertence a outro motorista.
+	AddDriverFaces(ctx context.Context, driverID, source string, faceIDs []string) error
+	// ListDriverFaces retorna ErrNotFound quando o motorista não existe.
+	ListDriverFaces(ctx context.Context, driverID string) ([]models.DriverFace, error)
+	// RemoveDriverFace retorna ErrNotFound quando o rosto não está associado ao motorista.
+	RemoveDriverFace(ctx context.Context, driverID, faceID string) error
+	// GetDriver retorna ErrNotFound quando o id não existe.
+	GetDriver(ctx context.Context, id string) (*models.Driver, error)
+	// ResolveDriver devolve o motorista do rosto reconhecido (pelo FaceId associado ou pelo ExternalImageId
+	// igual ao id do motorista) e ErrNotFound quando nenhum corresponde.
+	ResolveDriver(ctx context.Context, faceID, externalImageID string) (string, error)
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 }
 
+var (
+	ErrNotFound  = errors.New("registro não encontrado")
+	ErrDuplicate = errors.New("registro já existe")
+	// ErrFaceAssigned indica um rosto já associado a outro motorista.
+	ErrFaceAssigned = errors.New("rosto já associado a outro motorista")
+)
+
 type PostgresStorage struct {
-	db *sql.DB
+	pool *sql.DB
+	// db é o pool ou, dentro de WithTx, a transação corrente (tx).
+	db querier
+	tx *sql.Tx
+	// locations cifra as posições de GPS; nil grava em claro.
+	locations *crypto.LocationCipher
+	// auditKey assina o encadeamento do audit_log; nil grava a cadeia sem HMAC.
+	auditKey []byte
 }
 
 func NewPostgresStorage(connStr string) (*PostgresStorage, error) {
@@ -29,83 +117,183 @@ func NewPostgresStorage(connStr string) (*PostgresStorage, error) {
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("não foi possível conectar ao postgres: %w", err)
 	}
-	return &PostgresStorage{db: db}, nil
-}
-
-func (s *PostgresStorage) InitTables() error {
-	gyroscopeTable := `
-	CREATE TABLE IF NOT EXISTS gyroscope (
-		id SERIAL PRIMARY KEY,
-		device_id TEXT NOT NULL,
-		x REAL NOT NULL,
-		y REAL NOT NULL,
-		z REAL NOT NULL,
-		timestamp TIMESTAMP NOT NULL
-	);`
-
-	gpsTable := `
-	CREATE TABLE IF NOT EXISTS gps (
-		id SERIAL PRIMARY KEY,
-		device_id TEXT NOT NULL,
-		latitude REAL NOT NULL,
-		longitude REAL NOT NULL,
-		timestamp TIMESTAMP NOT NULL
-	);`
-
-	photoTable := `
-	CREATE TABLE IF NOT EXISTS photo (
-		id SERIAL PRIMARY KEY,
-		device_id TEXT NOT NULL,
-		photo TEXT NOT NULL,
-		timestamp TIMESTAMP NOT NULL,
-		recognized BOOLEAN NOT NULL DEFAULT FALSE
-	);`
-
-	auditTable := `
-    CREATE TABLE IF NOT EXISTS audit_log (
-        id SERIAL PRIMARY KEY,
-        timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
-        actor TEXT NOT NULL,
-        action TEXT NOT NULL,
-        details JSONB
-    );`
-
-	tables := []string{gyroscopeTable, gpsTable, photoTable, auditTable}
-	for _, tableSQL := range tables {
-		if _, err := s.db.Exec(tableSQL); err != nil {
+	return &PostgresStorage{pool: db, db: db}, nil
+}
+
+func (s *PostgresStorage) LogAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	return s.LogAuditEvents(ctx, []models.AuditEvent{event})
+}
+
+// SetAuditKey define a chave do HMAC das linhas do audit_log (AUDIT_HMAC_KEY).
+func (s *PostgresStorage) SetAuditKey(key []byte) {
+	s.auditKey = key
+}
+
+func (s *PostgresStorage) AuditChainHead(ctx context.Context) (int64, []byte, error) {
+	return auditChainHead(ctx, s.db)
+}
+
+func (s *PostgresStorage) StreamAuditChain(ctx context.Context, from, to int64, fn func(models.AuditEntry) error) error {
+	return streamAuditChain(ctx, s.db, from, to, fn)
+}
+
+func (s *PostgresStorage) StreamAuditLog(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	return streamAuditLog(ctx, s.db, postgresAuditDetailsMatch, filter, fn)
+}
+
+func (s *PostgresStorage) SaveGyroscope(ctx context.Context, data *models.GyroscopeData) error {
+	query := "INSERT INTO gyroscope(device_id, x, y, z, timestamp) VALUES($1, $2, $3, $4, $5)"
+	_, err := s.db.ExecContext(ctx, query, data.DeviceID, *data.X, *data.Y, *data.Z, data.Timestamp)
+	return err
+}
+
+// SetLocationCipher liga a cifragem das posições de GPS e dos eventos de excesso de velocidade.
+func (s *PostgresStorage) SetLocationCipher(locations *crypto.LocationCipher) {
+	s.locations = locations
+}
+
+func (s *PostgresStorage) SaveGPS(ctx context.Context, data *models.GPSData) error {
+	return saveGPS(ctx, s.db, s.locations, data)
+}
+
+func (s *PostgresStorage) SaveOverspeedEvent(ctx context.Context, event *models.OverspeedEvent) error {
+	return saveOverspeedEvent(ctx, s.db, s.locations, event)
+}
+
+// SavePhoto grava os metadados da foto; a imagem vai para o armazenamento de blobs e a referência entra
+// depois, por SetPhotoContent. data.Photo não é persistido.
+func (s *PostgresStorage) SavePhoto(ctx context.Context, data *models.PhotoData) (*models.PhotoMetadata, error) {
+	return savePhoto(ctx, s.db, data)
+}
+
+func (s *PostgresStorage) GetPhoto(ctx context.Context, id int64) (*models.StoredPhoto, error) {
+	return getPhoto(ctx, s.db, id)
+}
+
+func (s *PostgresStorage) ListPhotosBelowKeyVersion(ctx context.Context, version uint32, afterID int64, limit int) ([]models.StoredPhoto, error) {
+	return listPhotosBelowKeyVersion(ctx, s.db, version, afterID, limit)
+}
+
+func (s *PostgresStorage) CountPhotosBelowKeyVersion(ctx context.Context, version uint32) (int64, error) {
+	return countPhotosBelowKeyVersion(ctx, s.db, version)
+}
+
+func (s *PostgresStorage) ReplacePhotoContent(ctx context.Context, id int64, oldKey string, content models.PhotoContent) error {
+	return replacePhotoContent(ctx, s.db, id, oldKey, content)
+}
+
+func (s *PostgresStorage) ListLegacyPhotos(ctx context.Context, afterID int64, limit int) ([]models.LegacyPhoto, error) {
+	return listLegacyPhotos(ctx, s.db, afterID, limit)
+}
+
+func (s *PostgresStorage) SetPhotoContent(ctx context.Context, id int64, content models.PhotoContent) error {
+	return setPhotoContent(ctx, s.db, id, content)
+}
+
+func (s *PostgresStorage) StreamPhotoContentKeys(ctx context.Context, before time.Time, fn func(key string) error) error {
+	return streamPhotoContentKeys(ctx, s.db, before, fn)
+}
+
+// StreamGPS percorre as leituras em ordem cronológica, entregando uma linha por vez a fn.
+// Um deviceID vazio inclui todos os dispositivos. Leituras anonimizadas, sem posição, ficam de fora.
+func (s *PostgresStorage) StreamGPS(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GPSData) error) error {
+	return streamGPS(ctx, s.db, s.locations, deviceID, from, to, fn)
+}
+
+func (s *PostgresStorage) QueryGPSAreas(ctx context.Context, deviceID string, from, to time.Time, precision int) ([]models.GPSArea, error) {
+	return queryGPSAreas(ctx, s.db, deviceID, from, to, precision)
+}
+
+func (s *PostgresStorage) StreamGyroscope(ctx context.Context, deviceID string, from, to time.Time, fn func(models.GyroscopeData) error) error {
+	query := `SELECT device_id, x, y, z, timestamp FROM gyroscope
+		WHERE ($1 = '' OR device_id = $1) AND timestamp >= $2 AND timestamp < $3 ORDER BY timestamp`
+	rows, err := s.db.QueryContext(ctx, query, deviceID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data models.GyroscopeData
+		var x, y, z float64
+		if err := rows.Scan(&data.DeviceID, &x, &y, &z, &data.Timestamp); err != nil {
+			return err
+		}
+		data.X, data.Y, data.Z = &x, &y, &z
+		if err := fn(data); err != nil {
 			return err
 		}
 	}
-	slog.Info("Tabelas do banco de dados inicializadas com sucesso")
-	return nil
+	return rows.Err()
+}
+
+func (s *PostgresStorage) StreamPhotoMetadata(ctx context.Context, deviceID string, from, to time.Time, fn func(models.PhotoMetadata) error) error {
+	return streamPhotoMetadata(ctx, s.db, deviceID, from, to, fn)
 }
 
-func (s *PostgresStorage) LogAuditEvent(event models.AuditEvent) error {
-	query := "INSERT INTO audit_log(actor, action, details) VALUES($1, $2, $3)"
+const exportJobColumns = `id, dataset, format, device_id, from_ts, to_ts, status, requested_by, location, row_count, error, created_at, started_at, finished_at`
 
-	detailsJSON, err := json.Marshal(event.Details)
+func scanExportJob(row interface{ Scan(...any) error }) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := row.Scan(&job.ID, &job.Dataset, &job.Format, &job.DeviceID, &job.From, &job.To, &job.Status,
+		&job.RequestedBy, &job.Location, &job.Rows, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &job, nil
+}
 
-	_, err = s.db.Exec(query, event.Actor, event.Action, detailsJSON)
+// CreateExportJob retorna ErrDuplicate quando o agendador já criou um job para o mesmo período.
+func (s *PostgresStorage) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	query := `INSERT INTO export_job(dataset, format, device_id, from_ts, to_ts, status, requested_by)
+		VALUES($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING RETURNING id, created_at`
+	job.Status = models.ExportStatusPending
+	err := s.db.QueryRowContext(ctx, query, job.Dataset, job.Format, job.DeviceID, job.From, job.To, job.Status, job.RequestedBy).
+		Scan(&job.ID, &job.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDuplicate
+	}
 	return err
 }
 
-func (s *PostgresStorage) SaveGyroscope(data *models.GyroscopeData) error {
-	query := "INSERT INTO gyroscope(device_id, x, y, z, timestamp) VALUES($1, $2, $3, $4, $5)"
-	_, err := s.db.Exec(query, data.DeviceID, *data.X, *data.Y, *data.Z, data.Timestamp)
-	return err
+func (s *PostgresStorage) GetExportJob(ctx context.Context, id int64) (*models.ExportJob, error) {
+	job, err := scanExportJob(s.db.QueryRowContext(ctx, "SELECT "+exportJobColumns+" FROM export_job WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
 }
 
-func (s *PostgresStorage) SaveGPS(data *models.GPSData) error {
-	query := "INSERT INTO gps(device_id, latitude, longitude, timestamp) VALUES($1, $2, $3, $4)"
-	_, err := s.db.Exec(query, data.DeviceID, *data.Latitude, *data.Longitude, data.Timestamp)
-	return err
+// ClaimExportJob marca o job pendente mais antigo como em execução. SKIP LOCKED permite vários workers
+// disputando a fila sem executar o mesmo job duas vezes. Retorna nil quando não há jobs pendentes.
+func (s *PostgresStorage) ClaimExportJob(ctx context.Context) (*models.ExportJob, error) {
+	query := `UPDATE export_job SET status = $1, started_at = NOW()
+		WHERE id = (SELECT id FROM export_job WHERE status = $2 ORDER BY id FOR UPDATE SKIP LOCKED LIMIT 1)
+		RETURNING ` + exportJobColumns
+	job, err := scanExportJob(s.db.QueryRowContext(ctx, query, models.ExportStatusRunning, models.ExportStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
 }
 
-func (s *PostgresStorage) SavePhoto(data *models.PhotoData) error {
-	query := "INSERT INTO photo(device_id, photo, timestamp, recognized) VALUES($1, $2, $3, $4)"
-	_, err := s.db.Exec(query, data.DeviceID, data.Photo, data.Timestamp, data.Recognized)
-	return err
+func (s *PostgresStorage) FinishExportJob(ctx context.Context, job *models.ExportJob) error {
+	query := `UPDATE export_job SET status = $1, location = $2, row_count = $3, error = $4, finished_at = NOW()
+		WHERE id = $5 RETURNING finished_at`
+	return s.db.QueryRowContext(ctx, query, job.Status, job.Location, job.Rows, job.Error, job.ID).Scan(&job.FinishedAt)
+}
+
+// reclaimExportJobs devolve à fila os jobs em execução desde antes de startedBefore, deixados para trás
+// por um worker que parou no meio.
+func reclaimExportJobs(ctx context.Context, db querier, startedBefore time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, `UPDATE export_job SET status = $1, started_at = NULL
+		WHERE status = $2 AND started_at < $3`, models.ExportStatusPending, models.ExportStatusRunning, startedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *PostgresStorage) ReclaimExportJobs(ctx context.Context, startedBefore time.Time) (int64, error) {
+	return reclaimExportJobs(ctx, s.db, startedBefore)
 }
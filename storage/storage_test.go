@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"challenge-v3/auditchain"
+	"challenge-v3/crypto"
+	"challenge-v3/geo"
 	"challenge-v3/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,7 +32,7 @@ func setupTestDB(t *testing.T) (*PostgresStorage, *sql.DB) {
 	storage, err := NewPostgresStorage(connStr)
 	require.NoError(t, err)
 
-	err = storage.InitTables()
+	_, err = storage.Migrate(context.Background())
 	require.NoError(t, err)
 
 	db, err := sql.Open("postgres", connStr)
@@ -33,36 +41,837 @@ func setupTestDB(t *testing.T) (*PostgresStorage, *sql.DB) {
 	return storage, db
 }
 
+// setupTestSQLite cria um banco novo por teste, num arquivo temporário.
+func setupTestSQLite(t *testing.T) (*SQLiteStorage, *sql.DB) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	storage, err := NewSQLiteStorage(path)
+	require.NoError(t, err)
+
+	_, err = storage.Migrate(context.Background())
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+
+	return storage, db
+}
+
+// forEachBackend roda o mesmo teste contra o PostgreSQL e o SQLite. O *sql.DB devolvido é uma conexão
+// à parte, usada para conferir o que foi de fato gravado.
+func forEachBackend(t *testing.T, test func(t *testing.T, storage Storage, db *sql.DB)) {
+	backends := map[string]func(t *testing.T) (Storage, *sql.DB){
+		BackendPostgres: func(t *testing.T) (Storage, *sql.DB) { return setupTestDB(t) },
+		BackendSQLite:   func(t *testing.T) (Storage, *sql.DB) { return setupTestSQLite(t) },
+	}
+	for _, name := range []string{BackendPostgres, BackendSQLite} {
+		t.Run(name, func(t *testing.T) {
+			storage, db := backends[name](t)
+			defer db.Close()
+			test(t, storage, db)
+		})
+	}
+}
+
 func float64Ptr(f float64) *float64 { return &f }
 
-func TestPostgresStorage_SaveGPS(t *testing.T) {
+func TestStorage_SaveGPS(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		_, err := db.Exec("DELETE FROM gps WHERE device_id = 'test-dev-gps'")
+		require.NoError(t, err)
+
+		testData := models.GPSData{
+			DeviceID:  "test-dev-gps",
+			Latitude:  float64Ptr(-10.5),
+			Longitude: float64Ptr(-35.5),
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		}
+
+		err = storage.SaveGPS(context.Background(), &testData)
+		require.NoError(t, err)
+
+		var result models.GPSData
+		var lat, lon float64
+		err = db.QueryRow("SELECT device_id, latitude, longitude, timestamp FROM gps WHERE device_id = $1", "test-dev-gps").Scan(
+			&result.DeviceID, &lat, &lon, &result.Timestamp,
+		)
+		require.NoError(t, err)
+		result.Latitude = &lat
+		result.Longitude = &lon
+
+		assert.Equal(t, testData.DeviceID, result.DeviceID)
+		assert.InDelta(t, *testData.Latitude, *result.Latitude, 0.001)
+		assert.InDelta(t, *testData.Longitude, *result.Longitude, 0.001)
+		assert.True(t, testData.Timestamp.Equal(result.Timestamp), "Os timestamps deveriam representar o mesmo momento")
+	})
+}
+
+func TestStorage_SaveGPSBatchAndStream(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		_, err := db.Exec("DELETE FROM gps WHERE device_id = 'test-dev-stream'")
+		require.NoError(t, err)
+
+		base := time.Date(2001, 3, 4, 10, 0, 0, 0, time.UTC)
+		speed := 42.0
+		batch := []*models.GPSData{
+			{DeviceID: "test-dev-stream", Latitude: float64Ptr(1), Longitude: float64Ptr(1), Timestamp: base.Add(2 * time.Second)},
+			{DeviceID: "test-dev-stream", Latitude: float64Ptr(2), Longitude: float64Ptr(2), Timestamp: base.Add(500 * time.Millisecond), Speed: &speed},
+			{DeviceID: "test-dev-stream", Latitude: float64Ptr(3), Longitude: float64Ptr(3), Timestamp: base.Add(time.Minute)},
+		}
+		require.NoError(t, storage.SaveGPSBatch(context.Background(), batch))
+
+		var streamed []models.GPSData
+		err = storage.StreamGPS(context.Background(), "test-dev-stream", base, base.Add(time.Minute), func(d models.GPSData) error {
+			streamed = append(streamed, d)
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Len(t, streamed, 2, "o limite final é exclusivo")
+		assert.True(t, streamed[0].Timestamp.Equal(base.Add(500*time.Millisecond)), "frações de segundo precisam ordenar corretamente")
+		require.NotNil(t, streamed[0].Speed)
+		assert.InDelta(t, speed, *streamed[0].Speed, 0.001)
+		assert.Nil(t, streamed[1].Speed)
+	})
+}
+
+func TestStorage_AuditChain(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		key := []byte("chave-hmac-da-auditoria-com-32-bytes")
+		storage.(interface{ SetAuditKey([]byte) }).SetAuditKey(key)
+		startSeq, startHash, err := storage.AuditChainHead(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, storage.LogAuditEvent(ctx, models.AuditEvent{Actor: "test-chain", Action: "A",
+			Details: map[string]interface{}{"b": 1.5, "a": "ação", "n": nil}}))
+		require.NoError(t, storage.WithTx(ctx, func(tx Storage) error {
+			return tx.LogAuditEvents(ctx, []models.AuditEvent{{Actor: "test-chain", Action: "B"}, {Actor: "test-chain", Action: "C"}})
+		}))
+		require.Error(t, storage.WithTx(ctx, func(tx Storage) error {
+			require.NoError(t, tx.LogAuditEvent(ctx, models.AuditEvent{Actor: "test-chain", Action: "DESCARTADO"}))
+			return errors.New("falha depois da auditoria")
+		}))
+
+		seq, head, err := storage.AuditChainHead(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, startSeq+3, seq, "a transação desfeita não consome posições")
+
+		var entries []models.AuditEntry
+		require.NoError(t, storage.StreamAuditChain(ctx, startSeq+1, seq, func(e models.AuditEntry) error {
+			entries = append(entries, e)
+			return nil
+		}))
+		require.Len(t, entries, 3)
+		prev := startHash
+		for i, entry := range entries {
+			assert.Equal(t, startSeq+int64(i)+1, entry.Seq)
+			assert.Equal(t, prev, entry.PrevHash)
+			hash, err := auditchain.Hash(prev, entry)
+			require.NoError(t, err)
+			assert.Equal(t, hash, entry.Hash, "o hash recalculado do que foi lido do banco confere com o gravado")
+			assert.Equal(t, auditchain.MAC(key, hash), entry.HMAC)
+			prev = entry.Hash
+		}
+		assert.Equal(t, []string{"A", "B", "C"}, []string{entries[0].Action, entries[1].Action, entries[2].Action})
+		assert.Equal(t, head, prev)
+	})
+}
+
+func TestStorage_SearchAuditLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		_, err := db.Exec("DELETE FROM audit_log WHERE actor LIKE 'test-search%'")
+		require.NoError(t, err)
+		require.NoError(t, storage.LogAuditEvents(ctx, []models.AuditEvent{
+			{Actor: "test-search", Action: "PHOTO_VIEWED", Details: map[string]interface{}{"photo_id": 1, "device_id": "dev-1"}},
+			{Actor: "test-search", Action: "PHOTO_VIEWED", Details: map[string]interface{}{"photo_id": 2, "device_id": "dev-2"}},
+			{Actor: "test-search", Action: "EXPORT_REQUESTED", Details: map[string]interface{}{"job_id": 7, "device_id": "dev-1"}},
+			{Actor: "test-search-2", Action: "PHOTO_VIEWED", Details: map[string]interface{}{"photo_id": 1, "device_id": "dev-1", "match": true}},
+		}))
+
+		search := func(filter models.AuditFilter) []models.AuditEntry {
+			filter.From, filter.To = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+			var entries []models.AuditEntry
+			require.NoError(t, storage.StreamAuditLog(ctx, filter, func(e models.AuditEntry) error {
+				if strings.HasPrefix(e.Actor, "test-search") {
+					entries = append(entries, e)
+				}
+				return nil
+			}))
+			return entries
+		}
+		actions := func(entries []models.AuditEntry) []string {
+			result := []string{}
+			for _, e := range entries {
+				result = append(result, e.Actor+"/"+e.Action)
+			}
+			return result
+		}
+
+		assert.Equal(t, []string{"test-search/EXPORT_REQUESTED", "test-search/PHOTO_VIEWED", "test-search/PHOTO_VIEWED"},
+			actions(search(models.AuditFilter{Actor: "test-search"})), "das mais novas para as mais antigas")
+		assert.Equal(t, []string{"test-search-2/PHOTO_VIEWED", "test-search/PHOTO_VIEWED"},
+			actions(search(models.AuditFilter{Action: "PHOTO_VIEWED", Details: map[string]json.RawMessage{"photo_id": json.RawMessage("1")}})))
+		assert.Equal(t, []string{"test-search/EXPORT_REQUESTED", "test-search/PHOTO_VIEWED"},
+			actions(search(models.AuditFilter{Actor: "test-search", Details: map[string]json.RawMessage{"device_id": json.RawMessage(`"dev-1"`)}})))
+		assert.Equal(t, []string{"test-search-2/PHOTO_VIEWED"},
+			actions(search(models.AuditFilter{Details: map[string]json.RawMessage{"match": json.RawMessage("true"), "device_id": json.RawMessage(`"dev-1"`)}})))
+		assert.Empty(t, search(models.AuditFilter{Details: map[string]json.RawMessage{"photo_id": json.RawMessage(`"1"`)}}), "string não casa com número")
+
+		first := search(models.AuditFilter{Actor: "test-search", Limit: 2})
+		require.Len(t, first, 2)
+		assert.Equal(t, `{"device_id":"dev-1","job_id":7}`, string(mustCanonical(t, first[0].Details)))
+		next := search(models.AuditFilter{Actor: "test-search", Limit: 2, BeforeID: first[1].ID})
+		require.Len(t, next, 1)
+		assert.Less(t, next[0].ID, first[1].ID)
+	})
+}
+
+func mustCanonical(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	canonical, err := auditchain.CanonicalDetails(raw)
+	require.NoError(t, err)
+	return canonical
+}
+
+func TestStorage_EncryptedLocations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		for _, table := range []string{"gps", "overspeed_event"} {
+			_, err := db.Exec("DELETE FROM " + table + " WHERE device_id IN ('test-dev-geo', 'test-dev-geo-2')")
+			require.NoError(t, err)
+		}
+		base := time.Date(2001, 5, 6, 10, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: "test-dev-geo", Latitude: float64Ptr(-23.5505),
+			Longitude: float64Ptr(-46.6333), Timestamp: base}), "leitura gravada antes de ligar a cifragem")
+
+		keys, err := crypto.NewKeyring(map[uint32][]byte{1: []byte("este-e-um-segredo-de-32-bytes!!*")})
+		require.NoError(t, err)
+		storage.(interface {
+			SetLocationCipher(*crypto.LocationCipher)
+		}).SetLocationCipher(crypto.NewLocationCipher(keys))
+
+		require.NoError(t, storage.SaveGPSBatch(ctx, []*models.GPSData{
+			{DeviceID: "test-dev-geo", Latitude: float64Ptr(-23.5510), Longitude: float64Ptr(-46.6340), Timestamp: base.Add(time.Minute)},
+			{DeviceID: "test-dev-geo-2", Latitude: float64Ptr(-22.9068), Longitude: float64Ptr(-43.1729), Timestamp: base.Add(time.Minute)},
+		}))
+		require.NoError(t, storage.WithTx(ctx, func(tx Storage) error {
+			return tx.SaveOverspeedEvent(ctx, &models.OverspeedEvent{DeviceID: "test-dev-geo", Speed: 120, Limit: 80,
+				Latitude: -23.5510, Longitude: -46.6340, Timestamp: base.Add(time.Minute)})
+		}))
+
+		var lat sql.NullFloat64
+		var location []byte
+		var hash string
+		require.NoError(t, db.QueryRow("SELECT latitude, location, geohash FROM gps WHERE device_id = 'test-dev-geo-2'").Scan(&lat, &location, &hash))
+		assert.False(t, lat.Valid, "com a cifragem ligada a coordenada não fica em claro")
+		assert.NotEmpty(t, location)
+		assert.Equal(t, geo.Geohash(-22.9068, -43.1729, geo.CoarseGeohashPrecision), hash)
+		require.NoError(t, db.QueryRow("SELECT latitude, location FROM overspeed_event WHERE device_id = 'test-dev-geo'").Scan(&lat, &location))
+		assert.False(t, lat.Valid)
+		assert.NotEmpty(t, location)
+
+		var streamed []models.GPSData
+		require.NoError(t, storage.StreamGPS(ctx, "", base, base.Add(time.Hour), func(d models.GPSData) error {
+			if d.DeviceID == "test-dev-geo" || d.DeviceID == "test-dev-geo-2" {
+				streamed = append(streamed, d)
+			}
+			return nil
+		}))
+		require.Len(t, streamed, 3)
+		assert.InDelta(t, -23.5505, *streamed[0].Latitude, 0.0001, "as leituras em claro continuam legíveis")
+		for _, d := range streamed[1:] {
+			if d.DeviceID == "test-dev-geo-2" {
+				assert.InDelta(t, -43.1729, *d.Longitude, 0.0001)
+			}
+		}
+
+		areas, err := storage.QueryGPSAreas(ctx, "test-dev-geo", base, base.Add(time.Hour), 5)
+		require.NoError(t, err)
+		require.Len(t, areas, 1)
+		assert.Equal(t, "6gyf4", areas[0].Geohash)
+		assert.Equal(t, int64(2), areas[0].Points)
+		assert.True(t, areas[0].LastSeen.Equal(base.Add(time.Minute)))
+
+		// A posição de um dispositivo copiada para a linha de outro não abre.
+		_, err = db.Exec(`UPDATE gps SET location = (SELECT location FROM gps WHERE device_id = 'test-dev-geo-2')
+			WHERE device_id = 'test-dev-geo' AND location IS NOT NULL`)
+		require.NoError(t, err)
+		err = storage.StreamGPS(ctx, "test-dev-geo", base, base.Add(time.Hour), func(models.GPSData) error { return nil })
+		assert.Error(t, err)
+	})
+}
+
+func TestStorage_RollupsMatchRawData(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		device := "test-dev-rollup"
+		for _, table := range []string{"gps", "gyroscope", "telemetry_rollup_minute", "telemetry_rollup_hour"} {
+			_, err := db.Exec("DELETE FROM "+table+" WHERE device_id = $1", device)
+			require.NoError(t, err)
+		}
+
+		base := time.Date(2001, 3, 4, 10, 0, 0, 0, time.UTC)
+		gps := []*models.GPSData{
+			{DeviceID: device, Latitude: float64Ptr(-10.000), Longitude: float64Ptr(-35), Timestamp: base},
+			{DeviceID: device, Latitude: float64Ptr(-10.001), Longitude: float64Ptr(-35), Timestamp: base.Add(30 * time.Second)},
+			{DeviceID: device, Latitude: float64Ptr(-10.002), Longitude: float64Ptr(-35), Timestamp: base.Add(70 * time.Second)},
+		}
+		gyro := []*models.GyroscopeData{
+			{DeviceID: device, X: float64Ptr(3), Y: float64Ptr(4), Z: float64Ptr(0), Timestamp: base.Add(10 * time.Second)},
+			{DeviceID: device, X: float64Ptr(0), Y: float64Ptr(0), Z: float64Ptr(1), Timestamp: base.Add(20 * time.Second)},
+		}
+		require.NoError(t, storage.SaveGPSBatch(context.Background(), gps))
+		require.NoError(t, storage.SaveGyroscopeBatch(context.Background(), gyro))
+		require.NoError(t, storage.RefreshRollups(context.Background(), base, base.Add(time.Hour)))
+
+		step := geo.Haversine(-10.000, -35, -10.001, -35)
+
+		for _, resolution := range []string{models.ResolutionRaw, models.ResolutionMinute} {
+			buckets, err := storage.QueryRollups(context.Background(), device, base, base.Add(time.Hour), resolution)
+			require.NoError(t, err)
+			require.Len(t, buckets, 2, resolution)
+
+			assert.True(t, buckets[0].Bucket.Equal(base), resolution)
+			assert.Equal(t, int64(2), buckets[0].GPSPoints, resolution)
+			assert.InDelta(t, step, buckets[0].DistanceMeters, 1, resolution)
+			assert.Equal(t, int64(2), buckets[0].GyroPoints, resolution)
+			require.NotNil(t, buckets[0].GyroAvg, resolution)
+			assert.InDelta(t, 3, *buckets[0].GyroAvg, 0.001, resolution)
+			assert.InDelta(t, 5, *buckets[0].GyroMax, 0.001, resolution)
+
+			assert.True(t, buckets[1].Bucket.Equal(base.Add(time.Minute)), resolution)
+			assert.Equal(t, int64(1), buckets[1].GPSPoints, resolution)
+			assert.InDelta(t, step, buckets[1].DistanceMeters, 1, resolution)
+			assert.Zero(t, buckets[1].GyroPoints, resolution)
+		}
+
+		hours, err := storage.QueryRollups(context.Background(), device, base.Add(30*time.Minute), base.Add(time.Hour), models.ResolutionHour)
+		require.NoError(t, err)
+		require.Len(t, hours, 1, "o início é truncado para a hora")
+		assert.Equal(t, int64(3), hours[0].GPSPoints)
+		assert.InDelta(t, 2*step, hours[0].DistanceMeters, 2)
+		assert.Equal(t, int64(2), hours[0].GyroPoints)
+
+		require.NoError(t, storage.SetRollupWatermark(context.Background(), base.Add(time.Hour)))
+		require.NoError(t, storage.SetRollupWatermark(context.Background(), base), "o watermark nunca volta")
+		watermark, err := storage.RollupWatermark(context.Background())
+		require.NoError(t, err)
+		assert.False(t, watermark.Before(base.Add(time.Hour)))
+	})
+}
+
+func TestStorage_RollupsWithEncryptedLocations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		device := "test-dev-rollup-enc"
+		for _, table := range []string{"gps", "gyroscope", "telemetry_rollup_minute", "telemetry_rollup_hour"} {
+			_, err := db.Exec("DELETE FROM "+table+" WHERE device_id = $1", device)
+			require.NoError(t, err)
+		}
+
+		base := time.Date(2001, 3, 5, 10, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: device, Latitude: float64Ptr(-10.000),
+			Longitude: float64Ptr(-35), Timestamp: base}), "leitura gravada antes de ligar a cifragem")
+
+		keys, err := crypto.NewKeyring(map[uint32][]byte{1: []byte("este-e-um-segredo-de-32-bytes!!*")})
+		require.NoError(t, err)
+		storage.(interface {
+			SetLocationCipher(*crypto.LocationCipher)
+		}).SetLocationCipher(crypto.NewLocationCipher(keys))
+
+		require.NoError(t, storage.SaveGPSBatch(ctx, []*models.GPSData{
+			{DeviceID: device, Latitude: float64Ptr(-10.001), Longitude: float64Ptr(-35.001), Timestamp: base.Add(30 * time.Second)},
+			{DeviceID: device, Latitude: float64Ptr(-10.002), Longitude: float64Ptr(-35), Timestamp: base.Add(70 * time.Second),
+				Speed: float64Ptr(0)},
+		}))
+		require.NoError(t, storage.SaveGyroscopeBatch(ctx, []*models.GyroscopeData{
+			{DeviceID: device, X: float64Ptr(3), Y: float64Ptr(4), Z: float64Ptr(0), Timestamp: base.Add(2 * time.Minute)},
+		}))
+		require.NoError(t, storage.RefreshRollups(ctx, base, base.Add(time.Hour)))
+
+		step := geo.Haversine(-10.000, -35, -10.001, -35.001)
+		for _, resolution := range []string{models.ResolutionRaw, models.ResolutionMinute} {
+			buckets, err := storage.QueryRollups(ctx, device, base, base.Add(time.Hour), resolution)
+			require.NoError(t, err)
+			require.Len(t, buckets, 3, resolution)
+
+			assert.Equal(t, int64(2), buckets[0].GPSPoints, resolution)
+			assert.InDelta(t, step, buckets[0].DistanceMeters, 1, "a distância usa as posições decifradas: %s", resolution)
+			assert.Equal(t, int64(1), buckets[1].GPSPoints, resolution)
+			assert.Zero(t, buckets[1].DistanceMeters, "leitura parada não soma distância: %s", resolution)
+			for _, b := range buckets {
+				assert.Nil(t, b.MinLatitude, "a bounding box revelaria a posição: %s", resolution)
+				assert.Nil(t, b.MaxLatitude, resolution)
+				assert.Nil(t, b.MinLongitude, resolution)
+				assert.Nil(t, b.MaxLongitude, resolution)
+			}
+
+			assert.True(t, buckets[2].Bucket.Equal(base.Add(2*time.Minute)), resolution)
+			assert.Zero(t, buckets[2].GPSPoints, resolution)
+			assert.Equal(t, int64(1), buckets[2].GyroPoints, resolution)
+			require.NotNil(t, buckets[2].GyroAvg, resolution)
+			assert.InDelta(t, 5, *buckets[2].GyroAvg, 0.001, resolution)
+		}
+
+		hours, err := storage.QueryRollups(ctx, device, base, base.Add(time.Hour), models.ResolutionHour)
+		require.NoError(t, err)
+		require.Len(t, hours, 1)
+		assert.Equal(t, int64(3), hours[0].GPSPoints)
+		assert.InDelta(t, step, hours[0].DistanceMeters, 1)
+		assert.Nil(t, hours[0].MinLatitude)
+
+		for _, table := range []string{"telemetry_rollup_minute", "telemetry_rollup_hour"} {
+			var exposed int
+			require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table+` WHERE device_id = $1 AND
+				(min_lat IS NOT NULL OR max_lat IS NOT NULL OR min_lon IS NOT NULL OR max_lon IS NOT NULL)`, device).Scan(&exposed))
+			assert.Zero(t, exposed, "nenhuma coordenada em claro em %s", table)
+		}
+	})
+}
+
+func TestStorage_ExportJobQueue(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		_, err := db.Exec("DELETE FROM export_job")
+		require.NoError(t, err)
+
+		from := time.Date(2001, 3, 4, 0, 0, 0, 0, time.UTC)
+		newJob := func() *models.ExportJob {
+			return &models.ExportJob{
+				ExportRequest: models.ExportRequest{Dataset: "gps", Format: "csv", From: from, To: from.AddDate(0, 0, 1)},
+				RequestedBy:   "scheduler",
+			}
+		}
+		job := newJob()
+		require.NoError(t, storage.CreateExportJob(context.Background(), job))
+		assert.NotZero(t, job.ID)
+		assert.ErrorIs(t, storage.CreateExportJob(context.Background(), newJob()), ErrDuplicate)
+
+		claimed, err := storage.ClaimExportJob(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		assert.Equal(t, job.ID, claimed.ID)
+		assert.Equal(t, models.ExportStatusRunning, claimed.Status)
+		assert.NotNil(t, claimed.StartedAt)
+		assert.True(t, claimed.From.Equal(from))
+
+		again, err := storage.ClaimExportJob(context.Background())
+		require.NoError(t, err)
+		assert.Nil(t, again, "um job em execução não pode ser reivindicado de novo")
+
+		reclaimed, err := storage.ReclaimExportJobs(context.Background(), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, reclaimed, "um job iniciado dentro do prazo continua com quem o reivindicou")
+		reclaimed, err = storage.ReclaimExportJobs(context.Background(), time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), reclaimed)
+		claimed, err = storage.ClaimExportJob(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, claimed, "o job abandonado volta para a fila")
+		assert.Equal(t, job.ID, claimed.ID)
+
+		claimed.Status, claimed.Rows = models.ExportStatusCompleted, 7
+		require.NoError(t, storage.FinishExportJob(context.Background(), claimed))
+		stored, err := storage.GetExportJob(context.Background(), job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ExportStatusCompleted, stored.Status)
+		assert.Equal(t, int64(7), stored.Rows)
+		assert.NotNil(t, stored.FinishedAt)
+
+		_, err = storage.GetExportJob(context.Background(), job.ID+1000)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStorage_DataSubjectErasure(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		erased, anonymized, pseudonym := "test-dev-lgpd-erase", "test-dev-lgpd-anon", "anon-test-lgpd"
+		for _, table := range deviceDataTables {
+			_, err := db.Exec("DELETE FROM "+table+" WHERE device_id IN ($1, $2, $3)", erased, anonymized, pseudonym)
+			require.NoError(t, err)
+		}
+
+		base := time.Date(2001, 3, 4, 10, 0, 0, 0, time.UTC)
+		for _, device := range []string{erased, anonymized} {
+			require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: device, Latitude: float64Ptr(-10.5), Longitude: float64Ptr(-35.5), Timestamp: base}))
+			require.NoError(t, storage.SaveGyroscope(ctx, &models.GyroscopeData{DeviceID: device, X: float64Ptr(1), Y: float64Ptr(2), Z: float64Ptr(3), Timestamp: base}))
+			require.NoError(t, storage.SaveOverspeedEvent(ctx, &models.OverspeedEvent{DeviceID: device, Speed: 90, Limit: 60, Latitude: -10.5, Longitude: -35.5, Timestamp: base}))
+			photo, err := storage.SavePhoto(ctx, &models.PhotoData{DeviceID: device, Timestamp: base})
+			require.NoError(t, err)
+			require.NoError(t, storage.SetPhotoContent(ctx, photo.ID, models.PhotoContent{Key: "photos/" + device, Size: 1, SHA256: "abc", Encryption: models.PhotoEncryptionNone}))
+		}
+		require.NoError(t, storage.RefreshRollups(ctx, base, base.Add(time.Hour)))
+
+		photos, err := storage.ListDevicePhotos(ctx, erased, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, photos, 1)
+		assert.Equal(t, "photos/"+erased, photos[0].Key)
+
+		all := map[string]int64{"gps": 1, "gyroscope": 1, "photo": 1, "overspeed_event": 1, "telemetry_rollup_minute": 1, "telemetry_rollup_hour": 1}
+		counts, err := storage.EraseDeviceData(ctx, erased)
+		require.NoError(t, err)
+		assert.Equal(t, all, counts)
+
+		counts, err = storage.AnonymizeDeviceData(ctx, anonymized, pseudonym)
+		require.NoError(t, err)
+		assert.Equal(t, all, counts)
+		_, err = storage.AnonymizeDeviceData(ctx, anonymized, anonymized)
+		assert.Error(t, err, "o pseudônimo não pode ser o próprio dispositivo")
+
+		for _, table := range deviceDataTables {
+			var remaining int
+			require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE device_id IN ($1, $2)", erased, anonymized).Scan(&remaining))
+			assert.Zero(t, remaining, table)
+		}
+		var latitude sql.NullFloat64
+		var geohash string
+		require.NoError(t, db.QueryRow("SELECT latitude, geohash FROM gps WHERE device_id = $1", pseudonym).Scan(&latitude, &geohash))
+		assert.False(t, latitude.Valid, "a posição exata é descartada")
+		assert.Len(t, geohash, AnonymizedGeohashPrecision)
+		var pseudonymPhotos, pseudonymGyro int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM photo WHERE device_id = $1", pseudonym).Scan(&pseudonymPhotos))
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gyroscope WHERE device_id = $1", pseudonym).Scan(&pseudonymGyro))
+		assert.Zero(t, pseudonymPhotos, "fotos não têm versão anônima")
+		assert.Equal(t, 1, pseudonymGyro)
+	})
+}
+
+func TestStorage_StreamGPSSkipsAnonymizedRows(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		device, pseudonym := "test-dev-lgpd-stream", "anon-test-lgpd-stream"
+		for _, table := range deviceDataTables {
+			_, err := db.Exec("DELETE FROM "+table+" WHERE device_id IN ($1, $2)", device, pseudonym)
+			require.NoError(t, err)
+		}
+
+		base := time.Date(2001, 3, 5, 10, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: device, Latitude: float64Ptr(-10.5), Longitude: float64Ptr(-35.5), Timestamp: base}))
+		require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: device, Latitude: float64Ptr(-10.6), Longitude: float64Ptr(-35.6), Timestamp: base.Add(time.Minute)}))
+		_, err := storage.AnonymizeDeviceData(ctx, device, pseudonym)
+		require.NoError(t, err)
+
+		var stored int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gps WHERE device_id = $1", pseudonym).Scan(&stored))
+		require.Equal(t, 2, stored, "as linhas anonimizadas continuam no banco")
+
+		var streamed []models.GPSData
+		err = storage.StreamGPS(ctx, pseudonym, base, base.Add(time.Hour), func(d models.GPSData) error {
+			streamed = append(streamed, d)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Empty(t, streamed, "linhas sem posição não viram leituras em 0,0")
+	})
+}
+
+func TestStorage_DataSubjectRequestQueue(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		_, err := db.Exec("DELETE FROM data_subject_request")
+		require.NoError(t, err)
+
+		req := &models.DataSubjectRequest{
+			DataSubjectRequestInput: models.DataSubjectRequestInput{
+				SubjectType: models.SubjectTypeDevice, SubjectID: "dev-1", Action: models.SubjectActionErase, Reason: "protocolo 1",
+			},
+			RequestedBy: "bia",
+		}
+		require.NoError(t, storage.CreateDataSubjectRequest(ctx, req))
+		assert.NotZero(t, req.ID)
+		assert.Equal(t, models.ExportStatusPending, req.Status)
+
+		claimed, err := storage.ClaimDataSubjectRequest(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, claimed)
+		assert.Equal(t, req.DataSubjectRequestInput, claimed.DataSubjectRequestInput)
+		assert.Equal(t, models.ExportStatusRunning, claimed.Status)
+		assert.NotNil(t, claimed.StartedAt)
+		again, err := storage.ClaimDataSubjectRequest(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, again)
+
+		claimed.Status, claimed.Location, claimed.Record = models.ExportStatusCompleted, "file:///lgpd/request-1-record.json", json.RawMessage(`{"request_id":1}`)
+		require.NoError(t, storage.FinishDataSubjectRequest(ctx, claimed))
+		stored, err := storage.GetDataSubjectRequest(ctx, req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ExportStatusCompleted, stored.Status)
+		assert.JSONEq(t, `{"request_id":1}`, string(stored.Record))
+		assert.NotNil(t, stored.FinishedAt)
+
+		_, err = storage.GetDataSubjectRequest(ctx, req.ID+1000)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStorage_PurgeBefore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		_, err := db.Exec("DELETE FROM gyroscope WHERE device_id = 'test-dev-purge'")
+		require.NoError(t, err)
+
+		cutoff := time.Date(2001, 3, 4, 0, 0, 0, 0, time.UTC)
+		var batch []*models.GyroscopeData
+		for _, ts := range []time.Time{cutoff.Add(-time.Hour), cutoff.Add(-time.Minute), cutoff.Add(-time.Nanosecond * 1000), cutoff} {
+			batch = append(batch, &models.GyroscopeData{DeviceID: "test-dev-purge", X: float64Ptr(1), Y: float64Ptr(1), Z: float64Ptr(1), Timestamp: ts})
+		}
+		require.NoError(t, storage.SaveGyroscopeBatch(context.Background(), batch))
+
+		deleted, err := storage.PurgeBefore(context.Background(), "gyroscope", cutoff, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+		deleted, err = storage.PurgeBefore(context.Background(), "gyroscope", cutoff, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+
+		var remaining int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gyroscope WHERE device_id = 'test-dev-purge'").Scan(&remaining))
+		assert.Equal(t, 1, remaining, "a leitura exatamente no corte fica")
+	})
+}
+
+func TestPostgresStorage_GPSPartitions(t *testing.T) {
 	storage, db := setupTestDB(t)
 	defer db.Close()
 
-	_, err := db.Exec("TRUNCATE TABLE gps RESTART IDENTITY")
+	old := time.Date(2000, 1, 15, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.EnsurePartitions(context.Background(), "gps", old, 0))
+	_, err := db.Exec("DELETE FROM gps WHERE device_id = 'test-dev-partition'")
 	require.NoError(t, err)
 
-	testData := models.GPSData{
-		DeviceID:  "test-dev-gps",
-		Latitude:  float64Ptr(-10.5),
-		Longitude: float64Ptr(-35.5),
-		Timestamp: time.Now().UTC().Truncate(time.Second),
-	}
+	err = storage.SaveGPS(context.Background(), &models.GPSData{DeviceID: "test-dev-partition", Latitude: float64Ptr(1), Longitude: float64Ptr(2), Timestamp: old})
+	require.NoError(t, err)
 
-	err = storage.SaveGPS(&testData)
+	var partition string
+	err = db.QueryRow("SELECT tableoid::regclass::text FROM gps WHERE device_id = 'test-dev-partition'").Scan(&partition)
 	require.NoError(t, err)
+	assert.Equal(t, "gps_p200001", partition)
 
-	var result models.GPSData
-	var lat, lon float64
-	err = db.QueryRow("SELECT device_id, latitude, longitude, timestamp FROM gps WHERE device_id = $1", "test-dev-gps").Scan(
-		&result.DeviceID, &lat, &lon, &result.Timestamp,
-	)
+	removed, err := storage.DropPartitionsBefore(context.Background(), "gps", time.Date(2000, 2, 1, 0, 0, 0, 0, time.UTC), false)
 	require.NoError(t, err)
-	result.Latitude = &lat
-	result.Longitude = &lon
+	assert.Contains(t, removed, "gps_p200001")
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gps WHERE device_id = 'test-dev-partition'").Scan(&count))
+	assert.Zero(t, count)
+}
+
+func TestPostgresStorage_PartitionAdoptsDefaultRows(t *testing.T) {
+	storage, db := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Nenhuma partição cobre 2099: a leitura de um relógio adiantado cai na partição padrão.
+	future := time.Date(2099, 5, 10, 0, 0, 0, 0, time.UTC)
+	_, err := db.Exec("DROP TABLE IF EXISTS gps_p209905")
+	require.NoError(t, err)
+	require.NoError(t, storage.EnsurePartitions(ctx, "gps", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), 0))
+	require.NoError(t, storage.SaveGPS(ctx, &models.GPSData{DeviceID: "test-dev-skew", Latitude: float64Ptr(1), Longitude: float64Ptr(2), Timestamp: future}))
+	defer db.Exec("DROP TABLE IF EXISTS gps_p209905")
+
+	require.NoError(t, storage.EnsurePartitions(ctx, "gps", future, 0))
+	require.NoError(t, storage.EnsurePartitions(ctx, "gps", future, 0), "criar de novo não faz nada")
+
+	var partition string
+	require.NoError(t, db.QueryRow("SELECT tableoid::regclass::text FROM gps WHERE device_id = 'test-dev-skew'").Scan(&partition))
+	assert.Equal(t, "gps_p209905", partition)
+}
+
+func TestStorage_WithTxRollsBackDataAndAudit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		_, err := db.Exec("DELETE FROM gps WHERE device_id = 'test-dev-tx'")
+		require.NoError(t, err)
+		_, err = db.Exec("DELETE FROM audit_log WHERE actor = 'test-dev-tx'")
+		require.NoError(t, err)
+
+		err = storage.WithTx(context.Background(), func(tx Storage) error {
+			if err := tx.SaveGPS(context.Background(), &models.GPSData{DeviceID: "test-dev-tx", Latitude: float64Ptr(1), Longitude: float64Ptr(1), Timestamp: time.Now().UTC()}); err != nil {
+				return err
+			}
+			if err := tx.LogAuditEvent(context.Background(), models.AuditEvent{Actor: "test-dev-tx", Action: "GPS_DATA_PROCESSED"}); err != nil {
+				return err
+			}
+			return fmt.Errorf("falha simulada depois das gravações")
+		})
+		require.Error(t, err)
+
+		var gpsCount, auditCount int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gps WHERE device_id = 'test-dev-tx'").Scan(&gpsCount))
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE actor = 'test-dev-tx'").Scan(&auditCount))
+		assert.Zero(t, gpsCount)
+		assert.Zero(t, auditCount)
+	})
+}
+
+func TestStorage_PhotoContent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		_, err := db.Exec("DELETE FROM photo WHERE device_id = 'test-dev-photo'")
+		require.NoError(t, err)
+
+		// Linha no formato antigo, com a imagem na própria tabela.
+		_, err = db.Exec(`INSERT INTO photo(device_id, timestamp, photo, recognized)
+			VALUES('test-dev-photo', '2025-01-02 03:04:05.000000000', 'aW1hZ2Vt', false)`)
+		require.NoError(t, err)
+		legacy, err := storage.ListLegacyPhotos(ctx, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, legacy, 1)
+		assert.Equal(t, "aW1hZ2Vt", legacy[0].Photo)
+		assert.True(t, legacy[0].Timestamp.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+		stored, err := storage.GetPhoto(ctx, legacy[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "aW1hZ2Vt", stored.Legacy)
+		assert.Empty(t, stored.Key)
+
+		migrated := models.PhotoContent{Key: "photos/antiga", Size: 6, SHA256: "abc", Encryption: models.PhotoEncryptionNone}
+		require.NoError(t, storage.SetPhotoContent(ctx, legacy[0].ID, migrated))
+		stored, err = storage.GetPhoto(ctx, legacy[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, migrated, stored.PhotoContent)
+		assert.Empty(t, stored.Legacy)
+		_, err = storage.GetPhoto(ctx, legacy[0].ID+1000)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, storage.SetPhotoContent(ctx, legacy[0].ID+1000, migrated), ErrNotFound)
+		legacy, err = storage.ListLegacyPhotos(ctx, 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, legacy, "a linha migrada não tem mais imagem na coluna photo")
+
+		recent := time.Now().UTC()
+		saved, err := storage.SavePhoto(ctx, &models.PhotoData{DeviceID: "test-dev-photo", Timestamp: recent, Recognized: true})
+		require.NoError(t, err)
+		assert.NotZero(t, saved.ID)
+		assert.WithinDuration(t, recent, saved.Timestamp, time.Millisecond, "o timestamp volta como foi gravado")
+		require.NoError(t, storage.SetPhotoContent(ctx, saved.ID, models.PhotoContent{Key: "photos/nova", Size: 10, SHA256: "def",
+			Encryption: models.PhotoEncryptionDataKeyAAD, KeyVersion: 2, WrappedKey: []byte("chave-embrulhada")}))
+		stored, err = storage.GetPhoto(ctx, saved.ID)
+		require.NoError(t, err)
+		assert.Equal(t, saved.Timestamp, stored.Timestamp, "a linha lida tem o mesmo timestamp devolvido por SavePhoto")
+		var size int64
+		var encryption string
+		require.NoError(t, db.QueryRow("SELECT content_size, encryption FROM photo WHERE content_key = 'photos/nova'").Scan(&size, &encryption))
+		assert.Equal(t, int64(10), size)
+		assert.Equal(t, models.PhotoEncryptionDataKeyAAD, encryption)
+
+		pending, err := storage.ListPhotosBelowKeyVersion(ctx, 2, 0, 10)
+		require.NoError(t, err)
+		var ids []int64
+		for _, p := range pending {
+			if p.DeviceID == "test-dev-photo" {
+				ids = append(ids, p.ID)
+			}
+		}
+		require.Len(t, ids, 1, "só a linha migrada está sem chave de dados; a nova já usa a versão 2")
+		count, err := storage.CountPhotosBelowKeyVersion(ctx, 3)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, count, int64(2))
+
+		rotated := models.PhotoContent{Key: "photos/recifrada", Size: 7, SHA256: "ghi", Encryption: models.PhotoEncryptionDataKeyAAD, KeyVersion: 2,
+			WrappedKey: []byte("vault:v2:abc")}
+		assert.ErrorIs(t, storage.ReplacePhotoContent(ctx, ids[0], "photos/outra", rotated), ErrNotFound)
+		require.NoError(t, storage.ReplacePhotoContent(ctx, ids[0], "photos/antiga", rotated))
+		stored, err = storage.GetPhoto(ctx, ids[0])
+		require.NoError(t, err)
+		assert.Equal(t, rotated, stored.PhotoContent)
+
+		var keys []string
+		require.NoError(t, storage.StreamPhotoContentKeys(ctx, recent.Add(-time.Hour), func(key string) error {
+			keys = append(keys, key)
+			return nil
+		}))
+		assert.Contains(t, keys, "photos/recifrada")
+		assert.NotContains(t, keys, "photos/nova")
+	})
+}
+
+func TestStorage_DriverResolutionAndPhotoMatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, storage Storage, db *sql.DB) {
+		ctx := context.Background()
+		_, err := db.Exec("DELETE FROM driver_faces WHERE driver_id IN ('drv-ana', 'drv-bia')")
+		require.NoError(t, err)
+		_, err = db.Exec("DELETE FROM drivers WHERE id IN ('drv-ana', 'drv-bia')")
+		require.NoError(t, err)
+		_, err = db.Exec("DELETE FROM photo WHERE device_id = 'test-dev-driver'")
+		require.NoError(t, err)
+
+		ana := &models.Driver{ID: "drv-ana", Name: "Ana"}
+		require.NoError(t, storage.SaveDriver(ctx, ana))
+		require.NoError(t, storage.SaveDriver(ctx, &models.Driver{ID: "drv-bia", Name: "Bia"}))
+		require.NoError(t, storage.AddDriverFaces(ctx, "drv-ana", models.DriverFaceSourceAssociated, []string{"face-1", "face-2"}))
+		require.NoError(t, storage.AddDriverFaces(ctx, "drv-ana", models.DriverFaceSourceEnrolled, []string{"face-1"}), "associar de novo não é erro")
+		assert.ErrorIs(t, storage.AddDriverFaces(ctx, "drv-bia", models.DriverFaceSourceEnrolled, []string{"face-2"}), ErrFaceAssigned)
+
+		ana.Name = "Ana Souza"
+		require.NoError(t, storage.SaveDriver(ctx, ana))
+		got, err := storage.GetDriver(ctx, "drv-ana")
+		require.NoError(t, err)
+		assert.Equal(t, "Ana Souza", got.Name)
+		assert.ElementsMatch(t, []string{"face-1", "face-2"}, got.FaceIDs)
+		_, err = storage.GetDriver(ctx, "drv-ninguem")
+		assert.ErrorIs(t, err, ErrNotFound)
+		faces, err := storage.ListDriverFaces(ctx, "drv-ana")
+		require.NoError(t, err)
+		require.Len(t, faces, 2)
+		for _, face := range faces {
+			assert.Equal(t, models.DriverFaceSourceAssociated, face.Source, "associar de novo não muda a origem")
+		}
+		_, err = storage.ListDriverFaces(ctx, "drv-ninguem")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		driverID, err := storage.ResolveDriver(ctx, "face-2", "drv-bia")
+		require.NoError(t, err)
+		assert.Equal(t, "drv-ana", driverID, "a associação do FaceId prevalece sobre o ExternalImageId")
+		driverID, err = storage.ResolveDriver(ctx, "face-indexada", "drv-bia")
+		require.NoError(t, err)
+		assert.Equal(t, "drv-bia", driverID)
+		_, err = storage.ResolveDriver(ctx, "face-desconhecida", "")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, storage.AddDriverFaces(ctx, "drv-bia", models.DriverFaceSourceEnrolled, []string{"face-3"}))
+		assert.ErrorIs(t, storage.RemoveDriverFace(ctx, "drv-ana", "face-3"), ErrNotFound, "o rosto é de outro motorista")
+		require.NoError(t, storage.RemoveDriverFace(ctx, "drv-bia", "face-3"))
+		faces, err = storage.ListDriverFaces(ctx, "drv-bia")
+		require.NoError(t, err)
+		assert.Empty(t, faces)
+
+		at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		similarity := 99.5
+		matched, err := storage.SavePhoto(ctx, &models.PhotoData{DeviceID: "test-dev-driver", Timestamp: at, Recognized: true,
+			DriverID: "drv-ana", FaceID: "face-1", Similarity: &similarity})
+		require.NoError(t, err)
+		assert.Equal(t, "drv-ana", matched.DriverID)
+		_, err = storage.SavePhoto(ctx, &models.PhotoData{DeviceID: "test-dev-driver", Timestamp: at.Add(time.Minute)})
+		require.NoError(t, err)
+
+		stored, err := storage.GetPhoto(ctx, matched.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "face-1", stored.FaceID)
+		require.NotNil(t, stored.Similarity)
+		assert.InDelta(t, 99.5, *stored.Similarity, 0.001)
+
+		var photos []models.PhotoMetadata
+		require.NoError(t, storage.StreamPhotoMetadata(ctx, "test-dev-driver", at, at.Add(time.Hour), func(p models.PhotoMetadata) error {
+			photos = append(photos, p)
+			return nil
+		}))
+		require.Len(t, photos, 2)
+		assert.Equal(t, "drv-ana", photos[0].DriverID)
+		assert.Empty(t, photos[1].DriverID)
+		assert.Empty(t, photos[1].FaceID)
+		assert.Nil(t, photos[1].Similarity)
+
+		devices, err := storage.ListDriverDevices(ctx, "drv-ana")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test-dev-driver"}, devices)
+		devices, err = storage.ListDriverDevices(ctx, "drv-bia")
+		require.NoError(t, err)
+		assert.Empty(t, devices)
 
-	assert.Equal(t, testData.DeviceID, result.DeviceID)
-	assert.InDelta(t, *testData.Latitude, *result.Latitude, 0.001)
-	assert.InDelta(t, *testData.Longitude, *result.Longitude, 0.001)
-	assert.True(t, testData.Timestamp.Equal(result.Timestamp), "Os timestamps deveriam representar o mesmo momento")
+		counts, err := storage.EraseDriver(ctx, "drv-ana")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"driver_faces": 2, "drivers": 1}, counts)
+		_, err = storage.GetDriver(ctx, "drv-ana")
+		assert.ErrorIs(t, err, ErrNotFound)
+		driverID, err = storage.ResolveDriver(ctx, "face-2", "")
+		assert.ErrorIs(t, err, ErrNotFound, "os rostos do motorista apagado não o identificam mais")
+	})
 }
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// querier é o subconjunto comum de *sql.DB e *sql.Tx usado pelas consultas, para que os mesmos métodos
+// funcionem dentro e fora de uma transação.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// inTx executa fn na transação corrente, se houver, ou numa nova transação confirmada ao final.
+func (s *PostgresStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	tx, err := s.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithTx executa fn como uma unidade de trabalho: tudo o que for gravado pelo Storage recebido é
+// confirmado junto quando fn retorna nil, ou descartado se fn retornar erro. Chamadas aninhadas
+// participam da transação externa.
+func (s *PostgresStorage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresStorage{pool: s.pool, db: tx, tx: tx, locations: s.locations, auditKey: s.auditKey})
+	})
+}